@@ -1,31 +1,188 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"fly-wireguard-vpn-proxy/internal/bootstrap"
 	"fly-wireguard-vpn-proxy/internal/config"
+	"fly-wireguard-vpn-proxy/internal/dnspub"
+	"fly-wireguard-vpn-proxy/internal/endpointhost"
+	"fly-wireguard-vpn-proxy/internal/exitcode"
+	"fly-wireguard-vpn-proxy/internal/firewall"
+	"fly-wireguard-vpn-proxy/internal/logging"
 )
 
 func main() {
-	cfg := config.Load()
+	logging.Setup(os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
+	cfg := resolveEndpointHost(config.Load())
+
+	// `bootstrap-http console` is the recovery menu for `fly ssh console`.
+	if len(os.Args) > 1 && os.Args[1] == "console" {
+		bootstrap.NewServer(cfg).Console(os.Stdin, os.Stdout)
+		return
+	}
+
+	if err := checkStartup(cfg); err != nil {
+		exitcode.Exit(err)
+	}
+
+	applyFirewallExtras(cfg)
+
+	if cfg.NativeWireGuard {
+		if err := setupNativeWireGuard(cfg); err != nil {
+			exitcode.Exit(exitcode.Wrap(exitcode.WireGuardMissing, err))
+		}
+	}
 
 	// Wait for config file to be generated by the WireGuard container
-	waitForFile(cfg.PeerConfigPath(), 30*time.Second)
+	if waitForFile(cfg.PeerConfigPath(), 30*time.Second) {
+		go bootstrap.NewServer(cfg).NotifyWake()
+	}
+
+	if cfg.DNSPublishProvider != "" {
+		go publishEndpoint(cfg)
+	}
 
 	server := bootstrap.NewServer(cfg)
-	server.Listen()
+	exitcode.Exit(server.Listen())
 }
 
-func waitForFile(path string, timeout time.Duration) {
+// checkStartup catches the failures that would otherwise surface later as
+// confusing symptoms. An unwritable volume would mean the one-time link
+// can never be burned, so it is fatal rather than a warning.
+func checkStartup(cfg config.Config) error {
+	probe, err := os.CreateTemp(cfg.ConfigDir, ".write-check-*")
+	if err != nil {
+		return exitcode.Wrap(exitcode.StoreUnusable, fmt.Errorf("config dir %s is not writable: %w", cfg.ConfigDir, err))
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if err := cfg.CheckKeepalive(); err != nil {
+		return exitcode.Wrap(exitcode.ConfigInvalid, err)
+	}
+	return nil
+}
+
+// resolveEndpointHost asks the providers in ENDPOINT_HOST_PROVIDERS, in
+// order, for the host clients should dial. The default "env,fly" is the
+// historical behavior: BOOTSTRAP_ENDPOINT_HOST, else <app>.fly.dev. Off
+// Fly, add "public-ip", "ec2" or "gcp". A detected host is stored as
+// PublicHost so every consumer of ClientEndpointHost picks it up.
+func resolveEndpointHost(cfg config.Config) config.Config {
+	names := cfg.HostProviders
+	if len(names) == 0 {
+		names = []string{"env", "fly"}
+	}
+	var providers []endpointhost.Provider
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "env":
+			providers = append(providers, endpointhost.Static{Value: cfg.PublicHost})
+		case "fly":
+			providers = append(providers, endpointhost.Fly{App: cfg.EndpointHost})
+		case "public-ip":
+			providers = append(providers, endpointhost.NewPublicIP(cfg.PublicIPURL))
+		case "ec2":
+			providers = append(providers, endpointhost.EC2{})
+		case "gcp":
+			providers = append(providers, endpointhost.GCP{})
+		default:
+			slog.Warn("ignoring unknown ENDPOINT_HOST_PROVIDERS entry", "component", "endpoint", "provider", name)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	host, provider, err := endpointhost.Detect(ctx, providers)
+	switch {
+	case host == "":
+		if err != nil {
+			slog.Warn("endpoint host detection failed", "component", "endpoint", "error", err)
+		}
+	case provider == "fly":
+		// ClientEndpointHost and the "fly" rewriter derive this already.
+	default:
+		cfg.PublicHost = host
+		if provider != "env" {
+			slog.Info("endpoint host detected", "component", "endpoint", "host", host, "provider", provider)
+		}
+	}
+	return cfg
+}
+
+func waitForFile(path string, timeout time.Duration) bool {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
 		if _, err := os.Stat(path); err == nil {
-			return
+			return true
 		}
 		time.Sleep(time.Second)
 	}
-	log.Printf("warning: config file %s not found after %s", path, timeout)
-}
\ No newline at end of file
+	slog.Warn("config file not found", "component", "startup", "path", path, "waited", timeout.String())
+	return false
+}
+
+// applyFirewallExtras installs operator-declared nftables rules. Failures
+// are logged rather than fatal: the previous rules stay in place and the
+// VPN itself doesn't depend on them.
+func applyFirewallExtras(cfg config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	applied, err := firewall.ApplyExtras(ctx, cfg.FirewallExtras)
+	if err != nil {
+		slog.Warn("cannot install extra firewall rules", "component", "firewall", "error", err)
+		return
+	}
+	if applied {
+		slog.Info("installed extra firewall rules", "component", "firewall", "file", cfg.FirewallExtras, "table", firewall.ExtrasTable)
+	}
+}
+
+// publishEndpoint advertises the current endpoint as SRV/TXT records so
+// scripts can follow host/port changes without re-onboarding.
+func publishEndpoint(cfg config.Config) {
+	host := cfg.ClientEndpointHost()
+	if host == "" || cfg.DNSPublishName == "" {
+		slog.Warn("DNS_PUBLISH_PROVIDER set but endpoint host or DNS_PUBLISH_NAME is unknown; not publishing", "component", "dnspub")
+		return
+	}
+
+	var p dnspub.Provider
+	switch cfg.DNSPublishProvider {
+	case "cloudflare":
+		p = dnspub.NewCloudflare(cfg.CloudflareToken, cfg.CloudflareZoneID)
+	case "route53":
+		p = dnspub.NewRoute53(cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, cfg.AWSSessionToken, cfg.Route53ZoneID)
+	default:
+		slog.Warn("unknown DNS_PUBLISH_PROVIDER", "component", "dnspub", "provider", cfg.DNSPublishProvider)
+		return
+	}
+
+	ttl, err := strconv.Atoi(cfg.DNSPublishTTL)
+	if err != nil || ttl <= 0 {
+		ttl = 300
+	}
+	recs, err := dnspub.Records(cfg.DNSPublishName, host, cfg.EndpointPort, ttl)
+	if err != nil {
+		slog.Warn("cannot build endpoint records", "component", "dnspub", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := dnspub.Publish(ctx, p, recs); err != nil {
+		slog.Warn("endpoint DNS publication failed", "component", "dnspub", "error", err)
+		return
+	}
+	slog.Info("published endpoint", "component", "dnspub",
+		"endpoint", net.JoinHostPort(host, cfg.EndpointPort), "name", cfg.DNSPublishName, "provider", cfg.DNSPublishProvider)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// setupNativeWireGuard does the linuxserver sidecar's job for WG_NATIVE:
+// it generates the server and main peer keys on first start, writes the
+// configs in the sidecar's layout under /config (so everything else reads
+// them unchanged) and brings the interface up. Existing keys are reused,
+// so restarts don't invalidate clients.
+func setupNativeWireGuard(cfg config.Config) error {
+	subnet := cfg.TunnelSubnet
+	if !strings.Contains(subnet, "/") {
+		subnet += "/24"
+	}
+	pfx, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return fmt.Errorf("INTERNAL_SUBNET: %w", err)
+	}
+	pfx = pfx.Masked()
+	serverAddr := pfx.Addr().Next()
+
+	serverPriv, serverPub, err := loadOrCreateKeys(filepath.Join(cfg.ConfigDir, "server"), "server")
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(cfg.PeerConfigPath()); errors.Is(err, fs.ErrNotExist) {
+		if err := createNativePeer(cfg, serverPub, netip.PrefixFrom(serverAddr.Next(), 32)); err != nil {
+			return err
+		}
+		slog.Info("generated keys and config", "component", "wg", "peer", cfg.PeerName)
+	}
+
+	sc := wg.ServerConfig{
+		PrivateKey: serverPriv,
+		Address:    netip.PrefixFrom(serverAddr, pfx.Bits()),
+		ListenPort: cfg.ListenPort,
+		MTU:        cfg.MTU,
+		Peers:      nativePeers(cfg.ConfigDir),
+	}
+
+	dir := filepath.Join(cfg.ConfigDir, "wg_confs")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, cfg.WGInterface+".conf"), []byte(sc.Render()), 0o600); err != nil {
+		return err
+	}
+	if err := wg.Up(cfg.WGInterface, sc); err != nil {
+		return err
+	}
+	slog.Info("interface up", "component", "wg", "iface", cfg.WGInterface, "port", cfg.ListenPort, "peer_count", len(sc.Peers))
+	return nil
+}
+
+// loadOrCreateKeys reads privatekey-<name> from dir, generating it (and
+// publickey-<name>) when missing.
+func loadOrCreateKeys(dir, name string) (priv, pub string, err error) {
+	privPath := filepath.Join(dir, "privatekey-"+name)
+	if b, err := os.ReadFile(privPath); err == nil {
+		priv = strings.TrimSpace(string(b))
+		pub, err := wg.PublicKey(priv)
+		return priv, pub, err
+	}
+	priv, pub, err = wg.GenerateKeyPair()
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(privPath, []byte(priv+"\n"), 0o600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "publickey-"+name), []byte(pub+"\n"), 0o600); err != nil {
+		return "", "", err
+	}
+	return priv, pub, nil
+}
+
+func createNativePeer(cfg config.Config, serverPub string, addr netip.Prefix) error {
+	host := cfg.ClientEndpointHost()
+	if host == "" {
+		return errors.New("WG_NATIVE needs an endpoint host: set BOOTSTRAP_ENDPOINT_HOST or run on Fly")
+	}
+	dir := filepath.Join(cfg.ConfigDir, cfg.PeerName)
+	priv, _, err := loadOrCreateKeys(dir, cfg.PeerName)
+	if err != nil {
+		return err
+	}
+	psk, err := wg.GeneratePresharedKey()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "presharedkey-"+cfg.PeerName), []byte(psk+"\n"), 0o600); err != nil {
+		return err
+	}
+	pc := wg.PeerConfig{
+		PrivateKey:      priv,
+		Address:         addr,
+		DNS:             cfg.PeerDNS,
+		MTU:             cfg.MTU,
+		ServerPublicKey: serverPub,
+		PresharedKey:    psk,
+		Endpoint:        net.JoinHostPort(host, cfg.EndpointPort),
+		AllowedIPs:      cfg.PeerAllowedIPs,
+	}
+	return os.WriteFile(cfg.PeerConfigPath(), []byte(pc.Render()), 0o600)
+}
+
+// nativePeers lists every peer directory on the volume with its public
+// key, preshared key and tunnel address, including peers added later
+// through /api/peers.
+func nativePeers(configDir string) []wg.ServerPeer {
+	var peers []wg.ServerPeer
+	paths, _ := filepath.Glob(filepath.Join(configDir, "*", "publickey-*"))
+	for _, p := range paths {
+		dir := filepath.Dir(p)
+		name := filepath.Base(dir)
+		if name == "server" || filepath.Base(p) != "publickey-"+name {
+			continue
+		}
+		pub, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		addr, ok := confAddress(filepath.Join(dir, name+".conf"))
+		if !ok {
+			continue
+		}
+		sp := wg.ServerPeer{
+			Name:       name,
+			PublicKey:  strings.TrimSpace(string(pub)),
+			AllowedIPs: []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())},
+		}
+		if psk, err := os.ReadFile(filepath.Join(dir, "presharedkey-"+name)); err == nil {
+			sp.PresharedKey = strings.TrimSpace(string(psk))
+		}
+		peers = append(peers, sp)
+	}
+	return peers
+}
+
+// confAddress returns the first Address in a peer config.
+func confAddress(path string) (netip.Addr, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(k) != "Address" {
+			continue
+		}
+		a, _, _ := strings.Cut(strings.TrimSpace(v), ",")
+		a, _, _ = strings.Cut(a, "/")
+		addr, err := netip.ParseAddr(strings.TrimSpace(a))
+		return addr, err == nil
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,49 @@
+package bootstrap
+
+import (
+	"net/http"
+	"strings"
+
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// spelledKeys are the settings read out character by character in the
+// text-only view.
+var spelledKeys = map[string]bool{
+	"PrivateKey":   true,
+	"PublicKey":    true,
+	"PresharedKey": true,
+}
+
+// textOnly reports whether the accessible text-only view should be shown
+// first, either per request (?view=text) or by default.
+func (s Server) textOnly(r *http.Request) bool {
+	if v := r.URL.Query().Get("view"); v != "" {
+		return v == "text"
+	}
+	return s.cfg.DefaultView == "text"
+}
+
+// textSections turns conf into ordered sections for the text-only view,
+// keeping the original field order so it matches the app's forms.
+func textSections(conf string) []ui.TextSection {
+	var sections []ui.TextSection
+	for _, line := range strings.Split(conf, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sections = append(sections, ui.TextSection{Name: strings.Trim(line, "[]")})
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || len(sections) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := ui.TextField{Key: strings.TrimSpace(k), Value: strings.TrimSpace(v)}
+		if spelledKeys[f.Key] {
+			f.Spelled = ui.SpellNATO(f.Value)
+		}
+		cur := &sections[len(sections)-1]
+		cur.Fields = append(cur.Fields, f)
+	}
+	return sections
+}
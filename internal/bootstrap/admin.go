@@ -0,0 +1,127 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/ui"
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// adminPeer is one row of the admin page's peer table.
+type adminPeer struct {
+	Name           string
+	PublicKey      string
+	Endpoint       string
+	LastHandshake  string
+	Received       string
+	Sent           string
+	Active         bool
+	Infrastructure bool
+}
+
+// admin is the operator's "why did my VPN stop working" page: interface
+// state, every peer's handshake, transfer and endpoint, and when the
+// keepalive loop will let Fly suspend the machine. Unlike /status it shows
+// keys and addresses, so it requires the bootstrap token.
+func (s Server) admin(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	data := map[string]any{
+		"Interface": s.cfg.WGInterface,
+		"Region":    s.cfg.Region,
+		"Endpoint":  s.cfg.ClientEndpointHost(),
+		"Now":       time.Now().UTC().Format(time.RFC3339),
+		"Suspend":   s.suspendOutlook(currentKeepalive(), time.Now()),
+	}
+
+	dev, err := wg.Show(s.cfg.WGInterface)
+	if err != nil {
+		data["InterfaceError"] = err.Error()
+	} else {
+		data["PublicKey"] = dev.PublicKey
+		data["ListenPort"] = dev.ListenPort
+		names := s.peerNamesByKey()
+		infra := s.infraPeerKeys()
+		peers := make([]adminPeer, 0, len(dev.Peers))
+		for _, p := range dev.Peers {
+			row := adminPeer{
+				Name:           names[p.PublicKey],
+				PublicKey:      p.PublicKey,
+				Endpoint:       p.Endpoint,
+				LastHandshake:  "never",
+				Received:       formatBytes(p.ReceiveBytes),
+				Sent:           formatBytes(p.TransmitBytes),
+				Infrastructure: infra[p.PublicKey],
+			}
+			if !p.LastHandshake.IsZero() {
+				ago := time.Since(p.LastHandshake)
+				row.LastHandshake = formatDuration(ago) + " ago"
+				row.Active = ago <= s.cfg.KeepaliveMaxIdle
+			}
+			peers = append(peers, row)
+		}
+		data["Peers"] = peers
+	}
+	data["People"] = s.deviceBudgets()
+	if s.cfg.DeviceRequests {
+		data["Requests"] = s.pendingDeviceRequests()
+	}
+	if p, ok := s.loadRouteProbe(); ok {
+		data["Probe"] = fmt.Sprintf("%s at %s", p.State, p.CheckedAt.UTC().Format(time.RFC3339))
+	}
+	if s.bootstrapDone() {
+		data["Bootstrap"] = "completed"
+	} else if s.bootstrapExpired() {
+		data["Bootstrap"] = "expired (BOOTSTRAP_TTL)"
+	} else {
+		data["Bootstrap"] = "open"
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	ui.AdminPage.Execute(w, data)
+}
+
+// suspendOutlook explains in one sentence whether, and roughly when, the
+// keepalive loop will stop holding the machine awake.
+func (s Server) suspendOutlook(ks keepaliveSnapshot, now time.Time) string {
+	startupWindow, maxIdle := s.cfg.KeepaliveStartupWindow, s.cfg.KeepaliveMaxIdle
+	switch {
+	case ks.Started.IsZero():
+		return "The keepalive loop isn't running (disabled, or no Fly app name), so Fly can suspend the machine whenever it's idle."
+	case !ks.Running:
+		return fmt.Sprintf("Keepalive stopped at %s; Fly can suspend the machine as soon as no requests arrive.",
+			ks.LastTick.UTC().Format(time.RFC3339))
+	case now.Sub(ks.Started) < startupWindow:
+		return fmt.Sprintf("In the startup window: the machine stays awake for at least %s more.",
+			formatDuration(startupWindow-now.Sub(ks.Started)))
+	case ks.Connected:
+		left := maxIdle - ks.Idle - now.Sub(ks.LastTick)
+		return fmt.Sprintf("A client is connected (idle %s). If no new handshake arrives, suspend is allowed in about %s.",
+			formatDuration(ks.Idle), formatDuration(left))
+	default:
+		return "No client connected; the next keepalive check will let the machine suspend."
+	}
+}
+
+// formatBytes renders a byte count with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,201 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/notify"
+)
+
+const (
+	// alertInterval is how often rules are evaluated for notifications.
+	alertInterval = 5 * time.Minute
+
+	// staleHandshake is how old the latest handshake may get while a
+	// session is open. WireGuard re-handshakes every two minutes while
+	// traffic flows, so anything past three means the client vanished
+	// without the keepalive loop noticing yet.
+	staleHandshake = 3 * time.Minute
+
+	diskFullRatio = 0.9
+	maxClockSkew  = 30 * time.Second
+)
+
+// alert is one firing rule.
+type alert struct {
+	Name     string    `json:"name"`
+	Severity string    `json:"severity"`
+	Summary  string    `json:"summary"`
+	ActiveAt time.Time `json:"active_at"`
+}
+
+// alertRule returns a summary and true while the condition holds.
+type alertRule struct {
+	name     string
+	severity string
+	eval     func(s Server) (string, bool)
+}
+
+var alertRules = []alertRule{
+	{"PeerHandshakeStale", "warning", alertStaleHandshake},
+	{"DiskNearlyFull", "critical", alertDiskFull},
+	{"ClockSkew", "warning", alertClockSkew},
+	{"RoutingBroken", "warning", alertRoutingBroken},
+	{"ClientMisbehaving", "warning", alertMisbehavingClient},
+}
+
+func alertStaleHandshake(s Server) (string, bool) {
+	st, err := loadKeepaliveState(s.cfg.KeepaliveStatePath())
+	if err != nil || st.CurrentSessionStart.IsZero() {
+		return "", false
+	}
+	idle, never, err := getWireGuardIdleDuration(s.cfg.WGInterface, s.infraPeerKeys())
+	if err != nil || never || idle <= staleHandshake {
+		return "", false
+	}
+	return fmt.Sprintf("%s is marked connected but hasn't handshaken for %s", s.cfg.PeerName, formatDuration(idle)), true
+}
+
+func alertDiskFull(s Server) (string, bool) {
+	used, total, err := diskUsage(s.cfg.ConfigDir)
+	if err != nil || total == 0 {
+		return "", false
+	}
+	ratio := float64(used) / float64(total)
+	if ratio < diskFullRatio && !s.historyPaused() {
+		return "", false
+	}
+	msg := fmt.Sprintf("%s is %.0f%% full", s.cfg.ConfigDir, ratio*100)
+	if s.historyPaused() {
+		msg += "; history writes are paused"
+	}
+	return msg, true
+}
+
+func alertClockSkew(s Server) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	skew, err := clockSkew(ctx, s.cfg.FlyAPIBaseURL)
+	if err != nil || (skew < maxClockSkew && skew > -maxClockSkew) {
+		return "", false
+	}
+	return fmt.Sprintf("system clock is off by %s", skew), true
+}
+
+func alertRoutingBroken(s Server) (string, bool) {
+	p, ok := s.loadRouteProbe()
+	if !ok || p.State == probeOK {
+		return "", false
+	}
+	return fmt.Sprintf("last routing check for %s failed (%s)", s.cfg.PeerName, p.State), true
+}
+
+// alertsMu serializes evaluations, which update the persisted firing set.
+var alertsMu sync.Mutex
+
+// evaluateAlerts runs every rule and returns the firing alerts along with
+// the ones that started firing since the last evaluation. ActiveAt
+// survives restarts via the alert state file.
+func (s Server) evaluateAlerts() (firing, started []alert) {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	prev := map[string]alert{}
+	if b, err := os.ReadFile(s.cfg.AlertStatePath()); err == nil {
+		var list []alert
+		if json.Unmarshal(b, &list) == nil {
+			for _, a := range list {
+				prev[a.Name] = a
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("cannot read alert state", "component", "alerts", "error", err)
+	}
+
+	for _, rule := range alertRules {
+		summary, ok := rule.eval(s)
+		if !ok {
+			continue
+		}
+		a := alert{Name: rule.name, Severity: rule.severity, Summary: summary, ActiveAt: time.Now()}
+		if p, seen := prev[rule.name]; seen {
+			a.ActiveAt = p.ActiveAt
+		} else {
+			started = append(started, a)
+		}
+		firing = append(firing, a)
+	}
+
+	b, err := json.MarshalIndent(firing, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.cfg.AlertStatePath(), b, 0o600)
+	}
+	if err != nil {
+		slog.Warn("failed to save state", "component", "alerts", "error", err)
+	}
+	return firing, started
+}
+
+// alertLoop evaluates the rules periodically and notifies n about alerts
+// that start firing.
+func (s Server) alertLoop(n notify.Notifier) {
+	for {
+		_, started := s.evaluateAlerts()
+		for _, a := range started {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := n.Send(ctx, notify.Event{
+				Event:   "alert",
+				Title:   "VPN alert: " + a.Name,
+				Message: a.Summary,
+				App:     s.cfg.EndpointHost,
+				Region:  s.cfg.Region,
+			})
+			cancel()
+			if err != nil {
+				slog.Warn("notification failed", "component", "alerts", "alert", a.Name, "error", err)
+			}
+		}
+		time.Sleep(alertInterval)
+	}
+}
+
+// alerts serves the currently firing alerts as JSON, or with
+// ?format=prometheus as the ALERTS series Prometheus itself exposes, so
+// existing dashboards can scrape it. Requires the bootstrap token.
+func (s Server) alerts(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	firing, _ := s.evaluateAlerts()
+	sort.Slice(firing, func(i, j int) bool { return firing[i].Name < firing[j].Name })
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "prometheus" {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# TYPE ALERTS gauge")
+		for _, a := range firing {
+			fmt.Fprintf(w, "ALERTS{alertname=%q,alertstate=\"firing\",severity=%q} 1\n", a.Name, a.Severity)
+		}
+		return
+	}
+	if firing == nil {
+		firing = []alert{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(firing)
+}
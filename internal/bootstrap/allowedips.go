@@ -0,0 +1,166 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/netcalc"
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// allowedIPsOverride is a split-exclude applied to the peer's AllowedIPs
+// whenever a config is served. Storing the exclusions rather than the
+// result keeps it correct if the sidecar's AllowedIPs change later.
+type allowedIPsOverride struct {
+	Exclude   []string  `json:"exclude"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// allowedIPs is the AllowedIPs calculator: "route everything except these
+// CIDRs". GET computes; POST with apply=1 saves the exclusions onto the
+// peer's profile so /bootstrap and /client-settings serve the result.
+// It shares the bootstrap token and is disabled without one.
+func (s Server) allowedIPs(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+
+	conf, err := os.ReadFile(s.cfg.PeerConfigPath())
+	if err != nil {
+		httpError(w, r, "config not ready", 503)
+		return
+	}
+	_, peer := parseConfSections(string(conf))
+
+	include := r.FormValue("include")
+	if include == "" {
+		include = peer["AllowedIPs"]
+	}
+	data := map[string]any{
+		"Token":   s.cfg.BootstrapToken,
+		"Include": include,
+		"Exclude": r.FormValue("exclude"),
+	}
+	if ov, ok := s.loadAllowedIPsOverride(); ok {
+		data["Applied"] = strings.Join(ov.Exclude, ", ")
+	}
+
+	if r.FormValue("exclude") != "" {
+		in, err := netcalc.ParseList(include)
+		if err != nil {
+			httpError(w, r, "invalid include list: "+err.Error(), 400)
+			return
+		}
+		ex, err := netcalc.ParseList(r.FormValue("exclude"))
+		if err != nil {
+			httpError(w, r, "invalid exclude list: "+err.Error(), 400)
+			return
+		}
+		data["Result"] = netcalc.FormatList(netcalc.Exclude(in, ex))
+
+		if r.Method == http.MethodPost && r.FormValue("apply") == "1" {
+			if err := s.saveAllowedIPsOverride(ex); err != nil {
+				slog.Error("failed to save override", "component", "allowed-ips", "error", err, "request_id", requestID(r))
+				httpError(w, r, "failed to save", 500)
+				return
+			}
+			slog.Info("exclusions changed", "component", "allowed-ips", "peer", s.cfg.PeerName, "excluded", netcalc.FormatList(ex), "request_id", requestID(r))
+			data["Applied"] = netcalc.FormatList(ex)
+			s.recordEvent(eventAllowedIPs, "AllowedIPs for %s now exclude %s", s.cfg.PeerName, netcalc.FormatList(ex))
+		}
+	} else if r.Method == http.MethodPost && r.FormValue("apply") == "1" {
+		if err := os.Remove(s.cfg.AllowedIPsOverridePath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			httpError(w, r, "failed to clear", 500)
+			return
+		}
+		slog.Info("cleared exclusions", "component", "allowed-ips", "peer", s.cfg.PeerName, "request_id", requestID(r))
+		delete(data, "Applied")
+		s.recordEvent(eventAllowedIPs, "AllowedIPs exclusions for %s cleared", s.cfg.PeerName)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.FormValue("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if res, ok := data["Result"].(string); ok {
+			fmt.Fprintf(w, "AllowedIPs = %s\n", res)
+		}
+		return
+	}
+	ui.AllowedIPsPage.Execute(w, data)
+}
+
+func (s Server) loadAllowedIPsOverride() (allowedIPsOverride, bool) {
+	var ov allowedIPsOverride
+	b, err := os.ReadFile(s.cfg.AllowedIPsOverridePath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read override", "component", "allowed-ips", "error", err)
+		}
+		return ov, false
+	}
+	if err := json.Unmarshal(b, &ov); err != nil {
+		slog.Warn("ignoring corrupt override", "component", "allowed-ips", "error", err)
+		return ov, false
+	}
+	return ov, len(ov.Exclude) > 0
+}
+
+func (s Server) saveAllowedIPsOverride(ex []netip.Prefix) error {
+	ov := allowedIPsOverride{UpdatedAt: time.Now()}
+	for _, p := range ex {
+		ov.Exclude = append(ov.Exclude, p.String())
+	}
+	b, err := json.MarshalIndent(ov, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.AllowedIPsOverridePath(), b, 0o600)
+}
+
+// applyAllowedIPsOverride rewrites conf's AllowedIPs with the saved
+// exclusions, if any.
+func (s Server) applyAllowedIPsOverride(conf string) string {
+	ov, ok := s.loadAllowedIPsOverride()
+	if !ok {
+		return conf
+	}
+	_, peer := parseConfSections(conf)
+	in, err := netcalc.ParseList(peer["AllowedIPs"])
+	if err != nil {
+		return conf
+	}
+	ex, err := netcalc.ParseList(strings.Join(ov.Exclude, ","))
+	if err != nil {
+		return conf
+	}
+	return replaceSetting(conf, "AllowedIPs", netcalc.FormatList(netcalc.Exclude(in, ex)))
+}
+
+// peerConfig reads the peer config and applies everything we change
+// before handing it to a client: the public endpoint and any saved
+// AllowedIPs exclusions.
+func (s Server) peerConfig() (string, error) {
+	b, err := os.ReadFile(s.cfg.PeerConfigPath())
+	if err != nil {
+		return "", err
+	}
+	conf := s.rewriteEndpoint(string(b))
+	return s.applyAllowedIPsOverride(conf), nil
+}
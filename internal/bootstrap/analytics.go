@@ -0,0 +1,142 @@
+package bootstrap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Onboarding funnel stages, in the order a user normally passes them.
+const (
+	funnelOpened         = "opened"          // /bootstrap requested while still open
+	funnelRejected       = "rejected"        // wrong or missing token
+	funnelFinalized      = "finalized"       // config served, link burned
+	funnelRedelivered    = "redelivered"     // re-fetched within the re-delivery window
+	funnelFirstHandshake = "first_handshake" // first session after a finalize
+)
+
+// funnelEvent is deliberately anonymous: a stage and a time, nothing about
+// the client.
+type funnelEvent struct {
+	Stage string    `json:"stage"`
+	Time  time.Time `json:"time"`
+}
+
+// funnelMu serializes rewrites of the funnel log between HTTP handlers and
+// the keepalive loop.
+var funnelMu sync.Mutex
+
+// recordFunnel appends stage to the funnel log, dropping events older than
+// the retention period. It is a no-op when analytics are disabled or the
+// volume is nearly full.
+func (s Server) recordFunnel(stage string) {
+	if !s.cfg.Analytics || s.historyPaused() {
+		return
+	}
+	funnelMu.Lock()
+	defer funnelMu.Unlock()
+
+	events, err := readFunnel(s.cfg.FunnelPath())
+	if err != nil {
+		slog.Warn("cannot read funnel", "component", "analytics", "error", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-s.cfg.AnalyticsRetention)
+	kept := events[:0]
+	for _, ev := range events {
+		if ev.Time.After(cutoff) {
+			kept = append(kept, ev)
+		}
+	}
+	kept = append(kept, funnelEvent{Stage: stage, Time: time.Now()})
+
+	if err := writeFunnel(s.cfg.FunnelPath(), kept); err != nil {
+		slog.Warn("cannot write funnel", "component", "analytics", "error", err)
+	}
+}
+
+// recordFirstHandshake marks the first session following a finalize, which
+// is the signal that onboarding actually worked end to end.
+func (s Server) recordFirstHandshake() {
+	if !s.cfg.Analytics {
+		return
+	}
+	funnelMu.Lock()
+	events, err := readFunnel(s.cfg.FunnelPath())
+	funnelMu.Unlock()
+	if err != nil {
+		return
+	}
+
+	pending := false
+	for _, ev := range events {
+		switch ev.Stage {
+		case funnelFinalized:
+			pending = true
+		case funnelFirstHandshake:
+			pending = false
+		}
+	}
+	if pending {
+		s.recordFunnel(funnelFirstHandshake)
+	}
+}
+
+// funnelCounts tallies funnel stages recorded since t.
+func (s Server) funnelCounts(since time.Time) (map[string]int, error) {
+	funnelMu.Lock()
+	events, err := readFunnel(s.cfg.FunnelPath())
+	funnelMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, ev := range events {
+		if ev.Time.After(since) {
+			counts[ev.Stage]++
+		}
+	}
+	return counts, nil
+}
+
+func readFunnel(path string) ([]funnelEvent, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []funnelEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev funnelEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) == nil {
+			events = append(events, ev)
+		}
+	}
+	return events, scanner.Err()
+}
+
+func writeFunnel(path string, events []funnelEvent) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
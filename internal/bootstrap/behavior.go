@@ -0,0 +1,236 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+const (
+	// behaviorWindow is how far back handshake and roaming counts look.
+	behaviorWindow = time.Hour
+
+	// A client with steady traffic re-handshakes every two minutes, about
+	// 30 times an hour. Well past that means it keeps tearing the tunnel
+	// down and bringing it back up.
+	maxHandshakesPerHour = 45
+
+	// Phones switching between Wi-Fi and mobile data roam a few times an
+	// hour; more than this usually means a flapping network or two
+	// devices sharing one key.
+	maxRoamsPerHour = 12
+
+	// minRoamsForRoaming marks a peer as roaming: its endpoint moved at
+	// least this often within behaviorWindow, as a phone walking between
+	// Wi-Fi and cellular does.
+	minRoamsForRoaming = 2
+)
+
+// endpointChange is one line of the endpoint history: a peer's source
+// IP:port moving, as seen by the server.
+type endpointChange struct {
+	Peer      string    `json:"peer,omitempty"`
+	PublicKey string    `json:"public_key"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Time      time.Time `json:"time"`
+}
+
+// peerBehavior is the recent handshake cadence and endpoint history of
+// one peer, kept in memory only.
+type peerBehavior struct {
+	lastHandshake int64
+	handshakes    []time.Time
+	endpoint      string
+	roams         []time.Time
+}
+
+var peerBehaviors = struct {
+	sync.Mutex
+	byKey map[string]*peerBehavior
+}{byKey: map[string]*peerBehavior{}}
+
+// samplePeerBehavior records new handshakes and endpoint changes from one
+// keepalive tick. Handshakes closer together than the tick interval are
+// seen as one, so counts are a lower bound.
+func (s Server) samplePeerBehavior(hs map[string]int64) {
+	endpoints, _ := wireGuardEndpoints(s.cfg.WGInterface)
+	now := time.Now()
+	cutoff := now.Add(-behaviorWindow)
+
+	var changes []endpointChange
+	peerBehaviors.Lock()
+	for key, ts := range hs {
+		b := peerBehaviors.byKey[key]
+		if b == nil {
+			b = &peerBehavior{lastHandshake: ts, endpoint: endpoints[key]}
+			peerBehaviors.byKey[key] = b
+			continue
+		}
+		if ts > b.lastHandshake {
+			b.handshakes = append(b.handshakes, time.Unix(ts, 0))
+			b.lastHandshake = ts
+		}
+		if ep := endpoints[key]; ep != "" {
+			if b.endpoint != "" && ep != b.endpoint {
+				b.roams = append(b.roams, now)
+				changes = append(changes, endpointChange{PublicKey: key, From: b.endpoint, To: ep, Time: now})
+			}
+			b.endpoint = ep
+		}
+		b.handshakes = trimBefore(b.handshakes, cutoff)
+		b.roams = trimBefore(b.roams, cutoff)
+	}
+	peerBehaviors.Unlock()
+
+	s.recordEndpointChanges(changes)
+}
+
+// recordEndpointChanges appends roams to the endpoint history, which
+// outlives the in-memory counters.
+func (s Server) recordEndpointChanges(changes []endpointChange) {
+	if len(changes) == 0 || s.historyPaused() {
+		return
+	}
+	names := s.peerNamesByKey()
+	f, err := os.OpenFile(s.cfg.EndpointHistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Warn("cannot open endpoint history", "component", "roaming", "error", err)
+		return
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, c := range changes {
+		c.Peer = names[c.PublicKey]
+		if err := enc.Encode(c); err != nil {
+			slog.Warn("write failed", "component", "roaming", "error", err)
+			return
+		}
+	}
+}
+
+// roamingPeers returns the peers whose endpoint moved at least
+// minRoamsForRoaming times within the last behaviorWindow.
+func roamingPeers() map[string]bool {
+	peerBehaviors.Lock()
+	defer peerBehaviors.Unlock()
+	out := map[string]bool{}
+	for key, b := range peerBehaviors.byKey {
+		if len(b.roams) >= minRoamsForRoaming {
+			out[key] = true
+		}
+	}
+	return out
+}
+
+// roamingAdjustedIdle relaxes the idle accounting for roaming peers by
+// ROAMING_IDLE_GRACE. A device between networks can go quiet for a few
+// minutes before its next handshake from the new address; without the
+// grace that gap looks like the session ended. It returns idle unchanged
+// when the grace is off or no roaming peer has a handshake.
+func (s Server) roamingAdjustedIdle(hs map[string]int64, idle time.Duration) time.Duration {
+	if s.cfg.RoamingGrace <= 0 {
+		return idle
+	}
+	now := time.Now()
+	infra := s.infraPeerKeys()
+	for key := range roamingPeers() {
+		ts := hs[key]
+		if ts == 0 || infra[key] {
+			continue
+		}
+		if adj := max(now.Sub(time.Unix(ts, 0))-s.cfg.RoamingGrace, 0); adj < idle {
+			idle = adj
+		}
+	}
+	return idle
+}
+
+func trimBefore(ts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(cutoff) {
+		i++
+	}
+	return ts[i:]
+}
+
+// peerBehaviorReport lists each peer's counts over the last hour with any
+// flags and what to do about them.
+func (s Server) peerBehaviorReport() []map[string]any {
+	names := s.peerNamesByKey()
+
+	peerBehaviors.Lock()
+	defer peerBehaviors.Unlock()
+	out := make([]map[string]any, 0, len(peerBehaviors.byKey))
+	for key, b := range peerBehaviors.byKey {
+		var flags, fixes []string
+		if len(b.handshakes) > maxHandshakesPerHour {
+			flags = append(flags, "reconnect_loop")
+			fixes = append(fixes, "Update the WireGuard app, and turn off any \"on demand\" or always-on rules that toggle the tunnel. A reconnect loop drains the battery and keeps this machine from suspending.")
+		}
+		if len(b.roams) > maxRoamsPerHour {
+			flags = append(flags, "endpoint_flapping")
+			fixes = append(fixes, "The client's address keeps changing. Check for a flaky network, or for the same config imported on two devices; give each device its own peer.")
+		}
+		var lastRoam string
+		if n := len(b.roams); n > 0 {
+			lastRoam = b.roams[n-1].UTC().Format(time.RFC3339)
+		}
+		out = append(out, map[string]any{
+			"peer":                       names[key],
+			"public_key":                 key,
+			"endpoint":                   b.endpoint,
+			"roaming":                    len(b.roams) >= minRoamsForRoaming,
+			"last_endpoint_change":       lastRoam,
+			"handshakes_last_hour":       len(b.handshakes),
+			"endpoint_changes_last_hour": len(b.roams),
+			"flags":                      flags,
+			"remediations":               fixes,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["public_key"].(string) < out[j]["public_key"].(string) })
+	return out
+}
+
+// alertMisbehavingClient fires while any peer is flagged.
+func alertMisbehavingClient(s Server) (string, bool) {
+	var flagged []string
+	for _, p := range s.peerBehaviorReport() {
+		flags := p["flags"].([]string)
+		if len(flags) == 0 {
+			continue
+		}
+		name, _ := p["peer"].(string)
+		if name == "" {
+			name = p["public_key"].(string)
+		}
+		flagged = append(flagged, fmt.Sprintf("%s (%s)", name, strings.Join(flags, ", ")))
+	}
+	if len(flagged) == 0 {
+		return "", false
+	}
+	return "Client misbehaving: " + strings.Join(flagged, "; "), true
+}
+
+// wireGuardEndpoints returns each peer's current endpoint by public key.
+// Peers that never connected report "(none)" and are left out.
+func wireGuardEndpoints(iface string) (map[string]string, error) {
+	dev, err := wg.Show(iface)
+	if err != nil {
+		return nil, err
+	}
+	eps := make(map[string]string)
+	for _, p := range dev.Peers {
+		if p.Endpoint != "" {
+			eps[p.PublicKey] = p.Endpoint
+		}
+	}
+	return eps, nil
+}
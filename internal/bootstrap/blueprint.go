@@ -0,0 +1,159 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// blueprint describes how a deployment is set up, without keys,
+// addresses or anything that names the deployment, so the same setup can
+// be reproduced elsewhere ("the same thing for my parents").
+type blueprint struct {
+	Version   int                 `json:"version"`
+	Generated time.Time           `json:"generated"`
+	Settings  map[string]string   `json:"settings"`
+	People    map[string][]string `json:"people,omitempty"`
+	Peers     []blueprintPeer     `json:"peers"`
+	Counts    map[string]int      `json:"counts"`
+}
+
+type blueprintPeer struct {
+	Name   string `json:"name"`
+	Person string `json:"person,omitempty"`
+	// Source is "sidecar" for peers from PEERS, which the import leaves
+	// to the WireGuard container, or "api".
+	Source string `json:"source"`
+}
+
+const blueprintVersion = 1
+
+// blueprint describes this deployment. Guests are counted but not
+// listed: they are claimed, not set up.
+func (s Server) blueprint() blueprint {
+	bp := blueprint{
+		Version:   blueprintVersion,
+		Generated: time.Now().UTC(),
+		Settings:  s.cfg.Blueprint(),
+		People:    s.people(),
+		Peers:     []blueprintPeer{},
+		Counts:    map[string]int{},
+	}
+	for _, p := range s.listPeers() {
+		source, _ := p["source"].(string)
+		person, _ := p["person"].(string)
+		name, _ := p["name"].(string)
+		if p["status"] == "revoked" {
+			bp.Counts["revoked_peers"]++
+			continue
+		}
+		if person == guestPerson {
+			bp.Counts["guest_peers"]++
+			continue
+		}
+		bp.Counts[source+"_peers"]++
+		bp.Peers = append(bp.Peers, blueprintPeer{Name: name, Person: person, Source: source})
+	}
+	delete(bp.People, guestPerson)
+	return bp
+}
+
+// adminBlueprint serves GET /admin/blueprint, the blueprint as JSON, and
+// POST /admin/blueprint, which takes one and creates its API peers here.
+// Settings can't be applied from inside the app, so the import reports
+// the ones that differ instead. Requires the admin token.
+func (s Server) adminBlueprint(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodGet:
+		slog.Info("blueprint exported", "component", "blueprint", "request_id", requestID(r))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="wgvpn-blueprint.json"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(s.blueprint())
+
+	case http.MethodPost:
+		var bp blueprint
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&bp); err != nil {
+			httpError(w, r, "expected a blueprint from GET /admin/blueprint", 400)
+			return
+		}
+		if bp.Version != blueprintVersion {
+			httpError(w, r, "unsupported blueprint version", 400)
+			return
+		}
+		res := s.importBlueprint(bp)
+		slog.Info("blueprint imported", "component", "blueprint", "created", len(res.Created), "skipped", len(res.Skipped), "failed", len(res.Failed), "request_id", requestID(r))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+
+	default:
+		httpError(w, r, "method not allowed", 405)
+	}
+}
+
+// blueprintImport is what POST /admin/blueprint did.
+type blueprintImport struct {
+	Created []string          `json:"created"`
+	Skipped map[string]string `json:"skipped"`
+	Failed  map[string]string `json:"failed"`
+	// Settings lists each setting whose value here differs from the
+	// blueprint's, as {"blueprint": …, "here": …}.
+	Settings map[string]map[string]string `json:"settings"`
+	// SidecarPeers is how many peers the blueprint's PEERS made; set
+	// PEERS on the WireGuard container to match.
+	SidecarPeers int `json:"sidecar_peers"`
+}
+
+// importBlueprint creates the blueprint's API peers that don't exist
+// yet, with fresh keys and addresses, and compares its settings.
+func (s Server) importBlueprint(bp blueprint) blueprintImport {
+	res := blueprintImport{
+		Created:  []string{},
+		Skipped:  map[string]string{},
+		Failed:   map[string]string{},
+		Settings: map[string]map[string]string{},
+	}
+	for _, p := range bp.Peers {
+		switch {
+		case p.Source != "api":
+			res.SidecarPeers++
+			continue
+		case !validPeerName.MatchString(p.Name) || reservedDirs[p.Name] || len(p.Name) > maxPeerDirLen:
+			res.Failed[p.Name] = "invalid peer name"
+			continue
+		case p.Person != "" && (!validPeerName.MatchString(p.Person) || len(p.Person) > 32 || p.Person == guestPerson):
+			res.Failed[p.Name] = "invalid person"
+			continue
+		}
+		created, _, err := s.createPeer(p.Name, p.Person)
+		switch {
+		case err == errPeerExists:
+			res.Skipped[p.Name] = "already exists"
+		case err != nil:
+			res.Failed[p.Name] = err.Error()
+		default:
+			res.Created = append(res.Created, created.Name)
+			s.recordEvent(eventPeerAdded, "Peer %s added from a blueprint at %s (public key %s)", created.Name, created.Address, created.PublicKey)
+		}
+	}
+
+	here := s.cfg.Blueprint()
+	for name, want := range bp.Settings {
+		if got, ok := here[name]; ok && got != want {
+			res.Settings[name] = map[string]string{"blueprint": want, "here": got}
+		}
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestBlueprintRoundTrip(t *testing.T) {
+	src := newTestServer(t, func(c *config.Config) {
+		c.People = []string{"alice:peer1"}
+		c.PeopleMaxDevices = 3
+		c.EndpointHost = "family.example.net"
+		c.AlertNotifyURL = "https://ntfy.sh/secret-topic"
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	if _, _, err := src.createPeer("peer_laptop", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := src.createPeer("peer_tv", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(src.adminBlueprint, http.MethodGet, "/admin/blueprint?token="+testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: status = %d: %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	for _, leak := range []string{"family.example.net", "secret-topic", testAdminToken, "PrivateKey", "10.13.13.3"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("blueprint contains %q", leak)
+		}
+	}
+	var bp blueprint
+	if err := json.Unmarshal(w.Body.Bytes(), &bp); err != nil {
+		t.Fatal(err)
+	}
+	if bp.Counts["api_peers"] != 2 || bp.Counts["sidecar_peers"] != 2 {
+		t.Errorf("counts = %v", bp.Counts)
+	}
+	if bp.Settings["PeopleMaxDevices"] != "3" {
+		t.Errorf("PeopleMaxDevices = %q, want 3", bp.Settings["PeopleMaxDevices"])
+	}
+
+	dst := newTestServer(t, nil)
+	r := httptest.NewRequest(http.MethodPost, "/admin/blueprint?token="+testAdminToken, strings.NewReader(w.Body.String()))
+	rec := httptest.NewRecorder()
+	dst.adminBlueprint(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import: status = %d: %s", rec.Code, rec.Body)
+	}
+	var res blueprintImport
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Created) != 2 || res.SidecarPeers != 2 {
+		t.Errorf("import = %+v", res)
+	}
+	if d, ok := res.Settings["PeopleMaxDevices"]; !ok || d["blueprint"] != "3" || d["here"] != "0" {
+		t.Errorf("settings diff = %v", res.Settings)
+	}
+	for _, p := range dst.loadAPIPeers() {
+		if p.Name == "peer_laptop" && p.Person != "alice" {
+			t.Errorf("peer_laptop person = %q, want alice", p.Person)
+		}
+	}
+
+	// Importing again changes nothing.
+	rec = httptest.NewRecorder()
+	dst.adminBlueprint(rec, httptest.NewRequest(http.MethodPost, "/admin/blueprint?token="+testAdminToken, strings.NewReader(w.Body.String())))
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || len(res.Created) != 0 || len(res.Skipped) != 2 {
+		t.Errorf("second import = %+v (%v)", res, err)
+	}
+}
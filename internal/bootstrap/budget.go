@@ -0,0 +1,70 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+var errDeviceBudget = errors.New("device budget reached")
+
+// personDevices lists person's peers that are on the volume and not
+// revoked: the devices that count against PEOPLE_MAX_DEVICES.
+func (s Server) personDevices(person string) []string {
+	var out []string
+	for _, p := range s.people()[person] {
+		if isPeerDir(filepath.Join(s.cfg.ConfigDir, p), p) && !s.peerRevoked(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// deviceLimit is how many devices person may have, and the setting that
+// says so. Guests share GUEST_MAX_PEERS between them.
+func (s Server) deviceLimit(person string) (int, string) {
+	if person == guestPerson {
+		return s.cfg.GuestMaxPeers, "GUEST_MAX_PEERS"
+	}
+	return s.cfg.PeopleMaxDevices, "PEOPLE_MAX_DEVICES"
+}
+
+// checkDeviceBudget refuses another device for person once they have
+// PEOPLE_MAX_DEVICES, so one member of a shared deployment can't quietly
+// fill the subnet. Peers created for nobody in particular aren't capped.
+func (s Server) checkDeviceBudget(person string) error {
+	limit, setting := s.deviceLimit(person)
+	if person == "" || limit <= 0 {
+		return nil
+	}
+	if have := s.personDevices(person); len(have) >= limit {
+		return fmt.Errorf("%w: %s already has %d of %d devices (%s); remove or revoke one first",
+			errDeviceBudget, person, len(have), limit, setting)
+	}
+	return nil
+}
+
+// personBudget is one row of the admin page's people table.
+type personBudget struct {
+	Name    string
+	Devices int
+	Max     int
+	Full    bool
+}
+
+func (s Server) deviceBudgets() []personBudget {
+	var out []personBudget
+	for name := range s.people() {
+		n := len(s.personDevices(name))
+		limit, _ := s.deviceLimit(name)
+		out = append(out, personBudget{
+			Name:    name,
+			Devices: n,
+			Max:     limit,
+			Full:    limit > 0 && n >= limit,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
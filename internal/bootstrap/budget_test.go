@@ -0,0 +1,73 @@
+package bootstrap
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestDeviceBudgetPerPerson(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.People = []string{"alice:peer1", "bob:peer2"}
+		c.PeopleMaxDevices = 2
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	steps := []struct {
+		name, peer, person string
+		wantErr            error
+	}{
+		{"alice's second device", "peer_a2", "alice", nil},
+		{"alice's third device", "peer_a3", "alice", errDeviceBudget},
+		{"bob has room", "peer_b2", "bob", nil},
+		{"nobody in particular", "peer_x", "", nil},
+	}
+	for _, st := range steps {
+		if _, _, err := s.createPeer(st.peer, st.person); !errors.Is(err, st.wantErr) {
+			t.Errorf("%s: err = %v, want %v", st.name, err, st.wantErr)
+		}
+	}
+
+	// A revoked device no longer counts.
+	if err := s.revokePeer("peer1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.createPeer("peer_a3", "alice"); err != nil {
+		t.Errorf("after revoking one of alice's devices: %v", err)
+	}
+
+	// Deleted devices give their slot back, but restoring needs it again.
+	if err := s.removePeer("peer_a2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.createPeer("peer_a4", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.restorePeer("peer_a2"); !errors.Is(err, errDeviceBudget) {
+		t.Errorf("restore over budget: err = %v, want %v", err, errDeviceBudget)
+	}
+}
+
+func TestDeviceBudgetIsReported(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.People = []string{"alice:peer1+peer2"}
+		c.PeopleMaxDevices = 2
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	r := httptest.NewRequest(http.MethodPost, "/api/peers?token="+testAdminToken, strings.NewReader(`{"name": "tablet", "person": "alice"}`))
+	w := httptest.NewRecorder()
+	s.apiPeers(w, r)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "alice already has 2 of 2 devices") {
+		t.Errorf("create over budget: status = %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(s.admin, http.MethodGet, "/admin?token="+testAdminToken)
+	if !strings.Contains(w.Body.String(), "2 of 2 (budget reached)") {
+		t.Errorf("admin page doesn't show alice's full budget:\n%s", w.Body)
+	}
+}
@@ -0,0 +1,88 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// capability describes one optional subsystem: whether this binary has it
+// at all, and whether the current configuration turns it on.
+type capability struct {
+	Compiled bool `json:"compiled"`
+	Enabled  bool `json:"enabled"`
+}
+
+// capabilities lists every optional subsystem a client might look for.
+// Subsystems this server doesn't implement are still listed, with
+// compiled=false, so clients can rely on the keys being present.
+func (s Server) capabilities() map[string]capability {
+	on := func(enabled bool) capability { return capability{Compiled: true, Enabled: enabled} }
+	absent := capability{}
+
+	return map[string]capability{
+		"keepalive":          on(s.cfg.EndpointHost != "" && strings.ToLower(config.Getenv("KEEPALIVE_ENABLED", "true")) != "false"),
+		"status_page":        on(s.cfg.StatusPage),
+		"bootstrap_token":    on(s.cfg.BootstrapToken != ""),
+		"private_only":       on(s.cfg.PrivateOnly),
+		"api_tunnel_only":    on(s.cfg.APITunnelOnly),
+		"redelivery":         on(s.cfg.RedeliveryWindow > 0),
+		"page_expiry":        on(s.cfg.PageExpiry > 0),
+		"bootstrap_ttl":      on(s.cfg.BootstrapTTL > 0),
+		"onboard_push":       on(s.cfg.OnboardNotifyURL != ""),
+		"analytics":          on(s.cfg.Analytics),
+		"digest":             on(s.cfg.DigestNotifyURL != ""),
+		"alert_notify":       on(s.cfg.AlertNotifyURL != ""),
+		"hooks":              on(s.hooks.Enabled()),
+		"dns_publish":        on(s.cfg.DNSPublishProvider != ""),
+		"machine_events":     on(s.cfg.FlyAPIToken != "" && s.cfg.MachineID != ""),
+		"explicit_suspend":   on(s.explicitSuspend()),
+		"firewall_extras":    on(s.cfg.FirewallExtras != ""),
+		"prometheus_alerts":  on(s.cfg.BootstrapToken != ""),
+		"allowed_ips_editor": on(s.cfg.BootstrapToken != ""),
+		"signed_configs":     on(s.cfg.SignConfigs),
+		"peer_api":           on(s.cfg.BootstrapToken != ""),
+		"metrics":            on(s.cfg.BootstrapToken != ""),
+		"admin_page":         on(s.cfg.BootstrapToken != ""),
+		"blueprint":          on(s.cfg.BootstrapToken != ""),
+		"onboarding_tokens":  on(s.cfg.BootstrapToken != ""),
+		"token_lockout":      on(s.tokenGuard != nil),
+		"peer_restore":       on(s.cfg.BootstrapToken != "" && s.cfg.PeerDeleteCooldown > 0),
+		"device_budget":      on(s.cfg.PeopleMaxDevices > 0),
+		"device_requests":    on(s.cfg.DeviceRequests && s.cfg.BootstrapToken != ""),
+		"guest_claims":       on(s.guestsEnabled()),
+		"idempotency_keys":   on(s.cfg.BootstrapToken != ""),
+		"tls":                on(s.cfg.TLS == "self-signed" || s.cfg.TLSCert != ""),
+		"doh":                absent,
+		"socks5":             absent,
+		"multi_region":       absent,
+		"userspace_wg":       absent,
+	}
+}
+
+// apiCapabilities serves GET /api/v1/capabilities so CLIs and dashboards
+// can hide features instead of probing endpoints that 404. It only
+// reveals on/off flags, but still requires the bootstrap token because
+// those flags describe the deployment.
+func (s Server) apiCapabilities(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(map[string]any{
+		"api":            "v1",
+		"subsystems":     s.capabilities(),
+		"export_formats": exportFormatNames(),
+	})
+}
@@ -0,0 +1,91 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// clientSettingKeys are the config lines a client may safely refresh
+// without re-onboarding. Keys are deliberately excluded.
+var clientSettingKeys = []string{"Endpoint", "DNS", "AllowedIPs"}
+
+// clientSettings serves the current non-key settings of a peer config as
+// "Key = value" lines for the updater scripts. It takes the peer's own
+// client token, not BOOTSTRAP_TOKEN, and unlike /bootstrap can be fetched
+// repeatedly.
+func (s Server) clientSettings(w http.ResponseWriter, r *http.Request) {
+	// Without a token there is nothing to derive client tokens from.
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	peer, ok := s.clientPeer(r)
+	if !ok {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	conf, err := s.forPeer(peer).peerConfig()
+	if err != nil {
+		httpError(w, r, "config not ready", 503)
+		return
+	}
+
+	var body strings.Builder
+	for _, line := range strings.Split(conf, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		for _, k := range clientSettingKeys {
+			if key == k {
+				fmt.Fprintf(&body, "%s = %s\n", key, strings.TrimSpace(value))
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	s.signResponse(w, r, []byte(body.String()))
+	_, _ = w.Write([]byte(body.String()))
+}
+
+// requestToken extracts a token from "Authorization: Bearer" or ?token=.
+func requestToken(r *http.Request) string {
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return r.URL.Query().Get("token")
+}
+
+// updateScripts renders the sh and PowerShell updaters as base64 so the
+// bootstrap page can offer them as data: downloads. They carry the peer's
+// client token, which can't do anything but refresh these settings. It
+// returns empty strings when no token is configured, since the settings
+// endpoint is disabled then.
+func (s Server) updateScripts(r *http.Request) (sh, ps1 string) {
+	if s.cfg.BootstrapToken == "" {
+		return "", ""
+	}
+	data := map[string]string{
+		"URL":   s.baseURL(r) + "/client-settings?peer=" + url.QueryEscape(s.cfg.PeerName),
+		"Token": s.peerClientToken(s.cfg.PeerName),
+	}
+	return renderBase64(ui.UpdateScriptSh, data), renderBase64(ui.UpdateScriptPS1, data)
+}
+
+func renderBase64(t *template.Template, data any) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,44 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxClockJump is how far the wall clock may drift from the monotonic
+// clock between two keepalive ticks before we treat it as a jump.
+const maxClockJump = 10 * time.Second
+
+// clockJump reports how much further the wall clock moved than the
+// monotonic clock between prev and now. Both must come from time.Now in
+// this process so they carry monotonic readings.
+func clockJump(prev, now time.Time) time.Duration {
+	return now.Round(0).Sub(prev.Round(0)) - now.Sub(prev)
+}
+
+// clockSkew estimates how far the local clock is off by comparing it with
+// the Date header of a well-known HTTPS server, correcting for half the
+// round trip. Date has one-second resolution, which is plenty to catch
+// the skews that break handshakes and token expiry.
+func clockSkew(ctx context.Context, url string) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	sent := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	rtt := time.Since(sent)
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("no usable Date header from %s", url)
+	}
+	local := sent.Add(rtt / 2)
+	return local.Sub(remote).Truncate(time.Second), nil
+}
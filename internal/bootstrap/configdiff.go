@@ -0,0 +1,73 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// checkConfigChange logs what changed in the effective configuration
+// since the previous boot, one line per setting, so "what changed since
+// the last deploy?" can be answered from `fly logs`. Secrets are compared
+// by fingerprint only. The snapshot is then saved for the next boot.
+func (s Server) checkConfigChange() {
+	path := s.cfg.ConfigSnapshotPath()
+	cur := s.cfg.Snapshot()
+
+	prev := map[string]string{}
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		prev = nil
+	case err != nil:
+		slog.Warn("cannot read snapshot", "component", "config", "path", path, "error", err)
+		return
+	default:
+		if err := json.Unmarshal(b, &prev); err != nil {
+			slog.Warn("ignoring corrupt snapshot", "component", "config", "path", path, "error", err)
+			prev = nil
+		}
+	}
+
+	if prev != nil {
+		var changed, rerender []string
+		for k, v := range cur {
+			if old, ok := prev[k]; ok && old != v {
+				changed = append(changed, k)
+			}
+		}
+		sort.Strings(changed)
+		for _, k := range changed {
+			slog.Info("setting changed", "component", "config", "setting", k, "old", prev[k], "new", cur[k], "rerender", config.RequiresRerender(k))
+			if config.RequiresRerender(k) {
+				rerender = append(rerender, k)
+			}
+		}
+		switch {
+		case len(changed) == 0:
+			slog.Info("no changes since the last boot", "component", "config")
+		case len(rerender) > 0:
+			slog.Warn("settings changed; served configs are affected, so devices need to re-import", "component", "config",
+				"changed_count", len(changed), "rerender", strings.Join(rerender, ","))
+		default:
+			slog.Info("settings changed; served configs are unaffected", "component", "config", "changed_count", len(changed))
+		}
+		if len(changed) == 0 && len(prev) == len(cur) {
+			return
+		}
+	}
+
+	b, err = json.MarshalIndent(cur, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		slog.Warn("failed to record snapshot", "component", "config", "error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package bootstrap
+
+import (
+	"bufio"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// conntrackPath is where the kernel exposes the connection tracking table.
+// It only exists when nf_conntrack is loaded, which it is whenever the
+// MASQUERADE rule from the entrypoint is active.
+const conntrackPath = "/proc/net/nf_conntrack"
+
+// conntrackFlows returns the set of tracked flows whose original source
+// address lies inside subnet, i.e. connections that VPN clients opened
+// through the tunnel. Each flow is keyed by its protocol and
+// original-direction tuple so snapshots can be compared between ticks.
+func conntrackFlows(subnet netip.Prefix) (map[string]struct{}, error) {
+	f, err := os.Open(conntrackPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseConntrack(f, subnet)
+}
+
+// parseConntrack reads a table in the /proc/net/nf_conntrack format.
+func parseConntrack(r io.Reader, subnet netip.Prefix) (map[string]struct{}, error) {
+	flows := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		// Only the first src/dst/sport/dport group describes the original
+		// direction; the second group is the reply tuple after NAT.
+		key := []string{fields[2]}
+		var src string
+		for _, field := range fields[3:] {
+			k, v, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			if k == "src" {
+				if src != "" {
+					break
+				}
+				src = v
+			}
+			if k == "src" || k == "dst" || k == "sport" || k == "dport" {
+				key = append(key, field)
+			}
+		}
+
+		addr, err := netip.ParseAddr(src)
+		if err != nil || !subnet.Contains(addr) {
+			continue
+		}
+		flows[strings.Join(key, " ")] = struct{}{}
+	}
+
+	return flows, scanner.Err()
+}
+
+// countNewFlows reports how many flows in cur were not present in prev.
+func countNewFlows(prev, cur map[string]struct{}) int {
+	n := 0
+	for k := range cur {
+		if _, ok := prev[k]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// tunnelPrefix parses the sidecar's INTERNAL_SUBNET value. The
+// linuxserver image takes a bare network address and assumes a /24, so
+// we do the same when no prefix length is given.
+func tunnelPrefix(subnet string) (netip.Prefix, error) {
+	if !strings.Contains(subnet, "/") {
+		subnet += "/24"
+	}
+	p, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
@@ -0,0 +1,85 @@
+package bootstrap
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConntrack(t *testing.T) {
+	subnet := netip.MustParsePrefix("10.13.13.0/24")
+	cases := []struct {
+		name  string
+		table string
+		want  []string
+	}{
+		{
+			name:  "tcp from a client",
+			table: "ipv4     2 tcp      6 431999 ESTABLISHED src=10.13.13.2 dst=1.1.1.1 sport=40000 dport=443 src=1.1.1.1 dst=172.19.0.2 sport=443 dport=40000 [ASSURED] mark=0 zone=0 use=2\n",
+			want:  []string{"tcp src=10.13.13.2 dst=1.1.1.1 sport=40000 dport=443"},
+		},
+		{
+			name:  "udp without reply",
+			table: "ipv4     2 udp      17 29 src=10.13.13.3 dst=9.9.9.9 sport=5353 dport=53 [UNREPLIED] src=9.9.9.9 dst=172.19.0.2 sport=53 dport=5353 mark=0 zone=0 use=2\n",
+			want:  []string{"udp src=10.13.13.3 dst=9.9.9.9 sport=5353 dport=53"},
+		},
+		{
+			name:  "icmp has no ports",
+			table: "ipv4     2 icmp     1 29 src=10.13.13.2 dst=8.8.8.8 type=8 code=0 id=7 src=8.8.8.8 dst=172.19.0.2 type=0 code=0 id=7 mark=0 use=1\n",
+			want:  []string{"icmp src=10.13.13.2 dst=8.8.8.8"},
+		},
+		{
+			name:  "outside the tunnel",
+			table: "ipv4     2 tcp      6 300 ESTABLISHED src=172.19.0.2 dst=1.1.1.1 sport=50000 dport=443 src=1.1.1.1 dst=172.19.0.2 sport=443 dport=50000 [ASSURED] mark=0 use=1\n",
+		},
+		{
+			name:  "reply tuple in the tunnel",
+			table: "ipv4     2 tcp      6 300 ESTABLISHED src=172.19.0.2 dst=10.13.13.2 sport=50000 dport=22 src=10.13.13.2 dst=172.19.0.2 sport=22 dport=50000 [ASSURED] mark=0 use=1\n",
+		},
+		{
+			name:  "duplicates collapse, junk is skipped",
+			table: "garbage\n\nipv4 2 tcp 6 300 ESTABLISHED src=10.13.13.2 dst=1.1.1.1 sport=1 dport=2\nipv4 2 tcp 6 299 ESTABLISHED src=10.13.13.2 dst=1.1.1.1 sport=1 dport=2\nipv4 2 tcp 6 300 ESTABLISHED src=not-an-ip dst=1.1.1.1\n",
+			want:  []string{"tcp src=10.13.13.2 dst=1.1.1.1 sport=1 dport=2"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			flows, err := parseConntrack(strings.NewReader(tc.table), subnet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make(map[string]struct{})
+			for _, k := range tc.want {
+				want[k] = struct{}{}
+			}
+			if !reflect.DeepEqual(flows, want) {
+				t.Errorf("flows = %v, want %v", flows, want)
+			}
+		})
+	}
+}
+
+func TestCountNewFlows(t *testing.T) {
+	set := func(keys ...string) map[string]struct{} {
+		m := make(map[string]struct{})
+		for _, k := range keys {
+			m[k] = struct{}{}
+		}
+		return m
+	}
+	cases := []struct {
+		prev, cur map[string]struct{}
+		want      int
+	}{
+		{nil, set("a", "b"), 2},
+		{set("a"), set("a", "b"), 1},
+		{set("a", "b"), set("a"), 0},
+		{set("a"), set("b", "c"), 2},
+	}
+	for _, tc := range cases {
+		if got := countNewFlows(tc.prev, tc.cur); got != tc.want {
+			t.Errorf("countNewFlows(%v, %v) = %d, want %d", tc.prev, tc.cur, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package bootstrap
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Console is a line-driven recovery menu for `fly ssh console`. It works
+// straight off the volume, so it keeps working when the HTTP server is
+// the thing that's broken.
+func (s Server) Console(in io.Reader, out io.Writer) {
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, `
+  1) Show status
+  2) Print peer config as QR
+  3) Re-arm /bootstrap
+  4) Rotate bootstrap token
+  5) Push bootstrap link to the onboarding ntfy topic
+  6) Clean up orphaned files on the volume
+  q) Quit
+> `)
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		switch strings.TrimSpace(sc.Text()) {
+		case "1":
+			s.consoleStatus(out)
+		case "2":
+			s.consoleQR(out)
+		case "3":
+			fmt.Fprint(out, "Re-open the one-time bootstrap link? [y/N] ")
+			if sc.Scan() && strings.EqualFold(strings.TrimSpace(sc.Text()), "y") {
+				if err := s.rearmBootstrap(); err != nil {
+					fmt.Fprintf(out, "error: %v\n", err)
+				} else {
+					s.recordEvent(eventBootstrapRearm, "Bootstrap re-armed from the console")
+					fmt.Fprintln(out, "Bootstrap re-armed; the next visit to /bootstrap serves the config again.")
+				}
+			}
+		case "4":
+			s.consoleToken(out)
+		case "5":
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := s.pushBootstrapLink(ctx, s.publicURL()); err != nil {
+				fmt.Fprintf(out, "error: %v\n", err)
+			} else {
+				fmt.Fprintln(out, "Link pushed.")
+			}
+			cancel()
+		case "6":
+			orphans := s.findOrphans()
+			if len(orphans) == 0 {
+				fmt.Fprintln(out, "Nothing to clean up.")
+				break
+			}
+			var total int64
+			for _, o := range orphans {
+				fmt.Fprintf(out, "  %-40s %8d bytes  (%s)\n", o.Path, o.Bytes, o.Reason)
+				total += o.Bytes
+			}
+			fmt.Fprintf(out, "Delete these %d entries (%d bytes)? [y/N] ", len(orphans), total)
+			if sc.Scan() && strings.EqualFold(strings.TrimSpace(sc.Text()), "y") {
+				n, err := removeOrphans(orphans)
+				if err != nil {
+					fmt.Fprintf(out, "error: %v\n", err)
+				}
+				fmt.Fprintf(out, "Reclaimed %d bytes.\n", n)
+			}
+		case "q", "quit", "exit":
+			return
+		}
+	}
+}
+
+func (s Server) consoleStatus(out io.Writer) {
+	fmt.Fprintf(out, "WireGuard ready: %t\n", s.wireGuardReady())
+	if host := s.cfg.ClientEndpointHost(); host != "" {
+		fmt.Fprintf(out, "Endpoint:        %s:%s\n", host, s.cfg.EndpointPort)
+	}
+
+	if done, err := os.ReadFile(s.cfg.BootstrapDonePath()); err == nil {
+		fmt.Fprintf(out, "Bootstrap:       completed %s\n", strings.TrimSpace(string(done)))
+	} else {
+		fmt.Fprintln(out, "Bootstrap:       open")
+	}
+
+	if st, err := loadKeepaliveState(s.cfg.KeepaliveStatePath()); err != nil {
+		fmt.Fprintf(out, "Sessions:        unreadable (%v)\n", err)
+	} else {
+		fmt.Fprintf(out, "Sessions:        %d, %s connected in total\n",
+			st.Sessions, formatDuration(time.Duration(st.SessionSeconds)*time.Second))
+		if !st.LastSessionEnd.IsZero() {
+			fmt.Fprintf(out, "Last session:    ended %s\n", st.LastSessionEnd.Format(time.RFC3339))
+		}
+	}
+
+	if p, ok := s.loadRouteProbe(); ok {
+		fmt.Fprintf(out, "Routing probe:   %s at %s\n", p.State, p.CheckedAt.Format(time.RFC3339))
+	}
+
+	if peers, err := s.peerHandshakes(); err == nil {
+		for _, p := range peers {
+			name, _ := p["peer"].(string)
+			if name == "" {
+				name = p["public_key"].(string)
+			}
+			last, _ := p["last_handshake"].(string)
+			if last == "" {
+				last = "never"
+			}
+			fmt.Fprintf(out, "Peer %-12s active=%t last_handshake=%s\n", name, p["active"], last)
+		}
+	}
+	for _, p := range s.stalePeers() {
+		fmt.Fprintf(out, "Stale:           %s %s\n", p.Peer, p.Suggestion)
+	}
+}
+
+func (s Server) consoleQR(out io.Writer) {
+	conf, err := s.peerConfig()
+	if err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return
+	}
+	q, err := qrcode.New(conf, qrcode.Low)
+	if err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprint(out, q.ToSmallString(false))
+	fmt.Fprintln(out, "Scan with the WireGuard app. Clear your terminal scrollback afterwards; this contains the private key.")
+}
+
+// consoleToken suggests a fresh token. BOOTSTRAP_TOKEN is a Fly secret,
+// which can only be changed from outside the machine.
+func (s Server) consoleToken(out io.Writer) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintln(out, "The token is a Fly secret and can't be changed from inside the machine. From your workstation run:")
+	fmt.Fprintf(out, "\n  fly secrets set BOOTSTRAP_TOKEN=%s\n\n", hex.EncodeToString(b))
+	fmt.Fprintln(out, "The machine restarts with the new token; old links stop working. To keep the old token working while")
+	fmt.Fprintln(out, "clients move over, also set BOOTSTRAP_TOKENS=<old token>, then unset it later.")
+}
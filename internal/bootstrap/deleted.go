@@ -0,0 +1,133 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// deletedPeer is an API peer removed through DELETE /api/peers/<name>.
+// Its keys are gone with its directory; the record keeps the name and
+// address out of reach of new peers until PEER_DELETE_COOLDOWN passes, so
+// a mistaken delete can be undone and logs never show one address for two
+// devices in quick succession.
+type deletedPeer struct {
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	Created time.Time `json:"created"`
+	Person  string    `json:"person,omitempty"`
+	Deleted time.Time `json:"deleted"`
+	// Generation is the peer's link generation at deletion. A restored
+	// peer continues from it, so links from before the delete stay dead.
+	Generation int `json:"generation"`
+}
+
+func (s Server) loadDeletedPeers() []deletedPeer {
+	var peers []deletedPeer
+	b, err := os.ReadFile(s.cfg.DeletedPeersPath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read deleted peers", "component", "peers", "error", err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &peers); err != nil {
+		slog.Warn("deleted peers file is corrupt", "component", "peers", "error", err)
+		return nil
+	}
+	return peers
+}
+
+// saveDeletedPeers writes peers, dropping the ones past the cooldown.
+func (s Server) saveDeletedPeers(peers []deletedPeer) error {
+	kept := []deletedPeer{}
+	for _, p := range peers {
+		if time.Since(p.Deleted) < s.cfg.PeerDeleteCooldown {
+			kept = append(kept, p)
+		}
+	}
+	b, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.DeletedPeersPath(), b, 0o600)
+}
+
+func (s Server) recordDeletedPeer(p deletedPeer) error {
+	peers := s.loadDeletedPeers()
+	for i := range peers {
+		if peers[i].Name == p.Name {
+			peers = append(peers[:i], peers[i+1:]...)
+			break
+		}
+	}
+	return s.saveDeletedPeers(append(peers, p))
+}
+
+// findDeletedPeer returns name's record if it is still within the
+// cooldown at now.
+func (s Server) findDeletedPeer(name string, now time.Time) (deletedPeer, bool) {
+	for _, p := range s.loadDeletedPeers() {
+		if p.Name == name && now.Sub(p.Deleted) < s.cfg.PeerDeleteCooldown {
+			return p, true
+		}
+	}
+	return deletedPeer{}, false
+}
+
+var errAddressTaken = errors.New("the peer's address has been given to another peer")
+
+// restorePeer brings a deleted API peer back under its old name and
+// address with a fresh key pair and preshared key. Its bootstrap link
+// opens again, under a new link generation.
+func (s Server) restorePeer(name string) (apiPeer, string, error) {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+
+	d, ok := s.findDeletedPeer(name, time.Now())
+	if !ok {
+		return apiPeer{}, "", errPeerNotFound
+	}
+	if _, err := os.Stat(filepath.Join(s.cfg.ConfigDir, name)); err == nil {
+		return apiPeer{}, "", errPeerExists
+	}
+	addr, err := netip.ParseAddr(d.Address)
+	if err != nil {
+		return apiPeer{}, "", err
+	}
+	// Peers from PEERS are allocated by the sidecar, which doesn't know
+	// about the reservation.
+	if s.usedTunnelAddresses()[addr] {
+		return apiPeer{}, "", errAddressTaken
+	}
+	if err := s.checkDeviceBudget(d.Person); err != nil {
+		return apiPeer{}, "", err
+	}
+
+	p, conf, err := s.provisionPeer(apiPeer{Name: name, Address: d.Address, Created: d.Created, Person: d.Person})
+	if err != nil {
+		return apiPeer{}, "", err
+	}
+	gen := strconv.Itoa(d.Generation + 1)
+	if err := writeFileAtomic(peerLinkGenerationPath(s.cfg.ConfigDir, name), []byte(gen+"\n"), 0o600); err != nil {
+		return apiPeer{}, "", err
+	}
+	if err := s.forPeer(name).rearmBootstrap(); err != nil {
+		return apiPeer{}, "", err
+	}
+
+	peers := s.loadDeletedPeers()
+	for i := range peers {
+		if peers[i].Name == name {
+			peers = append(peers[:i], peers[i+1:]...)
+			break
+		}
+	}
+	return p, conf, s.saveDeletedPeers(peers)
+}
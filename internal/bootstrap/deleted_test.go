@@ -0,0 +1,89 @@
+package bootstrap
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestDeletedPeerCanBeRestored(t *testing.T) {
+	s := newTestServer(t, nil)
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	p, _, err := s.createPeer(apiPeerDir("laptop"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldLink := "/bootstrap/" + p.Name + "?token=" + s.peerBootstrapToken(p.Name)
+	if err := s.removePeer(p.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.cfg.ConfigDir, p.Name)); !os.IsNotExist(err) {
+		t.Fatalf("keys of the deleted peer kept: %v", err)
+	}
+
+	if _, _, err := s.createPeer(p.Name, ""); err != errPeerDeleted {
+		t.Errorf("re-creating the deleted name: err = %v, want %v", err, errPeerDeleted)
+	}
+	other, _, err := s.createPeer(apiPeerDir("tablet"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Address == p.Address {
+		t.Errorf("new peer got the deleted peer's address %s", p.Address)
+	}
+
+	w := serve(s.apiPeers, http.MethodPost, "/api/peers/"+p.Name+"/restore?token="+testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore: status = %d: %s", w.Code, w.Body)
+	}
+	restored := s.loadAPIPeers()
+	var got apiPeer
+	for _, r := range restored {
+		if r.Name == p.Name {
+			got = r
+		}
+	}
+	if got.Address != p.Address {
+		t.Errorf("restored address = %q, want %q", got.Address, p.Address)
+	}
+	if got.PublicKey == "" || got.PublicKey == p.PublicKey {
+		t.Errorf("restored peer kept its old key %q", got.PublicKey)
+	}
+	if w := serve(s.bootstrapPeer, http.MethodGet, oldLink); w.Code == http.StatusOK {
+		t.Error("link from before the delete opens the restored config")
+	}
+	newLink := "/bootstrap/" + p.Name + "?token=" + s.peerBootstrapToken(p.Name)
+	if w := serve(s.bootstrapPeer, http.MethodGet, newLink); w.Code != http.StatusOK {
+		t.Errorf("new link: status = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(s.apiPeers, http.MethodPost, "/api/peers/"+p.Name+"/restore?token="+testAdminToken); w.Code != http.StatusNotFound {
+		t.Errorf("second restore: status = %d, want 404", w.Code)
+	}
+}
+
+func TestDeleteWithoutCooldownIsFinal(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) { c.PeerDeleteCooldown = 0 })
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	p, _, err := s.createPeer(apiPeerDir("laptop"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.removePeer(p.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.restorePeer(p.Name); err != errPeerNotFound {
+		t.Errorf("restore: err = %v, want %v", err, errPeerNotFound)
+	}
+	again, _, err := s.createPeer(p.Name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Address != p.Address {
+		t.Errorf("address = %s, want the freed %s", again.Address, p.Address)
+	}
+}
@@ -0,0 +1,72 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diagnostics reports the operational health of the volume and the files
+// we keep on it, for debugging from a browser or curl. Requires the
+// bootstrap token.
+func (s Server) diagnostics(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	disk := map[string]any{"path": s.cfg.ConfigDir, "history_paused": s.historyPaused()}
+	if used, total, err := diskUsage(s.cfg.ConfigDir); err != nil {
+		disk["error"] = err.Error()
+	} else {
+		disk["used_bytes"] = used
+		disk["total_bytes"] = total
+		disk["free_bytes"] = total - used
+		disk["reserve_bytes"] = uint64(s.cfg.DiskReserveMB) << 20
+	}
+
+	files := map[string]int64{}
+	for _, p := range []string{
+		s.cfg.FunnelPath(),
+		s.cfg.EventsPath(),
+		s.cfg.MachineEventsPath(),
+		s.cfg.HandshakeHistoryPath(),
+		s.cfg.EndpointHistoryPath(),
+		s.cfg.KeepaliveStatePath(),
+		s.cfg.AlertStatePath(),
+	} {
+		if fi, err := os.Stat(p); err == nil {
+			files[filepath.Base(p)] = fi.Size()
+		}
+	}
+
+	_, peerErr := os.Stat(s.cfg.PeerConfigPath())
+	data := map[string]any{
+		"wireguard_ready":    s.wireGuardReady(),
+		"peer_config":        peerErr == nil,
+		"disk":               disk,
+		"history_file_bytes": files,
+		"activity_signals":   activitySignals(),
+	}
+	if peers, err := s.peerHandshakes(); err == nil {
+		data["peers"] = peers
+	}
+	data["peer_behavior"] = s.peerBehaviorReport()
+	data["stale_peers"] = s.stalePeers()
+	if people := s.peopleSummary(time.Now().Add(-24 * time.Hour)); people != nil {
+		data["people"] = people
+	}
+	data["orphaned_files"] = s.findOrphans()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(data)
+}
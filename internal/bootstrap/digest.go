@@ -0,0 +1,327 @@
+package bootstrap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/notify"
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// digestCheckInterval is how often we check whether a digest is due. The
+// machine sleeps most of the time, so digests go out on the first check
+// after they fall due rather than at a fixed wall-clock time.
+const digestCheckInterval = time.Hour
+
+// digestState remembers when the last digest went out and the session
+// totals at that point, so each digest reports deltas.
+type digestState struct {
+	LastSent       time.Time `json:"last_sent"`
+	Sessions       int       `json:"sessions"`
+	SessionSeconds int64     `json:"session_seconds"`
+	// Usage is each peer's transfer counters by public key.
+	Usage map[string]peerBytes `json:"usage,omitempty"`
+}
+
+// peerBytes is a peer's WireGuard transfer counters.
+type peerBytes struct {
+	Received int64 `json:"received"`
+	Sent     int64 `json:"sent"`
+}
+
+// digestLoop sends a summary of the past period to n whenever one is due.
+func (s Server) digestLoop(n notify.Notifier) {
+	for {
+		if err := s.sendDigestIfDue(n); err != nil {
+			slog.Warn("digest failed", "component", "digest", "error", err)
+		}
+		time.Sleep(digestCheckInterval)
+	}
+}
+
+func (s Server) sendDigestIfDue(n notify.Notifier) error {
+	path := s.cfg.DigestStatePath()
+	var prev digestState
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &prev); err != nil {
+			return fmt.Errorf("corrupt %s: %w", path, err)
+		}
+	}
+
+	now := time.Now()
+	if prev.LastSent.IsZero() {
+		// First run: start the clock rather than summarizing all history.
+		prev.LastSent = now
+		return s.saveDigestState(prev, path)
+	}
+	if now.Sub(prev.LastSent) < s.cfg.DigestPeriod {
+		return nil
+	}
+
+	ka, err := loadKeepaliveState(s.cfg.KeepaliveStatePath())
+	if err != nil {
+		return err
+	}
+	usage := s.peerUsage()
+	msg, err := s.digestMessage(prev, ka, usage, now)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = n.Send(ctx, notify.Event{
+		Event:   "digest",
+		Title:   "VPN digest",
+		Message: msg,
+		App:     s.cfg.EndpointHost,
+		Region:  s.cfg.Region,
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("sent summary", "component", "digest", "from", prev.LastSent.Format(time.RFC3339), "to", now.Format(time.RFC3339))
+
+	return s.saveDigestState(digestState{
+		LastSent:       now,
+		Sessions:       ka.Sessions,
+		SessionSeconds: ka.SessionSeconds,
+		Usage:          usage,
+	}, path)
+}
+
+// peerUsage reads every peer's transfer counters from the interface, or
+// returns nil when it can't.
+func (s Server) peerUsage() map[string]peerBytes {
+	dev, err := wg.Show(s.cfg.WGInterface)
+	if err != nil {
+		slog.Warn("no usage in digest", "component", "digest", "error", err)
+		return nil
+	}
+	out := make(map[string]peerBytes, len(dev.Peers))
+	for _, p := range dev.Peers {
+		out[p.PublicKey] = peerBytes{Received: p.ReceiveBytes, Sent: p.TransmitBytes}
+	}
+	return out
+}
+
+// digestMessage renders the human-readable summary.
+func (s Server) digestMessage(prev digestState, ka keepaliveState, usage map[string]peerBytes, now time.Time) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summary for %s (%s to %s)\n",
+		s.cfg.EndpointHost, prev.LastSent.Format("2006-01-02 15:04"), now.Format("2006-01-02 15:04 MST"))
+
+	connected := time.Duration(ka.SessionSeconds-prev.SessionSeconds) * time.Second
+	fmt.Fprintf(&b, "Sessions: %d new, %s connected\n", ka.Sessions-prev.Sessions, formatDuration(connected))
+
+	counts, during, err := machineEventCounts(s.cfg.MachineEventsPath(), prev.LastSent)
+	if err != nil {
+		return "", err
+	}
+	if counts != nil {
+		fmt.Fprintf(&b, "Machine: %d starts, %d suspends, %d stops", counts["start"], counts["suspend"], counts["stop"])
+		if during > 0 {
+			fmt.Fprintf(&b, " (%d while a client was connected)", during)
+		}
+		b.WriteString("\n")
+	}
+
+	if s.cfg.Analytics {
+		funnel, err := s.funnelCounts(prev.LastSent)
+		if err != nil {
+			return "", err
+		}
+		if len(funnel) > 0 {
+			fmt.Fprintf(&b, "Onboarding: %d opened, %d rejected, %d completed, %d re-fetched, %d first handshakes\n",
+				funnel[funnelOpened], funnel[funnelRejected], funnel[funnelFinalized],
+				funnel[funnelRedelivered], funnel[funnelFirstHandshake])
+		}
+	}
+
+	if p, ok := s.loadRouteProbe(); ok && p.CheckedAt.After(prev.LastSent) && p.State != probeOK {
+		fmt.Fprintf(&b, "Routing: %s at %s (connected, but traffic isn't flowing properly)\n",
+			p.State, p.CheckedAt.Format("2006-01-02 15:04"))
+	}
+
+	for _, p := range s.peopleSummary(prev.LastSent) {
+		fmt.Fprintf(&b, "Person %s: %s connected across %s\n",
+			p.Name, formatDuration(p.ActiveTime), strings.Join(p.Peers, ", "))
+	}
+
+	s.writeUsage(&b, prev.Usage, usage)
+
+	for _, p := range s.stalePeers() {
+		name := p.Peer
+		if name == "" {
+			name = p.PublicKey
+		}
+		if p.Never {
+			fmt.Fprintf(&b, "Stale device: %s has never connected. %s\n", name, p.Suggestion)
+		} else {
+			fmt.Fprintf(&b, "Stale device: %s last seen %s. %s\n", name, p.LastSeen.Format("2006-01-02"), p.Suggestion)
+		}
+	}
+
+	if done, err := os.ReadFile(s.cfg.BootstrapDonePath()); err == nil {
+		fmt.Fprintf(&b, "Bootstrap: completed %s\n", strings.TrimSpace(string(done)))
+	} else if s.cfg.BootstrapToken == "" {
+		b.WriteString("Bootstrap: STILL OPEN and not protected by a token\n")
+	} else {
+		b.WriteString("Bootstrap: still open (token protected)\n")
+	}
+
+	for _, e := range s.upcomingExpirations(now, now.Add(s.cfg.DigestPeriod)) {
+		fmt.Fprintf(&b, "Expires %s: %s\n", e.At.Format("2006-01-02 15:04"), e.What)
+	}
+
+	return b.String(), nil
+}
+
+// writeUsage lists how much each peer transferred since the last digest,
+// busiest first. The counters restart with the interface, so a counter
+// lower than last time counts from zero.
+func (s Server) writeUsage(b *strings.Builder, prev, cur map[string]peerBytes) {
+	names := s.peerNamesByKey()
+	type row struct {
+		name   string
+		rx, tx int64
+	}
+	var rows []row
+	for key, c := range cur {
+		p := prev[key]
+		rx, tx := c.Received-p.Received, c.Sent-p.Sent
+		if rx < 0 || tx < 0 {
+			rx, tx = c.Received, c.Sent
+		}
+		if rx == 0 && tx == 0 {
+			continue
+		}
+		name := names[key]
+		if name == "" {
+			name = key
+		}
+		rows = append(rows, row{name, rx, tx})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if a, b := rows[i].rx+rows[i].tx, rows[j].rx+rows[j].tx; a != b {
+			return a > b
+		}
+		return rows[i].name < rows[j].name
+	})
+	for _, r := range rows {
+		fmt.Fprintf(b, "Usage %s: %s received, %s sent\n", r.name, formatBytes(r.rx), formatBytes(r.tx))
+	}
+}
+
+// expiration is something that stops working on its own.
+type expiration struct {
+	At   time.Time
+	What string
+}
+
+// upcomingExpirations lists what runs out between now and until: minted
+// onboarding links, one-time bootstrap links under BOOTSTRAP_TTL, guest
+// peers, deleted peers that can still be restored, and unanswered device
+// requests. Soonest first.
+func (s Server) upcomingExpirations(now, until time.Time) []expiration {
+	var out []expiration
+	add := func(at time.Time, format string, args ...any) {
+		if at.After(now) && !at.After(until) {
+			out = append(out, expiration{At: at, What: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	tokensMu.Lock()
+	toks := s.loadOnboardingTokens()
+	tokensMu.Unlock()
+	for _, t := range toks {
+		label := t.ID
+		if t.Label != "" {
+			label = t.Label
+		}
+		add(t.Expires, "onboarding link %q for %s", label, t.Peer)
+	}
+
+	if s.cfg.BootstrapTTL > 0 {
+		for _, peer := range append([]string{s.cfg.PeerName}, s.sheetPeers("")...) {
+			ps := s
+			if peer != s.cfg.PeerName {
+				ps = s.forPeer(peer)
+			}
+			if ps.bootstrapDone() {
+				continue
+			}
+			bootstrapMu.Lock()
+			opened, ok := ps.bootstrapOpenedAt()
+			bootstrapMu.Unlock()
+			if ok {
+				add(opened.Add(s.cfg.BootstrapTTL), "bootstrap link for %s (BOOTSTRAP_TTL)", peer)
+			}
+		}
+	}
+
+	for _, p := range s.guestPeers() {
+		add(p.Expires, "guest peer %s (GUEST_PEER_TTL)", p.Name)
+	}
+	for _, d := range s.loadDeletedPeers() {
+		add(d.Deleted.Add(s.cfg.PeerDeleteCooldown), "last chance to restore deleted peer %s (PEER_DELETE_COOLDOWN)", d.Name)
+	}
+	if s.cfg.DeviceRequests {
+		for _, dr := range s.pendingDeviceRequests() {
+			add(dr.Created.Add(deviceRequestTTL), "unanswered device request for %s from %s", dr.Device, dr.Client)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// machineEventCounts tallies recorded machine events since t by type and
+// counts stop/suspend events flagged as happening during a session. It
+// returns a nil map if no events have been recorded at all.
+func machineEventCounts(path string, since time.Time) (map[string]int, int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	counts := make(map[string]int)
+	during := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec machineEventRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Time().Before(since) {
+			continue
+		}
+		counts[rec.Type]++
+		if rec.DuringSession {
+			during++
+		}
+	}
+	return counts, during, scanner.Err()
+}
+
+func (s Server) saveDigestState(st digestState, path string) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestDigestReportsUsage(t *testing.T) {
+	s := newTestServer(t, nil)
+	for peer, key := range map[string]string{"peer1": "KEY1", "peer2": "KEY2"} {
+		if err := os.WriteFile(filepath.Join(s.cfg.ConfigDir, peer, "publickey-"+peer), []byte(key+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		prev, cur map[string]peerBytes
+		want      []string
+		absent    []string
+	}{
+		{
+			name: "delta since the last digest, busiest first",
+			prev: map[string]peerBytes{"KEY1": {Received: 1000, Sent: 1000}, "KEY2": {Received: 0, Sent: 0}},
+			cur:  map[string]peerBytes{"KEY1": {Received: 3048, Sent: 1000}, "KEY2": {Received: 5 << 20, Sent: 1 << 20}},
+			want: []string{"Usage peer2: 5.0 MiB received, 1.0 MiB sent\nUsage peer1: 2.0 KiB received, 0 B sent\n"},
+		},
+		{
+			name: "counters reset by an interface restart",
+			prev: map[string]peerBytes{"KEY1": {Received: 1 << 30, Sent: 1 << 30}},
+			cur:  map[string]peerBytes{"KEY1": {Received: 2048, Sent: 1024}},
+			want: []string{"Usage peer1: 2.0 KiB received, 1.0 KiB sent"},
+		},
+		{
+			name:   "idle and unknown peers",
+			prev:   map[string]peerBytes{"KEY1": {Received: 10, Sent: 10}},
+			cur:    map[string]peerBytes{"KEY1": {Received: 10, Sent: 10}, "OTHER": {Received: 1024}},
+			want:   []string{"Usage OTHER: 1.0 KiB received"},
+			absent: []string{"Usage peer1"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			s.writeUsage(&b, tc.prev, tc.cur)
+			for _, w := range tc.want {
+				if !strings.Contains(b.String(), w) {
+					t.Errorf("usage lacks %q:\n%s", w, b.String())
+				}
+			}
+			for _, a := range tc.absent {
+				if strings.Contains(b.String(), a) {
+					t.Errorf("usage has %q:\n%s", a, b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestDigestListsUpcomingExpirations(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.BootstrapTTL = 30 * time.Hour
+		c.GuestClaimCode = "blue-door"
+		c.GuestPeerTTL = 2 * time.Hour
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	now := time.Now()
+
+	if _, _, err := s.mintOnboardingToken("peer2", "Alice", 3*time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.mintOnboardingToken("peer2", "Bob", 72*time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	guest, err := s.claimGuest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(s.bootstrapCreatedPath(), []byte(now.Add(-10*time.Hour).UTC().Format(time.RFC3339)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.forPeer("peer2").bootstrapDonePath(), []byte("done"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, e := range s.upcomingExpirations(now, now.Add(24*time.Hour)) {
+		got = append(got, e.What)
+	}
+	want := []string{
+		"guest peer " + guest.Name + " (GUEST_PEER_TTL)",
+		`onboarding link "Alice" for peer2`,
+		"bootstrap link for peer1 (BOOTSTRAP_TTL)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expirations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,70 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// disconnectRequests carries client-announced disconnects to the
+// keepalive loop. One pending request is enough; extras are dropped.
+var disconnectRequests = make(chan struct{}, 1)
+
+// disconnect lets a client say it is going away on purpose (e.g. from a
+// wg-quick PostDown hook). When no other peer is connected, the keepalive
+// loop then closes the session and stops pinging right away instead of
+// waiting out KEEPALIVE_MAX_IDLE. Requires the peer's client token, so a
+// device can only speak for itself.
+func (s Server) disconnect(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	peer, ok := s.clientPeer(r)
+	if !ok {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+
+	others, err := s.otherPeersActive(peer)
+	if err != nil {
+		// Without handshakes we can't tell whether someone else is still
+		// using the tunnel; the idle timeout will decide instead.
+		slog.Warn("could not read handshakes; ignoring disconnect", "component", "disconnect", "peer", peer, "error", err, "request_id", requestID(r))
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("disconnect noted; keepalive continues\n"))
+		return
+	}
+	if others > 0 {
+		slog.Info("client announced a disconnect; other peers still connected", "component", "disconnect", "peer", peer, "active_peers", others, "request_id", requestID(r))
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("disconnect noted; other peers still connected\n"))
+		return
+	}
+
+	select {
+	case disconnectRequests <- struct{}{}:
+	default:
+	}
+	slog.Info("client announced a disconnect", "component", "disconnect", "peer", peer, "request_id", requestID(r))
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("disconnect noted\n"))
+}
+
+// otherPeersActive counts the peers, other than peer and infrastructure
+// peers, with a handshake within KEEPALIVE_MAX_IDLE.
+func (s Server) otherPeersActive(peer string) (int, error) {
+	hs, err := wireGuardHandshakes(s.cfg.WGInterface)
+	if err != nil {
+		return 0, err
+	}
+	ignore := s.infraPeerKeys()
+	if key, err := s.peerPublicKey(peer); err == nil {
+		ignore[key] = true
+	}
+	return activePeers(hs, ignore, s.cfg.KeepaliveMaxIdle), nil
+}
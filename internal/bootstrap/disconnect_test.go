@@ -0,0 +1,79 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestDisconnectIsPeerScoped(t *testing.T) {
+	keys := map[string]string{
+		"peer1": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+		"peer2": "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBA=",
+		"relay": "CCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCCA=",
+	}
+	recent := time.Now().Add(-30 * time.Second).Unix()
+	stale := time.Now().Add(-time.Hour).Unix()
+
+	cases := []struct {
+		name   string
+		active []string // peers with a recent handshake
+		token  func(Server) string
+		status int
+		stops  bool
+	}{
+		{"only the caller connected", []string{"peer1"}, func(s Server) string { return s.peerClientToken("peer1") }, 202, true},
+		{"another peer connected", []string{"peer1", "peer2"}, func(s Server) string { return s.peerClientToken("peer1") }, 202, false},
+		{"only infrastructure left", []string{"peer1", "relay"}, func(s Server) string { return s.peerClientToken("peer1") }, 202, true},
+		{"another peer's token", []string{"peer1"}, func(s Server) string { return s.peerClientToken("peer2") }, 401, false},
+		{"admin token", []string{"peer1"}, func(Server) string { return testAdminToken }, 401, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *config.Config) { c.InfraPeers = []string{"relay"} })
+			dump := "priv\tpub\t51820\toff\n"
+			for _, peer := range []string{"peer1", "peer2", "relay"} {
+				writeTestPeer(t, s.cfg.ConfigDir, peer, testPeerConf)
+				if err := os.WriteFile(filepath.Join(s.cfg.ConfigDir, peer, "publickey-"+peer), []byte(keys[peer]+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				ts := stale
+				for _, a := range tc.active {
+					if a == peer {
+						ts = recent
+					}
+				}
+				dump += fmt.Sprintf("%s\t(none)\t(none)\t10.13.13.2/32\t%d\t0\t0\toff\n", keys[peer], ts)
+			}
+			fakeWG(t, dump)
+
+			select {
+			case <-disconnectRequests:
+			default:
+			}
+			r := httptest.NewRequest(http.MethodPost, "/disconnect?peer=peer1", nil)
+			r.Header.Set("Authorization", "Bearer "+tc.token(s))
+			w := httptest.NewRecorder()
+			s.disconnect(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			select {
+			case <-disconnectRequests:
+				if !tc.stops {
+					t.Error("keepalive was told to stop")
+				}
+			default:
+				if tc.stops {
+					t.Error("keepalive was not told to stop")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// discoveryPath is the well-known document client tooling reads first.
+const discoveryPath = "/.well-known/wgvpn.json"
+
+// discovery serves a public description of this deployment so a CLI or
+// third-party client can configure itself from the hostname alone. It
+// holds nothing that isn't already observable from outside: the endpoint
+// is in DNS and the routes answer 401/404 either way.
+func (s Server) discovery(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+
+	auth := []string{}
+	if s.cfg.BootstrapToken != "" {
+		auth = append(auth, "bearer", "query:token")
+	}
+
+	formats := exportFormatNames()
+	for _, f := range qrFormats {
+		formats = append(formats, "qr:"+f.Name)
+	}
+
+	doc := map[string]any{
+		"version":      1,
+		"api_base_url": base + "/api/v1",
+		"auth_methods": auth,
+		"endpoint": map[string]string{
+			"host": s.cfg.ClientEndpointHost(),
+			"port": s.cfg.EndpointPort,
+		},
+		"export_formats": formats,
+		"urls": map[string]string{
+			"bootstrap":       base + "/bootstrap",
+			"client_settings": base + "/client-settings",
+			"capabilities":    base + "/api/v1/capabilities",
+			"export":          base + "/export/{format}",
+		},
+	}
+	if s.cfg.SignConfigs {
+		doc["signing_key_url"] = base + signingKeyPath
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "max-age=300")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(doc)
+}
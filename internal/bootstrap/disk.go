@@ -0,0 +1,44 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"syscall"
+)
+
+// diskUsage reports used and total bytes of the filesystem holding path.
+// "Used" counts space reserved for root as used, matching what df shows
+// as unavailable to the sidecar.
+func diskUsage(path string) (used, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	bsize := uint64(st.Bsize)
+	total = st.Blocks * bsize
+	return total - st.Bavail*bsize, total, nil
+}
+
+// historyPausedFlag remembers the last verdict so transitions are logged
+// once rather than on every write.
+var historyPausedFlag atomic.Bool
+
+// historyPaused reports whether free space on the volume has dropped
+// below DISK_RESERVE_MB. Append-only history (funnel, event journal,
+// machine events) stops growing then, so the space that's left goes to
+// what matters: the peer config, bootstrap markers and keepalive state.
+func (s Server) historyPaused() bool {
+	used, total, err := diskUsage(s.cfg.ConfigDir)
+	if err != nil {
+		return false
+	}
+	paused := total-used < uint64(s.cfg.DiskReserveMB)<<20
+	if historyPausedFlag.Swap(paused) != paused {
+		if paused {
+			slog.Warn("low on disk space; pausing history writes", "component", "disk", "dir", s.cfg.ConfigDir, "reserve_mb", s.cfg.DiskReserveMB)
+		} else {
+			slog.Info("free space recovered; resuming history writes", "component", "disk", "dir", s.cfg.ConfigDir)
+		}
+	}
+	return paused
+}
@@ -0,0 +1,176 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/notify"
+)
+
+// maxPreviousHosts bounds the hostname history kept in the record.
+const maxPreviousHosts = 10
+
+// endpointRecord is the client-facing endpoint and tunnel subnet we last
+// served, persisted so a change between deploys can be detected at boot.
+type endpointRecord struct {
+	Host       string    `json:"host"`
+	Port       string    `json:"port"`
+	Subnet     string    `json:"subnet,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+
+	// The deployment's identity: the hostname clients dial, the first
+	// one ever recorded, and the ones it has been renamed away from.
+	ClientHost    string   `json:"client_host,omitempty"`
+	OriginalHost  string   `json:"original_host,omitempty"`
+	PreviousHosts []string `json:"previous_hosts,omitempty"`
+}
+
+// checkEndpointChange compares the configured endpoint port and tunnel
+// subnet with the ones recorded on the previous boot. Configs already
+// handed out still carry the old values (the sidecar re-renders its copy
+// when INTERNAL_SUBNET changes), so a change re-arms every peer's one-time
+// bootstrap link to let each fetch an updated config. The record is then
+// updated.
+func (s Server) checkEndpointChange() {
+	path := s.cfg.EndpointRecordPath()
+	cur := endpointRecord{
+		Host:       s.cfg.EndpointHost,
+		Port:       s.cfg.EndpointPort,
+		Subnet:     s.cfg.TunnelSubnet,
+		ClientHost: s.cfg.ClientEndpointHost(),
+	}
+
+	var prev endpointRecord
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// First boot with this feature; nothing to compare against.
+	case err != nil:
+		slog.Warn("cannot read endpoint record", "component", "endpoint", "path", path, "error", err)
+		return
+	default:
+		if err := json.Unmarshal(b, &prev); err != nil {
+			slog.Warn("ignoring corrupt endpoint record", "component", "endpoint", "path", path, "error", err)
+		}
+	}
+
+	cur.OriginalHost = prev.OriginalHost
+	if cur.OriginalHost == "" {
+		cur.OriginalHost = cur.ClientHost
+	}
+	cur.PreviousHosts = prev.PreviousHosts
+
+	stale := false
+	if prev.ClientHost != "" && cur.ClientHost != "" && prev.ClientHost != cur.ClientHost {
+		cur.PreviousHosts = append(cur.PreviousHosts, prev.ClientHost)
+		if len(cur.PreviousHosts) > maxPreviousHosts {
+			cur.PreviousHosts = cur.PreviousHosts[len(cur.PreviousHosts)-maxPreviousHosts:]
+		}
+		s.migrateHost(prev.ClientHost, cur.ClientHost)
+		stale = true
+	}
+	if prev.Port != "" && prev.Port != cur.Port {
+		slog.Warn("port changed; existing client configs are stale", "component", "endpoint", "old", prev.Port, "new", cur.Port)
+		stale = true
+	}
+	if prev.Subnet != "" && prev.Subnet != cur.Subnet {
+		slog.Warn("tunnel subnet changed; existing client configs are stale", "component", "endpoint", "old", prev.Subnet, "new", cur.Subnet)
+		stale = true
+	}
+	if stale {
+		s.rearmAllPeers()
+	}
+
+	if prev.Host == cur.Host && prev.Port == cur.Port && prev.Subnet == cur.Subnet &&
+		prev.ClientHost == cur.ClientHost && prev.OriginalHost == cur.OriginalHost {
+		return
+	}
+	cur.RecordedAt = time.Now()
+	b, err = json.MarshalIndent(cur, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		slog.Warn("failed to record endpoint", "component", "endpoint", "error", err)
+	}
+}
+
+// rearmAllPeers re-arms the bootstrap link of every peer that isn't
+// revoked. As in rotatePeer, each peer's link generation is bumped first,
+// so links and onboarding tokens from before the change don't open the
+// new config; the new links are on /admin and /bootstrap/sheet.
+func (s Server) rearmAllPeers() {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+
+	peers := append([]string{s.cfg.PeerName}, s.sheetPeers("")...)
+	for _, p := range s.cfg.InfraPeers {
+		if p != s.cfg.PeerName && isPeerDir(filepath.Join(s.cfg.ConfigDir, p), p) {
+			peers = append(peers, p)
+		}
+	}
+	var rearmed []string
+	for _, peer := range peers {
+		if s.peerRevoked(peer) {
+			continue
+		}
+		if err := s.bumpPeerLinkGeneration(peer); err != nil {
+			slog.Error("failed to re-arm bootstrap", "component", "endpoint", "peer", peer, "error", err)
+			continue
+		}
+		// rearmBootstrap also restarts the BOOTSTRAP_TTL window and drops
+		// the re-delivery record of the old config.
+		if err := s.forPeer(peer).rearmBootstrap(); err != nil {
+			slog.Error("failed to re-arm bootstrap", "component", "endpoint", "peer", peer, "error", err)
+			continue
+		}
+		rearmed = append(rearmed, peer)
+	}
+	if len(rearmed) == 0 {
+		return
+	}
+	slog.Info("re-armed bootstrap links so peers can re-onboard", "component", "endpoint", "event", eventBootstrapRearm, "peers", strings.Join(rearmed, ","))
+	s.recordEvent(eventBootstrapRearm, "Bootstrap re-armed for %s after an endpoint or subnet change", strings.Join(rearmed, ", "))
+}
+
+// migrateHost handles a changed client-facing hostname, usually a Fly app
+// rename (FLY_APP_NAME) without a custom BOOTSTRAP_ENDPOINT_HOST. Every
+// config handed out still dials the old name, which stops resolving, so
+// the caller re-arms every peer's link; the peers are listed so they can
+// be re-onboarded from /bootstrap/sheet.
+func (s Server) migrateHost(from, to string) {
+	slog.Warn("hostname changed; existing client configs point at a name that may no longer resolve", "component", "endpoint", "old", from, "new", to)
+
+	msg := fmt.Sprintf("Endpoint hostname changed from %s to %s. Re-import the config on every device.", from, to)
+	if others := s.sheetPeers(""); len(others) > 0 {
+		msg += fmt.Sprintf(" Peers to re-onboard besides %s: %s (new links on /bootstrap/sheet).", s.cfg.PeerName, strings.Join(others, ", "))
+	}
+	s.recordEvent(eventHostChanged, "%s", msg)
+
+	n := notify.New(s.cfg.AlertNotifyURL, s.cfg.AlertNotifyFormat)
+	if !n.Enabled() {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err := n.Send(ctx, notify.Event{
+			Event:   "host_changed",
+			Title:   "VPN hostname changed",
+			Message: msg,
+			App:     s.cfg.EndpointHost,
+			Region:  s.cfg.Region,
+		})
+		if err != nil {
+			slog.Warn("hostname change notification failed", "component", "endpoint", "error", err)
+		}
+	}()
+}
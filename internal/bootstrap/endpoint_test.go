@@ -0,0 +1,81 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// writeEndpointRecord stores rec as the previous boot's endpoint.
+func writeEndpointRecord(t *testing.T, s Server, rec endpointRecord) {
+	t.Helper()
+	b, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.cfg.EndpointRecordPath(), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEndpointChangeRearmsWithFreshTTL(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.EndpointPort = "443"
+		c.BootstrapTTL = time.Hour
+		c.RedeliveryWindow = time.Hour
+	})
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	for path, content := range map[string]string{
+		s.cfg.BootstrapDonePath():    old,
+		s.cfg.BootstrapCreatedPath(): old,
+		s.cfg.RedeliveryPath():       `{"fingerprint":"x","served_at":"` + old + `"}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeEndpointRecord(t, s, endpointRecord{Port: "51820", Subnet: s.cfg.TunnelSubnet})
+
+	s.checkEndpointChange()
+
+	if s.bootstrapDone() {
+		t.Error("bootstrap still marked done")
+	}
+	if s.bootstrapExpired() {
+		t.Error("re-armed link is already past BOOTSTRAP_TTL")
+	}
+	if _, err := os.Stat(s.cfg.RedeliveryPath()); !os.IsNotExist(err) {
+		t.Errorf("re-delivery record of the old config kept: %v", err)
+	}
+}
+
+func TestEndpointChangeRearmsEveryPeer(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) { c.EndpointPort = "443" })
+	peer2 := s.forPeer("peer2")
+	for _, p := range []Server{s, peer2} {
+		if err := os.WriteFile(p.bootstrapDonePath(), []byte("done"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldLink := "/bootstrap/peer2?token=" + s.peerBootstrapToken("peer2")
+	writeEndpointRecord(t, s, endpointRecord{Port: "51820", Subnet: s.cfg.TunnelSubnet})
+
+	s.checkEndpointChange()
+
+	for _, p := range []Server{s, peer2} {
+		if p.bootstrapDone() {
+			t.Errorf("%s: bootstrap still marked done", p.cfg.PeerName)
+		}
+	}
+	if w := serve(s.bootstrapPeer, http.MethodGet, oldLink); w.Code == http.StatusOK {
+		t.Error("per-peer link from before the change still opens the page")
+	}
+	newLink := "/bootstrap/peer2?token=" + s.peerBootstrapToken("peer2")
+	if w := serve(s.bootstrapPeer, http.MethodGet, newLink); w.Code != http.StatusOK {
+		t.Errorf("new per-peer link: status = %d: %s", w.Code, w.Body)
+	}
+}
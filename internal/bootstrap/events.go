@@ -0,0 +1,244 @@
+package bootstrap
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operational events worth an operator's attention.
+const (
+	eventBootstrapServed = "bootstrap_served"
+	eventPeerAdded       = "peer_added"
+	eventPeerRemoved     = "peer_removed"
+	eventKeyRotated      = "key_rotated"
+	eventPeerRevoked     = "peer_revoked"
+	eventBootstrapRearm  = "bootstrap_rearmed"
+	eventBootstrapPushed = "bootstrap_pushed"
+	eventAllowedIPs      = "allowed_ips_changed"
+	eventRoutingBroken   = "routing_broken"
+	eventSheetPrinted    = "qr_sheet_rendered"
+	eventHostChanged     = "host_changed"
+	eventKitDownloaded   = "recovery_kit_downloaded"
+	eventTokenLockout    = "token_lockout"
+	eventConfigExported  = "config_exported"
+	eventPeerRestored    = "peer_restored"
+	eventDeviceRequested = "device_requested"
+	eventRequestDecided  = "device_request_decided"
+	eventGuestClaimed    = "guest_claimed"
+	eventGuestExpired    = "guest_expired"
+)
+
+// maxEvents bounds the journal; the feed only ever shows recent entries.
+const maxEvents = 200
+
+type opEvent struct {
+	Kind    string    `json:"kind"`
+	Summary string    `json:"summary"`
+	Time    time.Time `json:"time"`
+}
+
+var eventsMu sync.Mutex
+
+// recordEvent appends an entry to the event journal behind /events.atom.
+// Entries are dropped while the volume is nearly full.
+func (s Server) recordEvent(kind, format string, args ...any) {
+	if s.historyPaused() {
+		return
+	}
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	events, err := readEvents(s.cfg.EventsPath())
+	if err != nil {
+		slog.Warn("cannot read events", "component", "events", "error", err)
+		return
+	}
+	events = append(events, opEvent{Kind: kind, Summary: fmt.Sprintf(format, args...), Time: time.Now()})
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+
+	f, err := os.OpenFile(s.cfg.EventsPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Warn("cannot write events", "component", "events", "error", err)
+		return
+	}
+	enc := json.NewEncoder(f)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			break
+		}
+	}
+	if err := f.Close(); err != nil {
+		slog.Warn("cannot write events", "component", "events", "error", err)
+	}
+}
+
+func readEvents(path string) ([]opEvent, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []opEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev opEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) == nil {
+			events = append(events, ev)
+		}
+	}
+	return events, scanner.Err()
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomEntry struct {
+	Title    string       `xml:"title"`
+	ID       string       `xml:"id"`
+	Updated  string       `xml:"updated"`
+	Category atomCategory `xml:"category"`
+	Content  string       `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// eventListSpec is what GET /api/events filters and sorts on. Times use
+// a fixed-width layout so they sort as text.
+var eventListSpec = listSpec{
+	idField:     "time",
+	filters:     []string{"kind"},
+	defaultSort: "-time",
+}
+
+const eventTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// apiEvents serves GET /api/events, the event journal as JSON, newest
+// first and paged, for scripts that walk the audit trail rather than
+// follow the Atom feed. Requires an admin token.
+func (s Server) apiEvents(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	if r.Method != http.MethodGet {
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+	lq, err := parseListQuery(r, eventListSpec)
+	if err != nil {
+		httpError(w, r, err.Error(), 400)
+		return
+	}
+
+	eventsMu.Lock()
+	events, err := readEvents(s.cfg.EventsPath())
+	eventsMu.Unlock()
+	if err != nil {
+		httpError(w, r, "cannot read events", 500)
+		return
+	}
+	out := make([]map[string]any, 0, len(events))
+	for _, ev := range events {
+		out = append(out, map[string]any{
+			"time":    ev.Time.UTC().Format(eventTimeLayout),
+			"kind":    ev.Kind,
+			"summary": ev.Summary,
+		})
+	}
+	out, next := lq.page(out)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{"events": out, "next_cursor": next})
+}
+
+// eventsFeed serves the event journal as Atom, newest first, so operators
+// can follow it in a feed reader. Feed readers rarely support headers, so
+// ?token= works as well as a bearer token. Disabled without a token.
+func (s Server) eventsFeed(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	eventsMu.Lock()
+	events, err := readEvents(s.cfg.EventsPath())
+	eventsMu.Unlock()
+	if err != nil {
+		httpError(w, r, "cannot read events", 500)
+		return
+	}
+
+	name := s.cfg.ClientEndpointHost()
+	if name == "" {
+		name = "wireguard-vpn"
+	}
+	feed := atomFeed{
+		Title:   "VPN events: " + name,
+		ID:      "tag:" + name + ",2024:events",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: s.baseURL(r) + "/events.atom", Rel: "self"},
+		Author:  atomAuthor{Name: name},
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		ev := events[i]
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:    ev.Summary,
+			ID:       fmt.Sprintf("tag:%s,2024:event/%d", name, ev.Time.UnixNano()),
+			Updated:  ev.Time.UTC().Format(time.RFC3339),
+			Category: atomCategory{Term: ev.Kind},
+			Content:  ev.Summary,
+		})
+	}
+	if len(events) > 0 {
+		feed.Updated = events[len(events)-1].Time.UTC().Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	_ = enc.Encode(feed)
+}
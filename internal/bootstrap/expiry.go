@@ -0,0 +1,93 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// servedPages tracks bootstrap pages rendered with BOOTSTRAP_PAGE_EXPIRY
+// so that, when a page's countdown runs out, everything it handed out can
+// be withdrawn at the same moment the tab clears itself.
+var servedPages = struct {
+	sync.Mutex
+	expires    map[string]time.Time
+	redelivery map[string]string // re-delivery record each page is covered by
+}{expires: map[string]time.Time{}, redelivery: map[string]string{}}
+
+type pageIDKey struct{}
+
+// startExpiringPage registers a new page and returns r carrying its ID, so
+// fetch links issued while rendering are tied to it. A timer expires the
+// page server-side even if the tab is closed before the countdown ends.
+func (s Server) startExpiringPage(r *http.Request) (*http.Request, string) {
+	var b [18]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return r, ""
+	}
+	id := base64.RawURLEncoding.EncodeToString(b[:])
+
+	servedPages.Lock()
+	servedPages.expires[id] = time.Now().Add(s.cfg.PageExpiry)
+	servedPages.redelivery[id] = s.redeliveryPath()
+	servedPages.Unlock()
+	time.AfterFunc(s.cfg.PageExpiry, func() { s.expirePage(id, "timer") })
+
+	return r.WithContext(context.WithValue(r.Context(), pageIDKey{}, id)), id
+}
+
+// pageID returns the expiring page r is rendering, or "".
+func pageID(r *http.Request) string {
+	id, _ := r.Context().Value(pageIDKey{}).(string)
+	return id
+}
+
+// expirePage revokes the page's one-time download links and closes the
+// re-delivery window, so reloading the page on a shared computer can't
+// bring the config back. It is idempotent; the second caller (timer or
+// tab) finds nothing left to do.
+func (s Server) expirePage(id, by string) bool {
+	servedPages.Lock()
+	_, ok := servedPages.expires[id]
+	rdPath := servedPages.redelivery[id]
+	delete(servedPages.expires, id)
+	delete(servedPages.redelivery, id)
+	servedPages.Unlock()
+	if !ok {
+		return false
+	}
+
+	n := fetchLinks.revokePage(id) + kitLinks.revokePage(id)
+
+	bootstrapMu.Lock()
+	err := os.Remove(rdPath)
+	bootstrapMu.Unlock()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("page expired but re-delivery record could not be removed", "component", "bootstrap", "error", err)
+	}
+
+	slog.Info("served page expired", "component", "bootstrap", "by", by, "revoked_links", n)
+	return true
+}
+
+// bootstrapExpire is called by the page itself when its countdown ends or
+// the visitor clears it early. The page ID is an unguessable capability
+// handed only to that page, so no token is needed.
+func (s Server) bootstrapExpire(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+	if !s.expirePage(r.URL.Query().Get("page"), "page") {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
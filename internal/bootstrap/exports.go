@@ -0,0 +1,166 @@
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"text/template"
+
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// exportPeer is the canonical peer model every export template renders
+// from, parsed once from the served wg-quick config.
+type exportPeer struct {
+	Name                string
+	Conf                string
+	PrivateKey          string
+	IPv4, IPv6          []string // CIDRs, /32 or /128 when the sidecar wrote bare addresses
+	DNS                 []string
+	MTU                 string
+	PublicKey           string
+	PresharedKey        string
+	Endpoint            string
+	EndpointHost        string
+	EndpointPort        string
+	AllowedIPs          []string
+	PersistentKeepalive string
+
+	// Fresh per render; profiles need them but nothing tracks them.
+	UUID, UUID2 string
+}
+
+// exportFormat is one downloadable representation of the peer. Adding a
+// format is a template in internal/ui plus an entry here.
+type exportFormat struct {
+	Name        string
+	Label       string
+	ContentType string
+	Ext         string
+	tmpl        *template.Template
+}
+
+var exportFormats = []exportFormat{
+	{"conf", "WireGuard config (wg-quick, all official apps)", "text/plain; charset=utf-8", ".conf", ui.ExportConf},
+	{"nmconnection", "NetworkManager connection (Linux desktops)", "text/plain; charset=utf-8", ".nmconnection", ui.ExportNMConnection},
+	{"routeros", "MikroTik RouterOS script", "text/plain; charset=utf-8", ".rsc", ui.ExportRouterOS},
+	{"mobileconfig", "Apple configuration profile (iOS, macOS)", "application/x-apple-aspen-config", ".mobileconfig", ui.ExportMobileConfig},
+}
+
+func findExportFormat(name string) (exportFormat, bool) {
+	for _, f := range exportFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return exportFormat{}, false
+}
+
+func exportFormatNames() []string {
+	names := make([]string, len(exportFormats))
+	for i, f := range exportFormats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// newExportPeer builds the canonical model from a served config.
+func newExportPeer(name, conf string) exportPeer {
+	iface, peer := parseConfSections(conf)
+	p := exportPeer{
+		Name:                name,
+		Conf:                conf,
+		PrivateKey:          iface["PrivateKey"],
+		DNS:                 splitList(iface["DNS"]),
+		MTU:                 iface["MTU"],
+		PublicKey:           peer["PublicKey"],
+		PresharedKey:        peer["PresharedKey"],
+		Endpoint:            peer["Endpoint"],
+		AllowedIPs:          splitList(peer["AllowedIPs"]),
+		PersistentKeepalive: peer["PersistentKeepalive"],
+		UUID:                newUUID(),
+		UUID2:               newUUID(),
+	}
+	p.EndpointHost, p.EndpointPort, _ = splitEndpoint(p.Endpoint)
+	for _, a := range splitList(iface["Address"]) {
+		pfx, err := netip.ParsePrefix(a)
+		if err != nil {
+			addr, err := netip.ParseAddr(a)
+			if err != nil {
+				continue
+			}
+			pfx = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if pfx.Addr().Is4() {
+			p.IPv4 = append(p.IPv4, pfx.String())
+		} else {
+			p.IPv6 = append(p.IPv6, pfx.String())
+		}
+	}
+	return p
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// export serves /export/<format>: the peer's config in any registered
+// format. The output contains the private key, so it shares the bootstrap
+// token, is disabled without one, and like /bootstrap is only reachable
+// over 6PN in private-only mode. Unlike the one-time page it can be
+// fetched repeatedly, so every download goes into the event feed.
+func (s Server) export(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" || (s.cfg.PrivateOnly && !isPrivateNetworkRequest(r)) {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	f, ok := findExportFormat(strings.TrimPrefix(r.URL.Path, "/export/"))
+	if !ok {
+		httpError(w, r, "unknown export format; try one of "+strings.Join(exportFormatNames(), ", "), 404)
+		return
+	}
+
+	conf, err := s.peerConfig()
+	if err != nil {
+		httpError(w, r, "config not ready", 503)
+		return
+	}
+	var buf bytes.Buffer
+	if err := f.tmpl.Execute(&buf, newExportPeer(s.cfg.PeerName, conf)); err != nil {
+		slog.Error("export failed", "component", "export", "format", f.Name, "error", err, "request_id", requestID(r))
+		httpError(w, r, "export failed", 500)
+		return
+	}
+	slog.Info("served export", "component", "export", "event", eventConfigExported, "format", f.Name, "peer", s.cfg.PeerName,
+		"client", s.clientIP(r), "request_id", requestID(r))
+	s.recordEvent(eventConfigExported, "Config for %s downloaded as %s from %s", s.cfg.PeerName, f.Name, s.clientIP(r))
+
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.cfg.PeerName+f.Ext))
+	w.Header().Set("Cache-Control", "no-store")
+	s.signResponse(w, r, buf.Bytes())
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,71 @@
+package bootstrap
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// serveOn is serve with the request arriving on local address ip, which
+// is how isPrivateNetworkRequest tells 6PN from the public proxy.
+// A non-empty body makes it a POST.
+func serveOn(h http.HandlerFunc, ip, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if body != "" {
+		r = httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	}
+	r.RemoteAddr = "198.51.100.7:40000"
+	local := &net.TCPAddr{IP: net.ParseIP(ip), Port: 8081}
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, net.Addr(local)))
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// Routes that hand out private keys must honour BOOTSTRAP_PRIVATE_ONLY
+// the same way /bootstrap does.
+func TestKeyRoutesArePrivateOnly(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) { c.PrivateOnly = true })
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	tok := "?token=" + testAdminToken
+
+	cases := []struct {
+		name         string
+		handler      http.HandlerFunc
+		target, body string
+		want         int
+	}{
+		{"export", s.export, "/export/conf" + tok, "", http.StatusOK},
+		{"sheet", s.bootstrapSheet, "/bootstrap/sheet" + tok, "", http.StatusOK},
+		{"create peer", s.apiPeers, "/api/peers" + tok, `{"name": "laptop"}`, http.StatusCreated},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := serveOn(tc.handler, "172.19.0.2", tc.target, tc.body); w.Code != http.StatusNotFound {
+				t.Errorf("through the public proxy: status = %d, want 404", w.Code)
+			}
+			if w := serveOn(tc.handler, "fdaa:0:1::2", tc.target, tc.body); w.Code != tc.want {
+				t.Errorf("over 6PN: status = %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestExportIsRecorded(t *testing.T) {
+	s := newTestServer(t, nil)
+	if w := serve(s.export, http.MethodGet, "/export/conf?token="+testAdminToken); w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	events, err := readEvents(s.cfg.EventsPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != eventConfigExported || !strings.Contains(events[0].Summary, "198.51.100.7") {
+		t.Errorf("events = %+v, want one %s naming the client", events, eventConfigExported)
+	}
+}
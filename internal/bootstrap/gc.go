@@ -0,0 +1,114 @@
+package bootstrap
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// orphan is a file or directory on the volume that no current peer owns.
+type orphan struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// expectedPeers is the set of peer directory names the sidecar generates
+// for the current PEERS value: "3" means peer1..peer3, a list such as
+// "phone,laptop" means peer_phone and peer_laptop. The served peer is
+// always kept, even if PEERS disagrees, and so are peers created through
+// /api/peers. It returns nil when PEERS isn't visible to this process, in
+// which case no peer directory is an orphan.
+func (s Server) expectedPeers() map[string]bool {
+	v := strings.TrimSpace(os.Getenv("PEERS"))
+	if v == "" {
+		return nil
+	}
+	want := map[string]bool{s.cfg.PeerName: true}
+	for _, p := range s.loadAPIPeers() {
+		want[p.Name] = true
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		for i := 1; i <= n; i++ {
+			want["peer"+strconv.Itoa(i)] = true
+		}
+		return want
+	}
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			want["peer_"+name] = true
+		}
+	}
+	return want
+}
+
+// findOrphans lists peer directories the current PEERS no longer covers,
+// stray QR images inside live peer directories, and temp files left by
+// interrupted writes. Anything that doesn't look like a peer directory
+// (the sidecar's server/, wg_confs/, templates/ ...) is never touched.
+func (s Server) findOrphans() []orphan {
+	want := s.expectedPeers()
+	entries, err := os.ReadDir(s.cfg.ConfigDir)
+	if err != nil {
+		return nil
+	}
+
+	var out []orphan
+	for _, e := range entries {
+		path := filepath.Join(s.cfg.ConfigDir, e.Name())
+		switch {
+		case e.IsDir() && isPeerDir(path, e.Name()):
+			if want != nil && !want[e.Name()] {
+				out = append(out, orphan{Path: path, Reason: "peer not in PEERS", Bytes: dirSize(path)})
+				continue
+			}
+			pngs, _ := filepath.Glob(filepath.Join(path, "*.png"))
+			for _, p := range pngs {
+				if filepath.Base(p) != e.Name()+".png" {
+					out = append(out, orphan{Path: p, Reason: "stray QR image", Bytes: dirSize(p)})
+				}
+			}
+		case !e.IsDir() && (strings.HasPrefix(e.Name(), ".write-check-") || strings.HasSuffix(e.Name(), ".tmp")):
+			out = append(out, orphan{Path: path, Reason: "leftover temp file", Bytes: dirSize(path)})
+		}
+	}
+	return out
+}
+
+// isPeerDir reports whether dir is a sidecar peer directory: it holds
+// <name>.conf or a publickey-<name> file.
+func isPeerDir(dir, name string) bool {
+	for _, f := range []string{name + ".conf", "publickey-" + name} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func dirSize(path string) int64 {
+	var n int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				n += info.Size()
+			}
+		}
+		return nil
+	})
+	return n
+}
+
+// removeOrphans deletes the given orphans and returns the bytes reclaimed.
+func removeOrphans(orphans []orphan) (int64, error) {
+	var reclaimed int64
+	for _, o := range orphans {
+		if err := os.RemoveAll(o.Path); err != nil {
+			return reclaimed, err
+		}
+		reclaimed += o.Bytes
+	}
+	return reclaimed, nil
+}
@@ -0,0 +1,215 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"fly-wireguard-vpn-proxy/internal/firewall"
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// guestPerson owns every peer handed out through /guest, so
+// GUEST_MAX_PEERS is enforced by the device budget.
+const guestPerson = "guests"
+
+// guestsMu keeps firewall updates in the order of the peer changes that
+// caused them.
+var guestsMu sync.Mutex
+
+// guestsEnabled reports whether /guest hands out peers.
+func (s Server) guestsEnabled() bool {
+	return s.cfg.GuestClaimCode != "" && s.cfg.BootstrapToken != "" && s.cfg.GuestPeerTTL > 0
+}
+
+// guestPeers returns the API peers created through /guest.
+func (s Server) guestPeers() []apiPeer {
+	var out []apiPeer
+	for _, p := range s.loadAPIPeers() {
+		if p.Person == guestPerson {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// guestClaim serves /guest: a form for the claim code on GET, and on POST
+// a new guest peer, redirecting to its one-time bootstrap page.
+func (s Server) guestClaim(w http.ResponseWriter, r *http.Request) {
+	if !s.guestsEnabled() || (s.cfg.PrivateOnly && !isPrivateNetworkRequest(r)) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	data := map[string]any{"TTL": formatDuration(s.cfg.GuestPeerTTL)}
+	switch r.Method {
+	case http.MethodGet:
+		ui.GuestClaimPage.Execute(w, data)
+		return
+	case http.MethodPost:
+	default:
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+
+	if !s.tokenAttemptAllowed(w, r) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	code := strings.TrimSpace(r.PostFormValue("code"))
+	ok := code != "" && tokenEqual(code, s.cfg.GuestClaimCode)
+	s.noteTokenAttempt(r, code, ok)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		data["Error"] = "That code isn't right. Check the poster and try again."
+		ui.GuestClaimPage.Execute(w, data)
+		return
+	}
+
+	p, err := s.claimGuest()
+	if err != nil {
+		code := 500
+		data["Error"] = "Something went wrong; try again."
+		if errors.Is(err, errDeviceBudget) {
+			code = http.StatusServiceUnavailable
+			data["Error"] = "All guest places are taken right now. Try again later, or ask your host."
+		}
+		slog.Warn("guest not created", "component", "guests", "client", s.clientIP(r), "error", err, "request_id", requestID(r))
+		w.WriteHeader(code)
+		ui.GuestClaimPage.Execute(w, data)
+		return
+	}
+	tok, _, err := s.mintOnboardingToken(p.Name, "guest", s.cfg.GuestPeerTTL, true)
+	if err != nil {
+		slog.Error("cannot mint guest link", "component", "guests", "peer", p.Name, "error", err, "request_id", requestID(r))
+		httpError(w, r, "could not create guest link", 500)
+		return
+	}
+
+	slog.Info("guest claimed", "component", "guests", "event", eventGuestClaimed, "peer", p.Name, "address", p.Address, "client", s.clientIP(r), "expires", p.Expires.Format(time.RFC3339), "request_id", requestID(r))
+	s.recordEvent(eventGuestClaimed, "Guest %s claimed from %s at %s until %s", p.Name, s.clientIP(r), p.Address, p.Expires.Format(time.RFC3339))
+	http.Redirect(w, r, s.onboardingURL(r, p.Name, tok), http.StatusSeeOther)
+}
+
+// claimGuest creates a guest peer that expires after GUEST_PEER_TTL under
+// a random name, and fences it off with the guest firewall rules.
+func (s Server) claimGuest() (apiPeer, error) {
+	var p apiPeer
+	var err error
+	for range 3 {
+		var b [3]byte
+		if _, err = rand.Read(b[:]); err != nil {
+			return apiPeer{}, err
+		}
+		// "peer_guest" and five hex digits fill maxPeerDirLen.
+		name := "peer_guest" + hex.EncodeToString(b[:])[:5]
+		p, _, err = s.newPeer(apiPeer{Name: name, Person: guestPerson, Expires: time.Now().UTC().Add(s.cfg.GuestPeerTTL)})
+		if !errors.Is(err, errPeerExists) {
+			break
+		}
+	}
+	if err != nil {
+		return apiPeer{}, err
+	}
+	s.isolateGuests()
+	return p, nil
+}
+
+// expireGuests deletes the guest peers past their expiry.
+func (s Server) expireGuests(now time.Time) {
+	removed := 0
+	for _, p := range s.guestPeers() {
+		if p.Expires.IsZero() || now.Before(p.Expires) {
+			continue
+		}
+		if err := s.removePeer(p.Name); err != nil && !errors.Is(err, errPeerNotFound) {
+			slog.Warn("cannot remove expired guest", "component", "guests", "peer", p.Name, "error", err)
+			continue
+		}
+		removed++
+		slog.Info("guest expired", "component", "guests", "event", eventGuestExpired, "peer", p.Name, "address", p.Address)
+		s.recordEvent(eventGuestExpired, "Guest %s at %s expired and was removed", p.Name, p.Address)
+	}
+	if removed > 0 {
+		s.isolateGuests()
+	}
+}
+
+// isolateGuests installs the firewall rules for the current guests.
+// Failures are logged: guests still expire, they just aren't fenced off.
+func (s Server) isolateGuests() {
+	guestsMu.Lock()
+	defer guestsMu.Unlock()
+
+	prefix, err := tunnelPrefix(s.cfg.TunnelSubnet)
+	if err != nil {
+		slog.Warn("cannot isolate guests", "component", "guests", "error", err)
+		return
+	}
+	var addrs []netip.Addr
+	for _, p := range s.guestPeers() {
+		if a, err := netip.ParseAddr(p.Address); err == nil {
+			addrs = append(addrs, a)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := firewall.ApplyGuestIsolation(ctx, prefix, addrs); err != nil {
+		slog.Warn("cannot isolate guests", "component", "guests", "guest_count", len(addrs), "error", err)
+	}
+}
+
+// guestLoop expires guest peers once a minute. It runs even with
+// GUEST_CLAIM_CODE unset, so guests from before it was removed still go.
+func (s Server) guestLoop() {
+	if s.guestsEnabled() || len(s.guestPeers()) > 0 {
+		s.isolateGuests()
+	}
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for now := range t.C {
+		s.expireGuests(now)
+	}
+}
+
+// guestPoster renders a printable poster with a QR code for /guest and,
+// unless ?code=0, the claim code, to put up where visitors will see it.
+// The QR holds no keys, so the poster can stay up. Requires the admin
+// token.
+func (s Server) guestPoster(w http.ResponseWriter, r *http.Request) {
+	if !s.guestsEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	claimURL := s.baseURL(r) + "/guest"
+	png, err := qrcode.Encode(claimURL, qrcode.Medium, 512)
+	if err != nil {
+		httpError(w, r, "could not render QR code", 500)
+		return
+	}
+	data := map[string]any{
+		"URL":      claimURL,
+		"QRBase64": base64.StdEncoding.EncodeToString(png),
+		"TTL":      formatDuration(s.cfg.GuestPeerTTL),
+	}
+	if r.URL.Query().Get("code") != "0" {
+		data["Code"] = s.cfg.GuestClaimCode
+	}
+	slog.Info("rendered guest poster", "component", "guests", "request_id", requestID(r))
+	w.Header().Set("Cache-Control", "no-store")
+	ui.GuestPosterPage.Execute(w, data)
+}
@@ -0,0 +1,87 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestGuestClaim(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.GuestClaimCode = "blue-door"
+		c.GuestPeerTTL = time.Hour
+		c.GuestMaxPeers = 2
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	if w := postForm(s.guestClaim, "/guest", url.Values{"code": {"red-door"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code: status = %d, want 401", w.Code)
+	}
+	if len(s.guestPeers()) != 0 {
+		t.Fatal("wrong code created a guest")
+	}
+
+	var links []string
+	for i := 0; i < 2; i++ {
+		w := postForm(s.guestClaim, "/guest", url.Values{"code": {"blue-door"}})
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("claim %d: status = %d: %s", i, w.Code, w.Body)
+		}
+		links = append(links, w.Header().Get("Location"))
+	}
+	if w := postForm(s.guestClaim, "/guest", url.Values{"code": {"blue-door"}}); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("claim over GUEST_MAX_PEERS: status = %d, want 503", w.Code)
+	}
+
+	guests := s.guestPeers()
+	if len(guests) != 2 {
+		t.Fatalf("guests = %+v", guests)
+	}
+	for _, g := range guests {
+		if len(g.Name) > maxPeerDirLen || !strings.HasPrefix(g.Name, "peer_guest") {
+			t.Errorf("guest name %q", g.Name)
+		}
+		if d := time.Until(g.Expires); d <= 0 || d > time.Hour {
+			t.Errorf("%s expires in %s, want within GUEST_PEER_TTL", g.Name, d)
+		}
+	}
+	link, _ := url.Parse(links[0])
+	if w := serve(s.bootstrapPeer, http.MethodGet, link.RequestURI()); w.Code != http.StatusOK {
+		t.Errorf("guest link: status = %d", w.Code)
+	}
+
+	s.expireGuests(time.Now().Add(2 * time.Hour))
+	if g := s.guestPeers(); len(g) != 0 {
+		t.Errorf("guests left after expiry: %+v", g)
+	}
+	if d := s.loadDeletedPeers(); len(d) != 0 {
+		t.Errorf("expired guests kept for restoring: %+v", d)
+	}
+	if w := postForm(s.guestClaim, "/guest", url.Values{"code": {"blue-door"}}); w.Code != http.StatusSeeOther {
+		t.Errorf("claim after expiry: status = %d, want 303", w.Code)
+	}
+}
+
+func TestGuestPoster(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) { c.GuestClaimCode = "blue-door" })
+
+	if w := serve(s.guestPoster, http.MethodGet, "/guest/poster"); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status = %d, want 401", w.Code)
+	}
+	w := serve(s.guestPoster, http.MethodGet, "/guest/poster?token="+testAdminToken)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "blue-door") || !strings.Contains(w.Body.String(), "/guest") {
+		t.Errorf("poster: %d %s", w.Code, w.Body)
+	}
+	if w := serve(s.guestPoster, http.MethodGet, "/guest/poster?code=0&token="+testAdminToken); strings.Contains(w.Body.String(), "blue-door") {
+		t.Error("?code=0 poster still shows the code")
+	}
+
+	off := newTestServer(t, nil)
+	if w := serve(off.guestClaim, http.MethodGet, "/guest"); w.Code != http.StatusNotFound {
+		t.Errorf("without GUEST_CLAIM_CODE: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// handshakeTransition is one line of the per-peer handshake history: a
+// peer becoming active (fresh handshake) or going idle.
+type handshakeTransition struct {
+	Peer          string    `json:"peer"`
+	PublicKey     string    `json:"public_key"`
+	State         string    `json:"state"` // "active" or "idle"
+	LastHandshake time.Time `json:"last_handshake"`
+	Time          time.Time `json:"time"`
+}
+
+// peerActivity remembers each peer's last sampled state between ticks.
+// It lives for the process; after a restart every peer starts unknown,
+// so the first sample records its current state once.
+var peerActivity = struct {
+	sync.Mutex
+	active map[string]bool
+}{active: map[string]bool{}}
+
+// recordHandshakeTransitions compares a latest-handshakes sample against
+// the previous one and appends a history line for every peer whose
+// active/idle state changed. A peer is active while its latest handshake
+// is within KEEPALIVE_MAX_IDLE, the same threshold the suspend decision
+// uses.
+func (s Server) recordHandshakeTransitions(hs map[string]int64) {
+	now := time.Now()
+	names := s.peerNamesByKey()
+
+	peerActivity.Lock()
+	var changes []handshakeTransition
+	for key, ts := range hs {
+		last := time.Unix(ts, 0)
+		active := ts > 0 && now.Sub(last) <= s.cfg.KeepaliveMaxIdle
+		if prev, seen := peerActivity.active[key]; seen && prev == active {
+			continue
+		}
+		peerActivity.active[key] = active
+		t := handshakeTransition{Peer: names[key], PublicKey: key, State: "idle", Time: now}
+		if active {
+			t.State = "active"
+		}
+		if ts > 0 {
+			t.LastHandshake = last
+		}
+		changes = append(changes, t)
+	}
+	peerActivity.Unlock()
+
+	if len(changes) == 0 || s.historyPaused() {
+		return
+	}
+	f, err := os.OpenFile(s.cfg.HandshakeHistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Warn("cannot open handshake history", "component", "handshakes", "error", err)
+		return
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, t := range changes {
+		if err := enc.Encode(t); err != nil {
+			slog.Warn("write failed", "component", "handshakes", "error", err)
+			return
+		}
+		label := t.Peer
+		if label == "" {
+			label = t.PublicKey
+		}
+		slog.Info("peer state changed", "component", "handshakes", "peer", label, "state", t.State)
+	}
+}
+
+// peerNamesByKey maps public keys to the sidecar's peer names using the
+// /config/<name>/publickey-<name> files.
+func (s Server) peerNamesByKey() map[string]string {
+	names := map[string]string{}
+	paths, _ := filepath.Glob(filepath.Join(s.cfg.ConfigDir, "*", "publickey-*"))
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		names[strings.TrimSpace(string(b))] = strings.TrimPrefix(filepath.Base(p), "publickey-")
+	}
+	return names
+}
+
+// peerHandshakes summarizes the current per-peer state for diagnostics
+// and the console.
+func (s Server) peerHandshakes() ([]map[string]any, error) {
+	hs, err := wireGuardHandshakes(s.cfg.WGInterface)
+	if err != nil {
+		return nil, err
+	}
+	names := s.peerNamesByKey()
+	infra := s.infraPeerKeys()
+	var out []map[string]any
+	for key, ts := range hs {
+		p := map[string]any{"peer": names[key], "public_key": key, "infrastructure": infra[key]}
+		if ts > 0 {
+			last := time.Unix(ts, 0)
+			p["last_handshake"] = last.UTC().Format(time.RFC3339)
+			p["active"] = time.Since(last) <= s.cfg.KeepaliveMaxIdle
+		} else {
+			p["active"] = false
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
@@ -0,0 +1,48 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// dataplaneHealth answers /healthz/dataplane for external load balancers
+// and DNS failover (e.g. Cloudflare load balancing across regions). It
+// ignores the bootstrap side entirely and fails only when the tunnel
+// can't carry traffic: the WireGuard interface is down, or the most
+// recent routing probe within HEALTH_PROBE_MAX_AGE failed. With
+// HEALTH_REQUIRE_PROBE=true a recent successful probe is also required.
+func (s Server) dataplaneHealth(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]any{}
+	healthy := true
+
+	_, err := wg.Show(s.cfg.WGInterface)
+	wgUp := err == nil
+	checks["wireguard_up"] = wgUp
+	healthy = healthy && wgUp
+
+	p, ok := s.loadRouteProbe()
+	recent := ok && time.Since(p.CheckedAt) <= s.cfg.HealthProbeMaxAge
+	switch {
+	case recent:
+		checks["probe"] = p.State
+		checks["probe_checked_at"] = p.CheckedAt.UTC().Format(time.RFC3339)
+		healthy = healthy && p.State == probeOK
+	case s.cfg.HealthRequireProbe:
+		checks["probe"] = "missing"
+		healthy = false
+	default:
+		checks["probe"] = "none_recent"
+	}
+
+	code := http.StatusOK
+	if !healthy {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"healthy": healthy, "checks": checks})
+}
@@ -0,0 +1,93 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+const testAdminToken = "admin-secret-token"
+
+// testPeerConf is a peer config in the sidecar's layout.
+const testPeerConf = `[Interface]
+Address = 10.13.13.2
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+DNS = 10.13.13.1
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+PresharedKey = /UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=
+Endpoint = vpn.example.com:51820
+AllowedIPs = 0.0.0.0/0, ::/0
+`
+
+// newTestServer returns a server over a fresh config directory holding
+// peer1 (the main peer) and peer2. edit may adjust the config first.
+func newTestServer(t *testing.T, edit func(*config.Config)) Server {
+	t.Helper()
+	cfg := config.Load()
+	cfg.ConfigDir = t.TempDir()
+	cfg.PeerName = "peer1"
+	cfg.BootstrapToken = testAdminToken
+	cfg.BootstrapTokens = []string{testAdminToken}
+	cfg.EndpointHost = ""
+	cfg.TokenRateLimit = 0
+	cfg.TokenLockoutThreshold = 0
+	if edit != nil {
+		edit(&cfg)
+	}
+	for _, peer := range []string{"peer1", "peer2"} {
+		writeTestPeer(t, cfg.ConfigDir, peer, testPeerConf)
+	}
+	return NewServer(cfg)
+}
+
+func writeTestPeer(t *testing.T, configDir, peer, conf string) {
+	t.Helper()
+	dir := filepath.Join(configDir, peer)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, peer+".conf"), []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeWG puts a wg tool on PATH whose `wg show <iface> dump` prints
+// dump. Other subcommands succeed and do nothing. The returned function
+// lists every invocation's arguments so far.
+func fakeWG(t *testing.T, dump string) (calls func() []string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dump"), []byte(dump), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$*\" >> " + log + "\n[ \"$3\" = dump ] && cat " + filepath.Join(dir, "dump") + "\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(dir, "wg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() []string {
+		b, _ := os.ReadFile(log)
+		if len(b) == 0 {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+}
+
+// serve runs one request through h and returns the recorded response.
+func serve(h http.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = "198.51.100.7:40000"
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
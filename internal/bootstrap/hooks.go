@@ -0,0 +1,67 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fly-wireguard-vpn-proxy/internal/hooks"
+)
+
+// fireHook delivers a lifecycle event in the background so a slow or
+// broken hook never delays a request or a keepalive tick.
+func (s Server) fireHook(event string, data map[string]any) {
+	if !s.hooks.Enabled() {
+		return
+	}
+	go s.fireHookSync(event, data)
+}
+
+// fireHookSync delivers a lifecycle event and waits for it. Used before
+// suspend, where the process may be frozen as soon as we return.
+func (s Server) fireHookSync(event string, data map[string]any) {
+	err := s.hooks.Fire(context.Background(), hooks.Payload{
+		Event:  event,
+		App:    s.cfg.EndpointHost,
+		Region: s.cfg.Region,
+		Peer:   s.cfg.PeerName,
+		Data:   data,
+	})
+	if err != nil {
+		slog.Warn("hook failed", "component", "hooks", "event", event, "error", err)
+	}
+}
+
+// checkPeerCreated fires PeerCreated when the peer's public key differs
+// from the one seen on the previous boot, i.e. the sidecar generated a new
+// key pair (first deploy, or a wiped peer directory).
+func (s Server) checkPeerCreated() {
+	key, err := os.ReadFile(filepath.Join(s.cfg.ConfigDir, s.cfg.PeerName, "publickey-"+s.cfg.PeerName))
+	if err != nil {
+		return
+	}
+	cur := strings.TrimSpace(string(key))
+
+	path := s.cfg.KnownPeerKeyPath()
+	prev, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("cannot read known peer key", "component", "hooks", "path", path, "error", err)
+		return
+	}
+	if strings.TrimSpace(string(prev)) == cur {
+		return
+	}
+	if err := os.WriteFile(path, []byte(cur+"\n"), 0o600); err != nil {
+		slog.Warn("cannot write known peer key", "component", "hooks", "path", path, "error", err)
+	}
+	if len(prev) == 0 {
+		s.recordEvent(eventPeerAdded, "Peer %s added (public key %s)", s.cfg.PeerName, cur)
+	} else {
+		s.recordEvent(eventKeyRotated, "Peer %s has a new key pair (public key %s)", s.cfg.PeerName, cur)
+	}
+	s.fireHook(hooks.PeerCreated, map[string]any{"public_key": cur})
+}
@@ -0,0 +1,185 @@
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// idempotencyHeader lets automation retry a POST that creates a peer,
+// rotates or restores one, or mints an onboarding link without doing it
+// twice: the first response is stored and replayed for the same key.
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyTTL is how long a stored response is replayed. Retries come
+// within minutes; a day covers a job re-run the next morning.
+const idempotencyTTL = 24 * time.Hour
+
+// idempotentResponse is a stored response. Replays of peer creation carry
+// the new private key, so the file sits next to the keys with the same
+// permissions.
+type idempotentResponse struct {
+	Key         string    `json:"key"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	BodyHash    string    `json:"body_hash"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body"`
+	Created     time.Time `json:"created"`
+}
+
+// idempotencyMu guards the stored responses and the keys in flight.
+var idempotencyMu sync.Mutex
+
+var idempotencyInFlight = map[string]bool{}
+
+func (s Server) loadIdempotentResponses() []idempotentResponse {
+	var out []idempotentResponse
+	b, err := os.ReadFile(s.cfg.IdempotencyPath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read idempotency records", "component", "api", "error", err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		slog.Warn("idempotency records are corrupt", "component", "api", "error", err)
+		return nil
+	}
+	return out
+}
+
+// storeIdempotentResponse adds rec, dropping records past idempotencyTTL.
+func (s Server) storeIdempotentResponse(rec idempotentResponse) error {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+	kept := []idempotentResponse{}
+	for _, old := range s.loadIdempotentResponses() {
+		if time.Since(old.Created) < idempotencyTTL && old.Key != rec.Key {
+			kept = append(kept, old)
+		}
+	}
+	b, err := json.Marshal(append(kept, rec))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.IdempotencyPath(), b, 0o600)
+}
+
+// captureWriter passes a response through while keeping a copy.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// idempotent wraps a mutating API handler. A POST with an
+// Idempotency-Key runs once; a retry with the same key, path and body
+// gets the stored response with Idempotent-Replayed: true, a retry while
+// the first is still running gets 409, and reusing the key for a
+// different request gets 422. Server errors aren't stored, so a retry
+// after one runs again. Requests without a valid admin token pass
+// straight through and are refused by the handler, so replays never reach
+// an unauthenticated caller.
+func (s Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if r.Method != http.MethodPost || key == "" || !s.isAdminToken(requestToken(r)) {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			httpError(w, r, "Idempotency-Key is longer than 255 characters", 400)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if err != nil {
+			httpError(w, r, "request body too large", 413)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(sum[:])
+
+		idempotencyMu.Lock()
+		var prev *idempotentResponse
+		for _, rec := range s.loadIdempotentResponses() {
+			if rec.Key == key && time.Since(rec.Created) < idempotencyTTL {
+				prev = &rec
+			}
+		}
+		busy := idempotencyInFlight[key]
+		if prev == nil && !busy {
+			idempotencyInFlight[key] = true
+		}
+		idempotencyMu.Unlock()
+
+		switch {
+		case prev != nil && (prev.Method != r.Method || prev.Path != r.URL.Path || prev.BodyHash != bodyHash):
+			httpError(w, r, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+			return
+		case prev != nil:
+			slog.Info("replayed", "component", "api", "path", r.URL.Path, "status", prev.Status, "request_id", requestID(r))
+			w.Header().Set("Cache-Control", "no-store")
+			if prev.ContentType != "" {
+				w.Header().Set("Content-Type", prev.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(prev.Status)
+			_, _ = w.Write(prev.Body)
+			return
+		case busy:
+			httpError(w, r, "a request with this Idempotency-Key is still in progress", http.StatusConflict)
+			return
+		}
+		defer func() {
+			idempotencyMu.Lock()
+			delete(idempotencyInFlight, key)
+			idempotencyMu.Unlock()
+		}()
+
+		cw := &captureWriter{ResponseWriter: w}
+		next(cw, r)
+		if cw.status == 0 || cw.status >= 500 {
+			return
+		}
+		err = s.storeIdempotentResponse(idempotentResponse{
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			BodyHash:    bodyHash,
+			Status:      cw.status,
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        cw.body.Bytes(),
+			Created:     time.Now().UTC(),
+		})
+		if err != nil {
+			slog.Warn("cannot store response for replay", "component", "api", "error", err, "request_id", requestID(r))
+		}
+	}
+}
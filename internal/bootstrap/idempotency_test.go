@@ -0,0 +1,73 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyKeyReplaysPeerCreation(t *testing.T) {
+	s := newTestServer(t, nil)
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	h := s.idempotent(s.apiPeers)
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/peers?token="+testAdminToken, strings.NewReader(body))
+		r.RemoteAddr = "198.51.100.7:40000"
+		if key != "" {
+			r.Header.Set(idempotencyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	first := post("k1", `{"name": "laptop"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first: status = %d: %s", first.Code, first.Body)
+	}
+	retry := post("k1", `{"name": "laptop"}`)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry: status = %d, body = %s; want the first response", retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("retry is not marked as replayed")
+	}
+	if n := len(s.loadAPIPeers()); n != 1 {
+		t.Errorf("%d API peers after a retried create, want 1", n)
+	}
+
+	cases := []struct {
+		name, key, body string
+		want            int
+	}{
+		{"same key, other body", "k1", `{"name": "tablet"}`, http.StatusUnprocessableEntity},
+		{"new key", "k2", `{"name": "tablet"}`, http.StatusCreated},
+		{"no key runs again", "", `{"name": "tablet"}`, http.StatusConflict},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := post(tc.key, tc.body); w.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyNeedsAdminToken(t *testing.T) {
+	s := newTestServer(t, nil)
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	h := s.idempotent(s.apiPeers)
+
+	want := []int{http.StatusCreated, http.StatusUnauthorized}
+	for i, tok := range []string{testAdminToken, "wrong"} {
+		r := httptest.NewRequest(http.MethodPost, "/api/peers?token="+tok, strings.NewReader(`{"name": "laptop"}`))
+		r.Header.Set(idempotencyHeader, "k1")
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != want[i] {
+			t.Errorf("token %q: status = %d, want %d", tok, w.Code, want[i])
+		}
+	}
+}
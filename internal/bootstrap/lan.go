@@ -0,0 +1,90 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"net/netip"
+	"strings"
+
+	"fly-wireguard-vpn-proxy/internal/netcalc"
+	"fly-wireguard-vpn-proxy/internal/ui"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// commonLANs are the home/office ranges routers hand out by default. The
+// browser can't reliably tell us the visitor's LAN, so the page lets them
+// pick theirs from this list.
+var commonLANs = []string{
+	"192.168.0.0/24",
+	"192.168.1.0/24",
+	"192.168.2.0/24",
+	"192.168.178.0/24",
+	"10.0.0.0/24",
+	"10.0.1.0/24",
+	"10.1.1.0/24",
+	"172.16.0.0/24",
+}
+
+// lanChecks precomputes, for each common LAN, whether it collides with the
+// tunnel subnet or is swallowed by a full-tunnel AllowedIPs, along with an
+// alternate profile that routes the LAN locally. Everything is rendered
+// up front because the one-time page can't be reloaded.
+func (s Server) lanChecks(conf string) []ui.LANCheck {
+	_, peer := parseConfSections(conf)
+	allowed, err := netcalc.ParseList(peer["AllowedIPs"])
+	if err != nil || len(allowed) == 0 {
+		return nil
+	}
+	tunnel, tunnelErr := tunnelPrefix(s.cfg.TunnelSubnet)
+
+	checks := make([]ui.LANCheck, 0, len(commonLANs))
+	for _, lan := range commonLANs {
+		p := netip.MustParsePrefix(lan)
+		c := ui.LANCheck{
+			Range:         lan,
+			TunnelOverlap: tunnelErr == nil && tunnel.Overlaps(p),
+			RouteOverlap:  netcalc.AnyOverlap(allowed, p),
+		}
+		if c.RouteOverlap && !c.TunnelOverlap {
+			alt := netcalc.Exclude(allowed, []netip.Prefix{p})
+			c.AltConfig = replaceSetting(conf, "AllowedIPs", netcalc.FormatList(alt))
+			if png, err := qrcode.Encode(c.AltConfig, qrcode.Medium, 256); err == nil {
+				c.AltQRBase64 = base64.StdEncoding.EncodeToString(png)
+			}
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// tunnelLANConflicts lists common LAN ranges the tunnel subnet itself
+// overlaps. That can't be fixed on the client, so the page warns up front.
+func (s Server) tunnelLANConflicts() []string {
+	tunnel, err := tunnelPrefix(s.cfg.TunnelSubnet)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, lan := range commonLANs {
+		if tunnel.Overlaps(netip.MustParsePrefix(lan)) {
+			out = append(out, lan)
+		}
+	}
+	return out
+}
+
+// replaceSetting rewrites the first "key = ..." line in conf, keeping its
+// indentation.
+func replaceSetting(conf, key, value string) string {
+	lines := strings.Split(conf, "\n")
+	for i, line := range lines {
+		k, _, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[i] = indent + key + " = " + value
+		break
+	}
+	return strings.Join(lines, "\n")
+}
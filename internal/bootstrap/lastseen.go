@@ -0,0 +1,122 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// lastSeenGranularity limits how often the record is rewritten: a busy
+// peer re-handshakes every two minutes, but "last seen" only needs to be
+// right to within this.
+const lastSeenGranularity = 10 * time.Minute
+
+// peerSeen is one peer's entry in the last-seen record. FirstSeen lets a
+// peer that was provisioned but never connected go stale too.
+type peerSeen struct {
+	Peer      string    `json:"peer,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
+}
+
+var lastSeenMu sync.Mutex
+
+// updateLastSeen folds a latest-handshakes sample into the persistent
+// last-seen record. Unlike `wg show`, which forgets everything when the
+// interface restarts, the record survives suspends and redeploys.
+func (s Server) updateLastSeen(hs map[string]int64) {
+	lastSeenMu.Lock()
+	defer lastSeenMu.Unlock()
+
+	seen := s.loadLastSeen()
+	names := s.peerNamesByKey()
+	now := time.Now()
+	changed := false
+	for key, ts := range hs {
+		e, ok := seen[key]
+		if !ok {
+			e = peerSeen{FirstSeen: now}
+			changed = true
+		}
+		if names[key] != "" && e.Peer != names[key] {
+			e.Peer = names[key]
+			changed = true
+		}
+		if ts > 0 {
+			if last := time.Unix(ts, 0); last.Sub(e.LastSeen) >= lastSeenGranularity {
+				e.LastSeen = last
+				changed = true
+			}
+		}
+		seen[key] = e
+	}
+	if !changed {
+		return
+	}
+
+	b, err := json.MarshalIndent(seen, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(s.cfg.PeerLastSeenPath(), b, 0o600); err != nil {
+		slog.Warn("cannot record last seen", "component", "lastseen", "error", err)
+	}
+}
+
+func (s Server) loadLastSeen() map[string]peerSeen {
+	seen := map[string]peerSeen{}
+	if b, err := os.ReadFile(s.cfg.PeerLastSeenPath()); err == nil {
+		if err := json.Unmarshal(b, &seen); err != nil {
+			slog.Warn("ignoring corrupt file", "component", "lastseen", "path", s.cfg.PeerLastSeenPath(), "error", err)
+		}
+	}
+	return seen
+}
+
+// stalePeer is a device that hasn't connected for STALE_PEER_AFTER, with
+// what to do about it.
+type stalePeer struct {
+	Peer       string    `json:"peer,omitempty"`
+	PublicKey  string    `json:"public_key"`
+	LastSeen   time.Time `json:"last_seen,omitempty"`
+	Never      bool      `json:"never_connected,omitempty"`
+	Suggestion string    `json:"suggestion"`
+}
+
+// stalePeers lists non-infrastructure peers not seen within
+// STALE_PEER_AFTER, oldest first.
+func (s Server) stalePeers() []stalePeer {
+	lastSeenMu.Lock()
+	seen := s.loadLastSeen()
+	lastSeenMu.Unlock()
+
+	infra := s.infraPeerKeys()
+	cutoff := time.Now().Add(-s.cfg.StalePeerAfter)
+	var out []stalePeer
+	for key, e := range seen {
+		ref := e.LastSeen
+		if ref.IsZero() {
+			ref = e.FirstSeen
+		}
+		if infra[key] || ref.After(cutoff) {
+			continue
+		}
+		suggestion := fmt.Sprintf("Pause until the next restart with `wg set %s peer %s remove`", s.cfg.WGInterface, key)
+		if e.Peer != "" {
+			suggestion += fmt.Sprintf("; to revoke for good, delete /config/%s and lower PEERS on the WireGuard container", e.Peer)
+		}
+		out = append(out, stalePeer{
+			Peer:       e.Peer,
+			PublicKey:  key,
+			LastSeen:   e.LastSeen,
+			Never:      e.LastSeen.IsZero(),
+			Suggestion: suggestion + ".",
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.Before(out[j].LastSeen) })
+	return out
+}
@@ -0,0 +1,54 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// opLimiter caps how many expensive operations of one kind run at once.
+// The machine is a shared CPU that also forwards all VPN traffic, so a
+// burst of page refreshes must queue briefly and then be turned away
+// rather than pile up.
+type opLimiter struct {
+	name  string
+	slots chan struct{}
+	wait  time.Duration
+}
+
+func newOpLimiter(name string, n int, wait time.Duration) *opLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &opLimiter{name: name, slots: make(chan struct{}, n), wait: wait}
+}
+
+// wrap runs next once a slot is free. Requests that can't get one within
+// the queue wait (or whose client goes away) get a 429 with Retry-After.
+// A nil limiter (EXPENSIVE_CONCURRENCY=0) lets everything through.
+func (l *opLimiter) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		timer := time.NewTimer(l.wait)
+		defer timer.Stop()
+		select {
+		case l.slots <- struct{}{}:
+		case <-timer.C:
+			l.reject(w, r)
+			return
+		case <-r.Context().Done():
+			return
+		}
+		defer func() { <-l.slots }()
+		next(w, r)
+	}
+}
+
+func (l *opLimiter) reject(w http.ResponseWriter, r *http.Request) {
+	slog.Warn("busy, request rejected", "component", "limit", "limiter", l.name, "path", r.URL.Path, "request_id", requestID(r))
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(l.wait.Seconds()), 1)))
+	httpError(w, r, "server busy, retry shortly", http.StatusTooManyRequests)
+}
@@ -0,0 +1,126 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// sixPNPrefix covers Fly's private (6PN) network. Connections made through
+// `fly proxy` or an org WireGuard tunnel arrive on a machine address in
+// this range; traffic from the public edge does not.
+var sixPNPrefix = netip.MustParsePrefix("fdaa::/16")
+
+// listenSpec is a single socket the HTTP server binds.
+type listenSpec struct {
+	network string
+	addr    string
+}
+
+// listenSpecs expands BOOTSTRAP_LISTEN entries into concrete sockets.
+// Each entry is one of:
+//
+//   - "ipv4": all IPv4 addresses (0.0.0.0), the historical default.
+//   - "ipv6": all IPv6 addresses ([::]), IPv6 only.
+//   - "both": the two above as separate sockets.
+//   - a host, IP or host:port, e.g. "fly-local-6pn" or "[fdaa::3]:8081".
+//     The configured port is used when none is given.
+func listenSpecs(entries []string, port string) ([]listenSpec, error) {
+	if len(entries) == 0 {
+		entries = []string{"ipv4"}
+	}
+
+	var specs []listenSpec
+	for _, e := range entries {
+		switch strings.ToLower(e) {
+		case "ipv4":
+			specs = append(specs, listenSpec{"tcp4", net.JoinHostPort("0.0.0.0", port)})
+		case "ipv6":
+			specs = append(specs, listenSpec{"tcp6", net.JoinHostPort("::", port)})
+		case "both":
+			specs = append(specs,
+				listenSpec{"tcp4", net.JoinHostPort("0.0.0.0", port)},
+				listenSpec{"tcp6", net.JoinHostPort("::", port)},
+			)
+		default:
+			spec, err := parseListenAddr(e, port)
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+func parseListenAddr(entry, port string) (listenSpec, error) {
+	host, p := entry, port
+	if h, hp, err := net.SplitHostPort(entry); err == nil {
+		host, p = h, hp
+	} else if strings.HasPrefix(entry, "[") && strings.HasSuffix(entry, "]") {
+		host = strings.Trim(entry, "[]")
+	}
+	if host == "" {
+		return listenSpec{}, fmt.Errorf("invalid listen address %q", entry)
+	}
+
+	network := "tcp"
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if ip.Is4() {
+			network = "tcp4"
+		} else {
+			network = "tcp6"
+		}
+	}
+	return listenSpec{network, net.JoinHostPort(host, p)}, nil
+}
+
+// isTunnelRequest reports whether r arrived on the server's own tunnel
+// address (.1 of INTERNAL_SUBNET), which only a connected peer can reach.
+func (s Server) isTunnelRequest(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	prefix, err := tunnelPrefix(s.cfg.TunnelSubnet)
+	if err != nil {
+		return false
+	}
+	return ap.Addr().Unmap() == prefix.Addr().Next()
+}
+
+// tunnelOnly answers 404 to management requests that didn't come through
+// the tunnel when BOOTSTRAP_API_TUNNEL_ONLY is set, so the admin page and
+// the API can only be used from a device that is already connected.
+func (s Server) tunnelOnly(next http.HandlerFunc) http.HandlerFunc {
+	if !s.cfg.APITunnelOnly {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isTunnelRequest(r) {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isPrivateNetworkRequest reports whether r arrived on a Fly 6PN address
+// of this machine rather than through the public proxy.
+func isPrivateNetworkRequest(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	return sixPNPrefix.Contains(ap.Addr().Unmap())
+}
@@ -0,0 +1,69 @@
+package bootstrap
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestListenSpecs(t *testing.T) {
+	cases := []struct {
+		name    string
+		entries []string
+		want    []listenSpec
+		wantErr bool
+	}{
+		{"default", nil, []listenSpec{{"tcp4", "0.0.0.0:8081"}}, false},
+		{"ipv4", []string{"ipv4"}, []listenSpec{{"tcp4", "0.0.0.0:8081"}}, false},
+		{"ipv6", []string{"IPv6"}, []listenSpec{{"tcp6", "[::]:8081"}}, false},
+		{"both", []string{"both"}, []listenSpec{{"tcp4", "0.0.0.0:8081"}, {"tcp6", "[::]:8081"}}, false},
+		{"hostname", []string{"fly-local-6pn"}, []listenSpec{{"tcp", "fly-local-6pn:8081"}}, false},
+		{"hostname with port", []string{"localhost:9000"}, []listenSpec{{"tcp", "localhost:9000"}}, false},
+		{"ipv4 address", []string{"127.0.0.1"}, []listenSpec{{"tcp4", "127.0.0.1:8081"}}, false},
+		{"bracketed ipv6", []string{"[fdaa::3]"}, []listenSpec{{"tcp6", "[fdaa::3]:8081"}}, false},
+		{"ipv6 with port", []string{"[fdaa::3]:9000"}, []listenSpec{{"tcp6", "[fdaa::3]:9000"}}, false},
+		{"bare ipv6", []string{"fdaa::3"}, []listenSpec{{"tcp6", "[fdaa::3]:8081"}}, false},
+		{"mixed", []string{"ipv4", "fly-local-6pn"}, []listenSpec{{"tcp4", "0.0.0.0:8081"}, {"tcp", "fly-local-6pn:8081"}}, false},
+		{"port only", []string{":9000"}, nil, true},
+		{"empty brackets", []string{"[]"}, nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := listenSpecs(tc.entries, "8081")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("listenSpecs = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestManagementRoutesCanBeTunnelOnly(t *testing.T) {
+	cases := []struct {
+		name       string
+		tunnelOnly bool
+		local      string
+		want       int
+	}{
+		{"off, public proxy", false, "172.19.0.2", http.StatusOK},
+		{"on, public proxy", true, "172.19.0.2", http.StatusNotFound},
+		{"on, 6PN", true, "fdaa:0:1::2", http.StatusNotFound},
+		{"on, another tunnel address", true, "10.66.13.2", http.StatusNotFound},
+		{"on, tunnel", true, "10.66.13.1", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *config.Config) {
+				c.APITunnelOnly = tc.tunnelOnly
+				c.TunnelSubnet = "10.66.13.0"
+			})
+			if w := serveOn(s.tunnelOnly(s.apiEvents), tc.local, "/api/events?token="+testAdminToken, ""); w.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Page sizes for the JSON list endpoints.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// listSpec is what a list endpoint lets callers filter and sort on. Every
+// item carries idField, which breaks ties so a cursor always points at
+// exactly one position.
+type listSpec struct {
+	idField     string
+	filters     []string
+	sorts       []string
+	defaultSort string // "-field" for descending
+}
+
+// listQuery is one request's ?limit=, ?cursor=, ?sort= and filters.
+type listQuery struct {
+	spec    listSpec
+	limit   int
+	after   []string // sort order, sort value and id of the last item seen
+	field   string
+	desc    bool
+	filters map[string]string
+}
+
+// parseListQuery reads the paging, sorting and filtering parameters of r.
+// Filters are plain query parameters named after a field, such as
+// ?source=api; a filter on a field the item lacks matches "".
+func parseListQuery(r *http.Request, spec listSpec) (listQuery, error) {
+	q := r.URL.Query()
+	lq := listQuery{spec: spec, limit: defaultListLimit, filters: map[string]string{}}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			return lq, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		lq.limit = n
+	}
+
+	order := q.Get("sort")
+	if order == "" {
+		order = spec.defaultSort
+	}
+	lq.field = strings.TrimPrefix(order, "-")
+	lq.desc = strings.HasPrefix(order, "-")
+	ok := lq.field == spec.idField
+	for _, f := range spec.sorts {
+		ok = ok || f == lq.field
+	}
+	if !ok {
+		return lq, fmt.Errorf("sort must be one of %s, %s (prefix - for descending)", spec.idField, strings.Join(spec.sorts, ", "))
+	}
+
+	for _, f := range spec.filters {
+		if q.Has(f) {
+			lq.filters[f] = q.Get(f)
+		}
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		b, err := base64.RawURLEncoding.DecodeString(c)
+		if err != nil || json.Unmarshal(b, &lq.after) != nil || len(lq.after) != 3 || lq.after[0] != order {
+			return lq, fmt.Errorf("invalid cursor; start again without one")
+		}
+	}
+	return lq, nil
+}
+
+// page filters and sorts items and returns those after the cursor, up to
+// the limit, with the cursor for the next page ("" on the last one).
+func (lq listQuery) page(items []map[string]any) ([]map[string]any, string) {
+	kept := []map[string]any{}
+	for _, it := range items {
+		match := true
+		for f, want := range lq.filters {
+			match = match && listValue(it, f) == want
+		}
+		if match {
+			kept = append(kept, it)
+		}
+	}
+
+	less := func(a, b map[string]any) bool {
+		if c := compareListValues(listValue(a, lq.field), listValue(b, lq.field)); c != 0 {
+			return (c < 0) != lq.desc
+		}
+		ia, ib := listValue(a, lq.spec.idField), listValue(b, lq.spec.idField)
+		return ia != ib && (ia < ib) != lq.desc
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return less(kept[i], kept[j]) })
+
+	if lq.after != nil {
+		last := map[string]any{lq.field: lq.after[1], lq.spec.idField: lq.after[2]}
+		i := sort.Search(len(kept), func(i int) bool { return less(last, kept[i]) })
+		kept = kept[i:]
+	}
+	if len(kept) <= lq.limit {
+		return kept, ""
+	}
+	kept = kept[:lq.limit]
+	last := kept[len(kept)-1]
+	order := lq.field
+	if lq.desc {
+		order = "-" + order
+	}
+	b, _ := json.Marshal([]string{order, listValue(last, lq.field), listValue(last, lq.spec.idField)})
+	return kept, base64.RawURLEncoding.EncodeToString(b)
+}
+
+func listValue(item map[string]any, field string) string {
+	v, ok := item[field]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// compareListValues orders addresses and numbers by value and everything
+// else, RFC 3339 times included, as text.
+func compareListValues(a, b string) int {
+	if pa, err := netip.ParsePrefix(a); err == nil {
+		if pb, err := netip.ParsePrefix(b); err == nil {
+			return pa.Addr().Compare(pb.Addr())
+		}
+	}
+	if aa, err := netip.ParseAddr(a); err == nil {
+		if ab, err := netip.ParseAddr(b); err == nil {
+			return aa.Compare(ab)
+		}
+	}
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,109 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestListPaging(t *testing.T) {
+	spec := listSpec{idField: "name", filters: []string{"source"}, sorts: []string{"address"}, defaultSort: "name"}
+	items := []map[string]any{
+		{"name": "peer1", "address": "10.13.13.2/32", "source": "sidecar"},
+		{"name": "peer_laptop", "address": "10.13.13.10/32", "source": "api"},
+		{"name": "peer2", "address": "10.13.13.3/32", "source": "sidecar"},
+		{"name": "peer_phone", "address": "10.13.13.9/32", "source": "api"},
+		{"name": "peer_tv", "address": "10.13.13.9/32", "source": "api"},
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"peer1", "peer2", "peer_laptop", "peer_phone", "peer_tv"}},
+		{"sort=-name", []string{"peer_tv", "peer_phone", "peer_laptop", "peer2", "peer1"}},
+		// Addresses sort by value, not as text; equal ones by name.
+		{"sort=address", []string{"peer1", "peer2", "peer_phone", "peer_tv", "peer_laptop"}},
+		{"sort=-address", []string{"peer_laptop", "peer_tv", "peer_phone", "peer2", "peer1"}},
+		{"source=api", []string{"peer_laptop", "peer_phone", "peer_tv"}},
+		{"source=api&sort=address", []string{"peer_phone", "peer_tv", "peer_laptop"}},
+		{"source=none", nil},
+	}
+	for _, tc := range cases {
+		for _, limit := range []string{"1", "2", "100"} {
+			t.Run(tc.query+"/limit="+limit, func(t *testing.T) {
+				var got []string
+				cursor := ""
+				for pages := 0; pages < 10; pages++ {
+					q, _ := url.ParseQuery(tc.query)
+					q.Set("limit", limit)
+					if cursor != "" {
+						q.Set("cursor", cursor)
+					}
+					lq, err := parseListQuery(httptest.NewRequest(http.MethodGet, "/?"+q.Encode(), nil), spec)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var page []map[string]any
+					page, cursor = lq.page(items)
+					for _, it := range page {
+						got = append(got, it["name"].(string))
+					}
+					if cursor == "" {
+						break
+					}
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("got %v, want %v", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+func TestListQueryRejects(t *testing.T) {
+	spec := listSpec{idField: "name", sorts: []string{"address"}, defaultSort: "name"}
+	for _, query := range []string{
+		"limit=0",
+		"limit=1001",
+		"limit=x",
+		"sort=public_key",
+		"cursor=garbage",
+		// A cursor from one sort order can't continue another.
+		"sort=address&cursor=WyJuYW1lIiwicGVlcjEiLCJwZWVyMSJd",
+	} {
+		if _, err := parseListQuery(httptest.NewRequest(http.MethodGet, "/?"+query, nil), spec); err == nil {
+			t.Errorf("%s: accepted", query)
+		}
+	}
+}
+
+func TestPeerListIsPaged(t *testing.T) {
+	s := newTestServer(t, nil)
+	w := serve(s.apiPeers, http.MethodGet, "/api/peers?limit=1&token="+testAdminToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Peers      []map[string]any `json:"peers"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 1 || resp.Peers[0]["name"] != "peer1" || resp.NextCursor == "" {
+		t.Fatalf("first page = %+v", resp)
+	}
+
+	w = serve(s.apiPeers, http.MethodGet, "/api/peers?limit=1&cursor="+resp.NextCursor+"&token="+testAdminToken)
+	resp.Peers, resp.NextCursor = nil, ""
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 1 || resp.Peers[0]["name"] != "peer2" || resp.NextCursor != "" {
+		t.Errorf("second page = %+v", resp)
+	}
+}
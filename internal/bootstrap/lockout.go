@@ -0,0 +1,180 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenGuard slows down token guessing per client address. Every request
+// that presents a token spends from a per-minute allowance, and after a
+// few wrong tokens in a row the address is locked out for a period that
+// doubles with each further miss. The bootstrap token is all that stands
+// between a stranger and a working VPN config, so guessing has to be
+// impractical even for a short or reused token.
+//
+// State is in memory: a restart clears lockouts, which is fine since a
+// restart is far slower than the guesses it would forgive.
+type tokenGuard struct {
+	perMinute int
+	threshold int
+	base, max time.Duration
+
+	mu       sync.Mutex
+	clients  map[string]*tokenClient
+	lockouts int // lockouts started since the process began, for /metrics
+}
+
+type tokenClient struct {
+	allowance   float64
+	lastRefill  time.Time
+	failures    int
+	lockedUntil time.Time
+	lastSeen    time.Time
+}
+
+// maxTokenClients bounds the table; idle entries are pruned past it.
+const maxTokenClients = 4096
+
+func newTokenGuard(perMinute, threshold int, base, max time.Duration) *tokenGuard {
+	if perMinute <= 0 && threshold <= 0 {
+		return nil
+	}
+	return &tokenGuard{perMinute: perMinute, threshold: threshold, base: base, max: max, clients: map[string]*tokenClient{}}
+}
+
+func (g *tokenGuard) client(ip string, now time.Time) *tokenClient {
+	c, ok := g.clients[ip]
+	if !ok {
+		if len(g.clients) >= maxTokenClients {
+			g.prune(now)
+		}
+		c = &tokenClient{allowance: float64(g.perMinute), lastRefill: now}
+		g.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c
+}
+
+// prune forgets addresses that are neither locked out nor seen within
+// the longest lockout.
+func (g *tokenGuard) prune(now time.Time) {
+	for ip, c := range g.clients {
+		if now.After(c.lockedUntil) && now.Sub(c.lastSeen) > max(g.max, time.Hour) {
+			delete(g.clients, ip)
+		}
+	}
+}
+
+// allow spends one attempt for ip at now. When it can't, it says how long
+// the client should wait.
+func (g *tokenGuard) allow(ip string, now time.Time) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := g.client(ip, now)
+	if now.Before(c.lockedUntil) {
+		return c.lockedUntil.Sub(now), false
+	}
+	if g.perMinute <= 0 {
+		return 0, true
+	}
+	rate := float64(g.perMinute) / 60
+	c.allowance = min(c.allowance+now.Sub(c.lastRefill).Seconds()*rate, float64(g.perMinute))
+	c.lastRefill = now
+	if c.allowance < 1 {
+		return time.Duration((1 - c.allowance) / rate * float64(time.Second)), false
+	}
+	c.allowance--
+	return 0, true
+}
+
+// fail records a wrong token from ip at now and returns the lockout it
+// started, if any: base after threshold misses, then twice as long per
+// further miss, up to max.
+func (g *tokenGuard) fail(ip string, now time.Time) (int, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := g.client(ip, now)
+	c.failures++
+	if g.threshold <= 0 || c.failures < g.threshold {
+		return c.failures, 0
+	}
+	lock := g.base
+	for i := g.threshold; i < c.failures && lock < g.max; i++ {
+		lock *= 2
+	}
+	lock = min(lock, g.max)
+	c.lockedUntil = now.Add(lock)
+	g.lockouts++
+	return c.failures, lock
+}
+
+// succeed clears ip's miss count after a correct token.
+func (g *tokenGuard) succeed(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.clients[ip]; ok {
+		c.failures = 0
+	}
+}
+
+// stats reports the addresses locked out right now and the lockouts
+// started since the process began.
+func (g *tokenGuard) stats() (locked, total int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	for _, c := range g.clients {
+		if now.Before(c.lockedUntil) {
+			locked++
+		}
+	}
+	return locked, g.lockouts
+}
+
+// guardTokens turns away requests that present a token while their
+// address is locked out or over its allowance. It sits in front of every
+// route, so endpoints added later are covered without opting in;
+// requests without a token pass untouched.
+func (s Server) guardTokens(next http.Handler) http.Handler {
+	if s.tokenGuard == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestToken(r) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wait, ok := s.tokenGuard.allow(s.clientIP(r), time.Now()); !ok {
+			slog.Warn("token attempt refused", "component", "auth", "client", s.clientIP(r), "path", r.URL.Path, "retry_after", wait.Round(time.Second).String(), "request_id", requestID(r))
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(wait.Seconds()+0.5), 1)))
+			httpError(w, r, "too many token attempts, retry later", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// noteTokenAttempt feeds the outcome of a token check into the lockout.
+// It is only called by routes that require a token, so a request that
+// brings none counts as a miss too; otherwise probing them would be free.
+func (s Server) noteTokenAttempt(r *http.Request, tok string, ok bool) {
+	if s.tokenGuard == nil {
+		return
+	}
+	ip := s.clientIP(r)
+	if ok {
+		s.tokenGuard.succeed(ip)
+		return
+	}
+	failures, lock := s.tokenGuard.fail(ip, time.Now())
+	if lock == 0 {
+		return
+	}
+	slog.Warn("locked out after bad tokens", "component", "auth", "event", eventTokenLockout, "client", ip, "failures", failures, "duration", lock.String(), "request_id", requestID(r))
+	s.recordEvent(eventTokenLockout, "%s locked out for %s after %d wrong tokens", ip, lock, failures)
+}
@@ -0,0 +1,116 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var guardStart = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestTokenGuardRefill(t *testing.T) {
+	g := newTokenGuard(6, 0, 0, 0) // one attempt every 10s
+	for i := 0; i < 6; i++ {
+		if _, ok := g.allow("a", guardStart); !ok {
+			t.Fatalf("attempt %d refused within the allowance", i+1)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		at       time.Duration
+		ok       bool
+		wantWait time.Duration
+	}{
+		{"allowance spent", 0, false, 10 * time.Second},
+		{"partly refilled", 4 * time.Second, false, 6 * time.Second},
+		{"one attempt back", 10 * time.Second, true, 0},
+		{"spent again", 10 * time.Second, false, 10 * time.Second},
+		{"refill is capped", time.Hour, true, 0},
+	}
+	for _, tc := range cases {
+		wait, ok := g.allow("a", guardStart.Add(tc.at))
+		if ok != tc.ok || (wait-tc.wantWait).Abs() > time.Millisecond {
+			t.Errorf("%s: allow = %s, %v; want %s, %v", tc.name, wait, ok, tc.wantWait, tc.ok)
+		}
+	}
+	// After an hour the bucket holds at most perMinute attempts.
+	n := 1
+	for ; n < 10; n++ {
+		if _, ok := g.allow("a", guardStart.Add(time.Hour)); !ok {
+			break
+		}
+	}
+	if n != 6 {
+		t.Errorf("%d attempts after a long idle, want 6", n)
+	}
+	if _, ok := g.allow("b", guardStart); !ok {
+		t.Error("another address shares the first one's allowance")
+	}
+}
+
+func TestTokenGuardLockoutDoubling(t *testing.T) {
+	g := newTokenGuard(0, 3, time.Minute, 10*time.Minute)
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, w := range want {
+		failures, lock := g.fail("a", guardStart)
+		if failures != i+1 || lock != w {
+			t.Errorf("miss %d: got %d, %s; want %d, %s", i+1, failures, lock, i+1, w)
+		}
+	}
+	if _, total := g.stats(); total != 6 {
+		t.Errorf("lockouts started = %d, want 6", total)
+	}
+
+	g.succeed("a")
+	if _, lock := g.fail("a", guardStart); lock != 0 {
+		t.Errorf("lockout %s on the first miss after a correct token", lock)
+	}
+}
+
+func TestTokenGuardLockoutExpiry(t *testing.T) {
+	g := newTokenGuard(0, 2, time.Minute, time.Hour)
+	g.fail("a", guardStart)
+	g.fail("a", guardStart) // locked until guardStart+1m
+
+	cases := []struct {
+		name     string
+		at       time.Duration
+		ok       bool
+		wantWait time.Duration
+	}{
+		{"just locked", 0, false, time.Minute},
+		{"halfway", 30 * time.Second, false, 30 * time.Second},
+		{"expired", time.Minute, true, 0},
+	}
+	for _, tc := range cases {
+		wait, ok := g.allow("a", guardStart.Add(tc.at))
+		if ok != tc.ok || wait != tc.wantWait {
+			t.Errorf("%s: allow = %s, %v; want %s, %v", tc.name, wait, ok, tc.wantWait, tc.ok)
+		}
+	}
+	if _, ok := g.allow("b", guardStart); !ok {
+		t.Error("lockout applied to another address")
+	}
+}
+
+// Probing a token-gated route without any token counts as a miss.
+func TestMissingTokenCountsTowardsLockout(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.tokenGuard = newTokenGuard(0, 2, time.Minute, time.Hour)
+	for i := 0; i < 2; i++ {
+		if w := serve(s.apiTokens, http.MethodGet, "/api/tokens"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+	}
+
+	h := s.guardTokens(http.HandlerFunc(s.apiTokens))
+	r := httptest.NewRequest(http.MethodGet, "/api/tokens?token="+testAdminToken, nil)
+	r.RemoteAddr = "198.51.100.7:40000"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After %q; want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+}
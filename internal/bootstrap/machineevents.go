@@ -0,0 +1,123 @@
+package bootstrap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/fly"
+)
+
+// machineEventInterval is how often we poll the Machines API while awake.
+// Suspend/resume doesn't restart the process, so a boot-time poll alone
+// would miss suspends that happened in between.
+const machineEventInterval = 15 * time.Minute
+
+// machineEventRecord is one line of the machine event log on the volume.
+type machineEventRecord struct {
+	fly.MachineEvent
+
+	// DuringSession is set for stop/suspend events that fell inside an
+	// inferred client session, i.e. Fly put the machine to sleep while a
+	// client was (as far as we could tell) connected.
+	DuringSession bool `json:"during_session,omitempty"`
+}
+
+// machineEventLoop records Fly machine lifecycle transitions into
+// /config/machine_events.jsonl and correlates them with keepalive sessions.
+func (s Server) machineEventLoop(client fly.Client, machineID string) {
+	path := s.cfg.MachineEventsPath()
+	last, err := lastRecordedEvent(path)
+	if err != nil {
+		slog.Warn("cannot read history", "component", "machine-events", "path", path, "error", err)
+		return
+	}
+
+	for {
+		last = s.recordMachineEvents(client, machineID, path, last)
+		time.Sleep(machineEventInterval)
+	}
+}
+
+// recordMachineEvents appends events newer than last and returns the new
+// high-water mark.
+func (s Server) recordMachineEvents(client fly.Client, machineID, path string, last int64) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	events, err := client.MachineEvents(ctx, machineID)
+	if err != nil {
+		slog.Warn("fetch failed", "component", "machine-events", "error", err)
+		return last
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Timestamp < events[j].Timestamp })
+
+	state, err := loadKeepaliveState(s.cfg.KeepaliveStatePath())
+	if err != nil {
+		slog.Warn("cannot load session state, skipping correlation", "component", "machine-events", "error", err)
+	}
+
+	// Leave the high-water mark alone so the events are picked up once
+	// there's room again.
+	if s.historyPaused() {
+		return last
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Warn("cannot open history", "component", "machine-events", "error", err)
+		return last
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, ev := range events {
+		if ev.Timestamp <= last {
+			continue
+		}
+		rec := machineEventRecord{MachineEvent: ev}
+		if ev.Type == "stop" || ev.Type == "suspend" {
+			rec.DuringSession = state.inSession(ev.Time())
+		}
+		if err := enc.Encode(rec); err != nil {
+			slog.Warn("write failed", "component", "machine-events", "error", err)
+			return last
+		}
+		if rec.DuringSession {
+			slog.Warn("machine state changed while a client session was active", "component", "machine-events",
+				"status", ev.Status, "at", ev.Time().Format(time.RFC3339))
+		} else {
+			slog.Info("recorded machine event", "component", "machine-events", "type", ev.Type, "status", ev.Status, "at", ev.Time().Format(time.RFC3339))
+		}
+		last = ev.Timestamp
+	}
+	return last
+}
+
+// lastRecordedEvent returns the newest timestamp already in the log.
+func lastRecordedEvent(path string) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var last int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec machineEventRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil && rec.Timestamp > last {
+			last = rec.Timestamp
+		}
+	}
+	return last, scanner.Err()
+}
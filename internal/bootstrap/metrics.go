@@ -0,0 +1,164 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// keepaliveStatus mirrors the keepalive loop's state for /metrics and the
+// admin page. The loop owns the real state; this is a read-only copy.
+var keepaliveStatus struct {
+	sync.Mutex
+	cur keepaliveSnapshot
+}
+
+type keepaliveSnapshot struct {
+	Running   bool
+	Connected bool
+	Idle      time.Duration
+	Started   time.Time
+	LastTick  time.Time
+}
+
+func keepaliveTicked(connected bool, idle time.Duration) {
+	keepaliveStatus.Lock()
+	defer keepaliveStatus.Unlock()
+	started := keepaliveStatus.cur.Started
+	if !keepaliveStatus.cur.Running {
+		started = time.Now()
+	}
+	keepaliveStatus.cur = keepaliveSnapshot{Running: true, Connected: connected, Idle: idle, Started: started, LastTick: time.Now()}
+}
+
+func keepaliveStopped() {
+	keepaliveStatus.Lock()
+	defer keepaliveStatus.Unlock()
+	keepaliveStatus.cur.Running = false
+	keepaliveStatus.cur.Connected = false
+}
+
+func currentKeepalive() keepaliveSnapshot {
+	keepaliveStatus.Lock()
+	defer keepaliveStatus.Unlock()
+	return keepaliveStatus.cur
+}
+
+// promWriter writes the Prometheus text format, emitting each metric's
+// HELP and TYPE lines once.
+type promWriter struct {
+	w    io.Writer
+	seen map[string]bool
+}
+
+func (p *promWriter) sample(name, typ, help string, labels map[string]string, v float64) {
+	if !p.seen[name] {
+		p.seen[name] = true
+		fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	if len(labels) == 0 {
+		fmt.Fprintf(p.w, "%s %g\n", name, v)
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, k, v)
+	}
+	fmt.Fprintf(p.w, "%s{%s} %g\n", name, strings.Join(pairs, ","), v)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metrics serves /metrics in the Prometheus text format: per-peer
+// transfer and handshake age, the connected-peer count, keepalive state
+// and bootstrap counters. Scrapers authenticate with the bootstrap token
+// as a bearer token; it is disabled without one.
+func (s Server) metrics(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	p := &promWriter{w: w, seen: map[string]bool{}}
+
+	dev, err := wg.Show(s.cfg.WGInterface)
+	p.sample("wireguard_up", "gauge", "Whether the WireGuard interface could be read.", nil, boolGauge(err == nil))
+	if err == nil {
+		names := s.peerNamesByKey()
+		infra := s.infraPeerKeys()
+		connected := 0
+		for _, peer := range dev.Peers {
+			labels := map[string]string{"public_key": peer.PublicKey, "peer": names[peer.PublicKey]}
+			p.sample("wireguard_peer_receive_bytes_total", "counter", "Bytes received from the peer.", labels, float64(peer.ReceiveBytes))
+			p.sample("wireguard_peer_transmit_bytes_total", "counter", "Bytes sent to the peer.", labels, float64(peer.TransmitBytes))
+			if !peer.LastHandshake.IsZero() {
+				age := time.Since(peer.LastHandshake)
+				p.sample("wireguard_peer_last_handshake_age_seconds", "gauge", "Seconds since the peer's latest handshake.", labels, age.Seconds())
+				if age <= s.cfg.KeepaliveMaxIdle && !infra[peer.PublicKey] {
+					connected++
+				}
+			}
+		}
+		p.sample("wireguard_connected_peers", "gauge", "Peers, excluding infrastructure peers, with a handshake within the keepalive idle limit.", nil, float64(connected))
+	}
+
+	ks := currentKeepalive()
+	p.sample("wgvpn_keepalive_running", "gauge", "Whether the keepalive loop is holding the machine awake.", nil, boolGauge(ks.Running))
+	p.sample("wgvpn_keepalive_connected", "gauge", "Whether the keepalive loop considers a client connected.", nil, boolGauge(ks.Connected))
+	if !ks.LastTick.IsZero() {
+		p.sample("wgvpn_keepalive_idle_seconds", "gauge", "Idle time measured at the last keepalive tick.", nil, ks.Idle.Seconds())
+		p.sample("wgvpn_keepalive_last_tick_timestamp_seconds", "gauge", "Unix time of the last keepalive tick.", nil, float64(ks.LastTick.Unix()))
+	}
+	if s.explicitSuspend() {
+		p.sample("wgvpn_suspend_requests_total", "counter", "Suspend requests sent to the Machines API.", nil, float64(suspendRequests.Load()))
+		p.sample("wgvpn_suspend_failures_total", "counter", "Suspend requests the Machines API refused or that failed before suspending.", nil, float64(suspendFailures.Load()))
+		if t := lastSuspendRequest.Load(); t > 0 {
+			p.sample("wgvpn_last_suspend_request_timestamp_seconds", "gauge", "Unix time of the last suspend request.", nil, float64(t))
+		}
+	}
+	if st, err := loadKeepaliveState(s.cfg.KeepaliveStatePath()); err == nil {
+		p.sample("wgvpn_sessions_total", "counter", "Client sessions seen since the volume was created.", nil, float64(st.Sessions))
+		p.sample("wgvpn_session_seconds_total", "counter", "Total connected time across finished sessions.", nil, float64(st.SessionSeconds))
+	}
+
+	if s.tokenGuard != nil {
+		locked, total := s.tokenGuard.stats()
+		p.sample("wgvpn_token_locked_clients", "gauge", "Client addresses locked out after wrong tokens.", nil, float64(locked))
+		p.sample("wgvpn_token_lockouts_total", "counter", "Lockouts started since the process began.", nil, float64(total))
+	}
+
+	_, err = os.Stat(s.cfg.BootstrapDonePath())
+	p.sample("wgvpn_bootstrap_done", "gauge", "Whether the one-time bootstrap link has been used.", nil, boolGauge(err == nil))
+	if s.cfg.Analytics {
+		if counts, err := s.funnelCounts(time.Time{}); err == nil {
+			for _, stage := range []string{funnelOpened, funnelRejected, funnelFinalized, funnelRedelivered, funnelFirstHandshake} {
+				p.sample("wgvpn_bootstrap_funnel_events", "gauge", "Bootstrap funnel events within the analytics retention period.",
+					map[string]string{"stage": stage}, float64(counts[stage]))
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package bootstrap
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bootstrapMu serializes every read-modify-write of the one-time link's
+// state: the done marker and the re-delivery record. Without it two
+// visitors racing on /bootstrap could both see "not done yet", or a
+// re-arm could land between the check and the write.
+var bootstrapMu sync.Mutex
+
+// claimBootstrap atomically decides whether r may receive the config and
+// records the delivery. The first caller creates the done marker with
+// O_EXCL, so exactly one first delivery happens even across processes
+// (the console runs as a separate process). Later callers only get
+// through as a re-delivery to the original client.
+func (s Server) claimBootstrap(r *http.Request) (redeliver, ok bool) {
+	bootstrapMu.Lock()
+	defer bootstrapMu.Unlock()
+
+	f, err := os.OpenFile(s.bootstrapDonePath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	switch {
+	case err == nil:
+		_, _ = f.WriteString(time.Now().Format(time.RFC3339))
+		f.Close()
+	case errors.Is(err, fs.ErrExist):
+		if !s.canRedeliver(r) {
+			return false, false
+		}
+		redeliver = true
+	default:
+		// Matches the old behaviour of serving even when the marker can't
+		// be written; checkStartup already refuses an unwritable volume.
+		slog.Error("failed to write done marker", "component", "bootstrap", "error", err, "request_id", requestID(r))
+	}
+
+	if err := s.recordDelivery(r, redeliver); err != nil {
+		slog.Warn("failed to record delivery", "component", "bootstrap", "error", err, "request_id", requestID(r))
+	}
+	return redeliver, true
+}
+
+// rearmBootstrap reopens the one-time link, also clearing the re-delivery
+// record so the next visitor gets a normal first delivery.
+func (s Server) rearmBootstrap() error {
+	bootstrapMu.Lock()
+	defer bootstrapMu.Unlock()
+
+	for _, p := range []string{s.bootstrapDonePath(), s.redeliveryPath()} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	// Re-arming opens a fresh BOOTSTRAP_TTL window.
+	return writeFileAtomic(s.bootstrapCreatedPath(), []byte(time.Now().UTC().Format(time.RFC3339)), 0o600)
+}
+
+// bootstrapDone reports whether the one-time link has been used.
+func (s Server) bootstrapDone() bool {
+	bootstrapMu.Lock()
+	defer bootstrapMu.Unlock()
+	_, err := os.Stat(s.bootstrapDonePath())
+	return err == nil
+}
+
+// bootstrapOpenedAt returns when the one-time link opened: when the peer's
+// config was generated, or when the link was last re-armed. The first call
+// records the config's modification time, so later rewrites of the config
+// (a key rotation, an AllowedIPs change) don't restart the clock. ok is
+// false while there is no config yet.
+func (s Server) bootstrapOpenedAt() (t time.Time, ok bool) {
+	path := s.bootstrapCreatedPath()
+	if b, err := os.ReadFile(path); err == nil {
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(b))); err == nil {
+			return t, true
+		}
+		slog.Warn("ignoring malformed creation time", "component", "bootstrap", "path", path)
+	}
+	fi, err := os.Stat(s.cfg.PeerConfigPath())
+	if err != nil {
+		return time.Time{}, false
+	}
+	t = fi.ModTime().UTC().Truncate(time.Second)
+	if err := os.WriteFile(path, []byte(t.Format(time.RFC3339)), 0o600); err != nil {
+		slog.Warn("cannot record creation time", "component", "bootstrap", "error", err)
+	}
+	return t, true
+}
+
+// bootstrapExpired reports whether BOOTSTRAP_TTL has run out for the
+// one-time link, whether or not anyone visited it, so a forgotten deploy
+// doesn't leave the config up for grabs indefinitely.
+func (s Server) bootstrapExpired() bool {
+	if s.cfg.BootstrapTTL <= 0 {
+		return false
+	}
+	bootstrapMu.Lock()
+	defer bootstrapMu.Unlock()
+	opened, ok := s.bootstrapOpenedAt()
+	return ok && time.Since(opened) > s.cfg.BootstrapTTL
+}
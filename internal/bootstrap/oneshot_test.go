@@ -0,0 +1,125 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// hammer runs n copies of fn at once and returns how many returned true.
+func hammer(n int, fn func() bool) int {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		count int
+		start = make(chan struct{})
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if fn() {
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return count
+}
+
+func fetchOK(s Server, target string) bool {
+	return serve(s.bootstrap, http.MethodGet, target).Code == http.StatusOK
+}
+
+func TestConcurrentClaimServesOnce(t *testing.T) {
+	s := newTestServer(t, nil)
+	if n := hammer(20, func() bool { return fetchOK(s, "/bootstrap?token="+testAdminToken) }); n != 1 {
+		t.Errorf("%d requests got the config, want 1", n)
+	}
+}
+
+func TestConcurrentRedeliveryKeepsCount(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.RedeliveryWindow = time.Hour
+		c.RedeliveryMax = 3
+	})
+	if !fetchOK(s, "/bootstrap?token="+testAdminToken) {
+		t.Fatal("first delivery failed")
+	}
+	if n := hammer(20, func() bool { return fetchOK(s, "/bootstrap?token="+testAdminToken) }); n != 3 {
+		t.Errorf("%d re-deliveries, want 3", n)
+	}
+	rd, err := s.loadRedelivery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rd.Count != 3 {
+		t.Errorf("recorded count = %d, want 3", rd.Count)
+	}
+}
+
+func TestRearmDuringClaims(t *testing.T) {
+	s := newTestServer(t, nil)
+	const rearms = 5
+	var served int
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		served = hammer(30, func() bool { return fetchOK(s, "/bootstrap?token="+testAdminToken) })
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rearms; i++ {
+			if err := s.rearmBootstrap(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+	// Every delivery closes the link and every re-arm opens it once.
+	if served < 1 || served > rearms+1 {
+		t.Errorf("%d deliveries with %d re-arms", served, rearms)
+	}
+}
+
+// A link checked before a rotation must not hand out the rotated config.
+func TestRotateDuringDelivery(t *testing.T) {
+	oldKey := "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	for i := 0; i < 200; i++ {
+		s := newTestServer(t, nil)
+		r := httptest.NewRequest(http.MethodGet, "/bootstrap/peer2?token="+s.peerBootstrapToken("peer2"), nil)
+
+		var (
+			conf string
+			ok   bool
+			wg   sync.WaitGroup
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			conf, _, ok = s.forPeer("peer2").deliverConfig(httptest.NewRecorder(), r)
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := s.rotatePeer("peer2"); err != nil {
+				t.Error(err)
+			}
+		}()
+		wg.Wait()
+
+		if ok && !strings.Contains(conf, oldKey) {
+			t.Fatalf("old link served the rotated config after %d rounds", i)
+		}
+	}
+}
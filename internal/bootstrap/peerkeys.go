@@ -0,0 +1,302 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// revokedPeer is a peer taken off the interface through
+// /api/peers/<name>/revoke. Its files stay on the volume, and the sidecar
+// would put it back from PEERS on its next start, so the key is recorded
+// to be removed again.
+type revokedPeer struct {
+	Name      string    `json:"name"`
+	PublicKey string    `json:"public_key"`
+	Revoked   time.Time `json:"revoked"`
+}
+
+func (s Server) loadRevokedPeers() []revokedPeer {
+	var peers []revokedPeer
+	b, err := os.ReadFile(s.cfg.RevokedPeersPath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read revocations", "component", "peers", "error", err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &peers); err != nil {
+		slog.Warn("revocations file is corrupt", "component", "peers", "error", err)
+		return nil
+	}
+	return peers
+}
+
+func (s Server) saveRevokedPeers(peers []revokedPeer) error {
+	b, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.RevokedPeersPath(), b, 0o600)
+}
+
+// peerRevoked reports whether name is revoked and not yet re-keyed.
+func (s Server) peerRevoked(name string) bool {
+	for _, p := range s.loadRevokedPeers() {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// peerAddress returns the tunnel address from name's config.
+func (s Server) peerAddress(name string) (netip.Addr, string, error) {
+	b, err := os.ReadFile(filepath.Join(s.cfg.ConfigDir, name, name+".conf"))
+	if err != nil {
+		return netip.Addr{}, "", err
+	}
+	iface, _ := parseConfSections(string(b))
+	a, _, _ := strings.Cut(iface["Address"], ",")
+	a, _, _ = strings.Cut(strings.TrimSpace(a), "/")
+	addr, err := netip.ParseAddr(a)
+	return addr, string(b), err
+}
+
+// peerPublicKey returns name's public key, derived from the config's
+// private key when there is no publickey-<name> file.
+func (s Server) peerPublicKey(name string) (string, error) {
+	dir := filepath.Join(s.cfg.ConfigDir, name)
+	if b, err := os.ReadFile(filepath.Join(dir, "publickey-"+name)); err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	b, err := os.ReadFile(filepath.Join(dir, name+".conf"))
+	if err != nil {
+		return "", err
+	}
+	iface, _ := parseConfSections(string(b))
+	return wg.PublicKey(iface["PrivateKey"])
+}
+
+// revokePeer takes name off the interface so its key stops working at
+// once. The peer keeps its address and files; rotating it issues a new
+// key and lifts the revocation.
+func (s Server) revokePeer(name string) error {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+
+	dir := filepath.Join(s.cfg.ConfigDir, name)
+	if !isPeerDir(dir, name) {
+		return errPeerNotFound
+	}
+	key, err := s.peerPublicKey(name)
+	if err != nil {
+		return err
+	}
+	if err := wg.RemovePeer(s.cfg.WGInterface, key); err != nil {
+		slog.Warn("cannot remove from the interface", "component", "peers", "peer", name, "error", err)
+	}
+	// A link the lost device still has must not open the config that
+	// rotating the peer later produces.
+	if err := s.bumpPeerLinkGeneration(name); err != nil {
+		return err
+	}
+
+	revoked := s.loadRevokedPeers()
+	for _, p := range revoked {
+		if p.Name == name {
+			return nil
+		}
+	}
+	return s.saveRevokedPeers(append(revoked, revokedPeer{Name: name, PublicKey: key, Revoked: time.Now().UTC()}))
+}
+
+// rotatePeer gives name a new key pair and preshared key at the same
+// address, swaps it in on the interface, and re-opens the peer's one-time
+// bootstrap link so the device can fetch the new config. The old key
+// stops working immediately.
+func (s Server) rotatePeer(name string) (string, error) {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+
+	dir := filepath.Join(s.cfg.ConfigDir, name)
+	if !isPeerDir(dir, name) {
+		return "", errPeerNotFound
+	}
+	addr, conf, err := s.peerAddress(name)
+	if err != nil {
+		return "", err
+	}
+	oldPub, _ := s.peerPublicKey(name)
+
+	priv, pub, err := wg.GenerateKeyPair()
+	if err != nil {
+		return "", err
+	}
+	psk, err := wg.GeneratePresharedKey()
+	if err != nil {
+		return "", err
+	}
+	// The sidecar rebuilds peer configs from these files on its next
+	// start, so they have to change along with the config.
+	files := map[string]string{
+		name + ".conf":         peerConfFromTemplate(conf, addr, priv, psk),
+		"privatekey-" + name:   priv + "\n",
+		"publickey-" + name:    pub + "\n",
+		"presharedkey-" + name: psk + "\n",
+	}
+	for f, content := range files {
+		if err := writeFileAtomic(filepath.Join(dir, f), []byte(content), 0o600); err != nil {
+			return "", err
+		}
+	}
+
+	if oldPub != "" {
+		if err := wg.RemovePeer(s.cfg.WGInterface, oldPub); err != nil {
+			slog.Warn("cannot remove old key from the interface", "component", "peers", "peer", name, "error", err)
+		}
+	}
+	if err := s.applyPeer(apiPeer{Name: name, PublicKey: pub, Address: addr.String()}); err != nil {
+		slog.Warn("rotated but not applied", "component", "peers", "peer", name, "error", err)
+	}
+
+	peers := s.loadAPIPeers()
+	for i := range peers {
+		if peers[i].Name == name {
+			peers[i].PublicKey = pub
+			if err := s.saveAPIPeers(peers); err != nil {
+				return "", err
+			}
+		}
+	}
+	revoked := s.loadRevokedPeers()
+	for i, p := range revoked {
+		if p.Name == name {
+			if err := s.saveRevokedPeers(append(revoked[:i], revoked[i+1:]...)); err != nil {
+				return "", err
+			}
+			break
+		}
+	}
+
+	// Old links and onboarding tokens would otherwise open the new config.
+	if err := s.bumpPeerLinkGeneration(name); err != nil {
+		return "", err
+	}
+	if err := s.forPeer(name).rearmBootstrap(); err != nil {
+		return "", err
+	}
+	return pub, nil
+}
+
+// removeRevokedPeers takes revoked keys off the interface again after
+// the sidecar re-creates it.
+func (s Server) removeRevokedPeers() {
+	for _, p := range s.loadRevokedPeers() {
+		if err := wg.RemovePeer(s.cfg.WGInterface, p.PublicKey); err != nil {
+			slog.Warn("cannot remove revoked peer", "component", "peers", "peer", p.Name, "error", err)
+		}
+	}
+}
+
+// apiPeerAction serves POST /api/peers/<name>/rotate and
+// /api/peers/<name>/revoke, for a lost or compromised device, and
+// /api/peers/<name>/restore for an API peer deleted by mistake. Rotate
+// and revoke work on any peer, including the sidecar's.
+func (s Server) apiPeerAction(w http.ResponseWriter, r *http.Request, name, action string) {
+	if r.Method != http.MethodPost {
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+	if name != filepath.Base(name) || reservedDirs[name] {
+		httpError(w, r, errPeerNotFound.Error(), 404)
+		return
+	}
+
+	switch action {
+	case "revoke":
+		err := s.revokePeer(name)
+		switch {
+		case errors.Is(err, errPeerNotFound):
+			httpError(w, r, err.Error(), 404)
+			return
+		case err != nil:
+			slog.Error("cannot revoke", "component", "peers", "peer", name, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not revoke peer", 500)
+			return
+		}
+		slog.Info("revoked", "component", "peers", "event", eventPeerRevoked, "peer", name, "request_id", requestID(r))
+		s.recordEvent(eventPeerRevoked, "Peer %s revoked via the API; rotate it to issue a new key", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case "rotate":
+		pub, err := s.rotatePeer(name)
+		switch {
+		case errors.Is(err, errPeerNotFound):
+			httpError(w, r, err.Error(), 404)
+			return
+		case err != nil:
+			slog.Error("cannot rotate", "component", "peers", "peer", name, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not rotate peer", 500)
+			return
+		}
+		slog.Info("rotated", "component", "peers", "event", eventKeyRotated, "peer", name, "public_key", pub, "request_id", requestID(r))
+		if name == s.cfg.PeerName {
+			// Records the rotation and updates the known key, so the next
+			// start doesn't report it a second time.
+			s.checkPeerCreated()
+		} else {
+			s.recordEvent(eventKeyRotated, "Peer %s has a new key pair via the API (public key %s)", name, pub)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":          name,
+			"public_key":    pub,
+			"bootstrap_url": s.peerBootstrapURL(r, name),
+		})
+
+	case "restore":
+		// The response carries the new private key.
+		if s.cfg.PrivateOnly && !isPrivateNetworkRequest(r) {
+			http.NotFound(w, r)
+			return
+		}
+		p, conf, err := s.restorePeer(name)
+		switch {
+		case errors.Is(err, errPeerNotFound):
+			httpError(w, r, "no deleted peer by that name within PEER_DELETE_COOLDOWN", 404)
+			return
+		case errors.Is(err, errPeerExists), errors.Is(err, errAddressTaken), errors.Is(err, errDeviceBudget):
+			httpError(w, r, err.Error(), 409)
+			return
+		case err != nil:
+			slog.Error("cannot restore", "component", "peers", "peer", name, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not restore peer", 500)
+			return
+		}
+		slog.Info("restored", "component", "peers", "event", eventPeerRestored, "peer", name, "address", p.Address, "request_id", requestID(r))
+		s.recordEvent(eventPeerRestored, "Peer %s restored via the API at %s with a new key pair (public key %s)", name, p.Address, p.PublicKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":          p.Name,
+			"address":       p.Address,
+			"public_key":    p.PublicKey,
+			"config":        s.rewriteEndpoint(conf),
+			"bootstrap_url": s.peerBootstrapURL(r, p.Name),
+		})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,52 @@
+package bootstrap
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRotateInvalidatesOldLinks(t *testing.T) {
+	for _, action := range []string{"rotate", "revoke"} {
+		t.Run(action, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			oldLink := "/bootstrap/peer2?token=" + s.peerBootstrapToken("peer2")
+			minted, _, err := s.mintOnboardingToken("peer2", "phone", time.Hour, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, _, err := s.mintOnboardingToken("peer1", "laptop", time.Hour, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if action == "rotate" {
+				_, err = s.rotatePeer("peer2")
+			} else {
+				err = s.revokePeer("peer2")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if w := serve(s.bootstrapPeer, http.MethodGet, oldLink); w.Code == http.StatusOK {
+				t.Error("old per-peer link still opens the page")
+			}
+			if s.onboardingTokenOK(minted, "peer2") {
+				t.Error("onboarding token minted before the " + action + " still works")
+			}
+			if !s.onboardingTokenOK(other, "peer1") {
+				t.Error("another peer's onboarding token was revoked")
+			}
+		})
+	}
+
+	s := newTestServer(t, nil)
+	if _, err := s.rotatePeer("peer2"); err != nil {
+		t.Fatal(err)
+	}
+	newLink := "/bootstrap/peer2?token=" + s.peerBootstrapToken("peer2")
+	if w := serve(s.bootstrapPeer, http.MethodGet, newLink); w.Code != http.StatusOK {
+		t.Errorf("rotated link: status = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,175 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// peerBootstrapToken derives the token for /bootstrap/<peer> from the
+// bootstrap token and the peer's link generation, so each peer's link is
+// independent, rotating BOOTSTRAP_TOKEN invalidates all of them, and
+// rotating or revoking a peer invalidates that peer's old link.
+func (s Server) peerBootstrapToken(peer string) string {
+	label := "bootstrap-peer:" + peer
+	if gen := s.peerLinkGeneration(peer); gen > 0 {
+		// Generation 0 keeps the links issued before generations existed.
+		label += ":" + strconv.Itoa(gen)
+	}
+	m := hmac.New(sha256.New, []byte(s.cfg.BootstrapToken))
+	m.Write([]byte(label))
+	return hex.EncodeToString(m.Sum(nil))[:32]
+}
+
+func peerLinkGenerationPath(configDir, peer string) string {
+	return filepath.Join(configDir, peer, "bootstrap_generation")
+}
+
+// peerLinkGeneration is how many times peer's link has been invalidated.
+func (s Server) peerLinkGeneration(peer string) int {
+	b, err := os.ReadFile(peerLinkGenerationPath(s.cfg.ConfigDir, peer))
+	if err != nil {
+		return 0
+	}
+	gen, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return gen
+}
+
+// bumpPeerLinkGeneration invalidates every /bootstrap/<peer> link handed
+// out so far, and any onboarding token minted for peer.
+func (s Server) bumpPeerLinkGeneration(peer string) error {
+	gen := strconv.Itoa(s.peerLinkGeneration(peer) + 1)
+	if err := writeFileAtomic(peerLinkGenerationPath(s.cfg.ConfigDir, peer), []byte(gen+"\n"), 0o600); err != nil {
+		return err
+	}
+	return s.revokePeerOnboardingTokens(peer)
+}
+
+// peerClientToken derives the token a peer's own device uses for
+// /client-settings and /disconnect. It only reads that peer's non-key
+// settings or ends its session, so it is safe to leave in the updater
+// scripts on the device, unlike BOOTSTRAP_TOKEN.
+func (s Server) peerClientToken(peer string) string {
+	m := hmac.New(sha256.New, []byte(s.cfg.BootstrapToken))
+	m.Write([]byte("client-settings:" + peer))
+	return hex.EncodeToString(m.Sum(nil))[:32]
+}
+
+// clientPeer returns the peer a /client-settings or /disconnect request
+// names in ?peer= (the main peer by default), and whether r carries that
+// peer's client token.
+func (s Server) clientPeer(r *http.Request) (string, bool) {
+	peer := r.URL.Query().Get("peer")
+	if peer == "" {
+		peer = s.cfg.PeerName
+	}
+	if peer != filepath.Base(peer) || reservedDirs[peer] || !isPeerDir(filepath.Join(s.cfg.ConfigDir, peer), peer) {
+		return "", false
+	}
+	tok := requestToken(r)
+	ok := tokenEqual(tok, s.peerClientToken(peer))
+	s.noteTokenAttempt(r, tok, ok)
+	return peer, ok
+}
+
+// peerBootstrapURL is the one-time link for peer, or "" when per-peer
+// links are disabled.
+func (s Server) peerBootstrapURL(r *http.Request, peer string) string {
+	if s.cfg.BootstrapToken == "" {
+		return ""
+	}
+	return s.baseURL(r) + "/bootstrap/" + peer + "?token=" + s.peerBootstrapToken(peer)
+}
+
+// forPeer returns a copy of s that serves peer's one-time page. Peers
+// other than the main one keep their done marker and re-delivery record
+// in their own directory, so onboarding one device doesn't close the
+// link for the others.
+func (s Server) forPeer(peer string) Server {
+	s.linkPeer = peer
+	if peer != s.cfg.PeerName {
+		s.cfg.PeerName = peer
+		s.peerState = true
+	}
+	return s
+}
+
+func (s Server) bootstrapDonePath() string {
+	if s.peerState {
+		return filepath.Join(s.cfg.ConfigDir, s.cfg.PeerName, "bootstrap_done")
+	}
+	return s.cfg.BootstrapDonePath()
+}
+
+func (s Server) bootstrapCreatedPath() string {
+	if s.peerState {
+		return filepath.Join(s.cfg.ConfigDir, s.cfg.PeerName, "bootstrap_created")
+	}
+	return s.cfg.BootstrapCreatedPath()
+}
+
+func (s Server) redeliveryPath() string {
+	if s.peerState {
+		return filepath.Join(s.cfg.ConfigDir, s.cfg.PeerName, "bootstrap_redelivery.json")
+	}
+	return s.cfg.RedeliveryPath()
+}
+
+// bootstrapTokenOK checks r against the tokens for the link being served:
+// the peer's derived token on /bootstrap/<peer>, any BOOTSTRAP_TOKEN (if
+// set) on /bootstrap, and on both an unexpired onboarding token minted
+// for that peer.
+func (s Server) bootstrapTokenOK(r *http.Request) bool {
+	tok := r.URL.Query().Get("token")
+	ok := s.checkBootstrapToken(tok)
+	s.noteTokenAttempt(r, tok, ok)
+	return ok
+}
+
+func (s Server) checkBootstrapToken(tok string) bool {
+	if s.onboardingTokenOK(tok, s.cfg.PeerName) {
+		return true
+	}
+	if s.linkPeer != "" {
+		return tokenEqual(tok, s.peerBootstrapToken(s.linkPeer))
+	}
+	return s.cfg.BootstrapToken == "" || s.isAdminToken(tok)
+}
+
+type linkPeerKey struct{}
+
+// linkPeerName returns the peer a /bootstrap/<peer> request is for, so
+// downloads issued while rendering are named after it.
+func linkPeerName(r *http.Request) string {
+	p, _ := r.Context().Value(linkPeerKey{}).(string)
+	return p
+}
+
+// bootstrapPeer serves /bootstrap/<peer>: the same one-time page as
+// /bootstrap, for any peer directory on the volume. It needs
+// BOOTSTRAP_TOKEN to derive the per-peer tokens and is disabled without
+// one.
+func (s Server) bootstrapPeer(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	peer := strings.TrimPrefix(r.URL.Path, "/bootstrap/")
+	dir := filepath.Join(s.cfg.ConfigDir, peer)
+	if peer == "" || peer != filepath.Base(peer) || peer == ".." || !isPeerDir(dir, peer) {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, peer+".conf")); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), linkPeerKey{}, peer))
+	s.forPeer(peer).bootstrap(w, r)
+}
@@ -0,0 +1,600 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// apiPeer is a peer created through /api/peers. The sidecar only knows
+// about the peers in its PEERS list, so these are recorded on the volume
+// to be re-applied after it restarts and spared by the orphan cleanup.
+type apiPeer struct {
+	Name      string    `json:"name"`
+	PublicKey string    `json:"public_key"`
+	Address   string    `json:"address"`
+	Created   time.Time `json:"created"`
+	// Person is who the device belongs to, alongside those in PEOPLE.
+	Person string `json:"person,omitempty"`
+	// Expires is when a guest peer is deleted again.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// peersMu serializes address allocation, registry updates and every
+// rewrite of a peer's files. deliverConfig holds it for reading so a
+// one-time link never races a rotation or revocation of its peer.
+var peersMu sync.RWMutex
+
+// validPeerName keeps names usable as a directory and a file name suffix.
+// The directory name, prefix included, must also fit maxPeerDirLen.
+var validPeerName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// maxPeerDirLen is the longest interface name Linux accepts (IFNAMSIZ
+// less the NUL). wg-quick names the interface after the config file, so
+// a longer peer name gives a config that won't come up.
+const maxPeerDirLen = 15
+
+// reservedDirs are the sidecar's own directories under /config, and
+// names that /bootstrap/<peer> couldn't reach.
+var reservedDirs = map[string]bool{
+	"server": true, "wg_confs": true, "templates": true, "coredns": true,
+	"fetch": true, "kit": true, "publish": true, "sheet": true, "expire": true,
+}
+
+func (s Server) loadAPIPeers() []apiPeer {
+	var peers []apiPeer
+	b, err := os.ReadFile(s.cfg.APIPeersPath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read registry", "component", "peers", "error", err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &peers); err != nil {
+		slog.Warn("registry is corrupt", "component", "peers", "error", err)
+		return nil
+	}
+	return peers
+}
+
+func (s Server) saveAPIPeers(peers []apiPeer) error {
+	b, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.APIPeersPath(), b, 0o600)
+}
+
+// usedTunnelAddresses collects the Address of every peer config on the
+// volume.
+func (s Server) usedTunnelAddresses() map[netip.Addr]bool {
+	used := map[netip.Addr]bool{}
+	paths, _ := filepath.Glob(filepath.Join(s.cfg.ConfigDir, "*", "*.conf"))
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		iface, _ := parseConfSections(string(b))
+		for _, a := range strings.Split(iface["Address"], ",") {
+			a, _, _ = strings.Cut(strings.TrimSpace(a), "/")
+			if addr, err := netip.ParseAddr(a); err == nil {
+				used[addr] = true
+			}
+		}
+	}
+	return used
+}
+
+// nextFreeAddress returns the lowest unused host address in the tunnel
+// subnet. The sidecar gives itself .1, so allocation starts at .2.
+func (s Server) nextFreeAddress() (netip.Addr, error) {
+	prefix, err := tunnelPrefix(s.cfg.TunnelSubnet)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("INTERNAL_SUBNET: %w", err)
+	}
+	used := s.usedTunnelAddresses()
+	for _, d := range s.loadDeletedPeers() {
+		if addr, err := netip.ParseAddr(d.Address); err == nil && time.Since(d.Deleted) < s.cfg.PeerDeleteCooldown {
+			used[addr] = true
+		}
+	}
+	a := prefix.Addr().Next().Next()
+	for ; prefix.Contains(a); a = a.Next() {
+		if !used[a] && prefix.Contains(a.Next()) {
+			return a, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no free addresses left in %s", prefix)
+}
+
+// peerConfFromTemplate derives a new peer's config from the served peer's:
+// same server, DNS and routes, with its own address and keys. The preshared
+// key is added after the server's PublicKey if the template has none.
+func peerConfFromTemplate(tmpl string, addr netip.Addr, priv, psk string) string {
+	var out []string
+	section := ""
+	hasPSK := strings.Contains(tmpl, "PresharedKey")
+	for _, line := range strings.Split(tmpl, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			section = strings.ToLower(trimmed)
+		}
+		key, val, ok := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+		switch {
+		case ok && section == "[interface]" && key == "Address":
+			a := addr.String()
+			if strings.Contains(val, "/") {
+				a += "/32"
+			}
+			line = "Address = " + a
+		case ok && section == "[interface]" && key == "PrivateKey":
+			line = "PrivateKey = " + priv
+		case ok && section == "[peer]" && key == "PresharedKey":
+			line = "PresharedKey = " + psk
+		case ok && section == "[peer]" && key == "PublicKey" && !hasPSK:
+			out = append(out, line)
+			line = "PresharedKey = " + psk
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// apiPeerDir is the directory, and so the peer name, for a peer created
+// as name. The sidecar allocates addresses by scanning /config/peer*/, so
+// names are prefixed the way it names its own peers from PEERS=laptop
+// (peer_laptop); otherwise it could hand the same address out again.
+func apiPeerDir(name string) string {
+	if strings.HasPrefix(name, "peer") {
+		return name
+	}
+	return "peer_" + name
+}
+
+// createPeer writes a new peer directory in the sidecar's layout and adds
+// the peer to the running interface. A non-empty person counts the peer
+// against that person's PEOPLE_MAX_DEVICES.
+func (s Server) createPeer(name, person string) (apiPeer, string, error) {
+	return s.newPeer(apiPeer{Name: name, Person: person})
+}
+
+// Placeholders for the keys in a previewed config.
+const (
+	previewPrivateKey   = "(generated when the peer is created)"
+	previewPresharedKey = "(generated when the peer is created)"
+)
+
+// previewPeer runs createPeer's checks and renders the config it would
+// write, with placeholder keys and the address it would get if nothing
+// else is created first. Nothing is allocated or written.
+func (s Server) previewPeer(name, person string) (apiPeer, string, error) {
+	peersMu.RLock()
+	defer peersMu.RUnlock()
+
+	if _, err := os.Stat(filepath.Join(s.cfg.ConfigDir, name)); err == nil {
+		return apiPeer{}, "", errPeerExists
+	}
+	if _, ok := s.findDeletedPeer(name, time.Now()); ok {
+		return apiPeer{}, "", errPeerDeleted
+	}
+	if err := s.checkDeviceBudget(person); err != nil {
+		return apiPeer{}, "", err
+	}
+	addr, err := s.nextFreeAddress()
+	if err != nil {
+		return apiPeer{}, "", err
+	}
+	tmpl, err := s.peerConfig()
+	if err != nil {
+		return apiPeer{}, "", fmt.Errorf("template peer %s: %w", s.cfg.PeerName, err)
+	}
+	p := apiPeer{Name: name, Address: addr.String(), Person: person}
+	return p, peerConfFromTemplate(tmpl, addr, previewPrivateKey, previewPresharedKey), nil
+}
+
+// newPeer is createPeer for a peer with more than a name and person set.
+// It fills in the address and creation time.
+func (s Server) newPeer(p apiPeer) (apiPeer, string, error) {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+
+	name, person := p.Name, p.Person
+	if _, err := os.Stat(filepath.Join(s.cfg.ConfigDir, name)); err == nil {
+		return apiPeer{}, "", errPeerExists
+	}
+	if _, ok := s.findDeletedPeer(name, time.Now()); ok {
+		return apiPeer{}, "", errPeerDeleted
+	}
+	if err := s.checkDeviceBudget(person); err != nil {
+		return apiPeer{}, "", err
+	}
+	addr, err := s.nextFreeAddress()
+	if err != nil {
+		return apiPeer{}, "", err
+	}
+	p.Address, p.Created = addr.String(), time.Now().UTC()
+	return s.provisionPeer(p)
+}
+
+// provisionPeer generates keys for p at p.Address, writes its directory
+// and registry entry, and puts it on the interface. The caller holds
+// peersMu.
+func (s Server) provisionPeer(p apiPeer) (apiPeer, string, error) {
+	name := p.Name
+	addr, err := netip.ParseAddr(p.Address)
+	if err != nil {
+		return apiPeer{}, "", err
+	}
+	dir := filepath.Join(s.cfg.ConfigDir, name)
+	tmpl, err := s.peerConfig()
+	if err != nil {
+		return apiPeer{}, "", fmt.Errorf("template peer %s: %w", s.cfg.PeerName, err)
+	}
+	priv, pub, err := wg.GenerateKeyPair()
+	if err != nil {
+		return apiPeer{}, "", err
+	}
+	psk, err := wg.GeneratePresharedKey()
+	if err != nil {
+		return apiPeer{}, "", err
+	}
+	conf := peerConfFromTemplate(tmpl, addr, priv, psk)
+
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return apiPeer{}, "", err
+	}
+	files := map[string]string{
+		name + ".conf":         conf,
+		"privatekey-" + name:   priv + "\n",
+		"publickey-" + name:    pub + "\n",
+		"presharedkey-" + name: psk + "\n",
+	}
+	for f, content := range files {
+		if err := writeFileAtomic(filepath.Join(dir, f), []byte(content), 0o600); err != nil {
+			_ = os.RemoveAll(dir)
+			return apiPeer{}, "", err
+		}
+	}
+
+	p.PublicKey = pub
+	if err := s.saveAPIPeers(append(s.loadAPIPeers(), p)); err != nil {
+		_ = os.RemoveAll(dir)
+		return apiPeer{}, "", err
+	}
+	if err := s.applyPeer(p); err != nil {
+		// The files are in place; the peer comes up the next time the
+		// registry is re-applied.
+		slog.Warn("written but not applied", "component", "peers", "peer", name, "error", err)
+	}
+	return p, conf, nil
+}
+
+// applyPeer adds p to the running interface.
+func (s Server) applyPeer(p apiPeer) error {
+	addr, err := netip.ParseAddr(p.Address)
+	if err != nil {
+		return err
+	}
+	psk := filepath.Join(s.cfg.ConfigDir, p.Name, "presharedkey-"+p.Name)
+	if _, err := os.Stat(psk); err != nil {
+		psk = ""
+	}
+	return wg.SetPeer(s.cfg.WGInterface, p.PublicKey, []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())}, psk)
+}
+
+// removePeer takes an API-created peer off the interface and the volume.
+// Peers from the sidecar's PEERS list are refused: it would recreate them
+// on its next start. The keys go with the directory, but unless
+// PEER_DELETE_COOLDOWN is zero the name and address are kept aside so
+// restorePeer can bring the peer back.
+func (s Server) removePeer(name string) error {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+
+	peers := s.loadAPIPeers()
+	idx := -1
+	for i, p := range peers {
+		if p.Name == name {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		if _, err := os.Stat(filepath.Join(s.cfg.ConfigDir, name)); err == nil {
+			return errPeerNotManaged
+		}
+		return errPeerNotFound
+	}
+
+	p := peers[idx]
+	if err := wg.RemovePeer(s.cfg.WGInterface, p.PublicKey); err != nil {
+		slog.Warn("cannot remove from the interface", "component", "peers", "peer", name, "error", err)
+	}
+	gen := s.peerLinkGeneration(name)
+	if err := os.RemoveAll(filepath.Join(s.cfg.ConfigDir, name)); err != nil {
+		return err
+	}
+	if err := s.revokePeerOnboardingTokens(name); err != nil {
+		return err
+	}
+	if err := s.saveAPIPeers(append(peers[:idx], peers[idx+1:]...)); err != nil {
+		return err
+	}
+	// Guests are disposable; there is nothing to restore.
+	if s.cfg.PeerDeleteCooldown <= 0 || p.Person == guestPerson {
+		return nil
+	}
+	return s.recordDeletedPeer(deletedPeer{Name: name, Address: p.Address, Created: p.Created, Person: p.Person, Deleted: time.Now().UTC(), Generation: gen})
+}
+
+var (
+	errPeerExists     = errors.New("a peer with that name already exists")
+	errPeerNotFound   = errors.New("no such peer")
+	errPeerNotManaged = errors.New("peer is managed by the WireGuard container's PEERS setting")
+	errPeerDeleted    = errors.New("a peer with that name was deleted recently; restore it or wait for PEER_DELETE_COOLDOWN")
+)
+
+// reapplyAPIPeers puts API-created peers back on the interface after the
+// sidecar (re)creates it from PEERS alone, and takes revoked ones off
+// again. It waits for the interface to come up, giving up after a few
+// minutes.
+func (s Server) reapplyAPIPeers() {
+	peers := s.loadAPIPeers()
+	if len(peers) == 0 && len(s.loadRevokedPeers()) == 0 {
+		return
+	}
+	for deadline := time.Now().Add(5 * time.Minute); !s.wireGuardReady(); time.Sleep(5 * time.Second) {
+		if time.Now().After(deadline) {
+			slog.Warn("WireGuard not up; API peers not re-applied", "component", "peers", "peer_count", len(peers))
+			return
+		}
+	}
+	for _, p := range peers {
+		if !strings.HasPrefix(p.Name, "peer") {
+			slog.Warn("API peer directory is outside the sidecar's peer* scan; it may reuse this address for a new PEERS entry",
+				"component", "peers", "peer", p.Name, "address", p.Address)
+		}
+		if s.peerRevoked(p.Name) {
+			continue
+		}
+		if err := s.applyPeer(p); err != nil {
+			slog.Warn("cannot re-apply", "component", "peers", "peer", p.Name, "error", err)
+		}
+	}
+	s.removeRevokedPeers()
+	slog.Info("re-applied API peers", "component", "peers", "peer_count", len(peers))
+}
+
+// peerListSpec is what GET /api/peers filters and sorts on.
+var peerListSpec = listSpec{
+	idField:     "name",
+	filters:     []string{"source", "status", "person"},
+	sorts:       []string{"address", "created"},
+	defaultSort: "name",
+}
+
+// listPeers describes every peer directory on the volume.
+func (s Server) listPeers() []map[string]any {
+	managed := map[string]apiPeer{}
+	for _, p := range s.loadAPIPeers() {
+		managed[p.Name] = p
+	}
+	revoked := map[string]revokedPeer{}
+	for _, p := range s.loadRevokedPeers() {
+		revoked[p.Name] = p
+	}
+	owner := map[string]string{}
+	for person, peers := range s.people() {
+		for _, p := range peers {
+			owner[p] = person
+		}
+	}
+	entries, _ := os.ReadDir(s.cfg.ConfigDir)
+	out := []map[string]any{}
+	for _, e := range entries {
+		dir := filepath.Join(s.cfg.ConfigDir, e.Name())
+		if !e.IsDir() || !isPeerDir(dir, e.Name()) {
+			continue
+		}
+		p := map[string]any{"name": e.Name(), "source": "sidecar", "status": "active"}
+		if person, ok := owner[e.Name()]; ok {
+			p["person"] = person
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, "publickey-"+e.Name())); err == nil {
+			p["public_key"] = strings.TrimSpace(string(b))
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, e.Name()+".conf")); err == nil {
+			iface, _ := parseConfSections(string(b))
+			p["address"] = iface["Address"]
+		}
+		if m, ok := managed[e.Name()]; ok {
+			p["source"] = "api"
+			p["created"] = m.Created.Format(time.RFC3339)
+			if !m.Expires.IsZero() {
+				p["expires"] = m.Expires.Format(time.RFC3339)
+			}
+		}
+		if rv, ok := revoked[e.Name()]; ok {
+			p["revoked"] = rv.Revoked.Format(time.RFC3339)
+			p["status"] = "revoked"
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["name"].(string) < out[j]["name"].(string) })
+	return out
+}
+
+// newPeerRequest is the body of POST /api/peers and /api/peers/preview.
+type newPeerRequest struct {
+	Name   string `json:"name"`
+	Person string `json:"person"`
+}
+
+// readNewPeerRequest decodes and validates a newPeerRequest, answering
+// 400 itself when it is unusable.
+func readNewPeerRequest(w http.ResponseWriter, r *http.Request) (newPeerRequest, bool) {
+	var req newPeerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		httpError(w, r, "expected a JSON body like {\"name\": \"laptop\"}", 400)
+		return req, false
+	}
+	if !validPeerName.MatchString(req.Name) || reservedDirs[req.Name] || len(apiPeerDir(req.Name)) > maxPeerDirLen {
+		httpError(w, r, "invalid peer name: use letters, digits, '-' or '_', at most 15 with the peer_ prefix", 400)
+		return req, false
+	}
+	if req.Person != "" && (!validPeerName.MatchString(req.Person) || len(req.Person) > 32) {
+		httpError(w, r, "invalid person: use up to 32 letters, digits, '-' or '_'", 400)
+		return req, false
+	}
+	if req.Person == guestPerson {
+		httpError(w, r, "person \""+guestPerson+"\" is reserved for peers claimed through /guest", 400)
+		return req, false
+	}
+	return req, true
+}
+
+// apiPeers serves /api/peers (GET lists, POST {"name": ...} creates),
+// POST /api/peers/preview (renders without creating),
+// /api/peers/<name> (DELETE removes), and POST /api/peers/<name>/rotate
+// and /api/peers/<name>/revoke. New peers reuse the served peer's config
+// as a template. Requires the bootstrap token.
+func (s Server) apiPeers(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/peers"), "/")
+	name, action, _ := strings.Cut(name, "/")
+
+	w.Header().Set("Cache-Control", "no-store")
+	switch {
+	case action != "":
+		s.apiPeerAction(w, r, name, action)
+
+	case r.Method == http.MethodGet && name == "":
+		lq, err := parseListQuery(r, peerListSpec)
+		if err != nil {
+			httpError(w, r, err.Error(), 400)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		peers, next := lq.page(s.listPeers())
+		for _, p := range peers {
+			p["bootstrap_url"] = s.peerBootstrapURL(r, p["name"].(string))
+			p["client_token"] = s.peerClientToken(p["name"].(string))
+			_, err := os.Stat(s.forPeer(p["name"].(string)).bootstrapDonePath())
+			p["bootstrap_done"] = err == nil
+		}
+		deleted := []map[string]any{}
+		for _, d := range s.loadDeletedPeers() {
+			if until := d.Deleted.Add(s.cfg.PeerDeleteCooldown); time.Now().Before(until) {
+				deleted = append(deleted, map[string]any{
+					"name":          d.Name,
+					"address":       d.Address,
+					"deleted":       d.Deleted.Format(time.RFC3339),
+					"restore_until": until.Format(time.RFC3339),
+				})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"peers": peers, "deleted": deleted, "next_cursor": next})
+
+	case r.Method == http.MethodPost && name == "preview":
+		req, ok := readNewPeerRequest(w, r)
+		if !ok {
+			return
+		}
+		p, conf, err := s.previewPeer(apiPeerDir(req.Name), req.Person)
+		switch {
+		case errors.Is(err, errDeviceBudget), errors.Is(err, errPeerExists), errors.Is(err, errPeerDeleted):
+			httpError(w, r, err.Error(), 409)
+			return
+		case err != nil:
+			slog.Error("cannot preview", "component", "peers", "peer", req.Name, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not preview peer", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":    p.Name,
+			"person":  p.Person,
+			"address": p.Address,
+			"config":  s.rewriteEndpoint(conf),
+		})
+
+	case r.Method == http.MethodPost && name == "":
+		// The response carries the new private key.
+		if s.cfg.PrivateOnly && !isPrivateNetworkRequest(r) {
+			http.NotFound(w, r)
+			return
+		}
+		req, ok := readNewPeerRequest(w, r)
+		if !ok {
+			return
+		}
+		p, conf, err := s.createPeer(apiPeerDir(req.Name), req.Person)
+		switch {
+		case errors.Is(err, errDeviceBudget):
+			httpError(w, r, err.Error(), 409)
+			return
+		case errors.Is(err, errPeerExists), errors.Is(err, errPeerDeleted):
+			httpError(w, r, err.Error(), 409)
+			return
+		case err != nil:
+			slog.Error("cannot create", "component", "peers", "peer", req.Name, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not create peer", 500)
+			return
+		}
+		slog.Info("created", "component", "peers", "event", eventPeerAdded, "peer", p.Name, "address", p.Address, "request_id", requestID(r))
+		s.recordEvent(eventPeerAdded, "Peer %s added via the API at %s (public key %s)", p.Name, p.Address, p.PublicKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":          p.Name,
+			"person":        p.Person,
+			"address":       p.Address,
+			"public_key":    p.PublicKey,
+			"config":        s.rewriteEndpoint(conf),
+			"bootstrap_url": s.peerBootstrapURL(r, p.Name),
+		})
+
+	case r.Method == http.MethodDelete && name != "":
+		err := s.removePeer(name)
+		switch {
+		case errors.Is(err, errPeerNotFound):
+			httpError(w, r, err.Error(), 404)
+			return
+		case errors.Is(err, errPeerNotManaged):
+			httpError(w, r, err.Error(), 409)
+			return
+		case err != nil:
+			slog.Error("cannot remove", "component", "peers", "peer", name, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not remove peer", 500)
+			return
+		}
+		slog.Info("removed", "component", "peers", "event", eventPeerRemoved, "peer", name, "request_id", requestID(r))
+		s.recordEvent(eventPeerRemoved, "Peer %s removed via the API", name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpError(w, r, "method not allowed", 405)
+	}
+}
@@ -0,0 +1,207 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestAPIPeerDirsAreVisibleToTheSidecar(t *testing.T) {
+	cases := []struct {
+		name, dir string
+	}{
+		{"laptop", "peer_laptop"},
+		{"peer_phone", "peer_phone"},
+		{"peer7", "peer7"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			fakeWG(t, "priv\tpub\t51820\toff\n")
+
+			r := httptest.NewRequest(http.MethodPost, "/api/peers?token="+testAdminToken, strings.NewReader(`{"name": "`+tc.name+`"}`))
+			w := httptest.NewRecorder()
+			s.apiPeers(w, r)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Name    string `json:"name"`
+				Address string `json:"address"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Name != tc.dir {
+				t.Errorf("name = %q, want %q", resp.Name, tc.dir)
+			}
+
+			// The sidecar's allocator: grep Address /config/peer*/*.conf.
+			confs, _ := filepath.Glob(filepath.Join(s.cfg.ConfigDir, "peer*", "*.conf"))
+			seen := false
+			for _, c := range confs {
+				b, _ := os.ReadFile(c)
+				seen = seen || strings.Contains(string(b), "Address = "+resp.Address+"\n")
+			}
+			if !seen {
+				t.Errorf("address %s is not in any /config/peer*/*.conf", resp.Address)
+			}
+		})
+	}
+}
+
+func TestAPIPeerNamesFitAnInterfaceName(t *testing.T) {
+	cases := []struct {
+		name string
+		want int
+	}{
+		{"tablet1234", http.StatusCreated},      // peer_tablet1234: 15
+		{"tablet12345", http.StatusBadRequest},  // peer_tablet12345: 16
+		{"peer_tablet1234", http.StatusCreated}, // kept as is
+		{"peer_tablet12345", http.StatusBadRequest},
+		{"-laptop", http.StatusBadRequest},
+		{"sheet", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			fakeWG(t, "priv\tpub\t51820\toff\n")
+
+			r := httptest.NewRequest(http.MethodPost, "/api/peers?token="+testAdminToken, strings.NewReader(`{"name": "`+tc.name+`"}`))
+			w := httptest.NewRecorder()
+			s.apiPeers(w, r)
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
+
+// TestPeerChangesLeaveOtherPeersAlone checks that adding, rotating,
+// revoking and removing a peer only ever touches that peer on the live
+// interface: no setconf or syncconf of the whole peer list, and no
+// restart, so every other peer keeps its session.
+func TestPeerChangesLeaveOtherPeersAlone(t *testing.T) {
+	s := newTestServer(t, nil)
+	calls := fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	var created apiPeer
+	oldKey, err := s.peerPublicKey("peer2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey := ""
+
+	// Each step returns the keys it may touch.
+	steps := []struct {
+		name string
+		run  func() ([]string, error)
+	}{
+		{"create", func() (keys []string, err error) {
+			created, _, err = s.createPeer(apiPeerDir("laptop"), "")
+			return []string{created.PublicKey}, err
+		}},
+		{"rotate", func() (keys []string, err error) {
+			newKey, err = s.rotatePeer("peer2")
+			return []string{oldKey, newKey}, err
+		}},
+		{"revoke", func() ([]string, error) {
+			return []string{newKey}, s.revokePeer("peer2")
+		}},
+		{"remove", func() ([]string, error) {
+			return []string{created.PublicKey}, s.removePeer(created.Name)
+		}},
+	}
+	seen := 0
+	for _, step := range steps {
+		keys, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		all := calls()
+		for _, c := range all[seen:] {
+			if strings.HasPrefix(c, "show ") {
+				continue
+			}
+			f := strings.Fields(c)
+			if len(f) < 4 || f[0] != "set" || f[1] != s.cfg.WGInterface || f[2] != "peer" {
+				t.Errorf("%s: wg %s changes more than one peer", step.name, c)
+				continue
+			}
+			touched := false
+			for _, k := range keys {
+				touched = touched || f[3] == k
+			}
+			if !touched {
+				t.Errorf("%s: wg %s touches a peer it shouldn't", step.name, c)
+			}
+		}
+		if len(all) == seen {
+			t.Errorf("%s: the interface was not updated", step.name)
+		}
+		seen = len(all)
+	}
+}
+
+func TestPeerPreviewAllocatesNothing(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.People = []string{"alice:peer1"}
+		c.PeopleMaxDevices = 1
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	preview := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/peers/preview?token="+testAdminToken, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.apiPeers(w, r)
+		return w
+	}
+
+	w := preview(`{"name": "laptop"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var got struct{ Name, Address, Config string }
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "peer_laptop" || !strings.Contains(got.Config, "Address = "+got.Address) || !strings.Contains(got.Config, previewPrivateKey) {
+		t.Errorf("preview = %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(s.cfg.ConfigDir, "peer_laptop")); !os.IsNotExist(err) {
+		t.Errorf("preview wrote the peer directory: %v", err)
+	}
+	if len(s.loadAPIPeers()) != 0 {
+		t.Error("preview registered the peer")
+	}
+
+	// The preview shows the address creation then actually gives out.
+	p, _, err := s.createPeer("peer_laptop", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Address != got.Address {
+		t.Errorf("created at %s, preview said %s", p.Address, got.Address)
+	}
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"name": "laptop"}`, http.StatusConflict},
+		{`{"name": "phone", "person": "alice"}`, http.StatusConflict},
+		{`{"name": "a-very-long-name"}`, http.StatusBadRequest},
+		{`{"name": "phone", "person": "guests"}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if w := preview(c.body); w.Code != c.want {
+			t.Errorf("%s: status = %d, want %d", c.body, w.Code, c.want)
+		}
+	}
+}
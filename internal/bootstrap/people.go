@@ -0,0 +1,122 @@
+package bootstrap
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// people parses PEOPLE ("alice:peer1+peer2,bob:peer3") into person ->
+// peer names, and adds the API peers created for a person. Households
+// think in people, not devices.
+func (s Server) people() map[string][]string {
+	out := map[string][]string{}
+	for _, entry := range s.cfg.People {
+		name, peers, ok := strings.Cut(entry, ":")
+		if !ok {
+			continue
+		}
+		for _, p := range strings.Split(peers, "+") {
+			if p = strings.TrimSpace(p); p != "" {
+				out[strings.TrimSpace(name)] = append(out[strings.TrimSpace(name)], p)
+			}
+		}
+	}
+	for _, p := range s.loadAPIPeers() {
+		if p.Person != "" && !slices.Contains(out[p.Person], p.Name) {
+			out[p.Person] = append(out[p.Person], p.Name)
+		}
+	}
+	return out
+}
+
+// peerActiveTime sums, per peer name, how long each peer was active
+// between since and now according to the handshake history. A peer with
+// no name is keyed by its public key.
+func (s Server) peerActiveTime(since, now time.Time) (map[string]time.Duration, error) {
+	f, err := os.Open(s.cfg.HandshakeHistoryPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	total := map[string]time.Duration{}
+	activeSince := map[string]time.Time{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var t handshakeTransition
+		if json.Unmarshal(sc.Bytes(), &t) != nil {
+			continue
+		}
+		id := t.Peer
+		if id == "" {
+			id = t.PublicKey
+		}
+		start, wasActive := activeSince[id]
+		switch {
+		case t.State == "active" && !wasActive:
+			activeSince[id] = t.Time
+		case t.State == "idle" && wasActive:
+			total[id] += overlap(start, t.Time, since)
+			delete(activeSince, id)
+		}
+	}
+	for id, start := range activeSince {
+		total[id] += overlap(start, now, since)
+	}
+	return total, sc.Err()
+}
+
+// overlap is the part of [start, end) that falls after since.
+func overlap(start, end, since time.Time) time.Duration {
+	if start.Before(since) {
+		start = since
+	}
+	return max(end.Sub(start), 0)
+}
+
+// personSummary is one person's devices and activity.
+type personSummary struct {
+	Name          string        `json:"name"`
+	Peers         []string      `json:"peers"`
+	ActiveDevices int           `json:"active_devices"`
+	ActiveTime    time.Duration `json:"-"`
+	ActiveSeconds int64         `json:"active_seconds"`
+}
+
+// peopleSummary aggregates per-peer state into per-person state: devices
+// active right now and time connected since the given moment.
+func (s Server) peopleSummary(since time.Time) []personSummary {
+	people := s.people()
+	if len(people) == 0 {
+		return nil
+	}
+	active := map[string]bool{}
+	if peers, err := s.peerHandshakes(); err == nil {
+		for _, p := range peers {
+			if name, _ := p["peer"].(string); name != "" && p["active"] == true {
+				active[name] = true
+			}
+		}
+	}
+	times, _ := s.peerActiveTime(since, time.Now())
+
+	out := make([]personSummary, 0, len(people))
+	for name, peers := range people {
+		ps := personSummary{Name: name, Peers: peers}
+		for _, p := range peers {
+			if active[p] {
+				ps.ActiveDevices++
+			}
+			ps.ActiveTime += times[p]
+		}
+		ps.ActiveSeconds = int64(ps.ActiveTime.Seconds())
+		out = append(out, ps)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
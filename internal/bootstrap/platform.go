@@ -0,0 +1,68 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client platforms we tailor the bootstrap page for.
+const (
+	platformAndroid = "android"
+	platformIOS     = "ios"
+	platformWindows = "windows"
+	platformMacOS   = "macos"
+	platformLinux   = "linux"
+)
+
+// clientPlatform guesses the visitor's OS from the User-Agent. It is only
+// used to order the page for this one response and is never stored.
+func clientPlatform(r *http.Request) string {
+	ua := strings.ToLower(r.UserAgent())
+	switch {
+	case strings.Contains(ua, "android"):
+		return platformAndroid
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return platformIOS
+	case strings.Contains(ua, "windows"):
+		return platformWindows
+	case strings.Contains(ua, "mac os x"), strings.Contains(ua, "macintosh"):
+		return platformMacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return platformLinux
+	}
+	return ""
+}
+
+// isDesktop reports whether platform is one where importing a .conf file
+// is easier than scanning a QR code.
+func isDesktop(platform string) bool {
+	return platform == platformWindows || platform == platformMacOS || platform == platformLinux
+}
+
+// wireGuardAndroidPackage is the official WireGuard app's package name.
+const wireGuardAndroidPackage = "com.wireguard.android"
+
+// androidImportLink returns a Chrome intent: URI that hands a single-use
+// download of conf straight to the WireGuard app, so an Android visitor
+// can import with one tap instead of scanning their own screen. If the app
+// isn't installed, Chrome follows the fallback to its Play Store page
+// without touching (and burning) the download link.
+func (s Server) androidImportLink(r *http.Request, conf string) string {
+	id, err := fetchLinks.issue(r, conf)
+	if err != nil {
+		return ""
+	}
+	target, err := url.Parse(s.baseURL(r) + "/bootstrap/fetch/" + id)
+	if err != nil {
+		return ""
+	}
+	fallback := "https://play.google.com/store/apps/details?id=" + wireGuardAndroidPackage
+
+	return "intent://" + target.Host + target.EscapedPath() +
+		"#Intent;scheme=" + target.Scheme +
+		";action=android.intent.action.VIEW" +
+		";package=" + wireGuardAndroidPackage +
+		";S.browser_fallback_url=" + url.QueryEscape(fallback) +
+		";end"
+}
@@ -0,0 +1,150 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// probeDelay gives a freshly connected client time to resolve a name and
+// open a connection before we judge its routing.
+const probeDelay = time.Minute
+
+// routeProbe is the outcome of the last post-connect verification. A
+// handshake only proves the keys match; this records whether traffic
+// actually flows in each direction.
+type routeProbe struct {
+	PeerIP    string    `json:"peer_ip"`
+	CheckedAt time.Time `json:"checked_at"`
+
+	// PingOK means the server reached the client through the tunnel.
+	// Many desktop firewalls drop ICMP, so a failure alone isn't fatal.
+	PingOK bool `json:"ping_ok"`
+
+	// DNSSeen and FlowsSeen mean the client's traffic reached the server.
+	DNSSeen   bool `json:"dns_seen"`
+	FlowsSeen bool `json:"flows_seen"`
+
+	State string `json:"state"`
+}
+
+const (
+	probeOK            = "ok"
+	probeRoutingBroken = "routing_broken" // handshaking, but no traffic arrives
+	probeNoReturnPath  = "no_return_path" // traffic arrives, replies don't make it back
+)
+
+// verifyRoutes runs once per new session: it waits probeDelay, pings the
+// peer's tunnel address and looks for DNS queries and other flows from the
+// tunnel subnet in conntrack, then records the verdict.
+func (s Server) verifyRoutes() {
+	time.Sleep(probeDelay)
+
+	conf, err := os.ReadFile(s.cfg.PeerConfigPath())
+	if err != nil {
+		slog.Warn("cannot read peer config", "component", "probe", "error", err)
+		return
+	}
+	iface, _ := parseConfSections(string(conf))
+	peerIP, err := tunnelAddr(iface["Address"])
+	if err != nil {
+		slog.Warn("cannot determine tunnel address", "component", "probe", "peer", s.cfg.PeerName, "error", err)
+		return
+	}
+
+	p := routeProbe{PeerIP: peerIP.String(), CheckedAt: time.Now()}
+	p.PingOK = exec.Command("ping", "-c", "3", "-W", "2", peerIP.String()).Run() == nil
+
+	if subnet, err := tunnelPrefix(s.cfg.TunnelSubnet); err == nil {
+		flows, err := conntrackFlows(subnet)
+		if err != nil {
+			slog.Warn("error reading conntrack table", "component", "probe", "error", err)
+		}
+		for key := range flows {
+			p.FlowsSeen = true
+			if strings.HasSuffix(key, " dport=53") {
+				p.DNSSeen = true
+				break
+			}
+		}
+	}
+
+	switch {
+	case !p.FlowsSeen && !p.PingOK:
+		p.State = probeRoutingBroken
+		slog.Warn("connected but routing looks broken: no ping reply and no traffic from the tunnel", "component", "probe",
+			"peer", s.cfg.PeerName, "peer_ip", p.PeerIP, "state", p.State)
+	case !p.FlowsSeen:
+		p.State = probeRoutingBroken
+		slog.Warn("answers ping but sends no traffic through the tunnel; check AllowedIPs and DNS on the client", "component", "probe",
+			"peer", s.cfg.PeerName, "peer_ip", p.PeerIP, "state", p.State)
+	case !p.PingOK && !p.DNSSeen:
+		p.State = probeNoReturnPath
+		slog.Warn("sends traffic but neither answers ping nor queries DNS; replies may not be reaching it", "component", "probe",
+			"peer", s.cfg.PeerName, "peer_ip", p.PeerIP, "state", p.State)
+	default:
+		p.State = probeOK
+		slog.Info("routing ok", "component", "probe", "peer", s.cfg.PeerName, "peer_ip", p.PeerIP, "ping", p.PingOK, "dns", p.DNSSeen)
+	}
+
+	if p.State != probeOK {
+		s.recordEvent(eventRoutingBroken, "%s (%s) connected but routing check failed: %s", s.cfg.PeerName, p.PeerIP, p.State)
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.cfg.RouteProbePath(), b, 0o600)
+	}
+	if err != nil {
+		slog.Warn("failed to record result", "component", "probe", "error", err)
+	}
+}
+
+// loadRouteProbe returns the last recorded probe, or ok=false if none has
+// run yet.
+func (s Server) loadRouteProbe() (routeProbe, bool) {
+	var p routeProbe
+	b, err := os.ReadFile(s.cfg.RouteProbePath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read last result", "component", "probe", "error", err)
+		}
+		return p, false
+	}
+	return p, json.Unmarshal(b, &p) == nil
+}
+
+// tunnelAddr picks the first IPv4 address out of an [Interface] Address
+// value such as "10.13.13.2/32, fd00::2/128".
+func tunnelAddr(v string) (netip.Addr, error) {
+	var first netip.Addr
+	for _, a := range strings.Split(v, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(a); err == nil {
+			a = prefix.Addr().String()
+		}
+		addr, err := netip.ParseAddr(a)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		if addr.Is4() {
+			return addr, nil
+		}
+		if !first.IsValid() {
+			first = addr
+		}
+	}
+	if !first.IsValid() {
+		return netip.Addr{}, errors.New("no Address in [Interface]")
+	}
+	return first, nil
+}
@@ -0,0 +1,130 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies turns TRUSTED_PROXIES entries (CIDRs or bare IPs)
+// into prefixes, skipping and logging anything unparseable.
+func parseTrustedProxies(entries []string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			if addr, err := netip.ParseAddr(e); err == nil {
+				out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+		}
+		p, err := netip.ParsePrefix(e)
+		if err != nil {
+			slog.Warn("ignoring invalid TRUSTED_PROXIES entry", "component", "proxy", "value", e)
+			continue
+		}
+		out = append(out, p.Masked())
+	}
+	return out
+}
+
+func (s Server) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range s.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddr is the address of the direct TCP peer.
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr, err == nil
+}
+
+// onFly reports whether we're deployed on Fly, whose proxy always sets
+// Fly-Client-IP and X-Forwarded-Proto and strips client-supplied copies.
+func (s Server) onFly() bool {
+	return s.cfg.EndpointHost != ""
+}
+
+// fromTrustedProxy reports whether r's forwarding headers can be believed:
+// either Fly's edge set them, or the direct peer is a configured proxy.
+func (s Server) fromTrustedProxy(r *http.Request) bool {
+	if s.onFly() {
+		return true
+	}
+	addr, ok := remoteAddr(r)
+	return ok && s.isTrustedProxy(addr)
+}
+
+// clientIP returns the visitor's address. On Fly that's Fly-Client-IP.
+// Behind a trusted proxy it's the right-most X-Forwarded-For hop that
+// isn't itself a trusted proxy. Otherwise it's the TCP peer.
+func (s Server) clientIP(r *http.Request) string {
+	if s.onFly() {
+		if ip := r.Header.Get("Fly-Client-IP"); ip != "" {
+			return ip
+		}
+	}
+
+	remote, ok := remoteAddr(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !s.isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if !s.isTrustedProxy(addr) {
+			return addr.String()
+		}
+	}
+	return remote.String()
+}
+
+// baseURL is the public URL links should be built on: the origin plus
+// BOOTSTRAP_BASE_PATH. BOOTSTRAP_BASE_URL sets the origin explicitly;
+// otherwise it is reconstructed from the request, honoring
+// X-Forwarded-Proto and X-Forwarded-Host only from a trusted proxy.
+func (s Server) baseURL(r *http.Request) string {
+	if s.cfg.PublicBaseURL != "" {
+		return strings.TrimRight(s.cfg.PublicBaseURL, "/") + s.cfg.BasePath
+	}
+
+	scheme, host := "http", r.Host
+	trusted := s.fromTrustedProxy(r)
+	if r.TLS != nil || (trusted && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	if fwd := r.Header.Get("X-Forwarded-Host"); trusted && fwd != "" {
+		host = strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return scheme + "://" + host + s.cfg.BasePath
+}
+
+// mount serves h under BOOTSTRAP_BASE_PATH, so the app can share a domain
+// with other services behind one proxy. /healthz stays at the root as well
+// because Fly's health checks and wake-up links point there.
+func (s Server) mount(h http.Handler) http.Handler {
+	if s.cfg.BasePath == "" {
+		return h
+	}
+	outer := http.NewServeMux()
+	outer.Handle(s.cfg.BasePath+"/", http.StripPrefix(s.cfg.BasePath, h))
+	outer.HandleFunc("/healthz", s.healthz)
+	return outer
+}
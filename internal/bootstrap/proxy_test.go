@@ -0,0 +1,102 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	cases := []struct {
+		name    string
+		entries []string
+		want    []string
+	}{
+		{"none", nil, nil},
+		{"cidr", []string{"10.0.0.0/8"}, []string{"10.0.0.0/8"}},
+		{"bare addresses", []string{"127.0.0.1", "::1"}, []string{"127.0.0.1/32", "::1/128"}},
+		{"host bits masked", []string{"192.168.1.7/24"}, []string{"192.168.1.0/24"}},
+		{"invalid skipped", []string{"proxy.internal", "10.0.0.0/33", "172.16.0.0/12"}, []string{"172.16.0.0/12"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var want []netip.Prefix
+			for _, s := range tc.want {
+				want = append(want, netip.MustParsePrefix(s))
+			}
+			if got := parseTrustedProxies(tc.entries); !reflect.DeepEqual(got, want) {
+				t.Errorf("parseTrustedProxies(%q) = %v, want %v", tc.entries, got, want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cases := []struct {
+		name    string
+		fly     bool
+		remote  string
+		headers map[string][]string
+		want    string
+	}{
+		{"direct", false, "198.51.100.7:40000", nil, "198.51.100.7"},
+		{
+			"forged headers from an untrusted peer",
+			false, "198.51.100.7:40000",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.1"}, "Fly-Client-Ip": {"203.0.113.2"}},
+			"198.51.100.7",
+		},
+		{
+			"trusted proxy",
+			false, "10.0.0.5:40000",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			"203.0.113.1",
+		},
+		{
+			"right-most untrusted hop wins",
+			false, "10.0.0.5:40000",
+			map[string][]string{"X-Forwarded-For": {"192.0.2.66, 203.0.113.1", "10.0.0.9"}},
+			"203.0.113.1",
+		},
+		{
+			"all hops trusted",
+			false, "10.0.0.5:40000",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.8, 10.0.0.9"}},
+			"10.0.0.5",
+		},
+		{
+			"garbage hop stops the walk",
+			false, "10.0.0.5:40000",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.1, unknown"}},
+			"10.0.0.5",
+		},
+		{"mapped trusted proxy", false, "[::ffff:10.0.0.5]:40000", map[string][]string{"X-Forwarded-For": {"203.0.113.1"}}, "203.0.113.1"},
+		{"fly edge", true, "172.16.0.2:40000", map[string][]string{"Fly-Client-Ip": {"203.0.113.2"}}, "203.0.113.2"},
+		{"fly without header", true, "172.16.0.2:40000", nil, "172.16.0.2"},
+		{"unparseable remote", false, "@", nil, "@"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *config.Config) {
+				c.TrustedProxies = []string{"10.0.0.0/8"}
+				if tc.fly {
+					c.EndpointHost = "example"
+				}
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			for k, vs := range tc.headers {
+				for _, v := range vs {
+					r.Header.Add(k, v)
+				}
+			}
+			if got := s.clientIP(r); got != tc.want {
+				t.Errorf("clientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
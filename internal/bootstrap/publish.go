@@ -0,0 +1,98 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/notify"
+)
+
+// publicURL is the externally reachable base URL when there is no request
+// to derive it from (console, background jobs).
+func (s Server) publicURL() string {
+	if s.cfg.PublicBaseURL != "" {
+		return strings.TrimRight(s.cfg.PublicBaseURL, "/") + s.cfg.BasePath
+	}
+	if host := s.cfg.ClientEndpointHost(); host != "" {
+		return "https://" + host + s.cfg.BasePath
+	}
+	return ""
+}
+
+// pushTokenTTL bounds how long a pushed link works if nobody opens it.
+const pushTokenTTL = time.Hour
+
+// pushBootstrapLink sends the one-time bootstrap link to the onboarding
+// ntfy topic, so a device already subscribed there gets a tappable link
+// instead of someone retyping it. base is the URL the link is built on.
+//
+// Topics are often readable by anyone who knows the name, so the link
+// carries a freshly minted single-use onboarding token that expires
+// after pushTokenTTL, never BOOTSTRAP_TOKEN.
+func (s Server) pushBootstrapLink(ctx context.Context, base string) error {
+	n := notify.New(s.cfg.OnboardNotifyURL, "text").WithBearer(s.cfg.OnboardNotifyToken)
+	if !n.Enabled() {
+		return errors.New("ONBOARD_NOTIFY_URL is not set")
+	}
+	if base == "" {
+		return errors.New("public URL unknown; set BOOTSTRAP_BASE_URL")
+	}
+	if _, err := os.Stat(s.cfg.BootstrapDonePath()); err == nil {
+		return errors.New("bootstrap already completed; re-arm it first")
+	}
+
+	link := base + "/bootstrap"
+	if s.cfg.BootstrapToken != "" {
+		tok, _, err := s.mintOnboardingToken(s.cfg.PeerName, "ntfy push", pushTokenTTL, true)
+		if err != nil {
+			return err
+		}
+		link += "?token=" + url.QueryEscape(tok)
+	}
+	err := n.Send(ctx, notify.Event{
+		Event:   "onboarding",
+		Title:   "Set up your VPN",
+		Message: "Open this link within an hour on the device you want to connect. It works once:\n" + link,
+		App:     s.cfg.EndpointHost,
+		Region:  s.cfg.Region,
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("pushed bootstrap link to the onboarding topic", "component", "onboarding", "event", eventBootstrapPushed, "peer", s.cfg.PeerName)
+	s.recordEvent(eventBootstrapPushed, "Bootstrap link for %s pushed to the onboarding topic", s.cfg.PeerName)
+	return nil
+}
+
+// bootstrapPublish is the on-demand admin action behind pushBootstrapLink.
+// Requires the bootstrap token.
+func (s Server) bootstrapPublish(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" || s.cfg.OnboardNotifyURL == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	if err := s.pushBootstrapLink(ctx, s.baseURL(r)); err != nil {
+		slog.Warn("push failed", "component", "onboarding", "error", err, "request_id", requestID(r))
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	_, _ = w.Write([]byte("bootstrap link pushed\n"))
+}
@@ -0,0 +1,73 @@
+package bootstrap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestPushedLinkIsSingleUse(t *testing.T) {
+	var pushed string
+	topic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		pushed = string(b)
+	}))
+	defer topic.Close()
+
+	s := newTestServer(t, func(c *config.Config) { c.OnboardNotifyURL = topic.URL })
+	if err := s.pushBootstrapLink(context.Background(), "https://vpn.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(pushed, testAdminToken) {
+		t.Fatal("pushed message contains BOOTSTRAP_TOKEN")
+	}
+	m := regexp.MustCompile(`https://vpn\.example\.com(/bootstrap\?token=\S+)`).FindStringSubmatch(pushed)
+	if m == nil {
+		t.Fatalf("no bootstrap link in %q", pushed)
+	}
+
+	if w := serve(s.bootstrap, http.MethodGet, m[1]); w.Code != http.StatusOK {
+		t.Fatalf("first use: status = %d: %s", w.Code, w.Body)
+	}
+	// Re-arm so only the token, not the done marker, can refuse the link.
+	if err := s.rearmBootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(s.bootstrap, http.MethodGet, m[1]); w.Code != http.StatusUnauthorized {
+		t.Errorf("second use: status = %d, want 401", w.Code)
+	}
+}
+
+func TestPushedLinkCanBeRefetched(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.RedeliveryWindow = time.Hour
+		c.RedeliveryMax = 3
+	})
+	tok, _, err := s.mintOnboardingToken(s.cfg.PeerName, "push", time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := "/bootstrap?token=" + tok
+
+	if w := serve(s.bootstrap, http.MethodGet, link); w.Code != http.StatusOK {
+		t.Fatalf("first fetch: status = %d: %s", w.Code, w.Body)
+	}
+	if w := serve(s.bootstrap, http.MethodGet, link); w.Code != http.StatusOK {
+		t.Errorf("re-fetch by the same client: status = %d: %s", w.Code, w.Body)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, link, nil)
+	r.RemoteAddr = "203.0.113.50:40000"
+	w := httptest.NewRecorder()
+	s.bootstrap(w, r)
+	if w.Code != http.StatusGone {
+		t.Errorf("fetch by another client: status = %d, want 410", w.Code)
+	}
+}
@@ -0,0 +1,272 @@
+package bootstrap
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// fetchLinkTTL bounds how long a one-time fetch URL shown in a QR code
+// stays valid.
+const fetchLinkTTL = 15 * time.Minute
+
+// qrFormat turns a rendered client config into a QR payload. Some router
+// and third-party importers choke on raw .conf QRs, so several are offered.
+type qrFormat struct {
+	Name    string
+	Label   string
+	payload func(s Server, r *http.Request, conf string) (string, error)
+}
+
+// qrFormats lists the available payloads; the first is the default when
+// BOOTSTRAP_QR_FORMAT is unset or unknown.
+var qrFormats = []qrFormat{
+	{"conf", "WireGuard config (official apps)", confPayload},
+	{"uri", "wireguard:// link (sing-box, v2rayN, Hiddify, ...)", uriPayload},
+	{"url", "One-time download link (any camera app)", fetchURLPayload},
+}
+
+// renderedQR is a payload rendered as a PNG for the page template.
+type renderedQR struct {
+	Label    string
+	QRBase64 string
+}
+
+// renderQRCodes renders the primary format first and the others after it.
+func (s Server) renderQRCodes(r *http.Request, conf string) []renderedQR {
+	ordered := make([]qrFormat, 0, len(qrFormats))
+	for _, f := range qrFormats {
+		if f.Name == s.cfg.QRFormat {
+			ordered = append(ordered, f)
+		}
+	}
+	for _, f := range qrFormats {
+		if f.Name != s.cfg.QRFormat {
+			ordered = append(ordered, f)
+		}
+	}
+
+	out := make([]renderedQR, 0, len(ordered))
+	for _, f := range ordered {
+		payload, err := f.payload(s, r, conf)
+		if err != nil {
+			slog.Warn("skipping QR", "component", "bootstrap", "format", f.Name, "error", err, "request_id", requestID(r))
+			continue
+		}
+		png, err := qrcode.Encode(payload, qrcode.Medium, 256)
+		if err != nil {
+			slog.Warn("skipping QR", "component", "bootstrap", "format", f.Name, "error", err, "request_id", requestID(r))
+			continue
+		}
+		out = append(out, renderedQR{Label: f.Label, QRBase64: base64.StdEncoding.EncodeToString(png)})
+	}
+	return out
+}
+
+// chunkedQRCodes splits conf into numbered QR codes when it is longer than
+// the configured chunk size, for cameras that can't resolve one dense code.
+// Each payload is "WGQR <i>/<n>" on its own line followed by the next slice
+// of the config, so concatenating the slices in order (minus the header
+// lines) restores the original text. It returns nil when chunking is
+// disabled or not needed.
+func (s Server) chunkedQRCodes(r *http.Request, conf string) []renderedQR {
+	size := s.cfg.QRChunkSize
+	if size <= 0 || len(conf) <= size {
+		return nil
+	}
+
+	n := (len(conf) + size - 1) / size
+	out := make([]renderedQR, 0, n)
+	for i := 0; i < n; i++ {
+		chunk := conf[i*size : min((i+1)*size, len(conf))]
+		payload := fmt.Sprintf("WGQR %d/%d\n%s", i+1, n, chunk)
+		png, err := qrcode.Encode(payload, qrcode.Medium, 256)
+		if err != nil {
+			slog.Warn("chunked QR failed", "component", "bootstrap", "chunk", i+1, "chunks", n, "error", err, "request_id", requestID(r))
+			return nil
+		}
+		out = append(out, renderedQR{
+			Label:    fmt.Sprintf("Part %d of %d", i+1, n),
+			QRBase64: base64.StdEncoding.EncodeToString(png),
+		})
+	}
+	return out
+}
+
+func confPayload(_ Server, _ *http.Request, conf string) (string, error) {
+	return conf, nil
+}
+
+// uriPayload renders the de-facto wireguard:// share link used by sing-box
+// and v2ray-family clients:
+//
+//	wireguard://<privkey>@<host:port>?publickey=..&address=..#<name>
+func uriPayload(s Server, _ *http.Request, conf string) (string, error) {
+	iface, peer := parseConfSections(conf)
+	if iface["PrivateKey"] == "" || peer["PublicKey"] == "" || peer["Endpoint"] == "" {
+		return "", fmt.Errorf("config is missing keys or endpoint")
+	}
+
+	q := url.Values{}
+	q.Set("publickey", peer["PublicKey"])
+	q.Set("address", iface["Address"])
+	for param, v := range map[string]string{
+		"presharedkey": peer["PresharedKey"],
+		"allowedips":   peer["AllowedIPs"],
+		"dns":          iface["DNS"],
+		"mtu":          iface["MTU"],
+		"keepalive":    peer["PersistentKeepalive"],
+	} {
+		if v != "" {
+			q.Set(param, v)
+		}
+	}
+
+	u := url.URL{
+		Scheme:   "wireguard",
+		User:     url.User(iface["PrivateKey"]),
+		Host:     peer["Endpoint"],
+		RawQuery: q.Encode(),
+		Fragment: s.cfg.PeerName,
+	}
+	return u.String(), nil
+}
+
+// fetchURLPayload issues a short single-use HTTPS link that downloads the
+// config, for importers that only understand URLs.
+func fetchURLPayload(s Server, r *http.Request, conf string) (string, error) {
+	id, err := fetchLinks.issue(r, conf)
+	if err != nil {
+		return "", err
+	}
+	return s.baseURL(r) + "/bootstrap/fetch/" + id, nil
+}
+
+// parseConfSections returns the key/value pairs of the [Interface] and the
+// first [Peer] section.
+func parseConfSections(conf string) (iface, peer map[string]string) {
+	iface, peer = map[string]string{}, map[string]string{}
+	var cur map[string]string
+	for _, line := range strings.Split(conf, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.EqualFold(line, "[Interface]"):
+			cur = iface
+		case strings.EqualFold(line, "[Peer]"):
+			if len(peer) > 0 {
+				return iface, peer
+			}
+			cur = peer
+		case cur != nil:
+			if k, v, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") {
+				cur[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return iface, peer
+}
+
+// fetchLinkStore holds single-use config downloads in memory. Links die
+// with the process, which is fine for a 15 minute lifetime.
+type fetchLinkStore struct {
+	mu    sync.Mutex
+	links map[string]fetchLink
+}
+
+type fetchLink struct {
+	conf    string
+	expires time.Time
+	page    string // expiring page that issued it, if any
+	peer    string // set when issued from /bootstrap/<peer>
+}
+
+var fetchLinks = &fetchLinkStore{links: map[string]fetchLink{}}
+
+// issue creates a link for conf. Links issued while rendering an expiring
+// page are tied to it and never outlive it.
+func (st *fetchLinkStore) issue(r *http.Request, conf string) (string, error) {
+	var b [18]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b[:])
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	for k, l := range st.links {
+		if now.After(l.expires) {
+			delete(st.links, k)
+		}
+	}
+	l := fetchLink{conf: conf, expires: now.Add(fetchLinkTTL), page: pageID(r), peer: linkPeerName(r)}
+	if l.page != "" {
+		servedPages.Lock()
+		if exp, ok := servedPages.expires[l.page]; ok && exp.Before(l.expires) {
+			l.expires = exp
+		}
+		servedPages.Unlock()
+	}
+	st.links[id] = l
+	return id, nil
+}
+
+// revokePage drops every link issued for page and returns how many.
+func (st *fetchLinkStore) revokePage(page string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := 0
+	for k, l := range st.links {
+		if l.page == page {
+			delete(st.links, k)
+			n++
+		}
+	}
+	return n
+}
+
+// redeem returns the link for id and invalidates it.
+func (st *fetchLinkStore) redeem(id string) (fetchLink, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	l, ok := st.links[id]
+	delete(st.links, id)
+	if !ok || time.Now().After(l.expires) {
+		return fetchLink{}, false
+	}
+	return l, true
+}
+
+// bootstrapFetch serves a config issued by fetchURLPayload exactly once.
+func (s Server) bootstrapFetch(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.PrivateOnly && !isPrivateNetworkRequest(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/bootstrap/fetch/")
+	l, ok := fetchLinks.redeem(id)
+	if !ok {
+		httpError(w, r, "link expired or already used", 410)
+		return
+	}
+	if l.peer != "" {
+		s = s.forPeer(l.peer)
+	}
+	conf := l.conf
+	slog.Info("one-time download link redeemed", "component", "bootstrap", "peer", s.cfg.PeerName, "request_id", requestID(r))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.cfg.PeerName+".conf"))
+	w.Header().Set("Cache-Control", "no-store")
+	s.signResponse(w, r, []byte(conf))
+	_, _ = w.Write([]byte(conf))
+}
@@ -0,0 +1,120 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// keepaliveArm wakes the supervisor when the start script reports that
+// the machine resumed. One pending request is enough; extras are dropped.
+var keepaliveArm = make(chan struct{}, 1)
+
+// runKeepalive keeps the keepalive loop available for the life of the
+// process. The loop returns once the tunnel goes idle so Fly can suspend
+// the machine; if the machine is resumed rather than restarted, this
+// process carries on where it left off, so the loop has to be started
+// again when a client comes back. With KEEPALIVE_SUSPEND it also asks
+// the Machines API to suspend the machine rather than waiting for Fly's
+// proxy to do it.
+func (s Server) runKeepalive(appName string) {
+	for {
+		// A disconnect announced while the loop wasn't running would
+		// otherwise end the next session before it starts.
+		select {
+		case <-disconnectRequests:
+		default:
+		}
+
+		s.keepaliveLoop(appName)
+		stopped := time.Now()
+		if s.explicitSuspend() {
+			s.suspendMachine()
+		}
+		s.waitForRearm(stopped)
+	}
+}
+
+// waitForRearm blocks until a handshake newer than stopped shows up, or
+// until /internal/keepalive/arm is called. Polling `wg show` sends no
+// traffic through the Fly proxy, so it doesn't keep the machine awake.
+//
+// A resumed machine keeps this process, so the wake notification sent at
+// startup would not fire again. It is sent here instead, as soon as the
+// wall clock jumps ahead of the monotonic one (the machine was frozen) or,
+// failing that, when the loop re-arms.
+func (s Server) waitForRearm(stopped time.Time) {
+	infra := s.infraPeerKeys()
+	names := s.peerNamesByKey()
+	woke := false
+	wake := func() {
+		if !woke {
+			woke = true
+			go s.NotifyWake()
+		}
+	}
+	defer wake()
+
+	lastPoll := time.Now()
+	for {
+		select {
+		case <-keepaliveArm:
+			slog.Info("re-armed on request", "component", "keepalive")
+			return
+		case <-time.After(s.cfg.KeepaliveInterval):
+		}
+
+		now := time.Now()
+		if jump := clockJump(lastPoll, now); jump > maxClockJump {
+			slog.Info("clock jumped while waiting; machine likely resumed", "component", "keepalive", "jump_seconds", int64(jump.Seconds()))
+			wake()
+		}
+		lastPoll = now
+
+		hs, err := wireGuardHandshakes(s.cfg.WGInterface)
+		if err != nil {
+			continue
+		}
+		for key, ts := range hs {
+			if ts > 0 && !infra[key] && time.Unix(ts, 0).After(stopped) {
+				peer := names[key]
+				if peer == "" {
+					peer = key
+				}
+				slog.Info("re-armed after a fresh handshake", "component", "keepalive", "peer", peer)
+				return
+			}
+		}
+	}
+}
+
+// keepaliveArmHook serves POST /internal/keepalive/arm for the start
+// script to call when the machine wakes, restarting the keepalive loop
+// without waiting for the next handshake poll. Loopback callers need no
+// token; anyone else needs the bootstrap token.
+func (s Server) keepaliveArmHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, r, "method not allowed", 405)
+		return
+	}
+	if addr, ok := remoteAddr(r); !ok || !addr.IsLoopback() {
+		if s.cfg.BootstrapToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !s.authorized(r) {
+			httpError(w, r, "unauthorized", 401)
+			return
+		}
+	}
+
+	if currentKeepalive().Running {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	select {
+	case keepaliveArm <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
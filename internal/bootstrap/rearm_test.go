@@ -0,0 +1,38 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// A resumed machine keeps its process, so re-arming has to repeat the
+// wake notification sent at startup.
+func TestRearmSendsWakeNotification(t *testing.T) {
+	sent := make(chan struct{}, 1)
+	topic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent <- struct{}{}
+	}))
+	defer topic.Close()
+
+	s := newTestServer(t, func(c *config.Config) {
+		c.WakeNotifyURL = topic.URL
+		c.KeepaliveInterval = time.Hour
+	})
+	keepaliveArm <- struct{}{}
+	s.waitForRearm(time.Now())
+
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no wake notification after re-arming")
+	}
+	select {
+	case <-sent:
+		t.Error("wake notification sent twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
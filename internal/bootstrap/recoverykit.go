@@ -0,0 +1,97 @@
+package bootstrap
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// kitLinks holds the single-use recovery kit downloads offered on the
+// bootstrap page. They follow the same rules as config download links,
+// including dying with an expiring page.
+var kitLinks = &fetchLinkStore{links: map[string]fetchLink{}}
+
+// recoveryKitLink issues the one-time link to conf's recovery kit.
+func (s Server) recoveryKitLink(r *http.Request, conf string) string {
+	id, err := kitLinks.issue(r, conf)
+	if err != nil {
+		return ""
+	}
+	return s.baseURL(r) + "/bootstrap/kit/" + id
+}
+
+// bootstrapKit serves a printable recovery kit for the bootstrapped peer:
+// the QR, the connection details, how to get back in, and fingerprints of
+// the deployment's keys so a restored config can be checked against the
+// server later. It can be opened once; saving it as PDF is left to the
+// browser, so nothing lands in cloud notes as plain text.
+func (s Server) bootstrapKit(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.PrivateOnly && !isPrivateNetworkRequest(r) {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/bootstrap/kit/")
+	l, ok := kitLinks.redeem(id)
+	if !ok {
+		httpError(w, r, "link expired or already used", 410)
+		return
+	}
+	if l.peer != "" {
+		s = s.forPeer(l.peer)
+	}
+	conf := l.conf
+	png, err := qrcode.Encode(conf, qrcode.Medium, 320)
+	if err != nil {
+		httpError(w, r, "could not render QR code", 500)
+		return
+	}
+
+	iface, peer := parseConfSections(conf)
+	data := map[string]any{
+		"PeerName":   s.cfg.PeerName,
+		"QRBase64":   base64.StdEncoding.EncodeToString(png),
+		"Address":    iface["Address"],
+		"DNS":        iface["DNS"],
+		"Endpoint":   peer["Endpoint"],
+		"AllowedIPs": peer["AllowedIPs"],
+		"ServerKey":  peer["PublicKey"],
+		"ServerFP":   wireGuardKeyFingerprint(peer["PublicKey"]),
+		"Generated":  time.Now().UTC().Format("2006-01-02 15:04 MST"),
+		"StatusURL":  s.baseURL(r) + "/status",
+	}
+	if s.cfg.SignConfigs {
+		if priv, err := s.deploymentKey(); err == nil {
+			data["SigningKeyID"] = keyID(priv.Public().(ed25519.PublicKey))
+		} else {
+			slog.Warn("cannot sign recovery kit", "component", "signing", "error", err, "request_id", requestID(r))
+		}
+	}
+
+	slog.Info("recovery kit downloaded", "component", "bootstrap", "event", eventKitDownloaded, "peer", s.cfg.PeerName, "request_id", requestID(r))
+	s.recordEvent(eventKitDownloaded, "Recovery kit for %s downloaded", s.cfg.PeerName)
+
+	w.Header().Set("Cache-Control", "no-store")
+	ui.RecoveryKitPage.Execute(w, data)
+}
+
+// wireGuardKeyFingerprint shortens a base64 WireGuard public key to
+// something that can be compared by eye against `wg show` output.
+func wireGuardKeyFingerprint(key string) string {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(b) != 32 {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	h := hex.EncodeToString(sum[:8])
+	return h[0:4] + " " + h[4:8] + " " + h[8:12] + " " + h[12:16]
+}
@@ -0,0 +1,74 @@
+package bootstrap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+)
+
+// redelivery records who completed the bootstrap, so the same client can
+// fetch the page again for a short while. This covers the common "my phone
+// scanned it but the import failed" case without re-arming the link for
+// everyone.
+type redelivery struct {
+	Fingerprint string    `json:"fingerprint"`
+	ServedAt    time.Time `json:"served_at"`
+	Count       int       `json:"count"`
+}
+
+// clientFingerprint hashes the client IP and User-Agent. It is not meant
+// to identify anyone, only to tell "same browser again" from "someone else".
+func (s Server) clientFingerprint(r *http.Request) string {
+	sum := sha256.Sum256([]byte(s.clientIP(r) + "\x00" + r.UserAgent()))
+	return hex.EncodeToString(sum[:])
+}
+
+// canRedeliver reports whether r may fetch the already-completed bootstrap
+// again: the window must be enabled and still open, the fingerprint must
+// match the original client, and the re-fetch budget must not be used up.
+func (s Server) canRedeliver(r *http.Request) bool {
+	if s.cfg.RedeliveryWindow <= 0 {
+		return false
+	}
+	rd, err := s.loadRedelivery()
+	if err != nil {
+		return false
+	}
+	return rd.Fingerprint == s.clientFingerprint(r) &&
+		time.Since(rd.ServedAt) <= s.cfg.RedeliveryWindow &&
+		rd.Count < s.cfg.RedeliveryMax
+}
+
+// recordDelivery stores the first delivery, or counts a re-delivery.
+func (s Server) recordDelivery(r *http.Request, redeliver bool) error {
+	if s.cfg.RedeliveryWindow <= 0 {
+		return nil
+	}
+	rd := redelivery{Fingerprint: s.clientFingerprint(r), ServedAt: time.Now()}
+	if redeliver {
+		prev, err := s.loadRedelivery()
+		if err != nil {
+			return err
+		}
+		rd = prev
+		rd.Count++
+	}
+	b, err := json.Marshal(rd)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.redeliveryPath(), b, 0o600)
+}
+
+func (s Server) loadRedelivery() (redelivery, error) {
+	var rd redelivery
+	b, err := os.ReadFile(s.redeliveryPath())
+	if err != nil {
+		return rd, err
+	}
+	err = json.Unmarshal(b, &rd)
+	return rd, err
+}
@@ -0,0 +1,65 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// requestIDHeader carries the correlation ID in both directions. Automation
+// may supply its own; otherwise one is generated.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds inbound IDs so callers can't stuff logs.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// withRequestID assigns every request an ID, stores it on the context and
+// echoes it in the response headers.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestID returns the ID assigned by withRequestID, or "-" outside it.
+func requestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+// httpError is http.Error with the request ID appended so users can quote
+// it when reporting a failure.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	http.Error(w, fmt.Sprintf("%s (request_id=%s)", msg, requestID(r)), code)
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID accepts short IDs made of visible ASCII only.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,525 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/notify"
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// deviceRequest is a request for a new device sent through the public
+// form at /request-device. It waits for an admin to approve it through
+// the API or the link in the notification. Approval creates the peer; the
+// requester's status page then mints a single-use onboarding link the
+// first time it is opened, so no usable token is ever stored.
+type deviceRequest struct {
+	ID     string `json:"id"`
+	Device string `json:"device"`
+	Person string `json:"person,omitempty"`
+	Note   string `json:"note,omitempty"`
+	Client string `json:"client"`
+	// SecretHash opens the requester's status page, ReviewHash the
+	// approver's page from the notification.
+	SecretHash string    `json:"secret_hash"`
+	ReviewHash string    `json:"review_hash"`
+	Created    time.Time `json:"created"`
+	Status     string    `json:"status"` // pending, approved or denied
+	Decided    time.Time `json:"decided,omitempty"`
+	Peer       string    `json:"peer,omitempty"`
+	LinkIssued time.Time `json:"link_issued,omitempty"`
+}
+
+const (
+	// deviceRequestTTL is how long requests, answered or not, are kept.
+	// It is also the lifetime of the link an approved request issues.
+	deviceRequestTTL = 7 * 24 * time.Hour
+	// maxPendingRequests stops a stranger from filling the admin's queue.
+	maxPendingRequests = 20
+	// deviceRequestCooldown is how often one client IP may ask.
+	deviceRequestCooldown = 10 * time.Minute
+)
+
+var (
+	requestsMu sync.Mutex
+	// lastDeviceRequest is when each client IP last sent the form.
+	lastDeviceRequest = map[string]time.Time{}
+)
+
+var (
+	errRequestNotFound = errors.New("no such request")
+	errRequestDecided  = errors.New("request was already answered")
+)
+
+func (s Server) loadDeviceRequests() []deviceRequest {
+	var reqs []deviceRequest
+	b, err := os.ReadFile(s.cfg.DeviceRequestsPath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read device requests", "component", "requests", "error", err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &reqs); err != nil {
+		slog.Warn("device requests file is corrupt", "component", "requests", "error", err)
+		return nil
+	}
+	return reqs
+}
+
+// saveDeviceRequests writes reqs, dropping those past deviceRequestTTL.
+func (s Server) saveDeviceRequests(reqs []deviceRequest) error {
+	kept := []deviceRequest{}
+	for _, r := range reqs {
+		if time.Since(r.Created) < deviceRequestTTL {
+			kept = append(kept, r)
+		}
+	}
+	b, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.DeviceRequestsPath(), b, 0o600)
+}
+
+// findDeviceRequest returns the live request with id. The caller holds
+// requestsMu.
+func (s Server) findDeviceRequest(id string) (deviceRequest, bool) {
+	for _, dr := range s.loadDeviceRequests() {
+		if dr.ID == id && time.Since(dr.Created) < deviceRequestTTL {
+			return dr, true
+		}
+	}
+	return deviceRequest{}, false
+}
+
+func (s Server) updateDeviceRequest(dr deviceRequest) error {
+	reqs := s.loadDeviceRequests()
+	for i := range reqs {
+		if reqs[i].ID == dr.ID {
+			reqs[i] = dr
+		}
+	}
+	return s.saveDeviceRequests(reqs)
+}
+
+func randomSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// tokenAttemptAllowed applies the bad-token lockout to the secrets in
+// these pages' URLs, which guardTokens doesn't see because they aren't
+// passed as ?token=.
+func (s Server) tokenAttemptAllowed(w http.ResponseWriter, r *http.Request) bool {
+	if s.tokenGuard == nil {
+		return true
+	}
+	wait, ok := s.tokenGuard.allow(s.clientIP(r), time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(wait.Seconds()+0.5), 1)))
+		httpError(w, r, "too many token attempts, retry later", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// secretOK compares a presented secret with a stored hash.
+func secretOK(secret, hash string) bool {
+	return secret != "" && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(hash)) == 1
+}
+
+// decideDeviceRequest approves or declines request id. Approving creates
+// the peer, subject to PEOPLE_MAX_DEVICES.
+func (s Server) decideDeviceRequest(id string, approve bool) (deviceRequest, error) {
+	requestsMu.Lock()
+	defer requestsMu.Unlock()
+
+	dr, ok := s.findDeviceRequest(id)
+	if !ok {
+		return deviceRequest{}, errRequestNotFound
+	}
+	if dr.Status != "pending" {
+		return dr, errRequestDecided
+	}
+	dr.Decided = time.Now().UTC()
+	if !approve {
+		dr.Status = "denied"
+		if err := s.updateDeviceRequest(dr); err != nil {
+			return dr, err
+		}
+		s.recordEvent(eventRequestDecided, "Request %s for device %s from %s declined", dr.ID, dr.Device, dr.Client)
+		return dr, nil
+	}
+
+	p, _, err := s.createPeer(apiPeerDir(dr.Device), dr.Person)
+	if err != nil {
+		return dr, err
+	}
+	dr.Status = "approved"
+	dr.Peer = p.Name
+	if err := s.updateDeviceRequest(dr); err != nil {
+		return dr, err
+	}
+	s.recordEvent(eventPeerAdded, "Peer %s added at %s by approving a request from %s", p.Name, p.Address, dr.Client)
+	s.recordEvent(eventRequestDecided, "Request %s for device %s from %s approved as %s", dr.ID, dr.Device, dr.Client, p.Name)
+	return dr, nil
+}
+
+// issueRequestLink mints the onboarding link of approved request id the
+// first time it is asked for, and returns "" afterwards.
+func (s Server) issueRequestLink(r *http.Request, id string) (string, error) {
+	requestsMu.Lock()
+	defer requestsMu.Unlock()
+	dr, ok := s.findDeviceRequest(id)
+	if !ok || dr.Status != "approved" || !dr.LinkIssued.IsZero() {
+		return "", nil
+	}
+	tok, _, err := s.mintOnboardingToken(dr.Peer, "device request "+dr.ID, deviceRequestTTL, true)
+	if err != nil {
+		return "", err
+	}
+	dr.LinkIssued = time.Now().UTC()
+	if err := s.updateDeviceRequest(dr); err != nil {
+		return "", err
+	}
+	return s.onboardingURL(r, dr.Peer, tok), nil
+}
+
+// deviceRequestForm serves /request-device (the form) and
+// /request-device/<id>?secret=… (the requester's status page).
+func (s Server) deviceRequestForm(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DeviceRequests || s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/request-device"), "/")
+	if id, ok := strings.CutSuffix(rest, "/review"); ok {
+		s.deviceRequestReview(w, r, id)
+		return
+	}
+	if rest != "" {
+		if !s.tokenAttemptAllowed(w, r) {
+			return
+		}
+		requestsMu.Lock()
+		dr, found := s.findDeviceRequest(rest)
+		requestsMu.Unlock()
+		secret := r.URL.Query().Get("secret")
+		ok := found && secretOK(secret, dr.SecretHash)
+		s.noteTokenAttempt(r, secret, ok)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data := map[string]any{"Status": dr.Status, "Device": dr.Device}
+		if dr.Status == "approved" {
+			link, err := s.issueRequestLink(r, rest)
+			switch {
+			case err != nil:
+				slog.Error("cannot issue link for approved request", "component", "requests", "request", rest, "error", err, "request_id", requestID(r))
+				data["Error"] = "Something went wrong; reload this page."
+			case link == "":
+				data["Status"] = "issued"
+			default:
+				slog.Info("link issued", "component", "requests", "request", rest, "peer", dr.Peer, "request_id", requestID(r))
+				data["Link"] = link
+			}
+		}
+		ui.DeviceRequestPage.Execute(w, data)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ui.DeviceRequestPage.Execute(w, map[string]any{})
+	case http.MethodPost:
+		s.submitDeviceRequest(w, r)
+	default:
+		httpError(w, r, "method not allowed", 405)
+	}
+}
+
+func (s Server) submitDeviceRequest(w http.ResponseWriter, r *http.Request) {
+	fail := func(code int, msg string) {
+		w.WriteHeader(code)
+		ui.DeviceRequestPage.Execute(w, map[string]any{"Error": msg})
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	device := strings.TrimSpace(r.PostFormValue("device"))
+	person := strings.TrimSpace(r.PostFormValue("person"))
+	note := strings.TrimSpace(r.PostFormValue("note"))
+	if !validPeerName.MatchString(device) || reservedDirs[device] || len(apiPeerDir(device)) > maxPeerDirLen {
+		fail(400, "Pick a device name of up to 10 letters, digits, '-' or '_'.")
+		return
+	}
+	if person != "" && (!validPeerName.MatchString(person) || len(person) > 32 || person == guestPerson) {
+		fail(400, "Use up to 32 letters, digits, '-' or '_' for your name.")
+		return
+	}
+	if len(note) > 280 {
+		note = note[:280]
+	}
+
+	client := s.clientIP(r)
+	secret, err := randomSecret(24)
+	if err != nil {
+		fail(500, "Something went wrong; try again.")
+		return
+	}
+	code, err := randomSecret(24)
+	if err != nil {
+		fail(500, "Something went wrong; try again.")
+		return
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		fail(500, "Something went wrong; try again.")
+		return
+	}
+	dr := deviceRequest{
+		ID:         hex.EncodeToString(id[:]),
+		Device:     device,
+		Person:     person,
+		Note:       note,
+		Client:     client,
+		SecretHash: hashToken(secret),
+		ReviewHash: hashToken(code),
+		Created:    time.Now().UTC(),
+		Status:     "pending",
+	}
+
+	requestsMu.Lock()
+	now := time.Now()
+	if last, ok := lastDeviceRequest[client]; ok && now.Sub(last) < deviceRequestCooldown {
+		requestsMu.Unlock()
+		w.Header().Set("Retry-After", strconv.Itoa(int((deviceRequestCooldown - now.Sub(last)).Seconds())))
+		fail(http.StatusTooManyRequests, "You sent a request a few minutes ago. Wait a while before sending another.")
+		return
+	}
+	reqs := s.loadDeviceRequests()
+	pending := 0
+	for _, o := range reqs {
+		if o.Status == "pending" && time.Since(o.Created) < deviceRequestTTL {
+			pending++
+		}
+	}
+	if pending >= maxPendingRequests {
+		requestsMu.Unlock()
+		fail(http.StatusServiceUnavailable, "Too many requests are waiting already. Ask whoever runs this VPN directly.")
+		return
+	}
+	err = s.saveDeviceRequests(append(reqs, dr))
+	if err == nil {
+		lastDeviceRequest[client] = now
+	}
+	requestsMu.Unlock()
+	if err != nil {
+		slog.Error("cannot store device request", "component", "requests", "error", err, "request_id", requestID(r))
+		fail(500, "Something went wrong; try again.")
+		return
+	}
+
+	base := s.baseURL(r) + "/request-device/" + dr.ID
+	slog.Info("device requested", "component", "requests", "request", dr.ID, "device", device, "person", person, "client", client, "request_id", requestID(r))
+	s.recordEvent(eventDeviceRequested, "Device %s requested by %s; approve with POST /api/requests/%s/approve", device, client, dr.ID)
+	s.notifyDeviceRequest(dr, base+"/review?code="+url.QueryEscape(code))
+
+	w.WriteHeader(http.StatusAccepted)
+	ui.DeviceRequestPage.Execute(w, map[string]any{"StatusURL": base + "?secret=" + url.QueryEscape(secret)})
+}
+
+// notifyDeviceRequest tells the admin through ALERT_NOTIFY_URL, with a
+// link to approve or decline. The link only opens a page; deciding takes
+// a button press there.
+func (s Server) notifyDeviceRequest(dr deviceRequest, reviewURL string) {
+	n := notify.New(s.cfg.AlertNotifyURL, s.cfg.AlertNotifyFormat)
+	if !n.Enabled() {
+		return
+	}
+	who := dr.Client
+	if dr.Person != "" {
+		who = dr.Person + " (" + dr.Client + ")"
+	}
+	msg := fmt.Sprintf("%s asks for VPN access for a device called %s.", who, dr.Device)
+	if dr.Note != "" {
+		msg += " Note: " + dr.Note
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err := n.Send(ctx, notify.Event{
+			Event:   "device_requested",
+			Title:   "VPN device request",
+			Message: msg + "\nReview: " + reviewURL,
+			URL:     reviewURL,
+			App:     s.cfg.EndpointHost,
+			Region:  s.cfg.Region,
+		})
+		if err != nil {
+			slog.Warn("device request notification failed", "component", "requests", "request", dr.ID, "error", err)
+		}
+	}()
+}
+
+// deviceRequestReview serves /request-device/<id>/review?code=…, the
+// approver's page linked from the notification.
+func (s Server) deviceRequestReview(w http.ResponseWriter, r *http.Request, id string) {
+	if !s.tokenAttemptAllowed(w, r) {
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 4096)
+		code = r.PostFormValue("code")
+	}
+	requestsMu.Lock()
+	dr, found := s.findDeviceRequest(id)
+	requestsMu.Unlock()
+	ok := found && secretOK(code, dr.ReviewHash)
+	s.noteTokenAttempt(r, code, ok)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := map[string]any{}
+	if r.Method == http.MethodPost {
+		var err error
+		dr, err = s.decideDeviceRequest(id, r.PostFormValue("decision") == "approve")
+		if err != nil {
+			data["Error"] = requestErrorText(err)
+			slog.Warn("device request not decided", "component", "requests", "request", id, "error", err, "request_id", requestID(r))
+		} else {
+			slog.Info("device request decided", "component", "requests", "request", id, "status", dr.Status, "peer", dr.Peer, "request_id", requestID(r))
+		}
+	}
+	data["Device"] = dr.Device
+	data["Person"] = dr.Person
+	data["Note"] = dr.Note
+	data["Client"] = dr.Client
+	data["Created"] = dr.Created.Format(time.RFC3339)
+	data["Status"] = dr.Status
+	data["Peer"] = dr.Peer
+	data["Code"] = code
+	ui.DeviceReviewPage.Execute(w, data)
+}
+
+// requestErrorText explains a failed decision to the approver.
+func requestErrorText(err error) string {
+	switch {
+	case errors.Is(err, errRequestDecided):
+		return "This request was already answered."
+	case errors.Is(err, errPeerExists), errors.Is(err, errPeerDeleted), errors.Is(err, errDeviceBudget):
+		return "Could not approve: " + err.Error() + "."
+	default:
+		return "Could not approve; see the server log."
+	}
+}
+
+// requestListSpec is what GET /api/requests filters and sorts on.
+var requestListSpec = listSpec{
+	idField:     "id",
+	filters:     []string{"status", "person"},
+	sorts:       []string{"created", "device"},
+	defaultSort: "-created",
+}
+
+// apiRequests serves GET /api/requests and POST
+// /api/requests/<id>/approve or /deny. Requires an admin token.
+func (s Server) apiRequests(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.DeviceRequests || s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/requests"), "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		lq, err := parseListQuery(r, requestListSpec)
+		if err != nil {
+			httpError(w, r, err.Error(), 400)
+			return
+		}
+		requestsMu.Lock()
+		reqs := s.loadDeviceRequests()
+		requestsMu.Unlock()
+		out := []map[string]any{}
+		for _, dr := range reqs {
+			item := map[string]any{
+				"id":      dr.ID,
+				"device":  dr.Device,
+				"person":  dr.Person,
+				"note":    dr.Note,
+				"client":  dr.Client,
+				"created": dr.Created.Format(time.RFC3339),
+				"status":  dr.Status,
+				"peer":    dr.Peer,
+			}
+			if !dr.Decided.IsZero() {
+				item["decided"] = dr.Decided.Format(time.RFC3339)
+			}
+			out = append(out, item)
+		}
+		out, next := lq.page(out)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"requests": out, "next_cursor": next})
+
+	case r.Method == http.MethodPost && (action == "approve" || action == "deny"):
+		dr, err := s.decideDeviceRequest(id, action == "approve")
+		switch {
+		case errors.Is(err, errRequestNotFound):
+			httpError(w, r, err.Error(), 404)
+			return
+		case errors.Is(err, errRequestDecided), errors.Is(err, errPeerExists), errors.Is(err, errPeerDeleted), errors.Is(err, errDeviceBudget):
+			httpError(w, r, err.Error(), 409)
+			return
+		case err != nil:
+			slog.Error("cannot decide device request", "component", "requests", "request", id, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not decide request", 500)
+			return
+		}
+		slog.Info("device request decided", "component", "requests", "request", id, "status", dr.Status, "peer", dr.Peer, "request_id", requestID(r))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": dr.ID, "status": dr.Status, "peer": dr.Peer})
+
+	default:
+		httpError(w, r, "method not allowed", 405)
+	}
+}
+
+// pendingDeviceRequests lists requests waiting for an answer, for /admin.
+func (s Server) pendingDeviceRequests() []deviceRequest {
+	requestsMu.Lock()
+	defer requestsMu.Unlock()
+	var out []deviceRequest
+	for _, dr := range s.loadDeviceRequests() {
+		if dr.Status == "pending" && time.Since(dr.Created) < deviceRequestTTL {
+			out = append(out, dr)
+		}
+	}
+	return out
+}
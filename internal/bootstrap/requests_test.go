@@ -0,0 +1,178 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func postForm(h http.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = "198.51.100.7:40000"
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func resetDeviceRequestCooldown(t *testing.T) {
+	t.Cleanup(func() {
+		requestsMu.Lock()
+		lastDeviceRequest = map[string]time.Time{}
+		requestsMu.Unlock()
+	})
+}
+
+func TestDeviceRequestApproved(t *testing.T) {
+	review := make(chan *http.Request, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { review <- r }))
+	defer hook.Close()
+	s := newTestServer(t, func(c *config.Config) {
+		c.DeviceRequests = true
+		c.AlertNotifyURL = hook.URL
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	resetDeviceRequestCooldown(t)
+
+	w := postForm(s.deviceRequestForm, "/request-device", url.Values{"device": {"laptop"}, "person": {"alice"}, "note": {"new job"}})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("request: status = %d: %s", w.Code, w.Body)
+	}
+	statusURL := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	if statusURL == nil {
+		t.Fatalf("no status link in %s", w.Body)
+	}
+	status, _ := url.Parse(strings.ReplaceAll(statusURL[1], "&amp;", "&"))
+
+	var reviewURL *url.URL
+	select {
+	case r := <-review:
+		reviewURL, _ = url.Parse(r.Header.Get("Click"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification sent")
+	}
+	if reviewURL == nil || !strings.HasSuffix(reviewURL.Path, "/review") {
+		t.Fatalf("notification links to %v, want a review page", reviewURL)
+	}
+
+	if w := serve(s.deviceRequestForm, http.MethodGet, status.RequestURI()); !strings.Contains(w.Body.String(), "still waiting") {
+		t.Errorf("status page before approval: %d %s", w.Code, w.Body)
+	}
+	if w := serve(s.deviceRequestForm, http.MethodGet, status.Path+"?secret=wrong"); w.Code != http.StatusNotFound {
+		t.Errorf("status page with a wrong secret: status = %d, want 404", w.Code)
+	}
+	if w := serve(s.deviceRequestForm, http.MethodGet, reviewURL.RequestURI()); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Approve") {
+		t.Fatalf("review page: %d %s", w.Code, w.Body)
+	}
+	if peers := s.loadAPIPeers(); len(peers) != 0 {
+		t.Fatalf("opening the review page created %d peers", len(peers))
+	}
+
+	w = postForm(s.deviceRequestForm, reviewURL.Path, url.Values{"code": {reviewURL.Query().Get("code")}, "decision": {"approve"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "approved") {
+		t.Fatalf("approve: %d %s", w.Code, w.Body)
+	}
+	peers := s.loadAPIPeers()
+	if len(peers) != 1 || peers[0].Name != "peer_laptop" || peers[0].Person != "alice" {
+		t.Fatalf("peers after approval = %+v", peers)
+	}
+
+	w = serve(s.deviceRequestForm, http.MethodGet, status.RequestURI())
+	link := regexp.MustCompile(`href="(http[^"]+/bootstrap/peer_laptop\?token=[^"]+)"`).FindStringSubmatch(w.Body.String())
+	if link == nil {
+		t.Fatalf("no onboarding link after approval: %s", w.Body)
+	}
+	if w := serve(s.deviceRequestForm, http.MethodGet, status.RequestURI()); strings.Contains(w.Body.String(), "?token=") {
+		t.Error("status page shows the link a second time")
+	}
+	onboard, _ := url.Parse(link[1])
+	if w := serve(s.bootstrapPeer, http.MethodGet, onboard.RequestURI()); w.Code != http.StatusOK {
+		t.Errorf("issued link: status = %d", w.Code)
+	}
+}
+
+func TestDeviceRequestAPI(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.DeviceRequests = true
+		c.People = []string{"alice:peer1"}
+		c.PeopleMaxDevices = 1
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+	resetDeviceRequestCooldown(t)
+
+	for i, dev := range []string{"phone", "tablet"} {
+		requestsMu.Lock()
+		lastDeviceRequest = map[string]time.Time{}
+		requestsMu.Unlock()
+		person := []string{"", "alice"}[i]
+		if w := postForm(s.deviceRequestForm, "/request-device", url.Values{"device": {dev}, "person": {person}}); w.Code != http.StatusAccepted {
+			t.Fatalf("request %s: status = %d: %s", dev, w.Code, w.Body)
+		}
+	}
+
+	w := serve(s.apiRequests, http.MethodGet, "/api/requests?status=pending&sort=device&token="+testAdminToken)
+	var list struct {
+		Requests []map[string]any `json:"requests"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Requests) != 2 {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	if _, ok := list.Requests[0]["secret_hash"]; ok {
+		t.Error("list exposes the requester's secret hash")
+	}
+	phone, tablet := list.Requests[0]["id"].(string), list.Requests[1]["id"].(string)
+
+	cases := []struct {
+		name, target string
+		want         int
+	}{
+		{"no token", "/api/requests/" + phone + "/approve", http.StatusUnauthorized},
+		{"approve", "/api/requests/" + phone + "/approve?token=" + testAdminToken, http.StatusOK},
+		{"approve twice", "/api/requests/" + phone + "/deny?token=" + testAdminToken, http.StatusConflict},
+		{"over alice's budget", "/api/requests/" + tablet + "/approve?token=" + testAdminToken, http.StatusConflict},
+		{"deny", "/api/requests/" + tablet + "/deny?token=" + testAdminToken, http.StatusOK},
+		{"unknown", "/api/requests/0000/approve?token=" + testAdminToken, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if w := serve(s.apiRequests, http.MethodPost, c.target); w.Code != c.want {
+			t.Errorf("%s: status = %d, want %d: %s", c.name, w.Code, c.want, w.Body)
+		}
+	}
+	if peers := s.loadAPIPeers(); len(peers) != 1 || peers[0].Name != "peer_phone" {
+		t.Errorf("peers = %+v, want only peer_phone", peers)
+	}
+}
+
+func TestDeviceRequestLimits(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) { c.DeviceRequests = true })
+	resetDeviceRequestCooldown(t)
+
+	cases := []struct {
+		name string
+		form url.Values
+		want int
+	}{
+		{"bad device name", url.Values{"device": {"../etc"}}, http.StatusBadRequest},
+		{"too long for an interface", url.Values{"device": {"a-very-long-name"}}, http.StatusBadRequest},
+		{"bad person", url.Values{"device": {"phone"}, "person": {"a b"}}, http.StatusBadRequest},
+		{"accepted", url.Values{"device": {"phone"}}, http.StatusAccepted},
+		{"same client again", url.Values{"device": {"tablet"}}, http.StatusTooManyRequests},
+	}
+	for _, c := range cases {
+		if w := postForm(s.deviceRequestForm, "/request-device", c.form); w.Code != c.want {
+			t.Errorf("%s: status = %d, want %d", c.name, w.Code, c.want)
+		}
+	}
+
+	off := newTestServer(t, nil)
+	if w := serve(off.deviceRequestForm, http.MethodGet, "/request-device"); w.Code != http.StatusNotFound {
+		t.Errorf("disabled: status = %d, want 404", w.Code)
+	}
+}
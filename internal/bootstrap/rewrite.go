@@ -0,0 +1,127 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"net"
+	"strings"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// endpointRewriter adjusts the host and/or port of a served config's
+// Endpoint. Rewriters run in order and each sees the previous one's
+// output; an empty host or port means "unknown".
+type endpointRewriter func(host, port string) (string, string)
+
+// endpointRewriters builds each named rewriter from the config. A
+// rewriter whose setting is unset passes its input through.
+var endpointRewriters = map[string]func(cfg config.Config) endpointRewriter{
+	// fly: <app>.fly.dev, the name Fly's dedicated IPv4 answers on.
+	"fly": func(cfg config.Config) endpointRewriter {
+		return func(host, port string) (string, string) {
+			if cfg.EndpointHost != "" {
+				host = cfg.EndpointHost + ".fly.dev"
+			}
+			return host, port
+		}
+	},
+	// custom-domain: BOOTSTRAP_ENDPOINT_HOST, e.g. a CNAME or a VPS.
+	"custom-domain": func(cfg config.Config) endpointRewriter {
+		return func(host, port string) (string, string) {
+			if cfg.PublicHost != "" {
+				host = cfg.PublicHost
+			}
+			return host, port
+		}
+	},
+	// port: BOOTSTRAP_ENDPOINT_PORT / SERVERPORT.
+	"port": func(cfg config.Config) endpointRewriter {
+		return func(host, port string) (string, string) {
+			if cfg.EndpointPort != "" {
+				port = cfg.EndpointPort
+			}
+			return host, port
+		}
+	},
+	// ipv6: strips brackets a host may already carry so the final
+	// host:port join brackets IPv6 literals exactly once.
+	"ipv6": func(cfg config.Config) endpointRewriter {
+		return func(host, port string) (string, string) {
+			return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), port
+		}
+	},
+}
+
+// defaultEndpointRewriters reproduces the historical behavior: the fly.dev
+// name, overridden by a custom host, with the configured port.
+var defaultEndpointRewriters = []string{"fly", "custom-domain", "port", "ipv6"}
+
+// buildEndpointRewriters resolves ENDPOINT_REWRITERS into a chain,
+// skipping (and logging) unknown names.
+func buildEndpointRewriters(cfg config.Config) []endpointRewriter {
+	names := cfg.EndpointRewriters
+	if len(names) == 0 {
+		names = defaultEndpointRewriters
+	}
+	var chain []endpointRewriter
+	for _, name := range names {
+		build, ok := endpointRewriters[strings.ToLower(name)]
+		if !ok {
+			slog.Warn("ignoring unknown ENDPOINT_REWRITERS entry", "component", "endpoint", "rewriter", name)
+			continue
+		}
+		chain = append(chain, build(cfg))
+	}
+	return chain
+}
+
+// rewriteEndpoint runs the Endpoint line of conf through the rewriter
+// chain. The original value seeds the chain, parsed leniently so the
+// bracket-less IPv6 form the sidecar sometimes writes ("2a02:...:51820")
+// is understood. The line is left alone if the chain ends up without a
+// host or port.
+func (s Server) rewriteEndpoint(conf string) string {
+	lines := strings.Split(conf, "\n")
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "Endpoint ") && !strings.HasPrefix(trimmed, "Endpoint=") {
+			continue
+		}
+
+		// Preserve original indentation.
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+		// Parse current value after "Endpoint" and optional "=".
+		rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "Endpoint"))
+		rest = strings.TrimLeft(rest, " =")
+
+		host, port, _ := splitEndpoint(rest)
+		for _, rw := range s.rewriters {
+			host, port = rw(host, port)
+		}
+		if host == "" || port == "" {
+			return conf
+		}
+		lines[i] = indent + "Endpoint = " + net.JoinHostPort(host, port)
+		return strings.Join(lines, "\n")
+	}
+
+	// No Endpoint line found; nothing to normalize.
+	return conf
+}
+
+// splitEndpoint splits an Endpoint value into host and port, accepting the
+// bracket-less IPv6 form the sidecar sometimes writes.
+func splitEndpoint(v string) (host, port string, ok bool) {
+	if h, p, err := net.SplitHostPort(v); err == nil {
+		return h, p, true
+	}
+	if strings.Count(v, ":") > 1 && !strings.Contains(v, "]") {
+		lastColon := strings.LastIndex(v, ":")
+		if lastColon > 0 && lastColon < len(v)-1 {
+			return v[:lastColon], v[lastColon+1:], true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,131 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+// endpointFixture reads a peer config from testdata/endpoints. The
+// fixtures differ only in their Endpoint line.
+func endpointFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "endpoints", name+".conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// splitEndpointLine returns conf's Endpoint line (indentation included)
+// and the rest of conf without it.
+func splitEndpointLine(conf string) (endpoint, rest string) {
+	var others []string
+	for _, line := range strings.Split(conf, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "Endpoint") {
+			endpoint = line
+			continue
+		}
+		others = append(others, line)
+	}
+	return endpoint, strings.Join(others, "\n")
+}
+
+// checkRewrite runs fixture through chain and checks that only the
+// Endpoint line changed, to want.
+func checkRewrite(t *testing.T, chain []endpointRewriter, fixture, want string) {
+	t.Helper()
+	in := endpointFixture(t, fixture)
+	out := Server{rewriters: chain}.rewriteEndpoint(in)
+	got, rest := splitEndpointLine(out)
+	if got != want {
+		t.Errorf("Endpoint line = %q, want %q", got, want)
+	}
+	if _, inRest := splitEndpointLine(in); rest != inRest {
+		t.Errorf("lines other than Endpoint changed:\n%s", out)
+	}
+}
+
+func TestEndpointRewriters(t *testing.T) {
+	cases := []struct {
+		rewriter string
+		fixture  string
+		cfg      config.Config
+		want     string
+	}{
+		{"fly", "ipv4", config.Config{EndpointHost: "myvpn"}, "Endpoint = myvpn.fly.dev:51820"},
+		{"fly", "ipv6-bare", config.Config{EndpointHost: "myvpn"}, "Endpoint = myvpn.fly.dev:51820"},
+		{"fly", "compact", config.Config{EndpointHost: "myvpn"}, "\tEndpoint = myvpn.fly.dev:51820"},
+		{"fly", "ipv4", config.Config{}, "Endpoint = 203.0.113.10:51820"},
+		{"fly", "no-endpoint", config.Config{EndpointHost: "myvpn"}, ""},
+
+		{"custom-domain", "hostname", config.Config{PublicHost: "vpn.example.org"}, "Endpoint = vpn.example.org:51820"},
+		{"custom-domain", "ipv6", config.Config{PublicHost: "vpn.example.org"}, "Endpoint = vpn.example.org:51820"},
+		{"custom-domain", "ipv6", config.Config{}, "Endpoint = [2a02:6b8::10]:51820"},
+		{"custom-domain", "no-endpoint", config.Config{PublicHost: "vpn.example.org"}, ""},
+
+		{"port", "ipv4", config.Config{EndpointPort: "443"}, "Endpoint = 203.0.113.10:443"},
+		{"port", "ipv6-bare", config.Config{EndpointPort: "443"}, "Endpoint = [2a02:6b8::10]:443"},
+		{"port", "compact", config.Config{EndpointPort: "443"}, "\tEndpoint = 203.0.113.10:443"},
+		{"port", "hostname", config.Config{}, "Endpoint = vpn.example.com:51820"},
+		{"port", "no-endpoint", config.Config{EndpointPort: "443"}, ""},
+
+		{"ipv6", "ipv6", config.Config{}, "Endpoint = [2a02:6b8::10]:51820"},
+		{"ipv6", "ipv6-bare", config.Config{}, "Endpoint = [2a02:6b8::10]:51820"},
+		{"ipv6", "ipv4", config.Config{}, "Endpoint = 203.0.113.10:51820"},
+		{"ipv6", "hostname", config.Config{}, "Endpoint = vpn.example.com:51820"},
+		{"ipv6", "no-endpoint", config.Config{}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.rewriter+"/"+tc.fixture, func(t *testing.T) {
+			checkRewrite(t, []endpointRewriter{endpointRewriters[tc.rewriter](tc.cfg)}, tc.fixture, tc.want)
+		})
+	}
+}
+
+func TestEndpointRewriterChain(t *testing.T) {
+	cases := []struct {
+		name    string
+		fixture string
+		cfg     config.Config
+		want    string
+	}{
+		{"default, fly only", "ipv4", config.Config{EndpointHost: "myvpn"}, "Endpoint = myvpn.fly.dev:51820"},
+		{"default, custom domain wins", "ipv6-bare", config.Config{EndpointHost: "myvpn", PublicHost: "vpn.example.org", EndpointPort: "443"}, "Endpoint = vpn.example.org:443"},
+		{"default, bracketed custom host", "hostname", config.Config{PublicHost: "[2001:db8::1]"}, "Endpoint = [2001:db8::1]:51820"},
+		{"default, nothing set", "ipv6-bare", config.Config{}, "Endpoint = [2a02:6b8::10]:51820"},
+		{"order matters", "ipv4", config.Config{EndpointHost: "myvpn", PublicHost: "vpn.example.org", EndpointRewriters: []string{"custom-domain", "fly"}}, "Endpoint = myvpn.fly.dev:51820"},
+		{"unknown skipped", "ipv4", config.Config{EndpointPort: "443", EndpointRewriters: []string{"nope", "PORT"}}, "Endpoint = 203.0.113.10:443"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkRewrite(t, buildEndpointRewriters(tc.cfg), tc.fixture, tc.want)
+		})
+	}
+}
+
+func TestSplitEndpoint(t *testing.T) {
+	cases := []struct {
+		in         string
+		host, port string
+		ok         bool
+	}{
+		{"vpn.example.com:51820", "vpn.example.com", "51820", true},
+		{"203.0.113.9:51820", "203.0.113.9", "51820", true},
+		{"[2001:db8::1]:51820", "2001:db8::1", "51820", true},
+		{"2001:db8::1:51820", "2001:db8::1", "51820", true},
+		{"vpn.example.com", "", "", false},
+		{"2001:db8::1:", "", "", false},
+		{"[2001:db8::1]", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tc := range cases {
+		host, port, ok := splitEndpoint(tc.in)
+		if host != tc.host || port != tc.port || ok != tc.ok {
+			t.Errorf("splitEndpoint(%q) = %q, %q, %v; want %q, %q, %v", tc.in, host, port, ok, tc.host, tc.port, tc.ok)
+		}
+	}
+}
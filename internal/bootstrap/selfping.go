@@ -0,0 +1,63 @@
+package bootstrap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// keepalivePath is where the keepalive loop sends its own pings. They go
+// through Fly's proxy on purpose, since that is what keeps the machine
+// from being auto-stopped. A dedicated path keeps them cheap and easy to
+// tell apart in logs.
+const keepalivePath = "/_internal/keepalive"
+
+// selfPingNonce marks pings from this process so the handler can tell
+// them from outside requests to the same path.
+var selfPingNonce = func() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}()
+
+var (
+	selfPings    atomic.Int64
+	lastSelfPing atomic.Int64 // unix seconds
+)
+
+// newSelfPing builds the keepalive request for url.
+func newSelfPing(url string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Keepalive-Nonce", selfPingNonce)
+	return req, nil
+}
+
+// keepalivePing answers the loop's own pings with an empty 204. They are
+// only counted; suspend decisions never look at HTTP traffic.
+func (s Server) keepalivePing(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Keepalive-Nonce") != selfPingNonce {
+		http.NotFound(w, r)
+		return
+	}
+	selfPings.Add(1)
+	lastSelfPing.Store(time.Now().Unix())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// activitySignals documents, for /diagnostics, what counts as activity.
+func activitySignals() map[string]any {
+	sig := map[string]any{
+		"counted":     []string{"WireGuard handshakes (minus KEEPALIVE_IGNORE_PEERS)", "new conntrack flows from the tunnel subnet"},
+		"not_counted": []string{"HTTP requests, including keepalive self-pings, health checks, scrapers and probes"},
+		"self_pings":  selfPings.Load(),
+	}
+	if t := lastSelfPing.Load(); t > 0 {
+		sig["last_self_ping"] = time.Unix(t, 0).UTC().Format(time.RFC3339)
+	}
+	return sig
+}
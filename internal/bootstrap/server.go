@@ -1,69 +1,225 @@
 package bootstrap
 
 import (
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
+	"html/template"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
-	"os/exec"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"fly-wireguard-vpn-proxy/internal/config"
+	"fly-wireguard-vpn-proxy/internal/exitcode"
+	"fly-wireguard-vpn-proxy/internal/fly"
+	"fly-wireguard-vpn-proxy/internal/hooks"
+	"fly-wireguard-vpn-proxy/internal/notify"
 	"fly-wireguard-vpn-proxy/internal/ui"
-
-	"github.com/skip2/go-qrcode"
-)
-
-const (
-	// startupWindow is how long we force keepalive on startup, to give
-	// clients a chance to connect before we allow idle suspend.
-	startupWindow = 2 * time.Minute
-
-	// maxIdle is how long we allow WireGuard to be idle (no handshakes)
-	// before we stop the keepalive ping and let Fly suspend the machine.
-	maxIdle = 5 * time.Minute
-
-	// interval is how often we check WG status and ping the proxy.
-	interval = 30 * time.Second
+	"fly-wireguard-vpn-proxy/internal/wg"
 )
 
 type Server struct {
-	cfg config.Config
+	cfg            config.Config
+	hooks          hooks.Runner
+	trustedProxies []netip.Prefix
+	rewriters      []endpointRewriter
+
+	// renderLimit covers QR and export rendering; wgLimit covers handlers
+	// that read the interface state, as `wg show` would.
+	renderLimit *opLimiter
+	wgLimit     *opLimiter
+	// tokenGuard rate-limits token attempts and locks out addresses
+	// that keep guessing; nil when both are turned off.
+	tokenGuard *tokenGuard
+
+	// linkPeer is set on copies serving /bootstrap/<peer> (see forPeer);
+	// peerState moves their one-time state into the peer's directory.
+	linkPeer  string
+	peerState bool
 }
 
 func NewServer(cfg config.Config) Server {
-	return Server{cfg: cfg}
+	return Server{
+		cfg:            cfg,
+		hooks:          hooks.New(cfg.HookExec, cfg.HookURL, cfg.HookTimeout),
+		trustedProxies: parseTrustedProxies(cfg.TrustedProxies),
+		rewriters:      buildEndpointRewriters(cfg),
+		renderLimit:    newOpLimiter("render", cfg.ExpensiveConcurrency, cfg.ExpensiveQueueWait),
+		wgLimit:        newOpLimiter("wg", cfg.ExpensiveConcurrency, cfg.ExpensiveQueueWait),
+		tokenGuard:     newTokenGuard(cfg.TokenRateLimit, cfg.TokenLockoutThreshold, cfg.TokenLockoutBase, cfg.TokenLockoutMax),
+	}
 }
 
-func (s Server) Listen() {
+// Listen starts the background loops and serves HTTP until a listener
+// fails. The returned error carries an exitcode class.
+func (s Server) Listen() error {
+	specs, err := listenSpecs(s.cfg.ListenAddrs, s.cfg.Port)
+	if err != nil {
+		return exitcode.Wrap(exitcode.ConfigInvalid, err)
+	}
+	tlsCfg, err := s.tlsConfig()
+	if err != nil {
+		return exitcode.Wrap(exitcode.ConfigInvalid, err)
+	}
+	var tlsSpecs []listenSpec
+	if tlsCfg != nil {
+		if tlsSpecs, err = listenSpecs(s.cfg.ListenAddrs, s.cfg.TLSPort); err != nil {
+			return exitcode.Wrap(exitcode.ConfigInvalid, err)
+		}
+	}
+
+	s.checkConfigChange()
+	s.checkEndpointChange()
+	s.checkPeerCreated()
+	if s.cfg.BootstrapTTL > 0 {
+		s.bootstrapExpired() // start the clock even if nobody visits
+	}
+	go s.reapplyAPIPeers()
+	go s.guestLoop()
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", s.root)
 	mux.HandleFunc("/healthz", s.healthz)
-	mux.HandleFunc("/bootstrap", s.bootstrap)
+	mux.HandleFunc("/healthz/dataplane", s.dataplaneHealth)
+	mux.HandleFunc(keepalivePath, s.keepalivePing)
+	mux.HandleFunc("/internal/keepalive/arm", s.keepaliveArmHook)
+	mux.HandleFunc("/bootstrap", s.renderLimit.wrap(s.bootstrap))
+	mux.HandleFunc("/bootstrap/", s.renderLimit.wrap(s.bootstrapPeer))
+	mux.HandleFunc("/bootstrap/fetch/", s.bootstrapFetch)
+	mux.HandleFunc("/bootstrap/kit/", s.renderLimit.wrap(s.bootstrapKit))
+	mux.HandleFunc("/bootstrap/publish", s.bootstrapPublish)
+	mux.HandleFunc("/bootstrap/sheet", s.renderLimit.wrap(s.bootstrapSheet))
+	mux.HandleFunc("/bootstrap/expire", s.bootstrapExpire)
+	mux.HandleFunc("/client-settings", s.clientSettings)
+	mux.HandleFunc("/status", s.wgLimit.wrap(s.status))
+	mux.HandleFunc("/allowed-ips", s.tunnelOnly(s.allowedIPs))
+	mux.HandleFunc("/events.atom", s.eventsFeed)
+	mux.HandleFunc("/api/events", s.tunnelOnly(s.apiEvents))
+	mux.HandleFunc("/alerts", s.wgLimit.wrap(s.alerts))
+	mux.HandleFunc("/diagnostics", s.tunnelOnly(s.wgLimit.wrap(s.diagnostics)))
+	mux.HandleFunc("/metrics", s.wgLimit.wrap(s.metrics))
+	mux.HandleFunc("/admin", s.tunnelOnly(s.wgLimit.wrap(s.admin)))
+	mux.HandleFunc("/admin/blueprint", s.tunnelOnly(s.idempotent(s.adminBlueprint)))
+	mux.HandleFunc("/disconnect", s.disconnect)
+	mux.HandleFunc("/api/v1/capabilities", s.tunnelOnly(s.apiCapabilities))
+	mux.HandleFunc("/api/peers", s.tunnelOnly(s.idempotent(s.apiPeers)))
+	mux.HandleFunc("/api/peers/", s.tunnelOnly(s.idempotent(s.apiPeers)))
+	mux.HandleFunc("/api/tokens", s.tunnelOnly(s.idempotent(s.apiTokens)))
+	mux.HandleFunc("/api/tokens/", s.tunnelOnly(s.idempotent(s.apiTokens)))
+	mux.HandleFunc("/api/requests", s.tunnelOnly(s.idempotent(s.apiRequests)))
+	mux.HandleFunc("/api/requests/", s.tunnelOnly(s.idempotent(s.apiRequests)))
+	mux.HandleFunc("/request-device", s.deviceRequestForm)
+	mux.HandleFunc("/request-device/", s.deviceRequestForm)
+	mux.HandleFunc("/guest", s.guestClaim)
+	mux.HandleFunc("/guest/poster", s.tunnelOnly(s.renderLimit.wrap(s.guestPoster)))
+	mux.HandleFunc(signingKeyPath, s.wellKnownSigningKey)
+	mux.HandleFunc(discoveryPath, s.discovery)
+	mux.HandleFunc("/export/", s.renderLimit.wrap(s.export))
 
 	// Background keepalive loop:
-	// - For the first 2 minutes after start, always send keepalive pings so
-	//   the machine doesn't suspend before clients connect.
+	// - For KEEPALIVE_STARTUP_WINDOW after start, always send keepalive
+	//   pings so the machine doesn't suspend before clients connect.
 	// - After that, only continue pings while WireGuard has recent handshakes.
-	//   If all peers have been idle for >5 minutes, stop pinging so Fly can
-	//   auto-suspend the machine.
+	//   If all peers have been idle for longer than KEEPALIVE_MAX_IDLE, stop
+	//   pinging so Fly can auto-suspend the machine.
+	// - Once stopped, start again on the next fresh handshake (see
+	//   runKeepalive), since a resumed machine keeps this process.
 	if s.cfg.EndpointHost != "" && strings.ToLower(config.Getenv("KEEPALIVE_ENABLED", "true")) != "false" {
-		go s.keepaliveLoop(s.cfg.EndpointHost)
+		if s.cfg.KeepaliveSuspend && !s.explicitSuspend() {
+			slog.Warn("KEEPALIVE_SUSPEND needs FLY_API_TOKEN and FLY_MACHINE_ID; leaving suspend to the Fly proxy", "component", "keepalive")
+		}
+		go s.runKeepalive(s.cfg.EndpointHost)
 	}
 
-	addr := "0.0.0.0:" + s.cfg.Port
-	log.Printf("bootstrap-http listening on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	// Record Fly's own view of start/stop/suspend transitions so they can
+	// be lined up with inferred client sessions.
+	if flyClient := fly.NewClient(s.cfg.FlyAPIBaseURL, s.cfg.EndpointHost, s.cfg.FlyAPIToken); flyClient.Enabled() && s.cfg.MachineID != "" {
+		go s.machineEventLoop(flyClient, s.cfg.MachineID)
+	}
+
+	if n := notify.New(s.cfg.DigestNotifyURL, s.cfg.DigestNotifyFormat); n.Enabled() {
+		go s.digestLoop(n)
+	}
+
+	if n := notify.New(s.cfg.AlertNotifyURL, s.cfg.AlertNotifyFormat); n.Enabled() {
+		go s.alertLoop(n)
+	}
+
+	handler := withRequestID(s.guardTokens(s.mount(mux)))
+	plain := handler
+	if tlsCfg != nil {
+		// The plain port stays up for health checks and to send
+		// browsers over to HTTPS.
+		plain = s.redirectToHTTPS(handler)
+	}
+
+	errc := make(chan error, len(specs)+len(tlsSpecs))
+	for _, spec := range specs {
+		ln, err := net.Listen(spec.network, spec.addr)
+		if err != nil {
+			return exitcode.Wrap(exitcode.ListenFailed, err)
+		}
+		slog.Info("listening", "component", "http", "addr", ln.Addr().String(), "network", spec.network)
+		go func() { errc <- http.Serve(ln, plain) }()
+	}
+	for _, spec := range tlsSpecs {
+		ln, err := net.Listen(spec.network, spec.addr)
+		if err != nil {
+			return exitcode.Wrap(exitcode.ListenFailed, err)
+		}
+		slog.Info("listening", "component", "http", "addr", ln.Addr().String(), "network", spec.network, "tls", true)
+		go func() { errc <- http.Serve(tls.NewListener(ln, tlsCfg), handler) }()
+	}
+	return exitcode.Wrap(exitcode.ListenFailed, <-errc)
 }
 
+// root is the public face of the app, chosen by ROOT_MODE:
+//
+//   - "text" (default): a one-line pointer to /bootstrap.
+//   - "status": a short plain-text summary (ready, region, bootstrap open
+//     or done), with nothing more sensitive than the status page shows.
+//   - "redirect": a 302 to ROOT_REDIRECT_URL, or the status page if unset.
 func (s Server) root(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("This app only serves /bootstrap (one-time WireGuard config + QR)."))
+	// Unknown paths land here too; they keep the plain pointer.
+	mode := s.cfg.RootMode
+	if r.URL.Path != "/" {
+		mode = "text"
+	}
+
+	switch mode {
+	case "status":
+		state := "starting"
+		if s.wireGuardReady() {
+			state = "online"
+		}
+		bootstrap := "open"
+		if _, err := os.Stat(s.cfg.BootstrapDonePath()); err == nil {
+			bootstrap = "completed"
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprintf(w, "WireGuard VPN: %s\n", state)
+		if s.cfg.Region != "" {
+			fmt.Fprintf(w, "Region: %s\n", s.cfg.Region)
+		}
+		fmt.Fprintf(w, "Onboarding: %s\n", bootstrap)
+	case "redirect":
+		target := s.cfg.RootRedirect
+		if target == "" {
+			target = s.cfg.BasePath + "/status"
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	default:
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("This app only serves /bootstrap (one-time WireGuard config + QR)."))
+	}
 }
 
 func (s Server) healthz(w http.ResponseWriter, r *http.Request) {
@@ -71,57 +227,150 @@ func (s Server) healthz(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("ok"))
 		return
 	}
-	http.Error(w, "config not ready", 503)
+	httpError(w, r, "config not ready", 503)
 }
 
 func (s Server) bootstrap(w http.ResponseWriter, r *http.Request) {
-	if _, err := os.Stat(s.cfg.BootstrapDonePath()); err == nil {
-		http.Error(w, "bootstrap already completed", 410)
+	// In private-only mode the page must never be reachable from the public
+	// edge; answer as if it didn't exist.
+	if s.cfg.PrivateOnly && !isPrivateNetworkRequest(r) {
+		http.NotFound(w, r)
 		return
 	}
 
-	if s.cfg.BootstrapToken != "" &&
-		r.URL.Query().Get("token") != s.cfg.BootstrapToken {
-		http.Error(w, "unauthorized", 401)
+	confStr, redeliver, ok := s.deliverConfig(w, r)
+	if !ok {
 		return
 	}
 
-	confBytes, err := os.ReadFile(s.cfg.PeerConfigPath())
-	if err != nil {
-		http.Error(w, "config not ready", 503)
-		return
+	s.fireHook(hooks.BootstrapServed, map[string]any{"redelivery": redeliver})
+	if redeliver {
+		s.recordFunnel(funnelRedelivered)
+		slog.Info("re-delivered config to original client", "component", "bootstrap", "event", eventBootstrapServed, "peer", s.cfg.PeerName, "redelivery", true, "request_id", requestID(r))
+		s.recordEvent(eventBootstrapServed, "Config for %s re-delivered to the original client", s.cfg.PeerName)
+	} else {
+		s.recordFunnel(funnelFinalized)
+		slog.Info("served config", "component", "bootstrap", "event", eventBootstrapServed, "peer", s.cfg.PeerName, "redelivery", false, "request_id", requestID(r))
+		s.recordEvent(eventBootstrapServed, "Config for %s served; bootstrap link is now closed", s.cfg.PeerName)
+	}
+
+	var page string
+	if s.cfg.PageExpiry > 0 {
+		r, page = s.startExpiringPage(r)
+	}
+
+	updateSh, updatePS1 := s.updateScripts(r)
+
+	platform := clientPlatform(r)
+	data := map[string]any{
+		"Config":       confStr,
+		"QRCodes":      s.renderQRCodes(r, confStr),
+		"QRChunks":     s.chunkedQRCodes(r, confStr),
+		"TextOnly":     s.textOnly(r),
+		"PeerName":     s.cfg.PeerName,
+		"TextSections": textSections(confStr),
+		"UpdateSh":     updateSh,
+		"UpdatePS1":    updatePS1,
+		"Platform":     platform,
+		"Desktop":      isDesktop(platform),
+		"ConfBase64":   base64.StdEncoding.EncodeToString([]byte(confStr)),
+		"LANChecks":    s.lanChecks(confStr),
+		"LANConflicts": s.tunnelLANConflicts(),
+	}
+	if platform == platformAndroid {
+		data["AndroidImport"] = template.URL(s.androidImportLink(r, confStr))
+	}
+	if kit := s.recoveryKitLink(r, confStr); kit != "" {
+		data["RecoveryKit"] = kit
+	}
+	if s.cfg.RedeliveryWindow > 0 {
+		data["Redelivery"] = formatDuration(s.cfg.RedeliveryWindow)
+	}
+	if page != "" {
+		data["ExpiresIn"] = int(s.cfg.PageExpiry.Seconds())
+		data["ExpireURL"] = s.baseURL(r) + "/bootstrap/expire?page=" + page
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	ui.Page.Execute(w, data)
+}
+
+// deliverConfig runs the one-time link's checks and claims it, answering
+// r itself when it may not have the config. It holds peersMu for reading
+// throughout, so rotating or revoking the peer can't land between the
+// token check, reading the config and closing the link: a link is either
+// refused or serves the config that was current when it was checked.
+func (s Server) deliverConfig(w http.ResponseWriter, r *http.Request) (confStr string, redeliver, ok bool) {
+	peersMu.RLock()
+	defer peersMu.RUnlock()
+
+	// A revoked peer's config no longer connects; don't hand it out.
+	if s.peerRevoked(s.cfg.PeerName) {
+		httpError(w, r, "peer revoked", 410)
+		return "", false, false
 	}
 
-	confStr := s.rewriteEndpoint(
-		string(confBytes),
-		s.cfg.EndpointHost,
-		s.cfg.EndpointPort,
-	)
+	// Once completed, only the original client may re-fetch, and only
+	// within the optional re-delivery window. This is a cheap early answer;
+	// claimBootstrap below makes the binding decision under the lock.
+	done := s.bootstrapDone()
+	if done {
+		if !s.canRedeliver(r) {
+			httpError(w, r, "bootstrap already completed", 410)
+			return "", false, false
+		}
+	} else {
+		if s.bootstrapExpired() {
+			slog.Info("link expired", "component", "bootstrap", "peer", s.cfg.PeerName, "ttl", s.cfg.BootstrapTTL.String(), "request_id", requestID(r))
+			httpError(w, r, "bootstrap link expired", 410)
+			return "", false, false
+		}
+		s.recordFunnel(funnelOpened)
+	}
 
-	qrPNG, _ := qrcode.Encode(confStr, qrcode.Medium, 256)
-	qrBase64 := base64.StdEncoding.EncodeToString(qrPNG)
+	// A re-delivery goes to the client that already presented a valid
+	// token, which may have been single-use and is gone by now.
+	if !done && !s.bootstrapTokenOK(r) {
+		slog.Warn("rejected request with invalid token", "component", "bootstrap", "request_id", requestID(r))
+		s.recordFunnel(funnelRejected)
+		httpError(w, r, "unauthorized", 401)
+		return "", false, false
+	}
 
-	_ = os.WriteFile(s.cfg.BootstrapDonePath(),
-		[]byte(time.Now().Format(time.RFC3339)),
-		0o600,
-	)
+	confStr, err := s.peerConfig()
+	if err != nil {
+		httpError(w, r, "config not ready", 503)
+		return "", false, false
+	}
 
-	ui.Page.Execute(w, map[string]any{
-		"Config":   confStr,
-		"QRBase64": qrBase64,
-	})
+	redeliver, ok = s.claimBootstrap(r)
+	if !ok {
+		httpError(w, r, "bootstrap already completed", 410)
+		return "", false, false
+	}
+	s.consumeOnboardingToken(r.URL.Query().Get("token"))
+	return confStr, redeliver, true
 }
 
 // keepaliveLoop periodically pings the Fly proxy to keep the machine alive
 // as long as there is active WireGuard traffic.
 func (s Server) keepaliveLoop(appName string) {
-	url := fmt.Sprintf("https://%s.fly.dev", appName)
+	url := fmt.Sprintf("https://%s.fly.dev%s%s", appName, s.cfg.BasePath, keepalivePath)
 	client := &http.Client{Timeout: 5 * time.Second}
 	start := time.Now()
 	wgInterface := config.Getenv("WG_INTERFACE", "wg0")
 
-	log.Printf("keepalive: starting loop for %s (interval=%s, startup=%s, max_idle=%s, iface=%s)",
-		url, interval, startupWindow, maxIdle, wgInterface)
+	// startupWindow is how long we force keepalive on startup, to give
+	// clients a chance to connect before we allow idle suspend. maxIdle is
+	// how long WireGuard may be idle (no handshakes) before we stop the
+	// keepalive ping and let Fly suspend the machine. interval is how often
+	// we check WG status and ping the proxy.
+	startupWindow := s.cfg.KeepaliveStartupWindow
+	maxIdle := s.cfg.KeepaliveMaxIdle
+	interval := s.cfg.KeepaliveInterval
+
+	slog.Info("starting loop", "component", "keepalive", "url", url, "interval_seconds", interval.Seconds(),
+		"startup_seconds", startupWindow.Seconds(), "max_idle_seconds", maxIdle.Seconds(), "iface", wgInterface)
+	keepaliveTicked(false, 0)
 
 	// lastIdle lets us detect when idle time "resets" (a new handshake),
 	// which we treat as evidence that a client is actively connected.
@@ -131,30 +380,114 @@ func (s Server) keepaliveLoop(appName string) {
 	var connected bool
 	var connectedSince time.Time
 
+	// Session counters persist across suspend/stop so statistics aren't
+	// lost every time the machine sleeps.
+	statePath := s.cfg.KeepaliveStatePath()
+	state, err := loadKeepaliveState(statePath)
+	if err != nil {
+		slog.Warn("could not restore saved state, starting fresh", "component", "keepalive", "error", err)
+		state = keepaliveState{}
+	} else if !state.CurrentSessionStart.IsZero() {
+		// The machine stopped mid-session without hibernating. The last
+		// checkpoint is our best bound on when that session ended.
+		state.endSession(state.CurrentSessionStart, state.SavedAt.Add(interval))
+		slog.Info("closed interrupted session", "component", "keepalive",
+			"interrupted_at", state.SavedAt.Format(time.RFC3339), "sessions", state.Sessions)
+	} else if state.Sessions > 0 {
+		slog.Info("restored state", "component", "keepalive", "sessions", state.Sessions,
+			"total_connected_seconds", state.SessionSeconds, "last_session_end", state.LastSessionEnd.Format(time.RFC3339))
+	}
+
+	// hibernate snapshots state right before we stop pinging and let Fly
+	// suspend the machine.
+	hibernate := func() {
+		keepaliveStopped()
+		if connected {
+			state.endSession(connectedSince, time.Now())
+			s.fireHookSync(hooks.SessionEnded, map[string]any{
+				"started_at":       connectedSince.Format(time.RFC3339),
+				"duration_seconds": int64(time.Since(connectedSince).Seconds()),
+			})
+		}
+		s.fireHookSync(hooks.BeforeSuspend, map[string]any{"sessions": state.Sessions})
+		if err := state.save(statePath); err != nil {
+			slog.Error("failed to save state before suspend", "component", "keepalive", "error", err)
+		}
+	}
+
+	// Conntrack snapshots supplement handshakes: WireGuard only handshakes
+	// every couple of minutes, but chatty apps open new flows in between.
+	// An invalid prefix disables the check if INTERNAL_SUBNET can't be parsed.
+	var lastFlows map[string]struct{}
+	subnet, err := tunnelPrefix(s.cfg.TunnelSubnet)
+	if err != nil {
+		slog.Warn("invalid tunnel subnet, conntrack activity disabled", "component", "keepalive", "subnet", s.cfg.TunnelSubnet, "error", err)
+	}
+
+	lastTick := time.Now()
 	for {
-		time.Sleep(interval)
+		select {
+		case <-time.After(interval):
+		case <-disconnectRequests:
+			if connected {
+				slog.Info("client announced disconnect; ending session and stopping keepalive to allow suspend", "component", "keepalive",
+					"event", "keepalive_stop", "session_seconds", int64(time.Since(connectedSince).Seconds()))
+			} else {
+				slog.Info("client announced disconnect; stopping keepalive to allow suspend", "component", "keepalive", "event", "keepalive_stop")
+			}
+			hibernate()
+			return
+		}
+
+		// Handshake ages are wall-clock based. If the wall clock just jumped
+		// (NTP correction, resume from suspend), this tick's idle value is
+		// meaningless: re-baseline and judge again next tick.
+		now := time.Now()
+		jump := clockJump(lastTick, now)
+		lastTick = now
+		recalibrating := jump > maxClockJump || jump < -maxClockJump
+		if recalibrating {
+			lastIdle = -1
+			if connected {
+				connectedSince = connectedSince.Add(jump)
+			}
+		}
 
 		// During the startup window we always send pings, but we still log
 		// a heartbeat so you can see activity.
 		if time.Since(start) <= startupWindow {
-			log.Printf("keepalive: tick (startup window), sending ping to %s", url)
+			slog.Info("tick (startup window), sending ping", "component", "keepalive", "event", "keepalive_tick", "status", "startup")
+		} else if recalibrating {
+			slog.Warn("wall clock jumped; recalibrating before judging idleness (still sending ping)", "component", "keepalive", "jump_seconds", jump.Seconds())
 		} else {
 			// After the startup window, only continue if WireGuard is "recently active".
-			idle, noHandshake, err := getWireGuardIdleDuration(wgInterface)
+			var idle time.Duration
+			var noHandshake bool
+			var peerCount int
+			hs, err := wireGuardHandshakes(wgInterface)
+			if err == nil {
+				peerCount = activePeers(hs, s.infraPeerKeys(), maxIdle)
+				s.recordHandshakeTransitions(hs)
+				s.samplePeerBehavior(hs)
+				s.updateLastSeen(hs)
+				idle, noHandshake, err = idleFromHandshakes(hs, s.infraPeerKeys())
+				idle = s.roamingAdjustedIdle(hs, idle)
+			}
 			if err != nil {
 				// If we can't read WG status, log and continue; better to keep alive
 				// than flap the machine due to transient errors.
-				log.Printf("keepalive: tick, error checking wg status: %v (still sending ping)", err)
+				slog.Warn("error checking wg status (still sending ping)", "component", "keepalive", "event", "keepalive_tick", "error", err)
 			} else if noHandshake {
 				// Never seen a handshake on this interface; no session to attribute.
 				if connected {
 					// Defensive: end any inferred session.
 					session := time.Since(connectedSince)
-					log.Printf("keepalive: WireGuard has never seen a handshake; ending session (duration=%s) and allowing suspend",
-						formatDuration(session))
+					slog.Info("WireGuard has never seen a handshake; ending session and allowing suspend", "component", "keepalive",
+						"event", "keepalive_stop", "session_seconds", int64(session.Seconds()))
 				} else {
-					log.Printf("keepalive: WireGuard has never seen a handshake; stopping keepalive to allow suspend")
+					slog.Info("WireGuard has never seen a handshake; stopping keepalive to allow suspend", "component", "keepalive", "event", "keepalive_stop")
 				}
+				hibernate()
 				return
 			} else {
 				roundedIdle := idle.Round(time.Second)
@@ -162,40 +495,82 @@ func (s Server) keepaliveLoop(appName string) {
 				// If idle decreased since the last tick, we saw a fresh handshake.
 				// That strongly suggests a client is actively connected.
 				if lastIdle >= 0 && idle < lastIdle {
-					log.Printf("keepalive: handshake detected, idle reset from %s to %s",
-						lastIdle.Round(time.Second), roundedIdle)
+					slog.Info("handshake detected", "component", "keepalive", "event", "handshake",
+						"previous_idle_seconds", lastIdle.Round(time.Second).Seconds(), "idle_seconds", roundedIdle.Seconds())
 				}
 				lastIdle = idle
 
-				if idle > maxIdle {
+				// New flows from tunnel addresses since the last tick count as
+				// activity even when the latest handshake is older than maxIdle.
+				newFlows := 0
+				if subnet.IsValid() {
+					flows, err := conntrackFlows(subnet)
+					if err != nil {
+						slog.Warn("error reading conntrack table", "component", "keepalive", "error", err)
+					} else {
+						if lastFlows != nil {
+							newFlows = countNewFlows(lastFlows, flows)
+						}
+						lastFlows = flows
+					}
+				}
+
+				if idle > maxIdle && newFlows > 0 {
+					slog.Info("idle exceeds max but conntrack saw new flows; treating as active", "component", "keepalive", "event", "keepalive_tick",
+						"status", "active", "idle_seconds", roundedIdle.Seconds(), "max_idle_seconds", maxIdle.Seconds(), "new_flows", newFlows, "peer_count", peerCount)
+				} else if idle > maxIdle {
 					if connected {
 						session := time.Since(connectedSince)
-						log.Printf("keepalive: tick, status=disconnected, idle=%s (max %s); ending session duration=%s and stopping keepalive to allow suspend",
-							roundedIdle, maxIdle, formatDuration(session))
+						slog.Info("disconnected; ending session and stopping keepalive to allow suspend", "component", "keepalive", "event", "keepalive_stop",
+							"status", "disconnected", "idle_seconds", roundedIdle.Seconds(), "max_idle_seconds", maxIdle.Seconds(), "session_seconds", int64(session.Seconds()))
 					} else {
-						log.Printf("keepalive: tick, status=disconnected, idle=%s (max %s); stopping keepalive to allow suspend",
-							roundedIdle, maxIdle)
+						slog.Info("disconnected; stopping keepalive to allow suspend", "component", "keepalive", "event", "keepalive_stop",
+							"status", "disconnected", "idle_seconds", roundedIdle.Seconds(), "max_idle_seconds", maxIdle.Seconds())
 					}
+					hibernate()
 					return
 				}
 
 				// We are within the idle threshold, so we infer a client is connected.
 				if !connected {
 					connected = true
-					connectedSince = time.Now()
-					log.Printf("keepalive: tick, status=connected, idle=%s (max %s); starting session at %s",
-						roundedIdle, maxIdle, connectedSince.Format(time.RFC3339))
+					if since, ok := state.resumeSession(time.Now(), maxIdle); ok {
+						connectedSince = since
+						slog.Info("connected; resuming session", "component", "keepalive", "event", "keepalive_tick", "status", "connected",
+							"idle_seconds", roundedIdle.Seconds(), "peer_count", peerCount, "session_start", connectedSince.Format(time.RFC3339))
+					} else {
+						connectedSince = time.Now()
+						state.Sessions++
+						s.recordFirstHandshake()
+						go s.verifyRoutes()
+						s.fireHook(hooks.SessionStarted, map[string]any{"session": state.Sessions})
+						slog.Info("connected; starting session", "component", "keepalive", "event", "keepalive_tick", "status", "connected",
+							"idle_seconds", roundedIdle.Seconds(), "peer_count", peerCount, "session_start", connectedSince.Format(time.RFC3339))
+					}
 				} else {
 					session := time.Since(connectedSince)
-					log.Printf("keepalive: tick, status=connected, idle=%s (max %s); session_duration=%s; sending ping to %s",
-						roundedIdle, maxIdle, formatDuration(session), url)
+					slog.Info("connected, sending ping", "component", "keepalive", "event", "keepalive_tick", "status", "connected",
+						"idle_seconds", roundedIdle.Seconds(), "peer_count", peerCount, "session_seconds", int64(session.Seconds()))
+				}
+
+				// Checkpoint the open session in case Fly suspends us anyway.
+				state.CurrentSessionStart = connectedSince
+				if err := state.save(statePath); err != nil {
+					slog.Warn("failed to checkpoint state", "component", "keepalive", "error", err)
 				}
 			}
 		}
 
-		resp, err := client.Get(url)
+		keepaliveTicked(connected, max(lastIdle, 0))
+
+		req, err := newSelfPing(url)
+		if err != nil {
+			slog.Error("cannot build ping", "component", "keepalive", "error", err)
+			continue
+		}
+		resp, err := client.Do(req)
 		if err != nil {
-			log.Printf("keepalive: ping failed: %v", err)
+			slog.Warn("ping failed", "component", "keepalive", "error", err)
 			continue
 		}
 		_, _ = io.Copy(io.Discard, resp.Body)
@@ -205,26 +580,40 @@ func (s Server) keepaliveLoop(appName string) {
 
 // getWireGuardIdleDuration returns the duration since the last handshake
 // of the most recently active peer, plus a flag indicating if there has
-// never been a handshake.
-func getWireGuardIdleDuration(iface string) (time.Duration, bool, error) {
-	out, err := exec.Command("wg", "show", iface, "latest-handshakes").Output()
+// never been a handshake. Peers whose public key is in ignore are
+// infrastructure (probes, monitors) and never count as user activity.
+func getWireGuardIdleDuration(iface string, ignore map[string]bool) (time.Duration, bool, error) {
+	hs, err := wireGuardHandshakes(iface)
 	if err != nil {
 		return 0, false, err
 	}
+	return idleFromHandshakes(hs, ignore)
+}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	var lastHandshake int64
+// wireGuardHandshakes returns each peer's latest handshake as Unix
+// seconds, keyed by public key. Zero means the peer never handshook.
+func wireGuardHandshakes(iface string) (map[string]int64, error) {
+	dev, err := wg.Show(iface)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) != 2 {
-			continue
-		}
-		ts, err := strconv.ParseInt(fields[1], 10, 64)
-		if err != nil {
-			continue
+	hs := make(map[string]int64, len(dev.Peers))
+	for _, p := range dev.Peers {
+		if p.LastHandshake.IsZero() {
+			hs[p.PublicKey] = 0
+		} else {
+			hs[p.PublicKey] = p.LastHandshake.Unix()
 		}
-		if ts > lastHandshake {
+	}
+	return hs, nil
+}
+
+// idleFromHandshakes is getWireGuardIdleDuration over an existing sample.
+func idleFromHandshakes(hs map[string]int64, ignore map[string]bool) (time.Duration, bool, error) {
+	var lastHandshake int64
+	for key, ts := range hs {
+		if !ignore[key] && ts > lastHandshake {
 			lastHandshake = ts
 		}
 	}
@@ -234,9 +623,51 @@ func getWireGuardIdleDuration(iface string) (time.Duration, bool, error) {
 		return 0, true, nil
 	}
 
-	return time.Since(time.Unix(lastHandshake, 0)), false, nil
+	// A handshake "in the future" means the clock was stepped back after
+	// it was recorded. Sub-second differences are just timestamp
+	// truncation; anything larger can't be trusted either way.
+	idle := time.Since(time.Unix(lastHandshake, 0))
+	if idle < -maxClockJump {
+		return 0, false, fmt.Errorf("latest handshake is %s in the future; system clock likely jumped", -idle)
+	}
+	if idle < 0 {
+		idle = 0
+	}
+	return idle, false, nil
+}
+
+// activePeers counts the peers, infrastructure peers aside, whose latest
+// handshake is within maxIdle.
+func activePeers(hs map[string]int64, ignore map[string]bool, maxIdle time.Duration) int {
+	n := 0
+	for key, ts := range hs {
+		if !ignore[key] && ts > 0 && time.Since(time.Unix(ts, 0)) <= maxIdle {
+			n++
+		}
+	}
+	return n
 }
 
+// infraPeerKeys resolves the KEEPALIVE_IGNORE_PEERS entries to WireGuard
+// public keys. Entries may be raw base64 keys or peer names, in which case
+// the key is read from the sidecar's /config/<name>/publickey-<name> file.
+// Names are re-resolved on every call since peers can be generated after
+// startup.
+func (s Server) infraPeerKeys() map[string]bool {
+	keys := make(map[string]bool, len(s.cfg.InfraPeers))
+	for _, peer := range s.cfg.InfraPeers {
+		if raw, err := base64.StdEncoding.DecodeString(peer); err == nil && len(raw) == 32 {
+			keys[peer] = true
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.cfg.ConfigDir, peer, "publickey-"+peer))
+		if err != nil {
+			continue
+		}
+		keys[strings.TrimSpace(string(b))] = true
+	}
+	return keys
+}
 
 // formatDuration renders a duration as a compact "XdYhZmWs" string so we can
 // quickly eyeball how long a client has been (inferred) connected.
@@ -269,58 +700,3 @@ func formatDuration(d time.Duration) string {
 
 	return strings.Join(parts, "")
 }
-// rewriteEndpoint normalizes the Endpoint line so that the config uses a
-// client-usable value:
-//
-//   - If appName and port are known, we set: "Endpoint = <app>.fly.dev:port".
-//   - Otherwise, if the existing Endpoint uses a bare IPv6 host without
-//     brackets (e.g. "2a02:...:51820"), we rewrite it to "[ipv6]:port".
-func (s Server) rewriteEndpoint(conf, appName, port string) string {
-	lines := strings.Split(conf, "\n")
-
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if !strings.HasPrefix(trimmed, "Endpoint ") && !strings.HasPrefix(trimmed, "Endpoint=") {
-			continue
-		}
-
-		// Preserve original indentation.
-		indentLen := len(line) - len(strings.TrimLeft(line, " \t"))
-		indent := line[:indentLen]
-
-		// Parse current value after "Endpoint" and optional "=".
-		rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "Endpoint"))
-		rest = strings.TrimLeft(rest, " =")
-		current := rest
-
-		// Case 1: we know the app name and port -> use <app>.fly.dev:port.
-		if appName != "" && port != "" {
-			target := fmt.Sprintf("Endpoint = %s.fly.dev:%s", appName, port)
-			lines[i] = indent + target
-			return strings.Join(lines, "\n")
-		}
-
-		// Case 2: best-effort IPv6 fix when we don't know app name.
-		// If the current value looks like "2a02:...:51820" (multiple ':' and
-		// no brackets), wrap the host in [ ] to make it a valid Endpoint.
-		if strings.Count(current, ":") > 1 && !strings.Contains(current, "]") {
-			lastColon := strings.LastIndex(current, ":")
-			if lastColon > 0 && lastColon < len(current)-1 {
-				host := current[:lastColon]
-				p := current[lastColon+1:]
-				if p != "" {
-					target := fmt.Sprintf("Endpoint = [%s]:%s", host, p)
-					lines[i] = indent + target
-					return strings.Join(lines, "\n")
-				}
-			}
-		}
-
-		// If we got here, either appName/port are missing and it wasn't a bare
-		// IPv6 host, or parsing failed; leave the line as-is.
-		return conf
-	}
-
-	// No Endpoint line found; nothing to normalize.
-	return conf
-}
\ No newline at end of file
@@ -0,0 +1,105 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+
+	"fly-wireguard-vpn-proxy/internal/ui"
+)
+
+// sheetCard is one labeled QR on the printable sheet.
+type sheetCard struct {
+	Peer     string
+	Address  string
+	QRBase64 string
+}
+
+// bootstrapSheet renders a printable page with one QR per pre-provisioned
+// peer (PEERS=10 on the sidecar gives ten guest slots), for handing out on
+// paper when there's no time to onboard devices one by one. By default it
+// covers every peer except the main one and infrastructure peers; pass
+// ?peers=peer2,peer3 to pick. Printing to PDF is left to the browser.
+// It shares the bootstrap token, is disabled without one, and is only
+// reachable over 6PN in private-only mode.
+func (s Server) bootstrapSheet(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" || (s.cfg.PrivateOnly && !isPrivateNetworkRequest(r)) {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+
+	names := s.sheetPeers(r.URL.Query().Get("peers"))
+	cards := make([]sheetCard, 0, len(names))
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(s.cfg.ConfigDir, name, name+".conf"))
+		if err != nil {
+			continue
+		}
+		conf := s.rewriteEndpoint(string(b))
+		png, err := qrcode.Encode(conf, qrcode.Medium, 256)
+		if err != nil {
+			slog.Warn("skipping peer", "component", "sheet", "peer", name, "error", err, "request_id", requestID(r))
+			continue
+		}
+		iface, _ := parseConfSections(conf)
+		cards = append(cards, sheetCard{
+			Peer:     name,
+			Address:  iface["Address"],
+			QRBase64: base64.StdEncoding.EncodeToString(png),
+		})
+	}
+	if len(cards) == 0 {
+		httpError(w, r, "no peer configs to print; set PEERS on the WireGuard container", 404)
+		return
+	}
+
+	slog.Info("rendered QR sheet", "component", "sheet", "peer_count", len(cards), "request_id", requestID(r))
+	s.recordEvent(eventSheetPrinted, "Printable QR sheet rendered for %d peers", len(cards))
+
+	w.Header().Set("Cache-Control", "no-store")
+	ui.SheetPage.Execute(w, map[string]any{
+		"Cards":    cards,
+		"Endpoint": s.cfg.ClientEndpointHost(),
+	})
+}
+
+// sheetPeers returns the requested peers, or every peer directory with a
+// config except the main peer and infrastructure peers.
+func (s Server) sheetPeers(requested string) []string {
+	if requested != "" {
+		var out []string
+		for _, p := range strings.Split(requested, ",") {
+			// Peer names become path components; refuse anything that
+			// could step outside the config dir.
+			if p = strings.TrimSpace(p); p != "" && p == filepath.Base(p) && p != ".." {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+
+	skip := map[string]bool{s.cfg.PeerName: true}
+	for _, p := range s.cfg.InfraPeers {
+		skip[p] = true
+	}
+	paths, _ := filepath.Glob(filepath.Join(s.cfg.ConfigDir, "*", "*.conf"))
+	var out []string
+	for _, p := range paths {
+		name := filepath.Base(filepath.Dir(p))
+		if filepath.Base(p) == name+".conf" && !skip[name] {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,114 @@
+package bootstrap
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// signatureHeader carries a detached Ed25519 signature over the exact
+// response body, as "keyid=<id>, sig=<base64>".
+const signatureHeader = "X-Config-Signature"
+
+// signingKeyPath is where the deployment key is published.
+const signingKeyPath = "/.well-known/wgvpn-signing-key"
+
+var signingKey struct {
+	sync.Mutex
+	priv ed25519.PrivateKey
+}
+
+// deploymentKey loads the deployment's signing key from the volume,
+// generating it on first use. It lives next to the WireGuard keys and is
+// exactly as durable as they are.
+func (s Server) deploymentKey() (ed25519.PrivateKey, error) {
+	signingKey.Lock()
+	defer signingKey.Unlock()
+	if signingKey.priv != nil {
+		return signingKey.priv, nil
+	}
+
+	path := s.cfg.SigningKeyPath()
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		seed, err := base64.StdEncoding.DecodeString(string(b))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("signing key %s is corrupt", path)
+		}
+		signingKey.priv = ed25519.NewKeyFromSeed(seed)
+	case errors.Is(err, fs.ErrNotExist):
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		seed := base64.StdEncoding.EncodeToString(priv.Seed())
+		if err := os.WriteFile(path, []byte(seed), 0o600); err != nil {
+			return nil, err
+		}
+		slog.Info("generated deployment key", "component", "signing", "key_id", keyID(priv.Public().(ed25519.PublicKey)))
+		signingKey.priv = priv
+	default:
+		return nil, err
+	}
+	return signingKey.priv, nil
+}
+
+// keyID is a short fingerprint so clients can tell keys apart after a
+// volume is replaced.
+func keyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// signResponse sets the signature header for body when SIGN_CONFIGS is
+// on. A signing failure is logged and the response goes out unsigned;
+// verifying clients will reject it, which is the point.
+func (s Server) signResponse(w http.ResponseWriter, r *http.Request, body []byte) {
+	if !s.cfg.SignConfigs {
+		return
+	}
+	priv, err := s.deploymentKey()
+	if err != nil {
+		slog.Error("signing key unavailable", "component", "signing", "error", err, "request_id", requestID(r))
+		return
+	}
+	sig := ed25519.Sign(priv, body)
+	w.Header().Set(signatureHeader, fmt.Sprintf("keyid=%s, sig=%s",
+		keyID(priv.Public().(ed25519.PublicKey)), base64.StdEncoding.EncodeToString(sig)))
+}
+
+// wellKnownSigningKey publishes the public half of the deployment key.
+// Pin it on first use; a later change means the volume (and with it the
+// WireGuard keys) was replaced, or something in between is lying.
+func (s Server) wellKnownSigningKey(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.SignConfigs {
+		http.NotFound(w, r)
+		return
+	}
+	priv, err := s.deploymentKey()
+	if err != nil {
+		slog.Error("signing key unavailable", "component", "signing", "error", err, "request_id", requestID(r))
+		httpError(w, r, "signing key unavailable", 503)
+		return
+	}
+	pub := priv.Public().(ed25519.PublicKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"alg":    "ed25519",
+		"key_id": keyID(pub),
+		"key":    base64.StdEncoding.EncodeToString(pub),
+		"header": signatureHeader,
+	})
+}
@@ -0,0 +1,113 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// keepaliveState is the part of the keepalive loop's bookkeeping that has
+// to survive a stop/start cycle. It is written to the volume right before
+// the loop stops pinging (i.e. just before Fly is allowed to suspend) and
+// read back the next time the loop starts.
+type keepaliveState struct {
+	// Sessions counts inferred client sessions across restarts.
+	Sessions int `json:"sessions"`
+
+	// SessionSeconds is the total inferred connected time.
+	SessionSeconds int64 `json:"session_seconds"`
+
+	// LastSessionStart and LastSessionEnd bound the most recent session so a
+	// client reconnecting shortly after a suspend can be stitched onto it.
+	LastSessionStart time.Time `json:"last_session_start,omitempty"`
+	LastSessionEnd   time.Time `json:"last_session_end,omitempty"`
+
+	// CurrentSessionStart is set while a session is open. It is
+	// checkpointed every tick so an unexpected suspend can still be
+	// attributed to the session it interrupted.
+	CurrentSessionStart time.Time `json:"current_session_start,omitempty"`
+
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// loadKeepaliveState reads the saved state, returning a zero state if none
+// has been written yet.
+func loadKeepaliveState(path string) (keepaliveState, error) {
+	var st keepaliveState
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(b, &st)
+	return st, err
+}
+
+// save writes the state atomically so a suspend mid-write can't leave a
+// truncated file behind.
+func (st keepaliveState) save(path string) error {
+	st.SavedAt = time.Now()
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, b, 0o600)
+}
+
+// writeFileAtomic is os.WriteFile through a temporary file and a rename,
+// so readers see either the old content or the new, never a truncated
+// file in between.
+func writeFileAtomic(path string, b []byte, perm fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// endSession folds a finished session into the totals.
+func (st *keepaliveState) endSession(start, end time.Time) {
+	st.SessionSeconds += int64(end.Sub(start).Seconds())
+	st.LastSessionStart = start
+	st.LastSessionEnd = end
+	st.CurrentSessionStart = time.Time{}
+}
+
+// inSession reports whether t falls inside the open session or the most
+// recently closed one.
+func (st keepaliveState) inSession(t time.Time) bool {
+	if !st.CurrentSessionStart.IsZero() && t.After(st.CurrentSessionStart) {
+		return true
+	}
+	return !st.LastSessionStart.IsZero() && t.After(st.LastSessionStart) && t.Before(st.LastSessionEnd)
+}
+
+// resumeSession reports whether a session starting now continues the last
+// saved one, i.e. the gap is within maxGap. If so, the previous segment is
+// taken back out of the totals since endSession will re-add the whole span.
+func (st *keepaliveState) resumeSession(now time.Time, maxGap time.Duration) (time.Time, bool) {
+	if st.LastSessionEnd.IsZero() || now.Sub(st.LastSessionEnd) > maxGap {
+		return time.Time{}, false
+	}
+	st.SessionSeconds -= int64(st.LastSessionEnd.Sub(st.LastSessionStart).Seconds())
+	return st.LastSessionStart, true
+}
@@ -0,0 +1,73 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/ui"
+	"fly-wireguard-vpn-proxy/internal/wg"
+)
+
+// status is the optional public status page for household members who just
+// want to know whether the VPN is up. It deliberately exposes nothing but
+// readiness and region; with the admin token it also counts who is
+// connected, which would otherwise tell anyone when the household is
+// online. The machine can't report being suspended: loading this page
+// wakes it, so "Starting" is what a sleeping VPN looks like.
+func (s Server) status(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.StatusPage {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := map[string]any{
+		"Ready":  s.wireGuardReady(),
+		"Region": s.cfg.Region,
+	}
+	// Only check a token that was sent: a household member without one
+	// mustn't count as a failed attempt.
+	admin := requestToken(r) != "" && s.authorized(r)
+	if admin {
+		if peers, err := s.peerHandshakes(); err == nil {
+			active := 0
+			for _, p := range peers {
+				if p["active"] == true && p["infrastructure"] != true {
+					active++
+				}
+			}
+			data["ActiveDevices"] = active
+		}
+		if people := s.peopleSummary(time.Now()); people != nil {
+			n := 0
+			for _, p := range people {
+				if p.ActiveDevices > 0 {
+					n++
+				}
+			}
+			data["ActivePeople"] = n
+		}
+	}
+	if p, ok := s.loadRouteProbe(); ok {
+		data["RoutingBroken"] = p.State != probeOK
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(data)
+		return
+	}
+	ui.StatusPage.Execute(w, data)
+}
+
+// wireGuardReady reports whether the peer config exists and the interface
+// is up.
+func (s Server) wireGuardReady() bool {
+	if _, err := os.Stat(s.cfg.PeerConfigPath()); err != nil {
+		return false
+	}
+	_, err := wg.Show(s.cfg.WGInterface)
+	return err == nil
+}
@@ -0,0 +1,43 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"fly-wireguard-vpn-proxy/internal/config"
+)
+
+func TestStatusCountsOnlyForAdmins(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.StatusPage = true
+		c.People = []string{"alice:peer1+peer2"}
+	})
+	fakeWG(t, "priv\tpub\t51820\toff\n")
+
+	cases := []struct {
+		name, target string
+		admin        bool
+	}{
+		{"public", "/status?format=json", false},
+		{"wrong token", "/status?format=json&token=nope", false},
+		{"admin", "/status?format=json&token=" + testAdminToken, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(s.status, http.MethodGet, tc.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var data map[string]any
+			if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"ActiveDevices", "ActivePeople"} {
+				if _, ok := data[key]; ok != tc.admin {
+					t.Errorf("%s shown = %v, want %v", key, ok, tc.admin)
+				}
+			}
+		})
+	}
+}
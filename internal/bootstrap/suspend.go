@@ -0,0 +1,55 @@
+package bootstrap
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/fly"
+)
+
+// Outcomes of explicit suspend requests, for /metrics.
+var (
+	suspendRequests    atomic.Int64
+	suspendFailures    atomic.Int64
+	lastSuspendRequest atomic.Int64 // unix seconds
+)
+
+// explicitSuspend reports whether KEEPALIVE_SUSPEND can be honoured: it
+// needs a Machines API token and to know which machine it runs on.
+func (s Server) explicitSuspend() bool {
+	return s.cfg.KeepaliveSuspend && s.cfg.FlyAPIToken != "" && s.cfg.MachineID != "" && s.cfg.EndpointHost != ""
+}
+
+// suspendMachine asks the Machines API to suspend this machine once the
+// keepalive loop has decided the tunnel is idle, instead of waiting for
+// Fly's proxy to notice the pings stopped. If the call fails, the proxy
+// still suspends the machine on its own schedule.
+//
+// The machine is frozen mid-call, so the request often returns only after
+// the next resume, sometimes with an error because the connection it went
+// out on is gone. The monotonic clock stops while suspended and the wall
+// clock doesn't, so a jump across the call shows the suspend happened.
+func (s Server) suspendMachine() {
+	client := fly.NewClient(s.cfg.FlyAPIBaseURL, s.cfg.EndpointHost, s.cfg.FlyAPIToken)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	slog.Info("requesting suspend", "component", "keepalive", "event", "suspend_request", "machine_id", s.cfg.MachineID)
+	suspendRequests.Add(1)
+	lastSuspendRequest.Store(time.Now().Unix())
+
+	start := time.Now()
+	err := client.Suspend(ctx, s.cfg.MachineID)
+	if jump := clockJump(start, time.Now()); jump > maxClockJump {
+		slog.Info("resumed after suspend", "component", "keepalive", "event", "suspend_resumed", "asleep_seconds", jump.Round(time.Second).Seconds())
+		return
+	}
+	if err != nil {
+		suspendFailures.Add(1)
+		slog.Warn("suspend request failed; leaving it to the Fly proxy", "component", "keepalive", "event", "suspend_failed", "error", err)
+		return
+	}
+	slog.Info("suspend accepted", "component", "keepalive", "event", "suspend_accepted")
+}
@@ -0,0 +1,213 @@
+package bootstrap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsConfig returns the TLS settings for the HTTPS listener, or nil when
+// TLS is off. BOOTSTRAP_TLS_CERT and BOOTSTRAP_TLS_KEY serve a certificate
+// from files; BOOTSTRAP_TLS=self-signed generates one on the volume.
+//
+// On Fly the edge already terminates TLS, so this is for deployments that
+// expose the port directly (a dedicated IPv4 with raw ports, or no Fly at
+// all), where /bootstrap would otherwise send the private key in the clear.
+func (s Server) tlsConfig() (*tls.Config, error) {
+	switch {
+	case s.cfg.TLSCert != "" || s.cfg.TLSKey != "":
+		if s.cfg.TLSCert == "" || s.cfg.TLSKey == "" {
+			return nil, errors.New("BOOTSTRAP_TLS_CERT and BOOTSTRAP_TLS_KEY must be set together")
+		}
+		cr := &certReloader{certPath: s.cfg.TLSCert, keyPath: s.cfg.TLSKey}
+		if _, err := cr.get(); err != nil {
+			return nil, err
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cr.get()
+		}}, nil
+	case s.cfg.TLS == "self-signed":
+		cert, err := s.selfSignedCert()
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}, nil
+	case s.cfg.TLS == "" || s.cfg.TLS == "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("BOOTSTRAP_TLS=%q: use self-signed, or set BOOTSTRAP_TLS_CERT and BOOTSTRAP_TLS_KEY", s.cfg.TLS)
+	}
+}
+
+// certReloader serves a certificate from files and picks up renewals
+// (certbot, a mounted secret) without a restart.
+type certReloader struct {
+	certPath, keyPath string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (c *certReloader) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fi, err := os.Stat(c.certPath)
+	if err != nil {
+		if c.cert != nil {
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil && fi.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		if c.cert != nil {
+			// Mid-renewal, the new cert may be on disk before its key.
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil {
+		slog.Info("reloaded certificate", "component", "tls", "path", c.certPath)
+	}
+	c.cert, c.modTime = &cert, fi.ModTime()
+	return c.cert, nil
+}
+
+// selfSignedCert loads the generated certificate from the volume, making a
+// new one when it is missing or close to expiry. Keeping it on the volume
+// keeps the fingerprint stable across restarts, so a user who checked it
+// once isn't asked again.
+func (s Server) selfSignedCert() (tls.Certificate, error) {
+	dir := filepath.Join(s.cfg.ConfigDir, "tls")
+	certPath, keyPath := filepath.Join(dir, "self-signed.crt"), filepath.Join(dir, "self-signed.key")
+
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Until(leaf.NotAfter) > 30*24*time.Hour {
+			logCertFingerprint(leaf.Raw, false)
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "fly-wireguard-vpn-proxy bootstrap"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range []string{s.cfg.ClientEndpointHost(), "localhost"} {
+		if h == "" {
+			continue
+		}
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	tmpl.IPAddresses = append(tmpl.IPAddresses, net.IPv4(127, 0, 0, 1), net.IPv6loopback)
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, err
+	}
+	logCertFingerprint(der, true)
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// logCertFingerprint logs the SHA-256 fingerprint browsers show for the
+// certificate, so the warning page can be checked against `fly logs`.
+func logCertFingerprint(der []byte, generated bool) {
+	sum := sha256.Sum256(der)
+	hexed := strings.ToUpper(hex.EncodeToString(sum[:]))
+	pairs := make([]string, 0, len(sum))
+	for i := 0; i < len(hexed); i += 2 {
+		pairs = append(pairs, hexed[i:i+2])
+	}
+	slog.Info("using self-signed certificate", "component", "tls", "generated", generated, "sha256", strings.Join(pairs, ":"))
+}
+
+// redirectToHTTPS answers plain-HTTP requests with a redirect to the TLS
+// listener. Health checks, the keepalive ping and loopback callers (the
+// start script) are served as before, as are requests a trusted proxy
+// already received over HTTPS.
+func (s Server) redirectToHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, s.cfg.BasePath)
+		addr, ok := remoteAddr(r)
+		switch {
+		case path == "/healthz" || path == keepalivePath:
+		case ok && addr.IsLoopback():
+		case s.fromTrustedProxy(r) && r.Header.Get("X-Forwarded-Proto") == "https":
+		default:
+			http.Redirect(w, r, s.httpsURL(r), http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpsURL is r's URL on the TLS listener. BOOTSTRAP_BASE_URL wins when it
+// is already https, since it knows the public port.
+func (s Server) httpsURL(r *http.Request) string {
+	if base := s.cfg.PublicBaseURL; strings.HasPrefix(base, "https://") {
+		return strings.TrimRight(base, "/") + r.URL.RequestURI()
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if s.cfg.TLSPort != "443" {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), s.cfg.TLSPort)
+	} else if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	return "https://" + host + r.URL.RequestURI()
+}
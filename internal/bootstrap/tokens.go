@@ -0,0 +1,323 @@
+package bootstrap
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenEqual compares a presented token with an expected one in constant
+// time. Both sides are hashed first so the comparison doesn't leak the
+// expected token's length either.
+func tokenEqual(got, want string) bool {
+	g, w := sha256.Sum256([]byte(got)), sha256.Sum256([]byte(want))
+	return subtle.ConstantTimeCompare(g[:], w[:]) == 1
+}
+
+// isAdminToken reports whether tok is one of the BOOTSTRAP_TOKEN values.
+// Several are accepted at once so a token can be rotated without a gap:
+// deploy "new,old", move clients over, then drop "old". Every candidate
+// is checked so the time taken doesn't reveal which one matched.
+func (s Server) isAdminToken(tok string) bool {
+	ok := false
+	for _, want := range s.cfg.BootstrapTokens {
+		if tokenEqual(tok, want) {
+			ok = true
+		}
+	}
+	return ok && tok != ""
+}
+
+// authorized reports whether r carries an admin token. It is the check
+// every token-protected endpoint uses, and feeds the bad-token lockout.
+func (s Server) authorized(r *http.Request) bool {
+	tok := requestToken(r)
+	ok := s.isAdminToken(tok)
+	s.noteTokenAttempt(r, tok, ok)
+	return ok
+}
+
+// onboardingToken is a short-lived token minted through /api/tokens. It
+// only opens one peer's bootstrap page and only until it expires. The
+// token itself is never stored, only its hash.
+type onboardingToken struct {
+	ID      string    `json:"id"`
+	Hash    string    `json:"hash"`
+	Label   string    `json:"label,omitempty"`
+	Peer    string    `json:"peer"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	// SingleUse tokens are deleted once they have opened the page.
+	SingleUse bool `json:"single_use,omitempty"`
+}
+
+// tokensMu serializes rewrites of the minted token file.
+var tokensMu sync.Mutex
+
+func (s Server) loadOnboardingTokens() []onboardingToken {
+	var toks []onboardingToken
+	b, err := os.ReadFile(s.cfg.OnboardingTokensPath())
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("cannot read minted tokens", "component", "tokens", "path", s.cfg.OnboardingTokensPath(), "error", err)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &toks); err != nil {
+		slog.Warn("minted tokens file is corrupt", "component", "tokens", "path", s.cfg.OnboardingTokensPath(), "error", err)
+		return nil
+	}
+	return toks
+}
+
+func (s Server) saveOnboardingTokens(toks []onboardingToken) error {
+	b, err := json.MarshalIndent(toks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cfg.OnboardingTokensPath(), b, 0o600)
+}
+
+func hashToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
+// onboardingTokenOK reports whether tok is an unexpired minted token for
+// peer.
+func (s Server) onboardingTokenOK(tok, peer string) bool {
+	if tok == "" {
+		return false
+	}
+	tokensMu.Lock()
+	toks := s.loadOnboardingTokens()
+	tokensMu.Unlock()
+
+	h := hashToken(tok)
+	now := time.Now()
+	ok := false
+	for _, t := range toks {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(t.Hash)) == 1 && t.Peer == peer && now.Before(t.Expires) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// mintOnboardingToken creates a token for peer valid for ttl, dropping
+// expired ones while the file is open anyway.
+func (s Server) mintOnboardingToken(peer, label string, ttl time.Duration, singleUse bool) (string, onboardingToken, error) {
+	var b [24]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", onboardingToken{}, err
+	}
+	tok := base64.RawURLEncoding.EncodeToString(b[:])
+	now := time.Now().UTC()
+	t := onboardingToken{
+		ID:        hashToken(tok)[:12],
+		Hash:      hashToken(tok),
+		Label:     label,
+		Peer:      peer,
+		Created:   now,
+		Expires:   now.Add(ttl),
+		SingleUse: singleUse,
+	}
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	kept := []onboardingToken{}
+	for _, old := range s.loadOnboardingTokens() {
+		if now.Before(old.Expires) {
+			kept = append(kept, old)
+		}
+	}
+	if err := s.saveOnboardingTokens(append(kept, t)); err != nil {
+		return "", onboardingToken{}, err
+	}
+	return tok, t, nil
+}
+
+// revokeOnboardingToken deletes the token with id and reports whether it
+// existed.
+func (s Server) revokeOnboardingToken(id string) (bool, error) {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	toks := s.loadOnboardingTokens()
+	for i, t := range toks {
+		if t.ID == id {
+			return true, s.saveOnboardingTokens(append(toks[:i], toks[i+1:]...))
+		}
+	}
+	return false, nil
+}
+
+// consumeOnboardingToken deletes tok if it is a single-use token, once it
+// has served its page.
+func (s Server) consumeOnboardingToken(tok string) {
+	if tok == "" {
+		return
+	}
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	h := hashToken(tok)
+	toks := s.loadOnboardingTokens()
+	for i, t := range toks {
+		if t.Hash == h && t.SingleUse {
+			if err := s.saveOnboardingTokens(append(toks[:i], toks[i+1:]...)); err != nil {
+				slog.Warn("cannot delete used token", "component", "tokens", "token_id", t.ID, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// revokePeerOnboardingTokens deletes every token minted for peer.
+func (s Server) revokePeerOnboardingTokens(peer string) error {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	toks := s.loadOnboardingTokens()
+	kept := toks[:0]
+	for _, t := range toks {
+		if t.Peer != peer {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == len(toks) {
+		return nil
+	}
+	return s.saveOnboardingTokens(kept)
+}
+
+// onboardingURL is the bootstrap link a minted token opens.
+func (s Server) onboardingURL(r *http.Request, peer, tok string) string {
+	if peer == s.cfg.PeerName {
+		return s.baseURL(r) + "/bootstrap?token=" + tok
+	}
+	return s.baseURL(r) + "/bootstrap/" + peer + "?token=" + tok
+}
+
+// tokenListSpec is what GET /api/tokens filters and sorts on.
+var tokenListSpec = listSpec{
+	idField:     "id",
+	filters:     []string{"peer", "label", "expired", "single_use"},
+	sorts:       []string{"created", "expires", "label", "peer"},
+	defaultSort: "created",
+}
+
+// apiTokens serves /api/tokens for handing out short-lived onboarding
+// links: GET lists minted tokens (never the tokens themselves), POST
+// {"peer": ..., "label": ..., "ttl": "24h"} mints one, and DELETE
+// /api/tokens/<id> revokes it. Requires an admin token.
+func (s Server) apiTokens(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.BootstrapToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		httpError(w, r, "unauthorized", 401)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tokens"), "/")
+
+	w.Header().Set("Cache-Control", "no-store")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		lq, err := parseListQuery(r, tokenListSpec)
+		if err != nil {
+			httpError(w, r, err.Error(), 400)
+			return
+		}
+		tokensMu.Lock()
+		toks := s.loadOnboardingTokens()
+		tokensMu.Unlock()
+		out := []map[string]any{}
+		for _, t := range toks {
+			out = append(out, map[string]any{
+				"id":         t.ID,
+				"label":      t.Label,
+				"peer":       t.Peer,
+				"created":    t.Created.Format(time.RFC3339),
+				"expires":    t.Expires.Format(time.RFC3339),
+				"expired":    time.Now().After(t.Expires),
+				"single_use": t.SingleUse,
+			})
+		}
+		out, next := lq.page(out)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"tokens": out, "next_cursor": next})
+
+	case r.Method == http.MethodPost && id == "":
+		var req struct {
+			Peer      string `json:"peer"`
+			Label     string `json:"label"`
+			TTL       string `json:"ttl"`
+			SingleUse bool   `json:"single_use"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			httpError(w, r, `expected a JSON body like {"peer": "peer2", "label": "Alice", "ttl": "24h"}`, 400)
+			return
+		}
+		if req.Peer == "" {
+			req.Peer = s.cfg.PeerName
+		}
+		if req.Peer != filepath.Base(req.Peer) || !isPeerDir(filepath.Join(s.cfg.ConfigDir, req.Peer), req.Peer) {
+			httpError(w, r, "no such peer", 404)
+			return
+		}
+		ttl := 24 * time.Hour
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 || d > 30*24*time.Hour {
+				httpError(w, r, "ttl must be a duration between 1s and 720h", 400)
+				return
+			}
+			ttl = d
+		}
+
+		tok, t, err := s.mintOnboardingToken(req.Peer, req.Label, ttl, req.SingleUse)
+		if err != nil {
+			slog.Error("cannot mint token", "component", "tokens", "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not mint token", 500)
+			return
+		}
+		slog.Info("minted token", "component", "tokens", "token_id", t.ID, "peer", t.Peer, "expires", t.Expires.Format(time.RFC3339), "request_id", requestID(r))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":            t.ID,
+			"token":         tok,
+			"peer":          t.Peer,
+			"expires":       t.Expires.Format(time.RFC3339),
+			"bootstrap_url": s.onboardingURL(r, t.Peer, tok),
+		})
+
+	case r.Method == http.MethodDelete && id != "":
+		found, err := s.revokeOnboardingToken(id)
+		switch {
+		case err != nil:
+			slog.Error("cannot revoke token", "component", "tokens", "token_id", id, "error", err, "request_id", requestID(r))
+			httpError(w, r, "could not revoke token", 500)
+		case !found:
+			httpError(w, r, "no such token", 404)
+		default:
+			slog.Info("revoked token", "component", "tokens", "token_id", id, "request_id", requestID(r))
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		httpError(w, r, "method not allowed", 405)
+	}
+}
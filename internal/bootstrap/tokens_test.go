@@ -0,0 +1,59 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pageDataURIs decodes the base64 data: downloads on a bootstrap page, so
+// tests can look inside the updater scripts too.
+func pageDataURIs(t *testing.T, body string) string {
+	t.Helper()
+	var out strings.Builder
+	for _, m := range regexp.MustCompile(`base64,([A-Za-z0-9+/=]+)`).FindAllStringSubmatch(body, -1) {
+		b, err := base64.StdEncoding.DecodeString(m[1])
+		if err != nil {
+			continue
+		}
+		out.Write(b)
+	}
+	return out.String()
+}
+
+// Onboarding tokens and per-peer links are handed to other people; the
+// pages they open must not contain anything that works as an admin token.
+func TestBootstrapPageNeverShowsAdminToken(t *testing.T) {
+	s := newTestServer(t, nil)
+	onboarding, _, err := s.mintOnboardingToken("peer1", "guest", time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+	}{
+		{"onboarding token", s.bootstrap, "/bootstrap?token=" + onboarding},
+		{"peer link", s.bootstrapPeer, "/bootstrap/peer2?token=" + s.peerBootstrapToken("peer2")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(tc.handler, http.MethodGet, tc.target)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, "wg-update.sh") {
+				t.Fatal("page has no updater; the check below would prove nothing")
+			}
+			if all := body + pageDataURIs(t, body); strings.Contains(all, testAdminToken) {
+				t.Error("page output contains BOOTSTRAP_TOKEN")
+			}
+		})
+	}
+}
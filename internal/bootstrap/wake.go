@@ -0,0 +1,41 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"fly-wireguard-vpn-proxy/internal/notify"
+)
+
+// NotifyWake tells subscribed devices that the VPN is reachable again, so
+// users retry instead of assuming it's broken. It is sent after the
+// machine (re)starts and again whenever a suspended machine resumes.
+func (s Server) NotifyWake() {
+	n := notify.New(s.cfg.WakeNotifyURL, s.cfg.WakeNotifyFormat)
+	if !n.Enabled() {
+		return
+	}
+
+	msg := "WireGuard VPN is up and accepting connections."
+	if host := s.cfg.ClientEndpointHost(); host != "" {
+		msg = fmt.Sprintf("WireGuard VPN %s is up and accepting connections.", host)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := n.Send(ctx, notify.Event{
+		Event:   "wake",
+		Title:   "VPN available",
+		Message: msg,
+		App:     s.cfg.EndpointHost,
+		Region:  s.cfg.Region,
+	})
+	if err != nil {
+		slog.Warn("wake notification failed", "component", "notify", "error", err)
+		return
+	}
+	slog.Info("wake notification sent", "component", "notify")
+}
@@ -1,35 +1,294 @@
 package config
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Port           string
+	PublicBaseURL  string
+	BasePath       string
+	TrustedProxies []string
+	ListenAddrs    []string
+	PrivateOnly    bool
+	// APITunnelOnly serves the management routes only to devices already
+	// on the VPN.
+	APITunnelOnly  bool
+	TLS            string
+	TLSCert        string
+	TLSKey         string
+	TLSPort        string
+	StatusPage     bool
+	RootMode       string
+	RootRedirect   string
 	BootstrapToken string
-	PeerName       string
-	ConfigDir      string
-	WGInterface    string
-	EndpointHost   string
-	EndpointPort   string
+	// BootstrapTokens holds every accepted admin token; BootstrapToken is
+	// the first, used wherever the server hands a token out.
+	BootstrapTokens []string
+	SignConfigs     bool
+
+	DefaultView      string
+	QRFormat         string
+	QRChunkSize      int
+	RedeliveryWindow time.Duration
+	PageExpiry       time.Duration
+	BootstrapTTL     time.Duration
+	StalePeerAfter   time.Duration
+	RoamingGrace     time.Duration
+	RedeliveryMax    int
+
+	Analytics          bool
+	AnalyticsRetention time.Duration
+	DiskReserveMB      int
+
+	ExpensiveConcurrency int
+	ExpensiveQueueWait   time.Duration
+
+	TokenRateLimit        int
+	TokenLockoutThreshold int
+	TokenLockoutBase      time.Duration
+	TokenLockoutMax       time.Duration
+
+	HealthProbeMaxAge  time.Duration
+	HealthRequireProbe bool
+
+	PeerName          string
+	ConfigDir         string
+	WGInterface       string
+	EndpointHost      string
+	PublicHost        string
+	EndpointRewriters []string
+	HostProviders     []string
+	PublicIPURL       string
+	EndpointPort      string
+	TunnelSubnet      string
+	FirewallExtras    string
+	InfraPeers        []string
+	People            []string
+	Region            string
+
+	// PeopleMaxDevices caps how many peers one person may have; zero
+	// means no cap.
+	PeopleMaxDevices int
+
+	// DeviceRequests opens the public /request-device form, whose
+	// requests wait for an admin's approval.
+	DeviceRequests bool
+
+	// GuestClaimCode opens /guest, where anyone with the code gets a
+	// guest peer that lasts GuestPeerTTL. At most GuestMaxPeers exist at
+	// once.
+	GuestClaimCode string
+	GuestPeerTTL   time.Duration
+	GuestMaxPeers  int
+
+	// PeerDeleteCooldown is how long a deleted API peer's name and
+	// address stay reserved for a restore. Zero deletes for good.
+	PeerDeleteCooldown time.Duration
+
+	KeepaliveStartupWindow time.Duration
+	KeepaliveMaxIdle       time.Duration
+	KeepaliveInterval      time.Duration
+	KeepaliveSuspend       bool
+
+	// NativeWireGuard makes this binary generate keys and configs and
+	// bring the interface up itself instead of waiting for the sidecar.
+	NativeWireGuard bool
+	ListenPort      int
+	PeerDNS         string
+	PeerAllowedIPs  string
+	MTU             int
+
+	WakeNotifyURL    string
+	WakeNotifyFormat string
+
+	DigestNotifyURL    string
+	DigestNotifyFormat string
+	DigestPeriod       time.Duration
+
+	AlertNotifyURL    string
+	AlertNotifyFormat string
+
+	OnboardNotifyURL   string
+	OnboardNotifyToken string
+
+	FlyAPIToken   string
+	FlyAPIBaseURL string
+	MachineID     string
+
+	HookExec    string
+	HookURL     string
+	HookTimeout time.Duration
+
+	DNSPublishProvider string
+	DNSPublishName     string
+	DNSPublishTTL      string
+	CloudflareToken    string
+	CloudflareZoneID   string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+	Route53ZoneID      string
 }
 
 func Load() Config {
 	peer := Getenv("BOOTSTRAP_PEER_NAME", "peer1")
 	configDir := "/config"
 
+	token, tokens := bootstrapTokens()
+
 	return Config{
 		Port:           Getenv("BOOTSTRAP_PORT", "8081"),
-		BootstrapToken: os.Getenv("BOOTSTRAP_TOKEN"),
-		PeerName:       peer,
-		ConfigDir:      configDir,
-		WGInterface:    Getenv("WG_INTERFACE", "wg0"),
-		EndpointHost:   os.Getenv("FLY_APP_NAME"),
-		EndpointPort:   Getenv("BOOTSTRAP_ENDPOINT_PORT", Getenv("SERVERPORT", "51820")),
+		PublicBaseURL:  os.Getenv("BOOTSTRAP_BASE_URL"),
+		BasePath:       cleanBasePath(os.Getenv("BOOTSTRAP_BASE_PATH")),
+		TrustedProxies: GetenvList("TRUSTED_PROXIES"),
+		ListenAddrs:    GetenvList("BOOTSTRAP_LISTEN"),
+		PrivateOnly:    GetenvBool("BOOTSTRAP_PRIVATE_ONLY", false),
+		APITunnelOnly:  GetenvBool("BOOTSTRAP_API_TUNNEL_ONLY", false),
+		TLS:            strings.ToLower(os.Getenv("BOOTSTRAP_TLS")),
+		TLSCert:        os.Getenv("BOOTSTRAP_TLS_CERT"),
+		TLSKey:         os.Getenv("BOOTSTRAP_TLS_KEY"),
+		TLSPort:        Getenv("BOOTSTRAP_TLS_PORT", "8443"),
+		StatusPage:     GetenvBool("STATUS_PAGE_ENABLED", false),
+		RootMode:       Getenv("ROOT_MODE", "text"),
+		RootRedirect:   os.Getenv("ROOT_REDIRECT_URL"),
+		SignConfigs:    GetenvBool("SIGN_CONFIGS", false),
+
+		BootstrapToken:  token,
+		BootstrapTokens: tokens,
+
+		DefaultView:      Getenv("BOOTSTRAP_VIEW", "visual"),
+		QRFormat:         Getenv("BOOTSTRAP_QR_FORMAT", "conf"),
+		QRChunkSize:      GetenvInt("BOOTSTRAP_QR_CHUNK_SIZE", 600),
+		RedeliveryWindow: GetenvDuration("BOOTSTRAP_REDELIVERY_WINDOW", 0),
+		PageExpiry:       GetenvDuration("BOOTSTRAP_PAGE_EXPIRY", 0),
+		BootstrapTTL:     GetenvDuration("BOOTSTRAP_TTL", 0),
+		StalePeerAfter:   GetenvDuration("STALE_PEER_AFTER", 30*24*time.Hour),
+		RoamingGrace:     GetenvDuration("ROAMING_IDLE_GRACE", 0),
+		RedeliveryMax:    GetenvInt("BOOTSTRAP_REDELIVERY_MAX", 3),
+
+		Analytics:          GetenvBool("BOOTSTRAP_ANALYTICS", true),
+		AnalyticsRetention: GetenvDuration("BOOTSTRAP_ANALYTICS_RETENTION", 30*24*time.Hour),
+		DiskReserveMB:      GetenvInt("DISK_RESERVE_MB", 16),
+
+		ExpensiveConcurrency: GetenvInt("EXPENSIVE_CONCURRENCY", 2),
+		ExpensiveQueueWait:   GetenvDuration("EXPENSIVE_QUEUE_WAIT", 5*time.Second),
+
+		TokenRateLimit:        GetenvInt("TOKEN_RATE_LIMIT", 30),
+		TokenLockoutThreshold: GetenvInt("TOKEN_LOCKOUT_THRESHOLD", 5),
+		TokenLockoutBase:      GetenvDuration("TOKEN_LOCKOUT_BASE", time.Minute),
+		TokenLockoutMax:       GetenvDuration("TOKEN_LOCKOUT_MAX", time.Hour),
+
+		HealthProbeMaxAge:  GetenvDuration("HEALTH_PROBE_MAX_AGE", time.Hour),
+		HealthRequireProbe: GetenvBool("HEALTH_REQUIRE_PROBE", false),
+
+		PeerName:          peer,
+		ConfigDir:         configDir,
+		WGInterface:       Getenv("WG_INTERFACE", "wg0"),
+		EndpointHost:      os.Getenv("FLY_APP_NAME"),
+		PublicHost:        os.Getenv("BOOTSTRAP_ENDPOINT_HOST"),
+		EndpointRewriters: GetenvList("ENDPOINT_REWRITERS"),
+		HostProviders:     GetenvList("ENDPOINT_HOST_PROVIDERS"),
+		PublicIPURL:       Getenv("PUBLIC_IP_URL", "https://api.ipify.org"),
+		EndpointPort:      Getenv("BOOTSTRAP_ENDPOINT_PORT", Getenv("SERVERPORT", "51820")),
+		TunnelSubnet:      Getenv("INTERNAL_SUBNET", "10.13.13.0"),
+		FirewallExtras:    Getenv("FIREWALL_EXTRAS_FILE", filepath.Join(configDir, "firewall-extra.nft")),
+		InfraPeers:        GetenvList("KEEPALIVE_IGNORE_PEERS"),
+		People:            GetenvList("PEOPLE"),
+		Region:            os.Getenv("FLY_REGION"),
+
+		PeopleMaxDevices: GetenvInt("PEOPLE_MAX_DEVICES", 0),
+		DeviceRequests:   GetenvBool("DEVICE_REQUESTS_ENABLED", false),
+		GuestClaimCode:   os.Getenv("GUEST_CLAIM_CODE"),
+		GuestPeerTTL:     GetenvDuration("GUEST_PEER_TTL", 24*time.Hour),
+		GuestMaxPeers:    GetenvInt("GUEST_MAX_PEERS", 5),
+
+		PeerDeleteCooldown: GetenvDuration("PEER_DELETE_COOLDOWN", 7*24*time.Hour),
+
+		KeepaliveStartupWindow: GetenvDuration("KEEPALIVE_STARTUP_WINDOW", 2*time.Minute),
+		KeepaliveMaxIdle:       GetenvDuration("KEEPALIVE_MAX_IDLE", 5*time.Minute),
+		KeepaliveInterval:      GetenvDuration("KEEPALIVE_INTERVAL", 30*time.Second),
+		KeepaliveSuspend:       GetenvBool("KEEPALIVE_SUSPEND", false),
+
+		NativeWireGuard: GetenvBool("WG_NATIVE", false),
+		ListenPort:      GetenvInt("SERVERPORT", 51820),
+		PeerDNS:         Getenv("PEERDNS", "1.1.1.1"),
+		PeerAllowedIPs:  Getenv("ALLOWEDIPS", "0.0.0.0/0, ::/0"),
+		MTU:             GetenvInt("WG_MTU", 0),
+
+		WakeNotifyURL:    os.Getenv("WAKE_NOTIFY_URL"),
+		WakeNotifyFormat: Getenv("WAKE_NOTIFY_FORMAT", "text"),
+
+		DigestNotifyURL:    os.Getenv("DIGEST_NOTIFY_URL"),
+		DigestNotifyFormat: Getenv("DIGEST_NOTIFY_FORMAT", "text"),
+		DigestPeriod:       GetenvDuration("DIGEST_PERIOD", 24*time.Hour),
+
+		AlertNotifyURL:    os.Getenv("ALERT_NOTIFY_URL"),
+		AlertNotifyFormat: Getenv("ALERT_NOTIFY_FORMAT", "text"),
+
+		OnboardNotifyURL:   os.Getenv("ONBOARD_NOTIFY_URL"),
+		OnboardNotifyToken: os.Getenv("ONBOARD_NOTIFY_TOKEN"),
+
+		FlyAPIToken:   os.Getenv("FLY_API_TOKEN"),
+		FlyAPIBaseURL: Getenv("FLY_API_BASE_URL", "https://api.machines.dev"),
+		MachineID:     os.Getenv("FLY_MACHINE_ID"),
+
+		HookExec:    os.Getenv("HOOK_EXEC"),
+		HookURL:     os.Getenv("HOOK_URL"),
+		HookTimeout: GetenvDuration("HOOK_TIMEOUT", 10*time.Second),
+
+		DNSPublishProvider: os.Getenv("DNS_PUBLISH_PROVIDER"),
+		DNSPublishName:     os.Getenv("DNS_PUBLISH_NAME"),
+		DNSPublishTTL:      Getenv("DNS_PUBLISH_TTL", "300"),
+		CloudflareToken:    os.Getenv("CLOUDFLARE_API_TOKEN"),
+		CloudflareZoneID:   os.Getenv("CLOUDFLARE_ZONE_ID"),
+		AWSAccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		AWSSecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		AWSSessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Route53ZoneID:      os.Getenv("ROUTE53_HOSTED_ZONE_ID"),
 	}
 }
 
+// ClientEndpointHost is the host clients should dial: BOOTSTRAP_ENDPOINT_HOST
+// if set, else the app's fly.dev name, else empty (keep whatever the
+// sidecar wrote).
+func (c Config) ClientEndpointHost() string {
+	if c.PublicHost != "" {
+		return c.PublicHost
+	}
+	if c.EndpointHost != "" {
+		return c.EndpointHost + ".fly.dev"
+	}
+	return ""
+}
+
+// minKeepaliveMaxIdle sits just above WireGuard's two-minute rekey
+// interval. A busy client handshakes only that often, so a shorter idle
+// limit would suspend machines in the middle of a session.
+const minKeepaliveMaxIdle = 150 * time.Second
+
+// CheckKeepalive rejects keepalive timings that would suspend active
+// sessions or never judge idleness at all.
+func (c Config) CheckKeepalive() error {
+	switch {
+	case c.KeepaliveMaxIdle < minKeepaliveMaxIdle:
+		return fmt.Errorf("KEEPALIVE_MAX_IDLE=%s is below %s; clients only handshake every two minutes and would be cut off mid-session",
+			c.KeepaliveMaxIdle, minKeepaliveMaxIdle)
+	case c.KeepaliveInterval < 5*time.Second:
+		return fmt.Errorf("KEEPALIVE_INTERVAL=%s is below 5s", c.KeepaliveInterval)
+	case c.KeepaliveInterval*2 > c.KeepaliveMaxIdle:
+		return fmt.Errorf("KEEPALIVE_INTERVAL=%s must be at most half of KEEPALIVE_MAX_IDLE=%s",
+			c.KeepaliveInterval, c.KeepaliveMaxIdle)
+	}
+	return nil
+}
+
 func (c Config) PeerConfigPath() string {
 	return filepath.Join(c.ConfigDir, c.PeerName, c.PeerName+".conf")
 }
@@ -38,9 +297,191 @@ func (c Config) BootstrapDonePath() string {
 	return filepath.Join(c.ConfigDir, "bootstrap_done")
 }
 
+func (c Config) BootstrapCreatedPath() string {
+	return filepath.Join(c.ConfigDir, "bootstrap_created")
+}
+
+func (c Config) KeepaliveStatePath() string {
+	return filepath.Join(c.ConfigDir, "keepalive_state.json")
+}
+
+func (c Config) MachineEventsPath() string {
+	return filepath.Join(c.ConfigDir, "machine_events.jsonl")
+}
+
+func (c Config) EndpointRecordPath() string {
+	return filepath.Join(c.ConfigDir, "endpoint.json")
+}
+
+func (c Config) DigestStatePath() string {
+	return filepath.Join(c.ConfigDir, "digest_state.json")
+}
+
+func (c Config) RedeliveryPath() string {
+	return filepath.Join(c.ConfigDir, "bootstrap_redelivery.json")
+}
+
+func (c Config) FunnelPath() string {
+	return filepath.Join(c.ConfigDir, "bootstrap_funnel.jsonl")
+}
+
+func (c Config) KnownPeerKeyPath() string {
+	return filepath.Join(c.ConfigDir, "known_peer_key")
+}
+
+func (c Config) AllowedIPsOverridePath() string {
+	return filepath.Join(c.ConfigDir, "allowed_ips_override.json")
+}
+
+func (c Config) EventsPath() string {
+	return filepath.Join(c.ConfigDir, "events.jsonl")
+}
+
+func (c Config) AlertStatePath() string {
+	return filepath.Join(c.ConfigDir, "alerts_state.json")
+}
+
+func (c Config) HandshakeHistoryPath() string {
+	return filepath.Join(c.ConfigDir, "handshake_history.jsonl")
+}
+
+func (c Config) PeerLastSeenPath() string {
+	return filepath.Join(c.ConfigDir, "peer_last_seen.json")
+}
+
+func (c Config) ConfigSnapshotPath() string {
+	return filepath.Join(c.ConfigDir, "config_snapshot.json")
+}
+
+func (c Config) EndpointHistoryPath() string {
+	return filepath.Join(c.ConfigDir, "endpoint_history.jsonl")
+}
+
+func (c Config) SigningKeyPath() string {
+	return filepath.Join(c.ConfigDir, "signing_key")
+}
+
+func (c Config) RouteProbePath() string {
+	return filepath.Join(c.ConfigDir, "route_probe.json")
+}
+
+func (c Config) OnboardingTokensPath() string {
+	return filepath.Join(c.ConfigDir, "onboarding_tokens.json")
+}
+
+func (c Config) APIPeersPath() string {
+	return filepath.Join(c.ConfigDir, "api_peers.json")
+}
+
+func (c Config) RevokedPeersPath() string {
+	return filepath.Join(c.ConfigDir, "revoked_peers.json")
+}
+
+func (c Config) DeletedPeersPath() string {
+	return filepath.Join(c.ConfigDir, "deleted_peers.json")
+}
+
+func (c Config) IdempotencyPath() string {
+	return filepath.Join(c.ConfigDir, "idempotency.json")
+}
+
+func (c Config) DeviceRequestsPath() string {
+	return filepath.Join(c.ConfigDir, "device_requests.json")
+}
+
+// cleanBasePath normalizes a mount prefix to "/segment[/segment...]" with
+// no trailing slash, or "" for the root.
+func cleanBasePath(v string) string {
+	v = strings.Trim(strings.TrimSpace(v), "/")
+	if v == "" {
+		return ""
+	}
+	return "/" + v
+}
+
 func Getenv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
 	return def
-}
\ No newline at end of file
+}
+
+// GetenvDuration parses a Go duration ("90s", "24h") from the
+// environment, falling back to def (with a warning) when it is unset,
+// malformed or not positive.
+func GetenvDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		slog.Warn("invalid setting, using default", "component", "config", "key", key, "value", v, "default", def.String())
+		return def
+	}
+	return d
+}
+
+// GetenvInt parses a non-negative integer from the environment, falling
+// back to def (with a warning) when it is unset or malformed.
+func GetenvInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		slog.Warn("invalid setting, using default", "component", "config", "key", key, "value", v, "default", def)
+		return def
+	}
+	return n
+}
+
+// GetenvBool parses a boolean environment variable, falling back to def
+// when it is unset or not a recognizable boolean.
+func GetenvBool(key string, def bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return def
+}
+
+// bootstrapTokens returns the admin token the server hands out and every
+// token it accepts. BOOTSTRAP_TOKEN is one token, commas included, as it
+// was before rotation was supported; BOOTSTRAP_TOKENS lists the others
+// accepted during a rotation.
+func bootstrapTokens() (string, []string) {
+	token := strings.TrimSpace(os.Getenv("BOOTSTRAP_TOKEN"))
+	if strings.Contains(token, ",") {
+		slog.Warn("BOOTSTRAP_TOKEN contains a comma and is used as a single token; list extra tokens in BOOTSTRAP_TOKENS",
+			"component", "config")
+	}
+	var tokens []string
+	if token != "" {
+		tokens = append(tokens, token)
+	}
+	for _, t := range GetenvList("BOOTSTRAP_TOKENS") {
+		if t != token {
+			tokens = append(tokens, t)
+		}
+	}
+	if token == "" && len(tokens) > 0 {
+		token = tokens[0]
+	}
+	return token, tokens
+}
+
+// GetenvList splits a comma-separated environment variable into its
+// non-empty, trimmed elements.
+func GetenvList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBootstrapTokens(t *testing.T) {
+	cases := []struct {
+		name         string
+		token, extra string
+		wantToken    string
+		wantAccepted []string
+	}{
+		{"unset", "", "", "", nil},
+		{"single", "s3cret", "", "s3cret", []string{"s3cret"}},
+		{"comma kept whole", "a,b", "", "a,b", []string{"a,b"}},
+		{"rotation", "new", "old, older", "new", []string{"new", "old", "older"}},
+		{"duplicate dropped", "new", "new,old", "new", []string{"new", "old"}},
+		{"extras only", "", "old", "old", []string{"old"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("BOOTSTRAP_TOKEN", tc.token)
+			t.Setenv("BOOTSTRAP_TOKENS", tc.extra)
+			token, accepted := bootstrapTokens()
+			if token != tc.wantToken || !reflect.DeepEqual(accepted, tc.wantAccepted) {
+				t.Errorf("got %q %q, want %q %q", token, accepted, tc.wantToken, tc.wantAccepted)
+			}
+		})
+	}
+}
+
+func TestServerPort(t *testing.T) {
+	cases := []struct {
+		env          string
+		wantListen   int
+		wantEndpoint string
+	}{
+		{"", 51820, "51820"},
+		{"443", 443, "443"},
+	}
+	for _, tc := range cases {
+		t.Setenv("SERVERPORT", tc.env)
+		t.Setenv("BOOTSTRAP_ENDPOINT_PORT", "")
+		c := Load()
+		if c.ListenPort != tc.wantListen || c.EndpointPort != tc.wantEndpoint {
+			t.Errorf("SERVERPORT=%q: ListenPort %d, EndpointPort %q; want %d, %q", tc.env, c.ListenPort, c.EndpointPort, tc.wantListen, tc.wantEndpoint)
+		}
+	}
+}
+
+func TestBlueprintLeavesOutSecretsAndIdentity(t *testing.T) {
+	c := Config{
+		BootstrapToken:   "s3cret",
+		AlertNotifyURL:   "https://ntfy.sh/topic",
+		EndpointHost:     "vpn.example.net",
+		PeopleMaxDevices: 3,
+		TunnelSubnet:     "10.13.13.0",
+	}
+	bp := c.Blueprint()
+	for _, field := range []string{"BootstrapToken", "AlertNotifyURL", "EndpointHost", "MachineID"} {
+		if v, ok := bp[field]; ok {
+			t.Errorf("%s = %q, want it left out", field, v)
+		}
+	}
+	if bp["PeopleMaxDevices"] != "3" || bp["TunnelSubnet"] != "10.13.13.0" {
+		t.Errorf("settings missing: %v", bp)
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// secretFields hold credentials, or URLs that commonly embed one (ntfy
+// topics, webhook paths). They never appear in a snapshot verbatim.
+var secretFields = map[string]bool{
+	"BootstrapToken":     true,
+	"BootstrapTokens":    true,
+	"OnboardNotifyToken": true,
+	"FlyAPIToken":        true,
+	"CloudflareToken":    true,
+	"AWSSecretAccessKey": true,
+	"AWSSessionToken":    true,
+	"WakeNotifyURL":      true,
+	"DigestNotifyURL":    true,
+	"AlertNotifyURL":     true,
+	"OnboardNotifyURL":   true,
+	"HookURL":            true,
+	"GuestClaimCode":     true,
+}
+
+// deploymentFields name this deployment rather than describe how it is
+// set up: its hostnames, certificates, machine and DNS zone. A blueprint
+// leaves them out, since a copy of the setup needs its own.
+var deploymentFields = map[string]bool{
+	"PublicBaseURL":    true,
+	"TLSCert":          true,
+	"TLSKey":           true,
+	"EndpointHost":     true,
+	"PublicHost":       true,
+	"Region":           true,
+	"MachineID":        true,
+	"DNSPublishName":   true,
+	"CloudflareZoneID": true,
+	"AWSAccessKeyID":   true,
+	"Route53ZoneID":    true,
+}
+
+// rerenderFields change what ends up in the configs served to clients,
+// so devices holding an older copy need a fresh one.
+var rerenderFields = map[string]bool{
+	"PeerName":          true,
+	"EndpointHost":      true,
+	"PublicHost":        true,
+	"EndpointRewriters": true,
+	"HostProviders":     true,
+	"EndpointPort":      true,
+	"TunnelSubnet":      true,
+}
+
+// Snapshot returns every effective setting as a display string keyed by
+// field name. Secrets are replaced by a short fingerprint, so rotating
+// one shows up in a diff without the value reaching logs or disk.
+func (c Config) Snapshot() map[string]string {
+	out := map[string]string{}
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		var s string
+		switch f := v.Field(i).Interface().(type) {
+		case []string:
+			s = strings.Join(f, ",")
+		default:
+			s = fmt.Sprint(f)
+		}
+		if secretFields[name] && s != "" {
+			sum := sha256.Sum256([]byte(s))
+			s = "sha256:" + hex.EncodeToString(sum[:4])
+		}
+		out[name] = s
+	}
+	return out
+}
+
+// Blueprint returns the settings another deployment would need to be set
+// up the same way: Snapshot without secrets, not even fingerprinted, and
+// without the fields that identify this deployment.
+func (c Config) Blueprint() map[string]string {
+	out := c.Snapshot()
+	for name := range out {
+		if secretFields[name] || deploymentFields[name] {
+			delete(out, name)
+		}
+	}
+	return out
+}
+
+// RequiresRerender reports whether changing the named setting changes
+// the configs served to clients.
+func RequiresRerender(field string) bool {
+	return rerenderFields[field]
+}
@@ -0,0 +1,113 @@
+package dnspub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// Cloudflare publishes records through the Cloudflare v4 API. The token
+// needs Zone.DNS edit permission on the zone.
+type Cloudflare struct {
+	token  string
+	zoneID string
+	client *http.Client
+}
+
+func NewCloudflare(token, zoneID string) Cloudflare {
+	return Cloudflare{
+		token:  token,
+		zoneID: zoneID,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type cfRecord struct {
+	ID      string  `json:"id,omitempty"`
+	Type    string  `json:"type"`
+	Name    string  `json:"name"`
+	Content string  `json:"content,omitempty"`
+	TTL     int     `json:"ttl"`
+	Data    *cfData `json:"data,omitempty"`
+}
+
+type cfData struct {
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	Port     int    `json:"port"`
+	Target   string `json:"target"`
+}
+
+type cfResponse struct {
+	Success bool              `json:"success"`
+	Errors  []json.RawMessage `json:"errors"`
+	Result  json.RawMessage   `json:"result"`
+}
+
+func (c Cloudflare) Upsert(ctx context.Context, rec Record) error {
+	body := cfRecord{Type: rec.Type, Name: rec.Name, TTL: rec.TTL}
+	switch rec.Type {
+	case "SRV":
+		body.Data = &cfData{Priority: rec.Priority, Weight: rec.Weight, Port: rec.Port, Target: rec.Target}
+	case "TXT":
+		body.Content = `"` + rec.Text + `"`
+	default:
+		return fmt.Errorf("unsupported record type %q", rec.Type)
+	}
+
+	q := url.Values{"type": {rec.Type}, "name": {rec.Name}}
+	var existing []cfRecord
+	if err := c.do(ctx, http.MethodGet, "/dns_records?"+q.Encode(), nil, &existing); err != nil {
+		return err
+	}
+
+	if len(existing) > 0 {
+		return c.do(ctx, http.MethodPut, "/dns_records/"+existing[0].ID, body, nil)
+	}
+	return c.do(ctx, http.MethodPost, "/dns_records", body, nil)
+}
+
+func (c Cloudflare) do(ctx context.Context, method, path string, in, out any) error {
+	var buf bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&buf).Encode(in); err != nil {
+			return err
+		}
+	}
+	u := fmt.Sprintf("%s/zones/%s%s", cloudflareAPI, url.PathEscape(c.zoneID), path)
+	req, err := http.NewRequestWithContext(ctx, method, u, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var cr cfResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return fmt.Errorf("cloudflare: %s: %w", resp.Status, err)
+	}
+	if !cr.Success {
+		errs := make([]string, 0, len(cr.Errors))
+		for _, e := range cr.Errors {
+			errs = append(errs, string(e))
+		}
+		return fmt.Errorf("cloudflare: %s: %s", resp.Status, strings.Join(errs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(cr.Result, out)
+	}
+	return nil
+}
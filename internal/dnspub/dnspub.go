@@ -0,0 +1,68 @@
+// Package dnspub publishes the VPN endpoint as DNS records so scripts and
+// smart clients can discover host/port changes without re-onboarding.
+//
+// Two records are maintained under a configured name, e.g. vpn.example.com:
+//
+//	_wireguard._udp.vpn.example.com. SRV 0 0 51820 myapp.fly.dev.
+//	_wireguard.vpn.example.com.      TXT "v=wgvpn1 host=myapp.fly.dev port=51820"
+package dnspub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Record is a provider-neutral DNS record.
+type Record struct {
+	Name string // fully qualified, without trailing dot
+	Type string // "SRV" or "TXT"
+	TTL  int
+
+	// SRV fields.
+	Priority int
+	Weight   int
+	Port     int
+	Target   string
+
+	// TXT payload, unquoted.
+	Text string
+}
+
+// Provider creates or replaces a record.
+type Provider interface {
+	Upsert(ctx context.Context, rec Record) error
+}
+
+// Records returns the SRV and TXT records describing host:port under name.
+func Records(name, host, port string, ttl int) ([]Record, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return nil, fmt.Errorf("dnspub: invalid port %q", port)
+	}
+	return []Record{
+		{
+			Name:   "_wireguard._udp." + name,
+			Type:   "SRV",
+			TTL:    ttl,
+			Port:   p,
+			Target: host,
+		},
+		{
+			Name: "_wireguard." + name,
+			Type: "TXT",
+			TTL:  ttl,
+			Text: fmt.Sprintf("v=wgvpn1 host=%s port=%d", host, p),
+		},
+	}, nil
+}
+
+// Publish upserts every record, stopping at the first failure.
+func Publish(ctx context.Context, p Provider, recs []Record) error {
+	for _, rec := range recs {
+		if err := p.Upsert(ctx, rec); err != nil {
+			return fmt.Errorf("dnspub: %s %s: %w", rec.Type, rec.Name, err)
+		}
+	}
+	return nil
+}
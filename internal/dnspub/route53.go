@@ -0,0 +1,164 @@
+package dnspub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	route53Host   = "route53.amazonaws.com"
+	route53Region = "us-east-1"
+)
+
+// Route53 publishes records through the Route 53 ChangeResourceRecordSets
+// API, whose UPSERT action creates or replaces in one call. Requests are
+// signed with AWS Signature Version 4.
+type Route53 struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	zoneID       string
+	client       *http.Client
+}
+
+func NewRoute53(accessKey, secretKey, sessionToken, zoneID string) Route53 {
+	return Route53{
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		zoneID:       strings.TrimPrefix(zoneID, "/hostedzone/"),
+		client:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type r53ChangeRequest struct {
+	XMLName xml.Name    `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Changes []r53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type r53Change struct {
+	Action string       `xml:"Action"`
+	Set    r53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type r53RecordSet struct {
+	Name   string   `xml:"Name"`
+	Type   string   `xml:"Type"`
+	TTL    int      `xml:"TTL"`
+	Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+func (r Route53) Upsert(ctx context.Context, rec Record) error {
+	var value string
+	switch rec.Type {
+	case "SRV":
+		value = fmt.Sprintf("%d %d %d %s.", rec.Priority, rec.Weight, rec.Port, rec.Target)
+	case "TXT":
+		value = `"` + rec.Text + `"`
+	default:
+		return fmt.Errorf("unsupported record type %q", rec.Type)
+	}
+
+	body, err := xml.Marshal(r53ChangeRequest{Changes: []r53Change{{
+		Action: "UPSERT",
+		Set:    r53RecordSet{Name: rec.Name + ".", Type: rec.Type, TTL: rec.TTL, Values: []string{value}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	path := "/2013-04-01/hostedzone/" + r.zoneID + "/rrset/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+route53Host+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	r.sign(req, body, time.Now().UTC())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("route53: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// sign adds SigV4 headers for the route53 service. Only the headers we set
+// ourselves are signed, which is all SigV4 requires.
+func (r Route53) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", route53Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if r.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.sessionToken)
+	}
+
+	signed := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if r.sessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	var canonHeaders strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = route53Host
+		}
+		canonHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + route53Region + "/route53/aws4_request"
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := signingKey(r.secretKey, date, route53Region, "route53")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		r.accessKey, scope, signedHeaders, sig))
+}
+
+// signingKey derives the SigV4 key for one day, region and service.
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
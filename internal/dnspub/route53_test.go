@@ -0,0 +1,60 @@
+package dnspub
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+
+// TestSigningKey checks the key derivation against the example in AWS's
+// "Examples of how to derive a signing key for Signature Version 4".
+func TestSigningKey(t *testing.T) {
+	got := hex.EncodeToString(signingKey(testSecretKey, "20120215", "us-east-1", "iam"))
+	if want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"; got != want {
+		t.Errorf("signingKey = %s, want %s", got, want)
+	}
+}
+
+func TestRoute53Sign(t *testing.T) {
+	const scope = "AKIDEXAMPLE/20260101/us-east-1/route53/aws4_request"
+	cases := []struct {
+		name          string
+		sessionToken  string
+		authorization string
+	}{
+		{
+			"long-term keys", "",
+			"AWS4-HMAC-SHA256 Credential=" + scope + ", SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=4902b6a96902df1af2e9a3732cca217634da8cdc24a32b4f42a82375b30777f6",
+		},
+		{
+			"session token", "session-token",
+			"AWS4-HMAC-SHA256 Credential=" + scope + ", SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature=cfe5b490a9b9eb9a51ae36331347ec188c44767888cb0b81c29279f5740def52",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRoute53("AKIDEXAMPLE", testSecretKey, tc.sessionToken, "/hostedzone/Z123")
+			body := []byte("<x/>")
+			req, err := http.NewRequest(http.MethodPost, "https://"+route53Host+"/2013-04-01/hostedzone/"+r.zoneID+"/rrset/", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/xml")
+			r.sign(req, body, time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+
+			if got := req.Header.Get("Authorization"); got != tc.authorization {
+				t.Errorf("Authorization =\n  %s\nwant\n  %s", got, tc.authorization)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20260101T120000Z" {
+				t.Errorf("X-Amz-Date = %s", got)
+			}
+			if got := req.Header.Get("X-Amz-Security-Token"); got != tc.sessionToken {
+				t.Errorf("X-Amz-Security-Token = %q, want %q", got, tc.sessionToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+// Package endpointhost works out the public hostname or address clients
+// should dial, so the server isn't tied to Fly's <app>.fly.dev names.
+package endpointhost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider is one source of the public endpoint host. Host returns ""
+// with a nil error when the source simply doesn't apply (e.g. the Fly
+// provider off Fly), and an error when it applies but failed.
+type Provider interface {
+	Name() string
+	Host(ctx context.Context) (string, error)
+}
+
+// Detect asks each provider in order and returns the first host found,
+// with the name of the provider that supplied it. Errors are collected
+// and only returned if no provider produced a host.
+func Detect(ctx context.Context, providers []Provider) (host, provider string, err error) {
+	var errs []error
+	for _, p := range providers {
+		h, err := p.Host(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		if h != "" {
+			return h, p.Name(), nil
+		}
+	}
+	return "", "", errors.Join(errs...)
+}
+
+// Static returns a fixed host, typically BOOTSTRAP_ENDPOINT_HOST.
+type Static struct{ Value string }
+
+func (s Static) Name() string { return "env" }
+
+func (s Static) Host(context.Context) (string, error) { return s.Value, nil }
+
+// Fly returns <app>.fly.dev when running as a Fly app.
+type Fly struct{ App string }
+
+func (f Fly) Name() string { return "fly" }
+
+func (f Fly) Host(context.Context) (string, error) {
+	if f.App == "" {
+		return "", nil
+	}
+	return f.App + ".fly.dev", nil
+}
+
+// PublicIP asks an echo service such as https://api.ipify.org for the
+// address this machine's outbound traffic comes from. That is only the
+// right answer when inbound UDP arrives on the same address, as on a
+// plain VPS.
+type PublicIP struct {
+	URL    string
+	client *http.Client
+}
+
+func NewPublicIP(url string) PublicIP {
+	return PublicIP{URL: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (p PublicIP) Name() string { return "public-ip" }
+
+func (p PublicIP) Host(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	return fetchIP(p.client, req)
+}
+
+// metadataClient is short-timeout because off the matching cloud the
+// link-local metadata address simply doesn't answer.
+var metadataClient = &http.Client{Timeout: 2 * time.Second}
+
+// EC2 reads the instance's public hostname, or failing that its public
+// IPv4, from the EC2 instance metadata service (IMDSv2).
+type EC2 struct{}
+
+func (EC2) Name() string { return "ec2" }
+
+func (EC2) Host(ctx context.Context) (string, error) {
+	const base = "http://169.254.169.254/latest"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, base+"/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := fetch(metadataClient, req)
+	if err != nil {
+		return "", err
+	}
+
+	for _, path := range []string{"/meta-data/public-hostname", "/meta-data/public-ipv4"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+		if v, err := fetch(metadataClient, req); err == nil && v != "" {
+			return v, nil
+		}
+	}
+	return "", errors.New("instance has no public hostname or IPv4")
+}
+
+// GCP reads the external IP of the first network interface from the
+// Compute Engine metadata server.
+type GCP struct{}
+
+func (GCP) Name() string { return "gcp" }
+
+func (GCP) Host(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return fetchIP(metadataClient, req)
+}
+
+func fetch(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// fetchIP is fetch for endpoints that must answer with a bare address.
+func fetchIP(client *http.Client, req *http.Request) (string, error) {
+	v, err := fetch(client, req)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(v) == nil {
+		return "", fmt.Errorf("%s returned %q, not an IP address", req.URL, v)
+	}
+	return v, nil
+}
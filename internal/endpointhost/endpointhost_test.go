@@ -0,0 +1,106 @@
+package endpointhost
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeProvider struct {
+	name string
+	host string
+	err  error
+}
+
+func (f fakeProvider) Name() string { return f.name }
+
+func (f fakeProvider) Host(context.Context) (string, error) { return f.host, f.err }
+
+func TestDetect(t *testing.T) {
+	failed := errors.New("metadata unreachable")
+	cases := []struct {
+		name         string
+		providers    []Provider
+		wantHost     string
+		wantProvider string
+		wantErr      string
+	}{
+		{
+			name:      "first host wins",
+			providers: []Provider{Static{Value: "vpn.example.com"}, Fly{App: "my-app"}},
+			wantHost:  "vpn.example.com", wantProvider: "env",
+		},
+		{
+			name:      "skips providers that don't apply",
+			providers: []Provider{Static{}, Fly{}, Fly{App: "my-app"}},
+			wantHost:  "my-app.fly.dev", wantProvider: "fly",
+		},
+		{
+			name:      "an error doesn't stop the search",
+			providers: []Provider{fakeProvider{name: "ec2", err: failed}, fakeProvider{name: "gcp", host: "203.0.113.7"}},
+			wantHost:  "203.0.113.7", wantProvider: "gcp",
+		},
+		{
+			name:      "errors are reported when nothing is found",
+			providers: []Provider{Static{}, fakeProvider{name: "ec2", err: failed}},
+			wantErr:   "ec2: metadata unreachable",
+		},
+		{name: "no providers"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host, provider, err := Detect(context.Background(), tc.providers)
+			if host != tc.wantHost || provider != tc.wantProvider {
+				t.Errorf("Detect = %q from %q, want %q from %q", host, provider, tc.wantHost, tc.wantProvider)
+			}
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Detect error = %v", err)
+			case tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr):
+				t.Errorf("Detect error = %v, want %q", err, tc.wantErr)
+			}
+			if tc.wantErr != "" && !errors.Is(err, failed) {
+				t.Error("the provider's error is not reachable with errors.Is")
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr string
+	}{
+		{name: "ipv4", status: 200, body: "203.0.113.7\n", want: "203.0.113.7"},
+		{name: "ipv6", status: 200, body: "2001:db8::7", want: "2001:db8::7"},
+		{name: "not an address", status: 200, body: "<html>rate limited</html>", wantErr: `returned "<html>rate limited</html>", not an IP address`},
+		{name: "empty", status: 200, body: "", wantErr: `returned "", not an IP address`},
+		{name: "error status", status: 503, body: "203.0.113.7", wantErr: "returned 503 Service Unavailable"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			got, err := NewPublicIP(srv.URL).Host(context.Background())
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Host error = %v, want it to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("Host = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+}
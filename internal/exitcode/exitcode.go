@@ -0,0 +1,61 @@
+// Package exitcode classifies fatal errors so restart loops can be told
+// apart from the exit status and the last log line alone.
+package exitcode
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+)
+
+// Exit codes. 1 is left for unclassified failures (and Go's own log.Fatal).
+const (
+	Unknown          = 1
+	ConfigInvalid    = 2 // an environment setting can't be used
+	ListenFailed     = 3 // an HTTP listener couldn't bind or stopped serving
+	WireGuardMissing = 4 // WG_NATIVE couldn't bring the interface up
+	StoreUnusable    = 5 // /config is missing, unwritable or holds corrupt state
+)
+
+var classes = map[int]string{
+	Unknown:          "unknown",
+	ConfigInvalid:    "config_invalid",
+	ListenFailed:     "listen_failed",
+	WireGuardMissing: "wireguard_unavailable",
+	StoreUnusable:    "store_unusable",
+}
+
+// Error is an error tagged with the exit code it should produce.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Wrap tags err with code. A nil err stays nil.
+func Wrap(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Exit logs one final structured line and exits with err's code, or
+// Unknown if err isn't tagged.
+func Exit(err error) {
+	code := codeOf(err)
+	slog.Error("fatal", "class", classes[code], "exit_code", code, "error", err)
+	os.Exit(code)
+}
+
+// codeOf returns the code err was tagged with, looking through wrapping,
+// or Unknown.
+func codeOf(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return Unknown
+}
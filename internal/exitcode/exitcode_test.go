@@ -0,0 +1,51 @@
+package exitcode
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	cause := errors.New("boom")
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"untagged", cause, Unknown},
+		{"tagged", Wrap(ConfigInvalid, cause), ConfigInvalid},
+		{"wrapped", fmt.Errorf("starting: %w", Wrap(ListenFailed, cause)), ListenFailed},
+		{"joined", errors.Join(cause, Wrap(StoreUnusable, cause)), StoreUnusable},
+		{"outermost wins", Wrap(ConfigInvalid, Wrap(StoreUnusable, cause)), ConfigInvalid},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := codeOf(tc.err); got != tc.want {
+				t.Errorf("codeOf = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if err := Wrap(ConfigInvalid, nil); err != nil {
+		t.Errorf("Wrap(nil) = %v, want nil", err)
+	}
+	err := Wrap(StoreUnusable, fmt.Errorf("open /config: %w", fs.ErrPermission))
+	if err.Error() != "open /config: permission denied" {
+		t.Errorf("Error() = %q, want the wrapped message", err.Error())
+	}
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Error("the wrapped error is not reachable with errors.Is")
+	}
+}
+
+func TestEveryCodeHasAClass(t *testing.T) {
+	for _, code := range []int{Unknown, ConfigInvalid, ListenFailed, WireGuardMissing, StoreUnusable} {
+		if classes[code] == "" {
+			t.Errorf("code %d has no class", code)
+		}
+	}
+}
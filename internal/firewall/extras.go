@@ -0,0 +1,136 @@
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ExtrasTable is the nftables table that holds operator-declared rules.
+// We own it outright: every apply replaces its contents, so rules removed
+// from the file disappear from the kernel too.
+const ExtrasTable = "inet wgvpn_extra"
+
+// ApplyExtras installs the chains and rules declared in path into
+// ExtrasTable. The file contains the body of the table, e.g.
+//
+//	chain forward {
+//	  type filter hook forward priority 0; policy accept;
+//	  iifname "wg0" ip daddr 10.0.0.0/8 drop
+//	}
+//
+// The ruleset is first checked with `nft -c` and then loaded as a single
+// transaction, so a bad file leaves the previously installed rules in
+// place. A missing file removes the table. It returns false when there was
+// nothing to apply.
+func ApplyExtras(ctx context.Context, path string) (bool, error) {
+	body, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Without nft there can't be a table left over to clean up.
+		if _, err := exec.LookPath("nft"); err != nil {
+			return false, nil
+		}
+		return false, removeExtras(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := checkExtrasBody(string(body)); err != nil {
+		return false, fmt.Errorf("firewall: %s: %w", path, err)
+	}
+
+	// Declaring the table before deleting it makes the delete succeed on
+	// first run; all three statements commit atomically.
+	ruleset := fmt.Sprintf("table %s\ndelete table %s\ntable %s {\n%s\n}\n",
+		ExtrasTable, ExtrasTable, ExtrasTable, body)
+
+	if err := nft(ctx, ruleset, "-c"); err != nil {
+		return false, fmt.Errorf("firewall: validating %s: %w", path, err)
+	}
+	if err := nft(ctx, ruleset); err != nil {
+		return false, fmt.Errorf("firewall: applying %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// checkExtrasBody rejects a body that would step outside ExtrasTable: a
+// top-level table statement, or a stray "}" that closes the table early
+// so what follows lands elsewhere. Comments and quoted strings are
+// skipped, so a rule that merely mentions "table" is fine. Everything
+// else is left to `nft -c`.
+func checkExtrasBody(body string) error {
+	depth := 0
+	atStart := true // at the start of a top-level statement
+	quoted, comment := false, false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case comment:
+			if c == '\n' {
+				comment, atStart = false, depth == 0
+			}
+			continue
+		case quoted:
+			quoted = c != '"'
+			continue
+		}
+		switch c {
+		case '#':
+			comment = true
+		case '"':
+			quoted, atStart = true, false
+		case '{':
+			depth++
+			atStart = false
+		case '}':
+			depth--
+			if depth < 0 {
+				return errors.New("unbalanced '}' would close the managed table")
+			}
+			atStart = depth == 0
+		case '\n', ';':
+			atStart = atStart || depth == 0
+		case ' ', '\t', '\r':
+		default:
+			if atStart && depth == 0 {
+				word := body[i:]
+				if j := strings.IndexAny(word, " \t\r\n;{#"); j >= 0 {
+					word = word[:j]
+				}
+				if word == "table" {
+					return errors.New("must only contain chains, sets and rules; the table is managed for you")
+				}
+			}
+			atStart = false
+		}
+	}
+	if depth != 0 {
+		return errors.New("unclosed '{'")
+	}
+	return nil
+}
+
+// removeExtras drops ExtrasTable if a previous deploy installed it.
+func removeExtras(ctx context.Context) error {
+	return nft(ctx, fmt.Sprintf("table %s\ndelete table %s\n", ExtrasTable, ExtrasTable))
+}
+
+// nft feeds ruleset to `nft -f -`, returning nft's stderr on failure.
+func nft(ctx context.Context, ruleset string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "nft", append(args, "-f", "-")...)
+	cmd.Stdin = strings.NewReader(ruleset)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
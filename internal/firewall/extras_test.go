@@ -0,0 +1,58 @@
+package firewall
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckExtrasBody(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"chain", "chain forward {\n  type filter hook forward priority 0; policy accept;\n  iifname \"wg0\" ip daddr 10.0.0.0/8 drop\n}\n", ""},
+		{"comment mentions table", "# see the table below\nchain c {\n  type filter hook input priority 0;\n}\n", ""},
+		{"rule comment", "chain c {\n  tcp dport 22 drop comment \"routing table guard\"\n}\n", ""},
+		{"set named table", "set table {\n  type ipv4_addr\n}\n", ""},
+		{"jump to a chain named table", "chain table { }\nchain c {\n  jump table\n}\n", ""},
+		{"brace in a string", "chain c {\n  drop comment \"}\"\n}\n", ""},
+		{"top-level table", "table ip other {\n}\n", "chains, sets and rules"},
+		{"table after a semicolon", "chain c { }; table ip other { }", "chains, sets and rules"},
+		{"indented table", "  table inet x { }", "chains, sets and rules"},
+		{"closes the managed table", "}\ntable ip other {\n  chain c { }\n", "unbalanced"},
+		{"closes it without a table", "chain c { } }\nchain d { }\n{", "unbalanced"},
+		{"unclosed", "chain c {\n", "unclosed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkExtrasBody(tc.body)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("err = %v, want one mentioning %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyExtrasRejectsATableBeforeRunningNft(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firewall-extra.nft")
+	if err := os.WriteFile(path, []byte("table ip other { }\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir()) // no nft: reaching it would be a different error
+	applied, err := ApplyExtras(context.Background(), path)
+	if applied || err == nil || !strings.Contains(err.Error(), "table is managed for you") {
+		t.Errorf("ApplyExtras = %v, %v", applied, err)
+	}
+
+	applied, err = ApplyExtras(context.Background(), filepath.Join(t.TempDir(), "missing.nft"))
+	if applied || err != nil {
+		t.Errorf("missing file without nft: ApplyExtras = %v, %v", applied, err)
+	}
+}
@@ -0,0 +1,57 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+// GuestsTable is the nftables table that fences guest peers off from the
+// rest of the tunnel. Like ExtrasTable it is replaced as a whole on every
+// apply.
+const GuestsTable = "inet wgvpn_guests"
+
+// ApplyGuestIsolation lets the guests in tunnel reach the internet and
+// the server's DNS, but neither the other peers nor anything else on the
+// server's tunnel address, such as the admin API. With no guests it
+// removes the table.
+func ApplyGuestIsolation(ctx context.Context, tunnel netip.Prefix, guests []netip.Addr) error {
+	if len(guests) == 0 {
+		// Without nft there can't be a table left over to clean up.
+		if _, err := exec.LookPath("nft"); err != nil {
+			return nil
+		}
+		return nft(ctx, fmt.Sprintf("table %s\ndelete table %s\n", GuestsTable, GuestsTable))
+	}
+	if err := nft(ctx, guestRuleset(tunnel, guests)); err != nil {
+		return fmt.Errorf("firewall: isolating guests: %w", err)
+	}
+	return nil
+}
+
+// guestRuleset renders the table for ApplyGuestIsolation. The server
+// listens on the first address of tunnel.
+func guestRuleset(tunnel netip.Prefix, guests []netip.Addr) string {
+	family, addrType := "ip", "ipv4_addr"
+	if tunnel.Addr().Is6() {
+		family, addrType = "ip6", "ipv6_addr"
+	}
+	elems := make([]string, len(guests))
+	for i, g := range guests {
+		elems[i] = g.String()
+	}
+	server := tunnel.Masked().Addr().Next()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table %s\ndelete table %s\ntable %s {\n", GuestsTable, GuestsTable, GuestsTable)
+	fmt.Fprintf(&b, "  set guests {\n    type %s\n    elements = { %s }\n  }\n", addrType, strings.Join(elems, ", "))
+	fmt.Fprintf(&b, "  chain forward {\n    type filter hook forward priority -10; policy accept;\n")
+	fmt.Fprintf(&b, "    %s saddr @guests %s daddr %s drop\n", family, family, tunnel.Masked())
+	fmt.Fprintf(&b, "    %s daddr @guests %s saddr %s drop\n  }\n", family, family, tunnel.Masked())
+	fmt.Fprintf(&b, "  chain input {\n    type filter hook input priority -10; policy accept;\n")
+	fmt.Fprintf(&b, "    %s saddr @guests %s daddr %s meta l4proto { tcp, udp } th dport 53 accept\n", family, family, server)
+	fmt.Fprintf(&b, "    %s saddr @guests %s daddr %s drop\n  }\n}\n", family, family, server)
+	return b.String()
+}
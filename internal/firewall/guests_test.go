@@ -0,0 +1,53 @@
+package firewall
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestGuestRuleset(t *testing.T) {
+	cases := []struct {
+		name   string
+		tunnel string
+		guests []string
+		want   []string
+	}{
+		{
+			name:   "ipv4",
+			tunnel: "10.13.13.0/24",
+			guests: []string{"10.13.13.7", "10.13.13.9"},
+			want: []string{
+				"delete table inet wgvpn_guests",
+				"type ipv4_addr",
+				"elements = { 10.13.13.7, 10.13.13.9 }",
+				"ip saddr @guests ip daddr 10.13.13.0/24 drop",
+				"ip daddr @guests ip saddr 10.13.13.0/24 drop",
+				"ip saddr @guests ip daddr 10.13.13.1 meta l4proto { tcp, udp } th dport 53 accept",
+				"ip saddr @guests ip daddr 10.13.13.1 drop",
+			},
+		},
+		{
+			name:   "ipv6",
+			tunnel: "fd00:13::/64",
+			guests: []string{"fd00:13::5"},
+			want: []string{
+				"type ipv6_addr",
+				"ip6 saddr @guests ip6 daddr fd00:13::/64 drop",
+				"ip6 saddr @guests ip6 daddr fd00:13::1 drop",
+			},
+		},
+	}
+	for _, c := range cases {
+		var guests []netip.Addr
+		for _, g := range c.guests {
+			guests = append(guests, netip.MustParseAddr(g))
+		}
+		got := guestRuleset(netip.MustParsePrefix(c.tunnel), guests)
+		for _, w := range c.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: ruleset lacks %q:\n%s", c.name, w, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package fly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultAPIBaseURL is the public Fly Machines API endpoint. Machines can
+// also reach it over 6PN at http://_api.internal:4280.
+const DefaultAPIBaseURL = "https://api.machines.dev"
+
+// Client is a minimal Fly Machines API client scoped to a single app.
+type Client struct {
+	baseURL string
+	token   string
+	app     string
+	http    *http.Client
+}
+
+// MachineEvent is one entry of a machine's lifecycle history, e.g.
+// type=suspend status=suspended or type=start status=started.
+type MachineEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Status    string `json:"status"`
+	Source    string `json:"source"`
+	Timestamp int64  `json:"timestamp"` // milliseconds since epoch
+}
+
+// Time returns the event timestamp.
+func (e MachineEvent) Time() time.Time {
+	return time.UnixMilli(e.Timestamp)
+}
+
+type machine struct {
+	ID     string         `json:"id"`
+	State  string         `json:"state"`
+	Events []MachineEvent `json:"events"`
+}
+
+func NewClient(baseURL, app, token string) Client {
+	if baseURL == "" {
+		baseURL = DefaultAPIBaseURL
+	}
+	return Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		app:     app,
+		http:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Enabled reports whether the client has what it needs to make calls.
+func (c Client) Enabled() bool {
+	return c.token != "" && c.app != ""
+}
+
+// MachineEvents returns the lifecycle events Fly retains for machineID,
+// newest first as returned by the API.
+func (c Client) MachineEvents(ctx context.Context, machineID string) ([]MachineEvent, error) {
+	var m machine
+	path := fmt.Sprintf("/v1/apps/%s/machines/%s", url.PathEscape(c.app), url.PathEscape(machineID))
+	if err := c.do(ctx, http.MethodGet, path, &m); err != nil {
+		return nil, err
+	}
+	return m.Events, nil
+}
+
+// Suspend asks Fly to suspend machineID, snapshotting its memory so the
+// next request resumes it where it left off. Called by the machine on
+// itself, the call may only return after the machine is resumed.
+func (c Client) Suspend(ctx context.Context, machineID string) error {
+	path := fmt.Sprintf("/v1/apps/%s/machines/%s/suspend", url.PathEscape(c.app), url.PathEscape(machineID))
+	return c.do(ctx, http.MethodPost, path, nil)
+}
+
+func (c Client) do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("fly api: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,123 @@
+package fly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMachineEvents(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		body    string
+		want    []MachineEvent
+		wantErr string
+	}{
+		{
+			name:   "events",
+			status: 200,
+			body: `{"id":"m1","state":"started","events":[
+				{"id":"e2","type":"start","status":"started","source":"flyd","timestamp":1767225660000},
+				{"id":"e1","type":"suspend","status":"suspended","source":"user","timestamp":1767225600000}]}`,
+			want: []MachineEvent{
+				{ID: "e2", Type: "start", Status: "started", Source: "flyd", Timestamp: 1767225660000},
+				{ID: "e1", Type: "suspend", Status: "suspended", Source: "user", Timestamp: 1767225600000},
+			},
+		},
+		{name: "no events", status: 200, body: `{"id":"m1","state":"started"}`},
+		{name: "not found", status: 404, body: "machine not found\n", wantErr: "404 Not Found: machine not found"},
+		{name: "unauthorized", status: 401, body: `{"error":"unauthorized"}`, wantErr: `401 Unauthorized: {"error":"unauthorized"}`},
+		{name: "bad json", status: 200, body: `{"events":`, wantErr: "unexpected EOF"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/v1/apps/my-app/machines/m1" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Bearer tok" {
+					t.Errorf("Authorization = %q", auth)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			got, err := NewClient(srv.URL+"/", "my-app", "tok").MachineEvents(context.Background(), "m1")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("MachineEvents error = %v, want it to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MachineEvents: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d events, want %d: %+v", len(got), len(tc.want), got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("event %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSuspend(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{"ok", 200, ""},
+		{"conflict", 409, "fly api: POST /v1/apps/my-app/machines/m1/suspend: 409 Conflict"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/apps/my-app/machines/m1/suspend" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(`{"ok":true}`))
+			}))
+			defer srv.Close()
+
+			err := NewClient(srv.URL, "my-app", "tok").Suspend(context.Background(), "m1")
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("Suspend: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("Suspend error = %v, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	if c := NewClient("", "app", "tok"); c.baseURL != DefaultAPIBaseURL {
+		t.Errorf("baseURL = %q, want %q", c.baseURL, DefaultAPIBaseURL)
+	}
+	for _, tc := range []struct {
+		app, token string
+		want       bool
+	}{
+		{"app", "tok", true},
+		{"", "tok", false},
+		{"app", "", false},
+	} {
+		if got := NewClient("", tc.app, tc.token).Enabled(); got != tc.want {
+			t.Errorf("Enabled(app=%q, token=%q) = %v, want %v", tc.app, tc.token, got, tc.want)
+		}
+	}
+	e := MachineEvent{Timestamp: 1767225600000}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); !e.Time().Equal(want) {
+		t.Errorf("Time() = %v, want %v", e.Time(), want)
+	}
+}
@@ -0,0 +1,124 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Lifecycle events passed to hooks.
+const (
+	PeerCreated     = "peer_created"     // a new peer config (key pair) appeared on the volume
+	BootstrapServed = "bootstrap_served" // /bootstrap handed out a config
+	SessionStarted  = "session_started"  // a client connected after being idle
+	SessionEnded    = "session_ended"    // the client went idle
+	BeforeSuspend   = "before_suspend"   // keepalive is about to stop and let Fly suspend
+)
+
+// Payload is the JSON document every hook receives.
+type Payload struct {
+	Event  string         `json:"event"`
+	Time   string         `json:"time"`
+	App    string         `json:"app,omitempty"`
+	Region string         `json:"region,omitempty"`
+	Peer   string         `json:"peer,omitempty"`
+	Data   map[string]any `json:"data,omitempty"`
+}
+
+// Runner delivers lifecycle events to operator-supplied extensions:
+//
+//   - an executable, run with the payload on stdin and the event name in
+//     $HOOK_EVENT. A non-zero exit is reported as an error.
+//   - an HTTP endpoint, which receives the payload as a JSON POST.
+//
+// Either, both or neither may be configured.
+type Runner struct {
+	exec    string
+	url     string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func New(execPath, url string, timeout time.Duration) Runner {
+	return Runner{
+		exec:    execPath,
+		url:     url,
+		timeout: timeout,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Enabled reports whether any hook target is configured.
+func (h Runner) Enabled() bool {
+	return h.exec != "" || h.url != ""
+}
+
+// Fire delivers p to every configured target, bounded by the runner's
+// timeout. Both targets are attempted even if the first fails.
+func (h Runner) Fire(ctx context.Context, p Payload) error {
+	if !h.Enabled() {
+		return nil
+	}
+	if p.Time == "" {
+		p.Time = time.Now().Format(time.RFC3339)
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	var errs []error
+	if h.exec != "" {
+		if err := h.runExec(ctx, p.Event, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if h.url != "" {
+		if err := h.post(ctx, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("hooks: %s: %v", p.Event, errs)
+	}
+	return nil
+}
+
+func (h Runner) runExec(ctx context.Context, event string, body []byte) error {
+	cmd := exec.CommandContext(ctx, h.exec)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "HOOK_EVENT="+event)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", h.exec, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (h Runner) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", h.url, resp.Status)
+	}
+	return nil
+}
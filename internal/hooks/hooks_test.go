@@ -0,0 +1,127 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript writes an executable shell hook to a temp dir.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFireHTTP(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{"ok", 200, ""},
+		{"accepted", 202, ""},
+		{"rejected", 400, "hooks: peer_created: [http://"},
+		{"server error", 500, "returned 500 Internal Server Error"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Payload
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q", ct)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("body: %v", err)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			err := New("", srv.URL, 5*time.Second).Fire(context.Background(), Payload{Event: PeerCreated, Peer: "peer_laptop"})
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("Fire: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("Fire error = %v, want it to contain %q", err, tc.wantErr)
+			}
+			if got.Event != PeerCreated || got.Peer != "peer_laptop" || got.Time == "" {
+				t.Errorf("payload = %+v", got)
+			}
+		})
+	}
+}
+
+func TestFireExec(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	cases := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"ok", `echo "$HOOK_EVENT" > ` + out + "\ncat >> " + out + "\n", ""},
+		{"non-zero exit", "echo nope >&2\nexit 3\n", "exit status 3: nope"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := New(writeScript(t, tc.script), "", 5*time.Second).Fire(context.Background(), Payload{Event: SessionStarted, Time: "2026-01-01T00:00:00Z"})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Fire error = %v, want it to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fire: %v", err)
+			}
+			b, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "session_started\n" + `{"event":"session_started","time":"2026-01-01T00:00:00Z"}`
+			if string(b) != want {
+				t.Errorf("hook saw %q, want %q", b, want)
+			}
+		})
+	}
+}
+
+func TestFireTriesBothTargets(t *testing.T) {
+	posted := false
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { posted = true }))
+	defer srv.Close()
+
+	err := New(writeScript(t, "exit 1\n"), srv.URL, 5*time.Second).Fire(context.Background(), Payload{Event: BeforeSuspend})
+	if err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Fatalf("Fire error = %v, want the exec failure", err)
+	}
+	if !posted {
+		t.Error("the HTTP hook was skipped after the exec hook failed")
+	}
+}
+
+func TestFireTimeout(t *testing.T) {
+	err := New(writeScript(t, "exec sleep 5\n"), "", 100*time.Millisecond).Fire(context.Background(), Payload{Event: SessionEnded})
+	if err == nil {
+		t.Fatal("Fire outlived its timeout without an error")
+	}
+}
+
+func TestFireDisabled(t *testing.T) {
+	r := New("", "", time.Second)
+	if r.Enabled() {
+		t.Error("Enabled with no targets")
+	}
+	if err := r.Fire(context.Background(), Payload{Event: PeerCreated}); err != nil {
+		t.Errorf("Fire = %v, want nil", err)
+	}
+}
@@ -0,0 +1,47 @@
+// Package logging configures the process-wide structured logger.
+//
+// Everything logs through log/slog with a "component" attribute naming
+// the subsystem and typed fields for the rest, so log shippers can
+// filter on fields instead of parsing prose. LOG_FORMAT picks key=value
+// text (the default, easy to read in `fly logs`) or one JSON object per
+// line for Loki and similar; LOG_LEVEL drops lines below a level.
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Setup installs the default slog logger writing to stderr. It also
+// routes the standard log package through it, so a stray log.Printf
+// still comes out in the chosen format. Unknown values fall back to text
+// and info, with a warning once the logger is up.
+func Setup(format, level string) {
+	lvl := slog.LevelInfo
+	badLevel := level != "" && lvl.UnmarshalText([]byte(level)) != nil
+	if badLevel {
+		lvl = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	badFormat := false
+	switch strings.ToLower(format) {
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	case "text", "":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		h = slog.NewTextHandler(os.Stderr, opts)
+		badFormat = true
+	}
+	slog.SetDefault(slog.New(h))
+
+	if badFormat {
+		slog.Warn("unknown LOG_FORMAT, using text", "component", "logging", "value", format)
+	}
+	if badLevel {
+		slog.Warn("unknown LOG_LEVEL, using info", "component", "logging", "value", level)
+	}
+}
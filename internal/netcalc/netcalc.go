@@ -0,0 +1,100 @@
+// Package netcalc does the CIDR arithmetic behind AllowedIPs suggestions.
+package netcalc
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Exclude returns a minimal set of prefixes covering everything in include
+// except the addresses in exclude, like the classic "AllowedIPs
+// calculator". Prefixes of the other address family pass through
+// untouched.
+func Exclude(include, exclude []netip.Prefix) []netip.Prefix {
+	out := make([]netip.Prefix, 0, len(include))
+	for _, p := range include {
+		pieces := []netip.Prefix{p.Masked()}
+		for _, e := range exclude {
+			e = e.Masked()
+			var next []netip.Prefix
+			for _, piece := range pieces {
+				next = append(next, subtract(piece, e)...)
+			}
+			pieces = next
+		}
+		out = append(out, pieces...)
+	}
+	return out
+}
+
+// subtract removes e from p by halving p until the halves either lie
+// entirely inside e (dropped) or don't touch it (kept).
+func subtract(p, e netip.Prefix) []netip.Prefix {
+	if p.Addr().Is4() != e.Addr().Is4() || !p.Overlaps(e) {
+		return []netip.Prefix{p}
+	}
+	if e.Bits() <= p.Bits() {
+		// e contains p.
+		return nil
+	}
+	lo, hi := split(p)
+	return append(subtract(lo, e), subtract(hi, e)...)
+}
+
+// split halves p into its two child prefixes.
+func split(p netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := p.Bits() + 1
+	lo := netip.PrefixFrom(p.Addr(), bits)
+
+	b := p.Addr().AsSlice()
+	idx := p.Bits()
+	b[idx/8] |= 0x80 >> (idx % 8)
+	hiAddr, _ := netip.AddrFromSlice(b)
+	return lo, netip.PrefixFrom(hiAddr, bits)
+}
+
+// ParseList parses a comma-separated list of prefixes as found in an
+// AllowedIPs line. Bare addresses are treated as single-host prefixes.
+func ParseList(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !strings.Contains(f, "/") {
+			a, err := netip.ParseAddr(f)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", f)
+			}
+			out = append(out, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q", f)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// FormatList renders prefixes the way AllowedIPs expects them.
+func FormatList(ps []netip.Prefix) string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = p.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// AnyOverlap reports whether any prefix in a overlaps b.
+func AnyOverlap(a []netip.Prefix, b netip.Prefix) bool {
+	for _, p := range a {
+		if p.Overlaps(b) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package netcalc
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func mustList(t *testing.T, s string) []netip.Prefix {
+	t.Helper()
+	ps, err := ParseList(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func TestExclude(t *testing.T) {
+	cases := []struct {
+		name             string
+		include, exclude string
+		want             string
+	}{
+		{"nothing excluded", "0.0.0.0/0", "", "0.0.0.0/0"},
+		{
+			"one private range",
+			"0.0.0.0/0", "10.0.0.0/8",
+			"0.0.0.0/5, 8.0.0.0/7, 11.0.0.0/8, 12.0.0.0/6, 16.0.0.0/4, 32.0.0.0/3, 64.0.0.0/2, 128.0.0.0/1",
+		},
+		{"half of a prefix", "10.0.0.0/24", "10.0.0.128/25", "10.0.0.0/25"},
+		{"single host", "192.168.1.0/30", "192.168.1.2", "192.168.1.0/31, 192.168.1.3/32"},
+		{"everything", "10.0.0.0/24", "10.0.0.0/8", ""},
+		{"no overlap", "10.0.0.0/24", "192.168.0.0/16", "10.0.0.0/24"},
+		{"unmasked input", "10.0.0.77/24", "10.0.0.0/25", "10.0.0.128/25"},
+		{"other family passes through", "0.0.0.0/0, ::/0", "fd00::/8", "0.0.0.0/0, ::/1, 8000::/2, c000::/3, e000::/4, f000::/5, f800::/6, fc00::/8, fe00::/7"},
+		{"several exclusions", "10.0.0.0/30", "10.0.0.0/32, 10.0.0.3/32", "10.0.0.1/32, 10.0.0.2/32"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := FormatList(Exclude(mustList(t, tc.include), mustList(t, tc.exclude)))
+			if got != tc.want {
+				t.Errorf("Exclude(%s; %s) =\n  %s\nwant\n  %s", tc.include, tc.exclude, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"10.0.0.1", []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}, false},
+		{"10.0.0.1/24, ::1", []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24"), netip.MustParsePrefix("::1/128")}, false},
+		{" 10.0.0.0/8 ,, ", []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, false},
+		{"10.0.0.0/33", nil, true},
+		{"example.com", nil, true},
+	}
+	for _, tc := range cases {
+		got, err := ParseList(tc.in)
+		if (err != nil) != tc.wantErr || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseList(%q) = %v, %v; want %v, error %v", tc.in, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
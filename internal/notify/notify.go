@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Notifier posts short operational messages to an external endpoint.
+//
+// Two payload formats are supported:
+//
+//   - "text": the message is sent as a plain-text body with the title in a
+//     "Title" header, and any link in a "Click" header. This is what ntfy
+//     topics (https://ntfy.sh/<topic>) expect.
+//   - "json": a small JSON object, for generic webhook receivers.
+type Notifier struct {
+	url    string
+	format string
+	token  string
+	client *http.Client
+}
+
+// Event is the JSON payload sent in "json" format.
+type Event struct {
+	Event   string `json:"event"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	App     string `json:"app,omitempty"`
+	Region  string `json:"region,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Time    string `json:"time"`
+}
+
+func New(url, format string) Notifier {
+	if format == "" {
+		format = "text"
+	}
+	return Notifier{
+		url:    url,
+		format: format,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WithBearer returns a copy of n that authenticates with an
+// "Authorization: Bearer" token, as protected ntfy topics require.
+func (n Notifier) WithBearer(token string) Notifier {
+	n.token = token
+	return n
+}
+
+// Enabled reports whether a destination URL is configured.
+func (n Notifier) Enabled() bool {
+	return n.url != ""
+}
+
+// Send delivers ev, returning an error for transport failures and
+// non-2xx responses.
+func (n Notifier) Send(ctx context.Context, ev Event) error {
+	if ev.Time == "" {
+		ev.Time = time.Now().Format(time.RFC3339)
+	}
+
+	var body []byte
+	contentType := "text/plain; charset=utf-8"
+	switch n.format {
+	case "text":
+		body = []byte(ev.Message)
+	case "json":
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		body = b
+		contentType = "application/json"
+	default:
+		return fmt.Errorf("unknown notify format %q", n.format)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if n.format == "text" && ev.Title != "" {
+		req.Header.Set("Title", ev.Title)
+	}
+	if n.format == "text" && ev.URL != "" {
+		req.Header.Set("Click", ev.URL)
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("notify: %s returned %s", n.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	ev := Event{Event: "ready", Title: "VPN ready", Message: "wg0 is up", URL: "https://vpn.example/admin", Time: "2026-01-01T00:00:00Z"}
+	cases := []struct {
+		name        string
+		format      string
+		token       string
+		status      int
+		contentType string
+		headers     map[string]string
+		wantErr     string
+	}{
+		{
+			name: "text", format: "", status: 200,
+			contentType: "text/plain; charset=utf-8",
+			headers:     map[string]string{"Title": "VPN ready", "Click": "https://vpn.example/admin", "Authorization": ""},
+		},
+		{
+			name: "json", format: "json", status: 204,
+			contentType: "application/json",
+			headers:     map[string]string{"Title": "", "Click": ""},
+		},
+		{
+			name: "bearer", format: "text", token: "tk", status: 200,
+			contentType: "text/plain; charset=utf-8",
+			headers:     map[string]string{"Authorization": "Bearer tk"},
+		},
+		{name: "rejected", format: "text", status: 403, wantErr: "returned 403 Forbidden"},
+		{name: "server error", format: "json", status: 502, wantErr: "returned 502 Bad Gateway"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *http.Request
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			err := New(srv.URL, tc.format).WithBearer(tc.token).Send(context.Background(), ev)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Send error = %v, want it to contain %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if got.Method != http.MethodPost {
+				t.Errorf("method = %s, want POST", got.Method)
+			}
+			if ct := got.Header.Get("Content-Type"); ct != tc.contentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tc.contentType)
+			}
+			for k, want := range tc.headers {
+				if v := got.Header.Get(k); v != want {
+					t.Errorf("%s header = %q, want %q", k, v, want)
+				}
+			}
+			if tc.contentType == "application/json" {
+				var sent Event
+				if err := json.Unmarshal(body, &sent); err != nil {
+					t.Fatalf("body is not JSON: %v: %s", err, body)
+				}
+				if sent != ev {
+					t.Errorf("sent %+v, want %+v", sent, ev)
+				}
+			} else if string(body) != ev.Message {
+				t.Errorf("body = %q, want %q", body, ev.Message)
+			}
+		})
+	}
+}
+
+func TestSendFillsTime(t *testing.T) {
+	var sent Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+	}))
+	defer srv.Close()
+
+	if err := New(srv.URL, "json").Send(context.Background(), Event{Event: "ready"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if sent.Time == "" {
+		t.Error("time was not filled in")
+	}
+}
+
+func TestSendUnknownFormat(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	defer srv.Close()
+
+	err := New(srv.URL, "xml").Send(context.Background(), Event{Message: "hi"})
+	if err == nil || !strings.Contains(err.Error(), `unknown notify format "xml"`) {
+		t.Fatalf("Send error = %v, want unknown format", err)
+	}
+	if called {
+		t.Error("request sent despite the unknown format")
+	}
+}
+
+func TestSendTransportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	if err := New(url, "text").Send(context.Background(), Event{Message: "hi"}); err == nil {
+		t.Fatal("Send to a closed server succeeded")
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	if New("", "text").Enabled() {
+		t.Error("Enabled with no URL")
+	}
+	if !New("https://ntfy.sh/x", "").Enabled() {
+		t.Error("not Enabled with a URL")
+	}
+}
@@ -0,0 +1,124 @@
+package ui
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+)
+
+// TextSection is one [Interface] or [Peer] block of the text-only view.
+type TextSection struct {
+	Name   string
+	Fields []TextField
+}
+
+// TextField is a single setting. Spelled is set for keys, which are
+// impossible to type reliably from a screen reader or large print.
+type TextField struct {
+	Key     string
+	Value   string
+	Spelled []SpelledBlock
+}
+
+// SpelledBlock is a short run of characters and how to read it aloud.
+type SpelledBlock struct {
+	Text   string
+	Spoken string
+}
+
+// spellBlockSize keeps each spoken group short enough to hold in memory
+// while typing.
+const spellBlockSize = 4
+
+var natoLetters = [...]string{
+	"alfa", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+	"india", "juliett", "kilo", "lima", "mike", "november", "oscar", "papa",
+	"quebec", "romeo", "sierra", "tango", "uniform", "victor", "whiskey",
+	"x-ray", "yankee", "zulu",
+}
+
+var natoDigits = [...]string{
+	"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+}
+
+var natoSymbols = map[rune]string{
+	'+': "plus",
+	'/': "slash",
+	'=': "equals",
+	'-': "dash",
+	'_': "underscore",
+	'.': "dot",
+	':': "colon",
+}
+
+// SpellNATO splits s into groups of four characters and spells each with
+// the NATO phonetic alphabet, marking case explicitly ("capital alfa",
+// "small bravo") since WireGuard keys are case-sensitive base64.
+func SpellNATO(s string) []SpelledBlock {
+	runes := []rune(s)
+	var blocks []SpelledBlock
+	for i := 0; i < len(runes); i += spellBlockSize {
+		chunk := runes[i:min(i+spellBlockSize, len(runes))]
+		words := make([]string, 0, len(chunk))
+		for _, r := range chunk {
+			words = append(words, spellRune(r))
+		}
+		blocks = append(blocks, SpelledBlock{Text: string(chunk), Spoken: strings.Join(words, ", ")})
+	}
+	return blocks
+}
+
+func spellRune(r rune) string {
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return "capital " + natoLetters[r-'A']
+	case r >= 'a' && r <= 'z':
+		return "small " + natoLetters[r-'a']
+	case r >= '0' && r <= '9':
+		return natoDigits[r-'0']
+	}
+	if w, ok := natoSymbols[r]; ok {
+		return w
+	}
+	if unicode.IsSpace(r) {
+		return "space"
+	}
+	return string(r)
+}
+
+// The text-only onboarding view. It is part of Page so both views ship in
+// the one-time response and the toggle works without reloading.
+var _ = template.Must(Page.New("textonly").Parse(`
+<div id="text-only" class="text-only" {{if not .TextOnly}}hidden{{end}}>
+  <h2 tabindex="-1">Set up your VPN step by step</h2>
+  <ol class="steps">
+    <li>Install the official WireGuard app from your device's app store, or from wireguard.com/install.</li>
+    <li>Open the app and add a new tunnel by creating it from scratch. This may be called "Add empty tunnel" or "Create from scratch".</li>
+    <li>Name the tunnel, for example "{{.PeerName}}".</li>
+    <li>Enter the Interface settings listed below, one field at a time.</li>
+    <li>Add a peer and enter the Peer settings listed below.</li>
+    <li>Save the tunnel and switch it on.</li>
+  </ol>
+
+  {{range .TextSections}}
+  <section aria-labelledby="section-{{.Name}}">
+    <h3 id="section-{{.Name}}">{{.Name}} settings</h3>
+    <dl>
+      {{range .Fields}}
+      <dt>{{.Key}}</dt>
+      <dd>
+        <span class="value">{{.Value}}</span>
+        {{if .Spelled}}
+        <p>Spelled out in groups of four characters:</p>
+        <ol class="spelled">
+          {{range .Spelled}}<li><span class="value">{{.Text}}</span>: {{.Spoken}}</li>
+          {{end}}
+        </ol>
+        {{end}}
+      </dd>
+      {{end}}
+    </dl>
+  </section>
+  {{end}}
+</div>
+`))
@@ -0,0 +1,94 @@
+package ui
+
+import "html/template"
+
+// AdminPage is the operator's view of the interface and its peers. It
+// shows keys and endpoints, so it is only rendered behind the token.
+var AdminPage = template.Must(template.New("admin").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <meta name="referrer" content="no-referrer">
+    <title>VPN admin</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 1000px; margin: 2rem auto; padding: 0 1rem; }
+      table { border-collapse: collapse; width: 100%; font-size: .9rem; }
+      th, td { text-align: left; padding: .35rem .5rem; border-bottom: 1px solid #ddd; }
+      code { font-size: .8rem; }
+      .ok { color: #1a7f37; }
+      .bad { color: #cf222e; }
+      .muted { color: #777; }
+    </style>
+  </head>
+  <body>
+    <h1>VPN admin</h1>
+    <p class="muted">Rendered {{.Now}}{{with .Region}} in {{.}}{{end}}. Reload for fresh numbers.</p>
+
+    <h2>Interface {{.Interface}}</h2>
+    {{if .InterfaceError}}
+    <p class="bad"><strong>Down or unreadable:</strong> {{.InterfaceError}}</p>
+    {{else}}
+    <p class="ok"><strong>Up</strong>{{with .ListenPort}}, listening on UDP {{.}}{{end}}.</p>
+    <p>Public key: <code>{{.PublicKey}}</code>{{with .Endpoint}}<br>Clients connect to: <code>{{.}}</code>{{end}}</p>
+    {{end}}
+
+    <h2>Suspend</h2>
+    <p>{{.Suspend}}</p>
+
+    {{if .Peers}}
+    <h2>Peers</h2>
+    <table>
+      <tr><th>Peer</th><th>Last handshake</th><th>Received</th><th>Sent</th><th>Endpoint</th></tr>
+      {{range .Peers}}
+      <tr>
+        <td>{{if .Name}}{{.Name}}{{else}}<code>{{.PublicKey}}</code>{{end}}{{if .Infrastructure}} <span class="muted">(infrastructure)</span>{{end}}</td>
+        <td class="{{if .Active}}ok{{else}}muted{{end}}">{{.LastHandshake}}</td>
+        <td>{{.Received}}</td>
+        <td>{{.Sent}}</td>
+        <td>{{with .Endpoint}}<code>{{.}}</code>{{else}}<span class="muted">none</span>{{end}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{end}}
+
+    {{if .People}}
+    <h2>People</h2>
+    <table>
+      <tr><th>Person</th><th>Devices</th></tr>
+      {{range .People}}
+      <tr>
+        <td>{{.Name}}</td>
+        <td{{if .Full}} class="bad"{{end}}>{{.Devices}}{{if .Max}} of {{.Max}}{{if .Full}} (budget reached){{end}}{{end}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{end}}
+
+    {{if .Requests}}
+    <h2>Device requests</h2>
+    <p class="muted">Approve with <code>POST /api/requests/&lt;id&gt;/approve</code>, or decline with <code>/deny</code>.</p>
+    <table>
+      <tr><th>ID</th><th>Device</th><th>Person</th><th>From</th><th>Asked</th><th>Note</th></tr>
+      {{range .Requests}}
+      <tr>
+        <td><code>{{.ID}}</code></td>
+        <td>{{.Device}}</td>
+        <td>{{.Person}}</td>
+        <td>{{.Client}}</td>
+        <td>{{.Created.Format "2006-01-02 15:04"}}</td>
+        <td>{{.Note}}</td>
+      </tr>
+      {{end}}
+    </table>
+    {{end}}
+
+    <h2>Other checks</h2>
+    <ul>
+      <li>Bootstrap link: {{.Bootstrap}}</li>
+      {{with .Probe}}<li>Last routing probe: {{.}}</li>{{end}}
+    </ul>
+  </body>
+</html>
+`))
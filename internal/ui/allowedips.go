@@ -0,0 +1,43 @@
+package ui
+
+import "html/template"
+
+// AllowedIPsPage is the split-exclude calculator.
+var AllowedIPsPage = template.Must(template.New("allowedips").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>AllowedIPs calculator</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 800px; margin: 2rem auto; padding: 0 1rem; }
+      label { display: block; margin-top: 1rem; font-weight: bold; }
+      input[type=text] { width: 100%; font-family: ui-monospace, monospace; }
+      pre { background: #f5f5f5; padding: 1rem; overflow-x: auto; white-space: pre-wrap; }
+    </style>
+  </head>
+  <body>
+    <h1>AllowedIPs calculator</h1>
+    <p>Route everything through the VPN except the networks you list. Separate entries with commas.</p>
+    <form method="post" action="?token={{.Token}}">
+      <label for="include">Route</label>
+      <input type="text" id="include" name="include" value="{{.Include}}">
+      <label for="exclude">Except</label>
+      <input type="text" id="exclude" name="exclude" value="{{.Exclude}}" placeholder="192.168.1.0/24, 10.0.0.0/8">
+      <p>
+        <button type="submit">Calculate</button>
+        <button type="submit" name="apply" value="1">Calculate and apply to my profile</button>
+      </p>
+    </form>
+
+    {{if .Result}}
+    <h2>Result</h2>
+    <pre>AllowedIPs = {{.Result}}</pre>
+    {{end}}
+
+    {{if .Applied}}
+    <p><strong>Applied:</strong> configs served from now on exclude {{.Applied}}. Re-import the config, or run the updater script, to pick it up. Submit "apply" with an empty "Except" field to undo.</p>
+    {{end}}
+  </body>
+</html>
+`))
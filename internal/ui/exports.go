@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"strings"
+	"text/template"
+)
+
+// exportFuncs are available to every export template.
+var exportFuncs = template.FuncMap{
+	"join": strings.Join,
+	"inc":  func(i int) int { return i + 1 },
+}
+
+func exportTemplate(name, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(exportFuncs).Parse(text))
+}
+
+// ExportConf is the wg-quick config as served by the sidecar.
+var ExportConf = exportTemplate("conf", `{{.Conf}}`)
+
+// ExportNMConnection is a NetworkManager keyfile. Copy it to
+// /etc/NetworkManager/system-connections/ with mode 0600.
+var ExportNMConnection = exportTemplate("nmconnection", `[connection]
+id={{.Name}}
+uuid={{.UUID}}
+type=wireguard
+interface-name=wg-{{.Name}}
+
+[wireguard]
+private-key={{.PrivateKey}}
+{{- with .MTU}}
+mtu={{.}}{{end}}
+
+[wireguard-peer.{{.PublicKey}}]
+endpoint={{.Endpoint}}
+allowed-ips={{join .AllowedIPs ";"}};
+{{- with .PresharedKey}}
+preshared-key={{.}}
+preshared-key-flags=0{{end}}
+{{- with .PersistentKeepalive}}
+persistent-keepalive={{.}}{{end}}
+
+[ipv4]
+{{- if .IPv4}}
+method=manual
+{{- range $i, $a := .IPv4}}
+address{{inc $i}}={{$a}}{{end}}
+{{- with .DNS}}
+dns={{join . ";"}};{{end}}
+{{- else}}
+method=disabled{{end}}
+
+[ipv6]
+{{- if .IPv6}}
+method=manual
+{{- range $i, $a := .IPv6}}
+address{{inc $i}}={{$a}}{{end}}
+{{- else}}
+method=disabled{{end}}
+`)
+
+// ExportRouterOS is a MikroTik RouterOS script. Paste it into a terminal
+// or /import it; routes are left to the operator.
+var ExportRouterOS = exportTemplate("routeros", `/interface wireguard add name=wg-{{.Name}} private-key="{{.PrivateKey}}"{{with .MTU}} mtu={{.}}{{end}}
+/interface wireguard peers add interface=wg-{{.Name}} public-key="{{.PublicKey}}" endpoint-address={{.EndpointHost}} endpoint-port={{.EndpointPort}} allowed-address={{join .AllowedIPs ","}}{{with .PresharedKey}} preshared-key="{{.}}"{{end}}{{with .PersistentKeepalive}} persistent-keepalive={{.}}s{{end}}
+{{range .IPv4}}/ip address add address={{.}} interface=wg-{{$.Name}}
+{{end}}{{range .IPv6}}/ipv6 address add address={{.}} interface=wg-{{$.Name}} advertise=no
+{{end}}`)
+
+// ExportMobileConfig is an Apple configuration profile for the official
+// WireGuard app on iOS and macOS. Values are XML-escaped with "html".
+var ExportMobileConfig = exportTemplate("mobileconfig", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>PayloadDisplayName</key>
+  <string>WireGuard {{html .Name}}</string>
+  <key>PayloadType</key>
+  <string>Configuration</string>
+  <key>PayloadVersion</key>
+  <integer>1</integer>
+  <key>PayloadIdentifier</key>
+  <string>wgvpn.{{html .Name}}.{{.UUID}}</string>
+  <key>PayloadUUID</key>
+  <string>{{.UUID}}</string>
+  <key>PayloadContent</key>
+  <array>
+    <dict>
+      <key>PayloadDisplayName</key>
+      <string>VPN</string>
+      <key>PayloadType</key>
+      <string>com.apple.vpn.managed</string>
+      <key>PayloadVersion</key>
+      <integer>1</integer>
+      <key>PayloadIdentifier</key>
+      <string>wgvpn.{{html .Name}}.{{.UUID}}.vpn</string>
+      <key>PayloadUUID</key>
+      <string>{{.UUID2}}</string>
+      <key>UserDefinedName</key>
+      <string>{{html .Name}}</string>
+      <key>VPNType</key>
+      <string>VPN</string>
+      <key>VPNSubType</key>
+      <string>com.wireguard.ios</string>
+      <key>VendorConfig</key>
+      <dict>
+        <key>WgQuickConfig</key>
+        <string>{{html .Conf}}</string>
+      </dict>
+      <key>VPN</key>
+      <dict>
+        <key>RemoteAddress</key>
+        <string>{{html .Endpoint}}</string>
+        <key>AuthenticationMethod</key>
+        <string>Password</string>
+      </dict>
+    </dict>
+  </array>
+</dict>
+</plist>
+`)
@@ -0,0 +1,68 @@
+package ui
+
+import "html/template"
+
+// GuestClaimPage is where a visitor enters the claim code from the guest
+// poster. A correct code redirects to a new guest peer's bootstrap page.
+var GuestClaimPage = template.Must(template.New("guest-claim").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <meta name="referrer" content="no-referrer">
+    <title>Guest VPN access</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 480px; margin: 3rem auto; padding: 0 1rem; }
+      label { display: block; margin: .75rem 0 .25rem; }
+      input { width: 100%; box-sizing: border-box; padding: .4rem; font: inherit; }
+      button { margin-top: 1rem; padding: .5rem 1rem; font: inherit; }
+      .muted { color: #777; }
+      .bad { color: #cf222e; }
+    </style>
+  </head>
+  <body>
+    <h1>Guest VPN access</h1>
+    {{if .Error}}<p class="bad">{{.Error}}</p>{{end}}
+    <p>Enter the code from the poster to get a VPN connection for this device. It stops working after {{.TTL}}.</p>
+    <form method="post">
+      <label for="code">Code</label>
+      <input id="code" name="code" required autocomplete="off" autocapitalize="none">
+      <button type="submit">Continue</button>
+    </form>
+    <p class="muted">You'll need the WireGuard app. The next page shows how to set it up.</p>
+  </body>
+</html>
+`))
+
+// GuestPosterPage is the printable poster pointing visitors at /guest.
+var GuestPosterPage = template.Must(template.New("guest-poster").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>Guest VPN poster</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 700px; margin: 2rem auto; padding: 0 1rem; text-align: center; }
+      img { width: 320px; height: 320px; }
+      .code { font-size: 2.5rem; font-family: ui-monospace, SFMono-Regular, Menlo, monospace; letter-spacing: .1em; }
+      ol { text-align: left; display: inline-block; }
+      @media print { .noprint { display: none; } body { margin: 0; } }
+    </style>
+  </head>
+  <body>
+    <p class="noprint">Print this page and put it up where guests will see it. The QR code holds no keys. {{if .Code}}Anyone who can read the code can join, so change <code>GUEST_CLAIM_CODE</code> to retire old posters, or print with <code>?code=0</code> and tell guests the code yourself.{{end}} <button onclick="window.print()">Print</button></p>
+    <h1>Guest VPN</h1>
+    <img src="data:image/png;base64,{{.QRBase64}}" alt="QR code for {{.URL}}">
+    <p><small>{{.URL}}</small></p>
+    {{with .Code}}<p>Code</p><p class="code">{{.}}</p>{{end}}
+    <ol>
+      <li>Install the WireGuard app.</li>
+      <li>Scan the QR code with your camera and enter the code.</li>
+      <li>Follow the steps on the page that opens.</li>
+    </ol>
+    <p>Access lasts {{.TTL}}.</p>
+  </body>
+</html>
+`))
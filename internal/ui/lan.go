@@ -0,0 +1,61 @@
+package ui
+
+import "html/template"
+
+// LANCheck describes how the config interacts with one common LAN range.
+type LANCheck struct {
+	Range string
+
+	// TunnelOverlap means the VPN's own subnet uses the same addresses;
+	// only the operator can fix that by changing INTERNAL_SUBNET.
+	TunnelOverlap bool
+
+	// RouteOverlap means AllowedIPs sends the LAN's traffic into the
+	// tunnel, so local devices become unreachable while connected.
+	RouteOverlap bool
+
+	// AltConfig is the same config with the LAN excluded from AllowedIPs.
+	AltConfig   string
+	AltQRBase64 string
+}
+
+// The LAN conflict checker section of Page.
+var _ = template.Must(Page.New("lancheck").Parse(`
+{{if .LANConflicts}}
+<p class="hint"><strong>Warning:</strong> this VPN uses addresses that many home networks also use ({{range $i, $r := .LANConflicts}}{{if $i}}, {{end}}{{$r}}{{end}}). If your network at home is one of them, the VPN won't work there; ask whoever runs it to change <code>INTERNAL_SUBNET</code>.</p>
+{{end}}
+
+{{if .LANChecks}}
+<details id="lan-check">
+  <summary>Using this at home or work? Check for conflicts with your local network</summary>
+  <p>Your router's address usually tells you the network: 192.168.1.1 means 192.168.1.0/24. You can find it in your Wi-Fi details.</p>
+  <label for="lan-select">My local network:</label>
+  <select id="lan-select">
+    <option value="">Choose…</option>
+    {{range .LANChecks}}<option value="{{.Range}}">{{.Range}}</option>
+    {{end}}
+  </select>
+  {{range .LANChecks}}
+  <div class="lan-result" data-range="{{.Range}}" hidden>
+    {{if .TunnelOverlap}}
+    <p><strong>Conflict:</strong> the VPN itself uses {{.Range}}. It won't work on this network; ask whoever runs it to change <code>INTERNAL_SUBNET</code>.</p>
+    {{else if .AltConfig}}
+    <p>This config sends all traffic through the VPN, so while connected you won't reach printers, NAS boxes or other devices on {{.Range}}. If you need them, use this alternate profile instead, which keeps {{.Range}} local:</p>
+    {{if .AltQRBase64}}<img src="data:image/png;base64,{{.AltQRBase64}}" alt="Alternate config QR excluding {{.Range}}">{{end}}
+    <pre>{{.AltConfig}}</pre>
+    {{else}}
+    <p>No conflict: {{.Range}} stays reachable while the VPN is on.</p>
+    {{end}}
+  </div>
+  {{end}}
+  <script>
+    document.getElementById("lan-select").addEventListener("change", function () {
+      var v = this.value;
+      document.querySelectorAll(".lan-result").forEach(function (el) {
+        el.hidden = el.getAttribute("data-range") !== v;
+      });
+    });
+  </script>
+</details>
+{{end}}
+`))
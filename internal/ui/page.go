@@ -3,27 +3,159 @@ package ui
 import "html/template"
 
 var Page = template.Must(template.New("page").Parse(`<!doctype html>
-<html>
+<html lang="en">
   <head>
     <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
     <title>Your WireGuard VPN</title>
     <style>
       body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 800px; margin: 2rem auto; padding: 0 1rem; }
+      .hint { background: #eef6ff; border-left: 4px solid #0969da; padding: 0.75rem 1rem; }
       pre { background: #f5f5f5; padding: 1rem; overflow-x: auto; }
       img { border: 1px solid #ddd; padding: 0.5rem; background: #fff; max-width: 100%; height: auto; }
+      .text-only { font-size: 1.4rem; line-height: 1.6; }
+      .text-only .value { font-family: ui-monospace, monospace; font-size: 1.6rem; word-break: break-all; }
+      .text-only dt { font-weight: bold; margin-top: 1.5rem; }
+      .text-only dd { margin-left: 0; }
     </style>
   </head>
   <body>
     <h1>Your WireGuard VPN</h1>
 
-    <h2>1. Scan this QR code with the WireGuard mobile app</h2>
+    <p><button type="button" id="view-toggle">{{if .TextOnly}}Show QR codes and full config{{else}}Switch to text-only version (screen readers, large print){{end}}</button></p>
+
+    <div id="visual" {{if .TextOnly}}hidden{{end}}>
+    {{if .Desktop}}
+    <p class="hint">You seem to be on a computer. Install WireGuard from wireguard.com/install, then
+      <a download="{{.PeerName}}.conf" href="data:application/octet-stream;base64,{{.ConfBase64}}">download {{.PeerName}}.conf</a>
+      and choose "Import tunnel(s) from file". To set up a phone instead, scan the QR code below with it.</p>
+    {{else if eq .Platform "android"}}
+    <p class="hint">On Android, install WireGuard from Google Play, then
+      {{if .AndroidImport}}<a href="{{.AndroidImport}}"><strong>tap here to import into WireGuard</strong></a>.
+      If that doesn't open the app, {{end}}<a download="{{.PeerName}}.conf" href="data:application/octet-stream;base64,{{.ConfBase64}}">download {{.PeerName}}.conf</a>
+      and import it in the app with the + button, or scan the QR code below from another screen.</p>
+    {{else if eq .Platform "ios"}}
+    <p class="hint">On iPhone or iPad, install WireGuard from the App Store. If you're viewing this page on the same device, use "Create from file or archive" with the
+      <a download="{{.PeerName}}.conf" href="data:application/octet-stream;base64,{{.ConfBase64}}">downloaded {{.PeerName}}.conf</a>.</p>
+    {{end}}
+
+    <h2 tabindex="-1">1. Scan this QR code with the WireGuard mobile app</h2>
     <p>Open the WireGuard app on your phone and choose "Scan from QR code".</p>
-    <img src="data:image/png;base64,{{.QRBase64}}" alt="WireGuard config QR">
+    {{range $i, $qr := .QRCodes}}{{if eq $i 0}}
+    <img src="data:image/png;base64,{{$qr.QRBase64}}" alt="{{$qr.Label}} QR">
+    {{end}}{{end}}
+
+    {{if .QRChunks}}
+    <details id="chunks">
+      <summary>Code too dense for your camera? Scan it in {{len .QRChunks}} parts</summary>
+      <p>Each code starts with a line like <code>WGQR 1/{{len .QRChunks}}</code>. Scan them in order and join the text that follows each header line; the result is the full configuration shown below. Routers that support multi-part import do this for you.</p>
+      <p><button type="button" id="chunk-play">Play as animation</button></p>
+      <div id="chunk-list">
+        {{range .QRChunks}}
+        <figure>
+          <img src="data:image/png;base64,{{.QRBase64}}" alt="{{.Label}}">
+          <figcaption>{{.Label}}</figcaption>
+        </figure>
+        {{end}}
+      </div>
+      <script>
+        (function () {
+          var figs = document.querySelectorAll("#chunk-list figure");
+          var timer = null, i = 0;
+          document.getElementById("chunk-play").addEventListener("click", function () {
+            if (timer) {
+              clearInterval(timer); timer = null;
+              figs.forEach(function (f) { f.style.display = ""; });
+              this.textContent = "Play as animation";
+              return;
+            }
+            this.textContent = "Show all parts";
+            var show = function () {
+              figs.forEach(function (f, j) { f.style.display = j === i ? "" : "none"; });
+              i = (i + 1) % figs.length;
+            };
+            show();
+            timer = setInterval(show, 1500);
+          });
+        })();
+      </script>
+    </details>
+    {{end}}
+
+    {{if gt (len .QRCodes) 1}}
+    <details>
+      <summary>Other QR formats (for routers and third-party apps)</summary>
+      {{range $i, $qr := .QRCodes}}{{if $i}}
+      <h3>{{$qr.Label}}</h3>
+      <img src="data:image/png;base64,{{$qr.QRBase64}}" alt="{{$qr.Label}} QR">
+      {{end}}{{end}}
+    </details>
+    {{end}}
 
     <h2>2. Or copy this configuration into a desktop client</h2>
     <pre>{{.Config}}</pre>
 
+    {{template "lancheck" .}}
+
+    {{with .RecoveryKit}}
+    <p>Want an offline backup? <a href="{{.}}" target="_blank" rel="noopener">Open your printable recovery kit</a> and save it as PDF or print it. The link works once.</p>
+    {{end}}
+
+    {{if .UpdateSh}}
+    <h2>3. Optional: keep this config up to date</h2>
+    <p>These scripts refresh the server address, DNS and routes in your saved config if they change later. Your keys are never touched.</p>
+    <ul>
+      <li><a download="wg-update.sh" href="data:text/x-shellscript;base64,{{.UpdateSh}}">Updater for Linux / macOS (wg-quick)</a></li>
+      <li><a download="wg-update.ps1" href="data:text/plain;base64,{{.UpdatePS1}}">Updater for Windows (PowerShell)</a></li>
+    </ul>
+    {{end}}
+    </div>
+
+    {{template "textonly" .}}
+
+    <script>
+      document.getElementById("view-toggle").addEventListener("click", function () {
+        var visual = document.getElementById("visual");
+        var text = document.getElementById("text-only");
+        var toText = text.hidden;
+        text.hidden = !toText;
+        visual.hidden = toText;
+        this.textContent = toText ? "Show QR codes and full config" : "Switch to text-only version (screen readers, large print)";
+        (toText ? text : visual).querySelector("h2").focus();
+      });
+    </script>
+
+    {{if .ExpiresIn}}
+    <p id="expiry" class="hint">For your safety this page clears itself in <strong id="expiry-left"></strong>, and its download links stop working at the same moment. <button type="button" id="expiry-now">Clear now</button></p>
+    <script>
+      (function () {
+        var left = {{.ExpiresIn}}, url = {{.ExpireURL}};
+        var out = document.getElementById("expiry-left");
+        var clear = function () {
+          clearInterval(timer);
+          ["visual", "text-only", "view-toggle"].forEach(function (id) {
+            var el = document.getElementById(id);
+            if (el) { el.remove(); }
+          });
+          document.getElementById("expiry").textContent = "This page has expired and the configuration was removed from it.";
+          if (navigator.sendBeacon) { navigator.sendBeacon(url); } else { fetch(url, {method: "POST", keepalive: true}); }
+        };
+        var tick = function () {
+          out.textContent = Math.floor(left / 60) + ":" + ("0" + left % 60).slice(-2);
+          if (left-- <= 0) { clear(); }
+        };
+        var timer = setInterval(tick, 1000);
+        tick();
+        document.getElementById("expiry-now").addEventListener("click", clear);
+      })();
+    </script>
+    {{end}}
+
+    {{if .Redelivery}}
+    <p><strong>Note:</strong> This page is one-time only. If importing fails, you can reload it from this same device for the next {{.Redelivery}}; after that the bootstrap endpoint is disabled.</p>
+    {{else}}
     <p><strong>Note:</strong> This page is one-time only. After you close it, the bootstrap endpoint is disabled.</p>
+    {{end}}
   </body>
 </html>
-`))
\ No newline at end of file
+`))
@@ -0,0 +1,55 @@
+package ui
+
+import "html/template"
+
+// RecoveryKitPage is the printable offline backup of one peer's access.
+var RecoveryKitPage = template.Must(template.New("kit").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>WireGuard recovery kit: {{.PeerName}}</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 700px; margin: 2rem auto; padding: 0 1rem; }
+      .qr { text-align: center; border: 1px solid #999; padding: 1rem; }
+      .qr img { width: 280px; height: 280px; }
+      table { border-collapse: collapse; width: 100%; }
+      th, td { text-align: left; padding: .3rem .5rem; border-bottom: 1px solid #ddd; vertical-align: top; }
+      code { word-break: break-all; }
+      .warn { border-left: 4px solid #c00; padding-left: .75rem; }
+      @media print { .noprint { display: none; } body { margin: 0; } }
+    </style>
+  </head>
+  <body>
+    <p class="noprint">This link works once. Print this page or save it as PDF now, then close the tab. <button onclick="window.print()">Print / save as PDF</button></p>
+
+    <h1>WireGuard recovery kit</h1>
+    <p>Device: <strong>{{.PeerName}}</strong> · generated {{.Generated}}</p>
+
+    <p class="warn"><strong>Keep this somewhere safe, like a passport.</strong> The QR code contains the private key: anyone who scans it can use your VPN. Don't photograph it into cloud notes or email it.</p>
+
+    <div class="qr">
+      <img src="data:image/png;base64,{{.QRBase64}}" alt="WireGuard QR code for {{.PeerName}}">
+    </div>
+
+    <h2>Connection details</h2>
+    <table>
+      <tr><th>Server</th><td><code>{{.Endpoint}}</code></td></tr>
+      <tr><th>Your address</th><td><code>{{.Address}}</code></td></tr>
+      {{with .DNS}}<tr><th>DNS</th><td><code>{{.}}</code></td></tr>{{end}}
+      <tr><th>Routed traffic</th><td><code>{{.AllowedIPs}}</code></td></tr>
+      <tr><th>Server public key</th><td><code>{{.ServerKey}}</code>{{with .ServerFP}}<br>fingerprint {{.}}{{end}}</td></tr>
+      {{with .SigningKeyID}}<tr><th>Deployment signing key</th><td><code>{{.}}</code></td></tr>{{end}}
+    </table>
+
+    <h2>Getting back in</h2>
+    <ol>
+      <li>Install the WireGuard app on the new or reset device.</li>
+      <li>Tap "+" and choose "Scan from QR code", then scan the code above.</li>
+      <li>Switch the tunnel on and check <code>{{.StatusURL}}</code> shows it connected.</li>
+    </ol>
+    <p>If the server has been rebuilt, its public key{{if .SigningKeyID}} or signing key{{end}} will no longer match the ones printed here and this kit won't connect. Ask whoever runs the server for a new bootstrap link, and shred this page.</p>
+  </body>
+</html>
+`))
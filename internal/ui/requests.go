@@ -0,0 +1,90 @@
+package ui
+
+import "html/template"
+
+// DeviceRequestPage is the public form for asking for a new device, and
+// the page a requester comes back to for the answer. Only the requester
+// holds the secret in its URL, so it may show the approved link, once.
+var DeviceRequestPage = template.Must(template.New("device-request").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <meta name="referrer" content="no-referrer">
+    <title>Request VPN access</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 480px; margin: 3rem auto; padding: 0 1rem; }
+      label { display: block; margin: .75rem 0 .25rem; }
+      input, textarea { width: 100%; box-sizing: border-box; padding: .4rem; font: inherit; }
+      button { margin-top: 1rem; padding: .5rem 1rem; font: inherit; }
+      .muted { color: #777; }
+      .bad { color: #cf222e; }
+    </style>
+  </head>
+  <body>
+    <h1>Request VPN access</h1>
+    {{if .Error}}<p class="bad">{{.Error}}</p>{{end}}
+    {{if .StatusURL}}
+    <p>Your request is waiting for approval. Bookmark this page's link, or keep it open, and come back later:</p>
+    <p><a href="{{.StatusURL}}">{{.StatusURL}}</a></p>
+    {{else if eq .Status "pending"}}
+    <p>Your request for <strong>{{.Device}}</strong> is still waiting for approval. Reload this page later.</p>
+    {{else if eq .Status "denied"}}
+    <p>Your request for <strong>{{.Device}}</strong> was declined. Ask whoever runs this VPN.</p>
+    {{else if eq .Status "approved"}}{{if .Link}}
+    <p>Your request for <strong>{{.Device}}</strong> was approved. Open this link on that device to set it up. It works once, and this page won't show it again:</p>
+    <p><a href="{{.Link}}">{{.Link}}</a></p>{{end}}
+    {{else if eq .Status "issued"}}
+    <p>Your request for <strong>{{.Device}}</strong> was approved and its link was already shown. If you lost it, ask whoever runs this VPN for a new one.</p>
+    {{else}}
+    <form method="post">
+      <label for="device">Device name</label>
+      <input id="device" name="device" required maxlength="10" pattern="[A-Za-z0-9][A-Za-z0-9_-]*" placeholder="laptop">
+      <p class="muted">Up to 10 letters, digits, '-' or '_'.</p>
+      <label for="person">Your name</label>
+      <input id="person" name="person" maxlength="32" pattern="[A-Za-z0-9][A-Za-z0-9_-]*">
+      <label for="note">Note for the admin (optional)</label>
+      <textarea id="note" name="note" rows="3" maxlength="280"></textarea>
+      <button type="submit">Send request</button>
+    </form>
+    {{end}}
+  </body>
+</html>
+`))
+
+// DeviceReviewPage lets an admin who followed the notification link
+// approve or decline a request. Acting takes a POST, so link previews
+// can't decide on anyone's behalf.
+var DeviceReviewPage = template.Must(template.New("device-review").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <meta name="referrer" content="no-referrer">
+    <title>Device request</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 480px; margin: 3rem auto; padding: 0 1rem; }
+      button { margin: 1rem .5rem 0 0; padding: .5rem 1rem; font: inherit; }
+      .muted { color: #777; }
+      .bad { color: #cf222e; }
+    </style>
+  </head>
+  <body>
+    <h1>Device request</h1>
+    {{if .Error}}<p class="bad">{{.Error}}</p>{{end}}
+    <p><strong>{{.Device}}</strong>{{with .Person}} for {{.}}{{end}}, asked {{.Created}} from {{.Client}}.</p>
+    {{with .Note}}<p>“{{.}}”</p>{{end}}
+    {{if eq .Status "pending"}}
+    <form method="post">
+      <input type="hidden" name="code" value="{{.Code}}">
+      <button type="submit" name="decision" value="approve">Approve</button>
+      <button type="submit" name="decision" value="deny">Decline</button>
+    </form>
+    {{else}}
+    <p class="muted">Already {{.Status}}{{with .Peer}} as {{.}}{{end}}.</p>
+    {{end}}
+  </body>
+</html>
+`))
@@ -0,0 +1,72 @@
+package ui
+
+import "text/template"
+
+// UpdateScriptSh is a POSIX shell updater for wg-quick style configs. It
+// fetches the non-key settings from the server and rewrites the matching
+// lines in place; keys are never touched.
+var UpdateScriptSh = template.Must(template.New("update.sh").Parse(`#!/bin/sh
+# Refreshes Endpoint, DNS and AllowedIPs in a local WireGuard config from
+# {{.URL}}. Private and public keys are never changed.
+#
+# Usage: sudo sh wg-update.sh [/etc/wireguard/wg0.conf]
+set -eu
+
+CONF="${1:-/etc/wireguard/wg0.conf}"
+URL='{{.URL}}'
+TOKEN='{{.Token}}'
+
+settings=$(curl -fsS -H "Authorization: Bearer $TOKEN" "$URL")
+
+tmp=$(mktemp)
+trap 'rm -f "$tmp"' EXIT
+cp "$CONF" "$tmp"
+
+printf '%s\n' "$settings" | while IFS= read -r line; do
+  key=$(printf '%s' "$line" | cut -d= -f1 | tr -d ' ')
+  value=$(printf '%s' "$line" | cut -d= -f2- | sed 's/^ *//')
+  [ -n "$key" ] || continue
+  sed -i.bak "s|^[[:space:]]*$key[[:space:]]*=.*|$key = $value|" "$tmp" && rm -f "$tmp.bak"
+done
+
+if cmp -s "$CONF" "$tmp"; then
+  echo "WireGuard config is up to date."
+  exit 0
+fi
+
+cat "$tmp" > "$CONF"
+echo "Updated $CONF. Reconnect to apply: wg-quick down $CONF && wg-quick up $CONF"
+`))
+
+// UpdateScriptPS1 is the PowerShell equivalent for Windows. It edits an
+// exported .conf file; re-import it in the WireGuard app afterwards.
+var UpdateScriptPS1 = template.Must(template.New("update.ps1").Parse(`# Refreshes Endpoint, DNS and AllowedIPs in a WireGuard .conf file from
+# {{.URL}}. Private and public keys are never changed.
+#
+# Usage: powershell -ExecutionPolicy Bypass -File wg-update.ps1 -Conf C:\path\to\wg0.conf
+param([Parameter(Mandatory = $true)][string]$Conf)
+
+$Url = '{{.URL}}'
+$Token = '{{.Token}}'
+
+$settings = Invoke-RestMethod -Uri $Url -Headers @{ Authorization = "Bearer $Token" }
+$lines = Get-Content -Path $Conf
+$updated = $lines
+
+foreach ($entry in ($settings -split "` + "`" + `n")) {
+  if ($entry -notmatch '^\s*(\w+)\s*=\s*(.*)$') { continue }
+  $key = $Matches[1]
+  $value = $Matches[2].Trim()
+  $updated = $updated | ForEach-Object {
+    if ($_ -match "^\s*$key\s*=") { "$key = $value" } else { $_ }
+  }
+}
+
+if ((Compare-Object $lines $updated) -eq $null) {
+  Write-Host "WireGuard config is up to date."
+  exit 0
+}
+
+Set-Content -Path $Conf -Value $updated
+Write-Host "Updated $Conf. Re-import it in the WireGuard app to apply."
+`))
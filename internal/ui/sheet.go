@@ -0,0 +1,42 @@
+package ui
+
+import "html/template"
+
+// SheetPage is the printable batch of guest QR codes.
+var SheetPage = template.Must(template.New("sheet").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>WireGuard guest sheet</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 900px; margin: 2rem auto; padding: 0 1rem; }
+      .cards { display: grid; grid-template-columns: repeat(auto-fill, minmax(260px, 1fr)); gap: 1rem; }
+      .card { border: 1px dashed #999; padding: 1rem; text-align: center; break-inside: avoid; }
+      .card img { width: 200px; height: 200px; }
+      .card h2 { margin: 0 0 .5rem; font-size: 1.1rem; }
+      .card ol { text-align: left; font-size: .85rem; padding-left: 1.2rem; }
+      @media print { .noprint { display: none; } body { margin: 0; } }
+    </style>
+  </head>
+  <body>
+    <h1 class="noprint">Guest sheet</h1>
+    <p class="noprint">Print this page (or save it as PDF) and cut along the dashed lines. Each QR contains a private key: hand out one per device and shred the leftovers. <button onclick="window.print()">Print</button></p>
+    <div class="cards">
+      {{range .Cards}}
+      <div class="card">
+        <h2>{{.Peer}}</h2>
+        <img src="data:image/png;base64,{{.QRBase64}}" alt="WireGuard QR code for {{.Peer}}">
+        <ol>
+          <li>Install the WireGuard app.</li>
+          <li>Tap "+" and choose "Scan from QR code".</li>
+          <li>Name the tunnel and switch it on.</li>
+        </ol>
+        <small>{{with $.Endpoint}}{{.}} · {{end}}{{.Address}}</small>
+      </div>
+      {{end}}
+    </div>
+  </body>
+</html>
+`))
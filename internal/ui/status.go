@@ -0,0 +1,36 @@
+package ui
+
+import "html/template"
+
+// StatusPage is the public, unauthenticated status page. It must only ever
+// receive coarse, non-sensitive values.
+var StatusPage = template.Must(template.New("status").Parse(`<!doctype html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>VPN status</title>
+    <style>
+      body { font-family: system-ui, -apple-system, BlinkMacSystemFont, sans-serif; max-width: 480px; margin: 3rem auto; padding: 0 1rem; text-align: center; }
+      .state { font-size: 2rem; font-weight: bold; }
+      .up { color: #1a7f37; }
+      .starting { color: #9a6700; }
+    </style>
+  </head>
+  <body>
+    <h1>VPN status</h1>
+    {{if .Ready}}
+    <p class="state up">Online</p>
+    <p>The VPN is up. If your device can't connect, try turning WireGuard off and on again.</p>
+    {{with .ActiveDevices}}<p>Devices connected right now: {{.}}{{with $.ActivePeople}} ({{.}} people){{end}}</p>{{end}}
+    {{else}}
+    <p class="state starting">Starting</p>
+    <p>The VPN is waking up. Give it a minute, then reload this page.</p>
+    {{end}}
+    {{if and .Ready .RoutingBroken}}
+    <p>The last device that connected couldn't get traffic through the VPN. Re-importing the config usually fixes it.</p>
+    {{end}}
+    {{if .Region}}<p>Region: {{.Region}}</p>{{end}}
+  </body>
+</html>
+`))
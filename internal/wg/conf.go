@@ -0,0 +1,135 @@
+package wg
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"strings"
+	"text/template"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ServerConfig is the wg-quick config for the server side of the tunnel.
+type ServerConfig struct {
+	PrivateKey string
+	Address    netip.Prefix
+	ListenPort int
+	MTU        int
+	Peers      []ServerPeer
+}
+
+// ServerPeer is one [Peer] section of a ServerConfig.
+type ServerPeer struct {
+	// Name is written as a comment, as the linuxserver image does.
+	Name         string
+	PublicKey    string
+	PresharedKey string
+	AllowedIPs   []netip.Prefix
+}
+
+// PeerConfig is the wg-quick config handed to a client. The layout
+// matches what the linuxserver image writes, so the rest of the server
+// parses either the same way.
+type PeerConfig struct {
+	PrivateKey string
+	Address    netip.Prefix
+	// ListenPort pins the client's own port; zero leaves it to the client
+	// to pick.
+	ListenPort          int
+	DNS                 string
+	MTU                 int
+	ServerPublicKey     string
+	PresharedKey        string
+	Endpoint            string
+	AllowedIPs          string
+	PersistentKeepalive int
+}
+
+func joinPrefixes(ps []netip.Prefix) string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = p.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+var funcs = template.FuncMap{"join": joinPrefixes}
+
+// serverTemplate only sets what wg-quick needs for the interface itself;
+// NAT and forwarding are set up by the container entrypoint.
+var serverTemplate = template.Must(template.New("server").Funcs(funcs).Parse(`[Interface]
+Address = {{.Address}}
+ListenPort = {{.ListenPort}}
+PrivateKey = {{.PrivateKey}}
+{{- if .MTU}}
+MTU = {{.MTU}}
+{{- end}}
+{{range .Peers}}
+[Peer]
+# {{.Name}}
+PublicKey = {{.PublicKey}}
+{{- if .PresharedKey}}
+PresharedKey = {{.PresharedKey}}
+{{- end}}
+AllowedIPs = {{join .AllowedIPs}}
+{{end}}`))
+
+var peerTemplate = template.Must(template.New("peer").Parse(`[Interface]
+Address = {{.Address}}
+PrivateKey = {{.PrivateKey}}
+{{- if .ListenPort}}
+ListenPort = {{.ListenPort}}
+{{- end}}
+{{- if .DNS}}
+DNS = {{.DNS}}
+{{- end}}
+{{- if .MTU}}
+MTU = {{.MTU}}
+{{- end}}
+
+[Peer]
+PublicKey = {{.ServerPublicKey}}
+{{- if .PresharedKey}}
+PresharedKey = {{.PresharedKey}}
+{{- end}}
+Endpoint = {{.Endpoint}}
+AllowedIPs = {{.AllowedIPs}}
+{{- if .PersistentKeepalive}}
+PersistentKeepalive = {{.PersistentKeepalive}}
+{{- end}}
+`))
+
+// Render returns c in wg-quick format.
+func (c ServerConfig) Render() string {
+	var b bytes.Buffer
+	_ = serverTemplate.Execute(&b, c)
+	return b.String()
+}
+
+// Render returns c in wg-quick format.
+func (c PeerConfig) Render() string {
+	var b bytes.Buffer
+	_ = peerTemplate.Execute(&b, c)
+	return b.String()
+}
+
+// device returns c as a wgctrl change that replaces the peer list.
+func (c ServerConfig) device() (wgtypes.Config, error) {
+	k, err := wgtypes.ParseKey(c.PrivateKey)
+	if err != nil {
+		return wgtypes.Config{}, fmt.Errorf("private key: %w", err)
+	}
+	d := wgtypes.Config{PrivateKey: &k, ReplacePeers: true}
+	if c.ListenPort != 0 {
+		d.ListenPort = &c.ListenPort
+	}
+	for _, p := range c.Peers {
+		pc, err := peerConfig(p.PublicKey, p.PresharedKey, p.AllowedIPs)
+		if err != nil {
+			return wgtypes.Config{}, err
+		}
+		d.Peers = append(d.Peers, pc)
+	}
+	return d, nil
+}
@@ -0,0 +1,68 @@
+package wg
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestPeerConfigListenPort(t *testing.T) {
+	pc := PeerConfig{
+		PrivateKey:      dumpPeerKey,
+		Address:         netip.MustParsePrefix("10.13.13.2/32"),
+		ServerPublicKey: dumpServerKey,
+		Endpoint:        "example.fly.dev:51820",
+		AllowedIPs:      "0.0.0.0/0",
+	}
+	if got := pc.Render(); strings.Contains(got, "ListenPort") {
+		t.Errorf("unset ListenPort rendered:\n%s", got)
+	}
+	pc.ListenPort = 41820
+	if got := pc.Render(); !strings.Contains(got, "\nListenPort = 41820\n") {
+		t.Errorf("ListenPort missing:\n%s", got)
+	}
+}
+
+func TestServerConfigDevice(t *testing.T) {
+	c := ServerConfig{
+		PrivateKey: dumpServerKey,
+		Address:    netip.MustParsePrefix("10.13.13.1/24"),
+		ListenPort: 51820,
+		MTU:        1420,
+		Peers: []ServerPeer{{
+			Name:         "peer1",
+			PublicKey:    dumpPeerKey,
+			PresharedKey: dumpServerKey,
+			AllowedIPs:   []netip.Prefix{netip.MustParsePrefix("10.13.13.2/32")},
+		}},
+	}
+	serverKey, peerKey := mustKey(t, dumpServerKey), mustKey(t, dumpPeerKey)
+	port := 51820
+	want := wgtypes.Config{
+		PrivateKey:   &serverKey,
+		ListenPort:   &port,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{{
+			PublicKey:         peerKey,
+			PresharedKey:      &serverKey,
+			ReplaceAllowedIPs: true,
+			AllowedIPs:        []net.IPNet{{IP: net.IP{10, 13, 13, 2}, Mask: net.CIDRMask(32, 32)}},
+		}},
+	}
+	got, err := c.device()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("device() = %+v, want %+v", got, want)
+	}
+
+	c.Peers[0].PublicKey = "not-a-key"
+	if _, err := c.device(); err == nil {
+		t.Error("device() accepted an invalid peer key")
+	}
+}
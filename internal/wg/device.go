@@ -0,0 +1,118 @@
+package wg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// errNoDevice means wgctrl found no WireGuard device by that name,
+// neither in the kernel nor as a userspace control socket. The wg tool
+// gets the last word, since it may know of devices wgctrl doesn't.
+var errNoDevice = errors.New("no such wireguard device")
+
+// getDevice reads iface through wgctrl.
+func getDevice(iface string) (*Device, error) {
+	c, err := wgctrl.New()
+	if err != nil {
+		return nil, errNoDevice
+	}
+	defer c.Close()
+
+	d, err := c.Device(iface)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoDevice
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromWgtypes(d), nil
+}
+
+// configure applies cfg to iface through wgctrl.
+func configure(iface string, cfg wgtypes.Config) error {
+	c, err := wgctrl.New()
+	if err != nil {
+		return errNoDevice
+	}
+	defer c.Close()
+
+	err = c.ConfigureDevice(iface, cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		return errNoDevice
+	}
+	return err
+}
+
+// fromWgtypes converts a wgctrl device to a Device.
+func fromWgtypes(d *wgtypes.Device) *Device {
+	dev := &Device{Name: d.Name, PublicKey: d.PublicKey.String(), ListenPort: d.ListenPort}
+	for _, wp := range d.Peers {
+		p := Peer{
+			PublicKey:           wp.PublicKey.String(),
+			HasPresharedKey:     wp.PresharedKey != wgtypes.Key{},
+			ReceiveBytes:        wp.ReceiveBytes,
+			TransmitBytes:       wp.TransmitBytes,
+			PersistentKeepalive: wp.PersistentKeepaliveInterval,
+		}
+		if wp.Endpoint != nil {
+			p.Endpoint = wp.Endpoint.String()
+		}
+		// Backends report "never" as the Unix epoch rather than the zero
+		// time.
+		if wp.LastHandshakeTime.After(time.Unix(0, 0)) {
+			p.LastHandshake = wp.LastHandshakeTime
+		}
+		for _, n := range wp.AllowedIPs {
+			if pfx, ok := prefixFromIPNet(n); ok {
+				p.AllowedIPs = append(p.AllowedIPs, pfx)
+			}
+		}
+		dev.Peers = append(dev.Peers, p)
+	}
+	return dev
+}
+
+// peerConfig is the wgctrl change that sets a peer's allowed IPs to
+// exactly allowedIPs. psk may be empty.
+func peerConfig(publicKey, psk string, allowedIPs []netip.Prefix) (wgtypes.PeerConfig, error) {
+	k, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return wgtypes.PeerConfig{}, fmt.Errorf("peer public key %q: %w", publicKey, err)
+	}
+	p := wgtypes.PeerConfig{PublicKey: k, ReplaceAllowedIPs: true}
+	if psk != "" {
+		k, err := wgtypes.ParseKey(psk)
+		if err != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("preshared key for %s: %w", publicKey, err)
+		}
+		p.PresharedKey = &k
+	}
+	for _, pfx := range allowedIPs {
+		p.AllowedIPs = append(p.AllowedIPs, ipNet(pfx))
+	}
+	return p, nil
+}
+
+func ipNet(p netip.Prefix) net.IPNet {
+	return net.IPNet{IP: p.Addr().AsSlice(), Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen())}
+}
+
+func prefixFromIPNet(n net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(n.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 32 {
+		addr = addr.Unmap()
+	}
+	pfx := netip.PrefixFrom(addr, ones)
+	return pfx, pfx.IsValid()
+}
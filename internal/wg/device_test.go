@@ -0,0 +1,136 @@
+package wg
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func mustKey(t *testing.T, s string) wgtypes.Key {
+	t.Helper()
+	k, err := wgtypes.ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestFromWgtypes(t *testing.T) {
+	serverKey, peerKey := mustKey(t, dumpServerKey), mustKey(t, dumpPeerKey)
+	cases := []struct {
+		name string
+		peer wgtypes.Peer
+		want Peer
+	}{
+		{
+			name: "active",
+			peer: wgtypes.Peer{
+				PublicKey:    peerKey,
+				PresharedKey: serverKey,
+				Endpoint:     &net.UDPAddr{IP: net.IPv4(203, 0, 113, 9), Port: 41820},
+				AllowedIPs: []net.IPNet{
+					{IP: net.IPv4(10, 13, 13, 2), Mask: net.CIDRMask(32, 32)},
+					{IP: net.ParseIP("fd00::2"), Mask: net.CIDRMask(128, 128)},
+				},
+				LastHandshakeTime:           time.Unix(1767268800, 500),
+				ReceiveBytes:                1024,
+				TransmitBytes:               2048,
+				PersistentKeepaliveInterval: 25 * time.Second,
+			},
+			want: Peer{
+				PublicKey:           dumpPeerKey,
+				HasPresharedKey:     true,
+				Endpoint:            "203.0.113.9:41820",
+				AllowedIPs:          []netip.Prefix{netip.MustParsePrefix("10.13.13.2/32"), netip.MustParsePrefix("fd00::2/128")},
+				LastHandshake:       time.Unix(1767268800, 500),
+				ReceiveBytes:        1024,
+				TransmitBytes:       2048,
+				PersistentKeepalive: 25 * time.Second,
+			},
+		},
+		{
+			name: "never connected",
+			peer: wgtypes.Peer{
+				PublicKey:         peerKey,
+				AllowedIPs:        []net.IPNet{{IP: net.IP{10, 13, 13, 3}, Mask: net.CIDRMask(32, 32)}},
+				LastHandshakeTime: time.Unix(0, 0),
+			},
+			want: Peer{
+				PublicKey:  dumpPeerKey,
+				AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.13.13.3/32")},
+			},
+		},
+		{
+			name: "ipv6 endpoint",
+			peer: wgtypes.Peer{
+				PublicKey: peerKey,
+				Endpoint:  &net.UDPAddr{IP: net.ParseIP("2001:db8::9"), Port: 51820},
+			},
+			want: Peer{PublicKey: dumpPeerKey, Endpoint: "[2001:db8::9]:51820"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := fromWgtypes(&wgtypes.Device{
+				Name:       "wg0",
+				PublicKey:  serverKey,
+				ListenPort: 51820,
+				Peers:      []wgtypes.Peer{tc.peer},
+			})
+			want := &Device{Name: "wg0", PublicKey: dumpServerKey, ListenPort: 51820, Peers: []Peer{tc.want}}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("fromWgtypes =\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestPeerConfig(t *testing.T) {
+	cases := []struct {
+		name       string
+		publicKey  string
+		psk        string
+		allowedIPs []netip.Prefix
+		wantErr    bool
+	}{
+		{name: "ipv4", publicKey: dumpPeerKey, allowedIPs: []netip.Prefix{netip.MustParsePrefix("10.13.13.2/32")}},
+		{name: "with psk", publicKey: dumpPeerKey, psk: dumpServerKey, allowedIPs: []netip.Prefix{netip.MustParsePrefix("fd00::2/128")}},
+		{name: "bad key", publicKey: "bm90IGEga2V5", wantErr: true},
+		{name: "bad psk", publicKey: dumpPeerKey, psk: "short", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := peerConfig(tc.publicKey, tc.psk, tc.allowedIPs)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("peerConfig succeeded with %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.PublicKey.String() != tc.publicKey || !p.ReplaceAllowedIPs {
+				t.Errorf("peerConfig = %+v", p)
+			}
+			if (p.PresharedKey != nil) != (tc.psk != "") {
+				t.Errorf("PresharedKey = %v, want set %v", p.PresharedKey, tc.psk != "")
+			}
+			var got []netip.Prefix
+			for _, n := range p.AllowedIPs {
+				pfx, ok := prefixFromIPNet(n)
+				if !ok {
+					t.Fatalf("allowed IP %v doesn't convert back", n)
+				}
+				got = append(got, pfx)
+			}
+			if !reflect.DeepEqual(got, tc.allowedIPs) {
+				t.Errorf("AllowedIPs = %v, want %v", got, tc.allowedIPs)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package wg
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// GenerateKeyPair returns a new Curve25519 private key and its public key,
+// base64-encoded the way `wg genkey` and `wg pubkey` print them.
+func GenerateKeyPair() (priv, pub string, err error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", "", err
+	}
+	// Clamp as wg genkey does, so the stored key is byte-identical to what
+	// the tools would produce.
+	b[0] &= 248
+	b[31] = b[31]&127 | 64
+	priv = base64.StdEncoding.EncodeToString(b[:])
+	pub, err = PublicKey(priv)
+	return priv, pub, err
+}
+
+// PublicKey derives the public key for a base64 private key, like
+// `wg pubkey`.
+func PublicKey(priv string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(priv)
+	if err != nil || len(b) != 32 {
+		return "", fmt.Errorf("invalid private key")
+	}
+	k, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(k.PublicKey().Bytes()), nil
+}
+
+// GeneratePresharedKey returns a random preshared key, like `wg genpsk`.
+func GeneratePresharedKey() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,63 @@
+package wg
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Up creates iface if needed and applies c to it: keys, listen port and
+// peers through wgctrl, then the address, MTU and link state over
+// rtnetlink. Calling it again on a running interface replaces the peer
+// list, like `wg-quick strip | wg syncconf`.
+func Up(iface string, c ServerConfig) error {
+	d, err := c.device()
+	if err != nil {
+		return fmt.Errorf("configure %s: %w", iface, err)
+	}
+
+	link, err := netlink.LinkByName(iface)
+	var notFound netlink.LinkNotFoundError
+	if errors.As(err, &notFound) {
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = iface
+		if err := netlink.LinkAdd(&netlink.Wireguard{LinkAttrs: attrs}); err != nil {
+			return fmt.Errorf("create %s: %w", iface, err)
+		}
+		link, err = netlink.LinkByName(iface)
+	}
+	if err != nil {
+		return fmt.Errorf("find %s: %w", iface, err)
+	}
+
+	if err := configure(iface, d); err != nil {
+		return fmt.Errorf("configure %s: %w", iface, err)
+	}
+
+	n := ipNet(c.Address)
+	if err := netlink.AddrReplace(link, &netlink.Addr{IPNet: &n}); err != nil {
+		return fmt.Errorf("set address of %s: %w", iface, err)
+	}
+	if c.MTU != 0 {
+		if err := netlink.LinkSetMTU(link, c.MTU); err != nil {
+			return fmt.Errorf("set MTU of %s: %w", iface, err)
+		}
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("bring %s up: %w", iface, err)
+	}
+	return nil
+}
+
+// Down deletes iface.
+func Down(iface string) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", iface, err)
+	}
+	if err := netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("delete %s: %w", iface, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package wg reads and configures WireGuard interfaces.
+//
+// It goes through wgctrl, which speaks netlink to kernel devices and the
+// control socket to userspace ones, so callers get handshakes, endpoints
+// and transfer counters as typed values from one call. For a device
+// wgctrl can't find it falls back to the wg tool and parses
+// `wg show <iface> dump`, the tab-separated form meant for scripts.
+//
+// It can also stand up an interface without the linuxserver sidecar:
+// generate keys, render server and peer configs, and apply them with Up.
+package wg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Device is a WireGuard interface and its peers.
+type Device struct {
+	Name       string
+	PublicKey  string
+	ListenPort int
+	Peers      []Peer
+}
+
+// Peer is one peer as the kernel sees it.
+type Peer struct {
+	PublicKey       string
+	HasPresharedKey bool
+	// Endpoint is empty until the peer has sent a packet.
+	Endpoint   string
+	AllowedIPs []netip.Prefix
+	// LastHandshake is the zero time if the peer never completed one.
+	LastHandshake time.Time
+	ReceiveBytes  int64
+	TransmitBytes int64
+	// PersistentKeepalive is zero when off.
+	PersistentKeepalive time.Duration
+}
+
+// Show returns the current state of iface. It fails if the interface
+// doesn't exist or can't be queried.
+func Show(iface string) (*Device, error) {
+	dev, err := getDevice(iface)
+	if errors.Is(err, errNoDevice) {
+		return showCLI(iface)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wg show %s: %w", iface, err)
+	}
+	return dev, nil
+}
+
+// showCLI is Show through `wg show <iface> dump`.
+func showCLI(iface string) (*Device, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("wg", "show", iface, "dump")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("wg show %s: %s", iface, msg)
+		}
+		return nil, fmt.Errorf("wg show %s: %w", iface, err)
+	}
+	return parseDump(iface, string(out))
+}
+
+// parseDump parses dump output: one line for the interface (private key,
+// public key, listen port, fwmark), then one per peer (public key,
+// preshared key, endpoint, allowed IPs, latest handshake, rx, tx,
+// persistent keepalive).
+func parseDump(iface, out string) (*Device, error) {
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	head := strings.Split(lines[0], "\t")
+	if len(head) != 4 {
+		return nil, errors.New("wg show dump: unexpected interface line")
+	}
+	dev := &Device{Name: iface, PublicKey: head[1]}
+	dev.ListenPort, _ = strconv.Atoi(head[2])
+
+	for _, line := range lines[1:] {
+		f := strings.Split(line, "\t")
+		if len(f) != 8 {
+			return nil, fmt.Errorf("wg show dump: unexpected peer line with %d fields", len(f))
+		}
+		p := Peer{
+			PublicKey:       f[0],
+			HasPresharedKey: f[1] != "(none)",
+		}
+		if f[2] != "(none)" {
+			p.Endpoint = f[2]
+		}
+		if f[3] != "(none)" {
+			for _, s := range strings.Split(f[3], ",") {
+				if pfx, err := netip.ParsePrefix(s); err == nil {
+					p.AllowedIPs = append(p.AllowedIPs, pfx)
+				}
+			}
+		}
+		if ts, err := strconv.ParseInt(f[4], 10, 64); err == nil && ts > 0 {
+			p.LastHandshake = time.Unix(ts, 0)
+		}
+		p.ReceiveBytes, _ = strconv.ParseInt(f[5], 10, 64)
+		p.TransmitBytes, _ = strconv.ParseInt(f[6], 10, 64)
+		if ka, err := strconv.Atoi(f[7]); err == nil {
+			p.PersistentKeepalive = time.Duration(ka) * time.Second
+		}
+		dev.Peers = append(dev.Peers, p)
+	}
+	return dev, nil
+}
+
+// SetPeer adds or updates a peer on iface. pskFile may be empty.
+func SetPeer(iface, publicKey string, allowedIPs []netip.Prefix, pskFile string) error {
+	var psk string
+	if pskFile != "" {
+		b, err := os.ReadFile(pskFile)
+		if err != nil {
+			return fmt.Errorf("wg set %s: %w", iface, err)
+		}
+		psk = strings.TrimSpace(string(b))
+	}
+	p, err := peerConfig(publicKey, psk, allowedIPs)
+	if err != nil {
+		return fmt.Errorf("wg set %s: %w", iface, err)
+	}
+	err = configure(iface, wgtypes.Config{Peers: []wgtypes.PeerConfig{p}})
+	if !errors.Is(err, errNoDevice) {
+		if err != nil {
+			return fmt.Errorf("wg set %s: %w", iface, err)
+		}
+		return nil
+	}
+
+	ips := make([]string, len(allowedIPs))
+	for i, p := range allowedIPs {
+		ips[i] = p.String()
+	}
+	args := []string{"set", iface, "peer", publicKey, "allowed-ips", strings.Join(ips, ",")}
+	if pskFile != "" {
+		args = append(args, "preshared-key", pskFile)
+	}
+	return run(args...)
+}
+
+// RemovePeer removes a peer from iface.
+func RemovePeer(iface, publicKey string) error {
+	k, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("wg set %s: peer public key %q: %w", iface, publicKey, err)
+	}
+	err = configure(iface, wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: k, Remove: true}}})
+	if errors.Is(err, errNoDevice) {
+		return run("set", iface, "peer", publicKey, "remove")
+	}
+	if err != nil {
+		return fmt.Errorf("wg set %s: %w", iface, err)
+	}
+	return nil
+}
+
+func run(args ...string) error {
+	out, err := exec.Command("wg", args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("wg %s: %s", args[0], msg)
+		}
+		return fmt.Errorf("wg %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package wg
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const (
+	dumpServerKey = "hVXbEDsEWCy0zWd2pMBuqJbQdlwq7VZGiBHTQz+4Wnc="
+	dumpPeerKey   = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+)
+
+func TestParseDump(t *testing.T) {
+	head := "cHJpdmF0ZQ==\t" + dumpServerKey + "\t51820\toff\n"
+	cases := []struct {
+		name    string
+		out     string
+		want    *Device
+		wantErr bool
+	}{
+		{
+			name: "no peers",
+			out:  head,
+			want: &Device{Name: "wg0", PublicKey: dumpServerKey, ListenPort: 51820},
+		},
+		{
+			name: "active peer",
+			out:  head + dumpPeerKey + "\tcHNr\t203.0.113.9:41820\t10.13.13.2/32,fd00::2/128\t1767268800\t1024\t2048\t25\n",
+			want: &Device{Name: "wg0", PublicKey: dumpServerKey, ListenPort: 51820, Peers: []Peer{{
+				PublicKey:           dumpPeerKey,
+				HasPresharedKey:     true,
+				Endpoint:            "203.0.113.9:41820",
+				AllowedIPs:          []netip.Prefix{netip.MustParsePrefix("10.13.13.2/32"), netip.MustParsePrefix("fd00::2/128")},
+				LastHandshake:       time.Unix(1767268800, 0),
+				ReceiveBytes:        1024,
+				TransmitBytes:       2048,
+				PersistentKeepalive: 25 * time.Second,
+			}}},
+		},
+		{
+			name: "peer never seen",
+			out:  head + dumpPeerKey + "\t(none)\t(none)\t(none)\t0\t0\t0\toff\n",
+			want: &Device{Name: "wg0", PublicKey: dumpServerKey, ListenPort: 51820, Peers: []Peer{{
+				PublicKey: dumpPeerKey,
+			}}},
+		},
+		{
+			name:    "short interface line",
+			out:     dumpServerKey + "\t51820\n",
+			wantErr: true,
+		},
+		{
+			name:    "short peer line",
+			out:     head + dumpPeerKey + "\t(none)\t(none)\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseDump("wg0", tc.out)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseDump succeeded with %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseDump =\n%+v\nwant\n%+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestShowFallsBackToTool checks that an interface the kernel doesn't know
+// as WireGuard is read through the wg tool.
+func TestShowFallsBackToTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake wg is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$3\" = dump ] || exit 1\nprintf 'cHJpdmF0ZQ==\\t" + dumpServerKey + "\\t51820\\toff\\n'\n"
+	if err := os.WriteFile(filepath.Join(dir, "wg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dev, err := Show("wgtest0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Name != "wgtest0" || dev.PublicKey != dumpServerKey || dev.ListenPort != 51820 {
+		t.Errorf("Show = %+v", dev)
+	}
+}